@@ -16,10 +16,14 @@
 
 package main
 
-import (
-	"fmt"
+// Adobe settings are hardened for every installed version of Acrobat Reader
+// and Adobe Acrobat (Pro/Standard). Installs are detected from their
+// InstallPath keys below HKEY_LOCAL_MACHINE\SOFTWARE\Adobe\<product>\<version>
+// in the 64 and the 32 bit registry view.
 
-	"golang.org/x/sys/windows/registry"
+import (
+	"sort"
+	"strings"
 )
 
 var standardAdobeVersions = []string{
@@ -28,13 +32,68 @@ var standardAdobeVersions = []string{
 	"XI",   // Acrobat Reader XI (outdated)
 }
 
-// AdobeRegistryRegExSingleDWORD is the data type for a RegEx Path and
-// Single Value DWORD combination.
+// Adobe products whose settings are hardened.
+const (
+	adobeProductReader  = "Acrobat Reader"
+	adobeProductAcrobat = "Adobe Acrobat"
+)
+
+var standardAdobeProducts = []string{adobeProductReader, adobeProductAcrobat}
+
+// adobeRegistrationKey contains the keys of the Adobe installs (in the
+// registry view of the install).
+const adobeRegistrationKey = "SOFTWARE\\Adobe"
+
+// adobeInstall is an installed Adobe product version.
+type adobeInstall struct {
+	Product string // e.g. Adobe Acrobat
+	Version string // e.g. DC
+}
+
+// String returns product and version of install.
+func (install adobeInstall) String() string {
+	return install.Product + " " + install.Version
+}
+
+// detectAdobeInstalls returns all installed versions of the standard Adobe
+// products sorted by product and version.
+func detectAdobeInstalls() []adobeInstall {
+	found := make(map[adobeInstall]bool)
+	for _, view := range registryViews {
+		for _, product := range standardAdobeProducts {
+			productKey := adobeRegistrationKey + "\\" + product
+			for _, version := range registrySubKeyNames(HKLM, productKey, view) {
+				if registryKeyExistsInView(HKLM, productKey+"\\"+version+"\\InstallPath", view) {
+					found[adobeInstall{product, version}] = true
+				}
+			}
+		}
+	}
+
+	installs := make([]adobeInstall, 0, len(found))
+	for install := range found {
+		installs = append(installs, install)
+	}
+	sort.Slice(installs, func(i, j int) bool {
+		if installs[i].Product != installs[j].Product {
+			return installs[i].Product < installs[j].Product
+		}
+		return installs[i].Version < installs[j].Version
+	})
+	return installs
+}
+
+// AdobeRegistryRegExSingleDWORD is the data type for a templated path and
+// single value DWORD combination. PathTemplate contains {adobe_version} and
+// optionally {adobe_product}; paths without {adobe_product} are Acrobat
+// Reader paths. The value is hardened for all installed versions of
+// AdobeProducts, or only the ones in AdobeVersions if it is set.
 type AdobeRegistryRegExSingleDWORD struct {
-	RootKey         registry.Key
-	PathRegEx       string
+	RootKey         RegistryRootKey
+	PathTemplate    string
 	ValueName       string
 	HardenedValue   uint32
+	AdobeProducts   []string
 	AdobeVersions   []string
 	shortName       string
 	longName        string
@@ -42,133 +101,33 @@ type AdobeRegistryRegExSingleDWORD struct {
 	hardenByDefault bool
 }
 
-// AdobePDFJS hardens Acrobat JavaScript.
-// bEnableJS possible values:
-// 0 - Disable AcroJS
-// 1 - Enable AcroJS
-var AdobePDFJS = &AdobeRegistryRegExSingleDWORD{
-	RootKey:       registry.CURRENT_USER,
-	PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\JSPrefs",
-	ValueName:     "bEnableJS",
-	HardenedValue: 0, // Disable AcroJS
-	AdobeVersions: standardAdobeVersions,
-	shortName:     "Adobe JavaScript",
-	longName:      "Acrobat Reader JavaScript",
-	description: "Disables JavaScript in Acrobat Reader. PDF documents\n" +
-		"that use JavaScript code might not work as expected.",
-	hardenByDefault: true,
-}
-
-// AdobePDFObjects hardens Adobe Reader Embedded Objects.
-// bAllowOpenFile set to 0 and
-// bSecureOpenFile set to 1 to disable
-// the opening of non-PDF documents
-var AdobePDFObjects = &MultiHardenInterfaces{
-	hardenInterfaces: []HardenInterface{
-		&AdobeRegistryRegExSingleDWORD{
-			RootKey:       registry.CURRENT_USER,
-			PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\Originals",
-			ValueName:     "bAllowOpenFile",
-			HardenedValue: 0,
-			AdobeVersions: standardAdobeVersions,
-			shortName:     "AdobePDFObjects_bAllowOpenFile",
-		},
-		&AdobeRegistryRegExSingleDWORD{
-			RootKey:       registry.CURRENT_USER,
-			PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\Originals",
-			ValueName:     "bSecureOpenFile",
-			HardenedValue: 1,
-			AdobeVersions: standardAdobeVersions,
-			shortName:     "AdobePDFObjects_bSecureOpenFile",
-		},
-	},
-	shortName: "Adobe Objects",
-	longName:  "Acrobat Reader Embedded Objects",
-	description: "Disables Acrobat Reader embedded objects. PDF documents\n" +
-		"that contain embedded files might not work as expected.",
-	hardenByDefault: true,
-}
-
-// AdobePDFProtectedMode switches on the Protected Mode setting under
-// "Security (Enhanced)" (enabled by default in current versions).
-// (HKEY_LOCAL_USER\Software\Adobe\Acrobat Reader<version>\Privileged -> DWORD „bProtectedMode“)
-// 0 - Disable Protected Mode
-// 1 - Enable Protected Mode
-var AdobePDFProtectedMode = &AdobeRegistryRegExSingleDWORD{
-	RootKey:       registry.CURRENT_USER,
-	PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\Privileged",
-	ValueName:     "bProtectedMode",
-	HardenedValue: 1,
-	AdobeVersions: standardAdobeVersions,
-	shortName:     "Adobe Protected Mode",
-	longName:      "Acrobat Reader Protected Mode",
-	description: "Enables Acrobat Reader Protected Mode. This is already\n" +
-		"enabled by default in current Acrobat Reader versions.",
-	hardenByDefault: true,
-}
-
-// AdobePDFProtectedView switches on Protected View for all files from
-// untrusted sources.
-// (HKEY_CURRENT_USER\SOFTWARE\Adobe\Acrobat Reader\<version>\TrustManager -> iProtectedView)
-// 0 - Disable Protected View
-// 1 - Enable Protected View
-var AdobePDFProtectedView = &AdobeRegistryRegExSingleDWORD{
-	RootKey:       registry.CURRENT_USER,
-	PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\TrustManager",
-	ValueName:     "iProtectedView",
-	HardenedValue: 1,
-	AdobeVersions: standardAdobeVersions,
-	shortName:     "Adobe Protected View",
-	longName:      "Acrobat Reader Protected View",
-	description: "Enables Acrobat Reader Protected View for all files from\n" +
-		"untrusted sources. In the Protected View mode,\n" +
-		"most features are disabled. You can view the PDF,\n" +
-		"but not do much else. In the Protected View, a yellow\n" +
-		"bar displays on top of the Reader  window. Click\n" +
-		"Enable All Features to exit the Protected View.",
-	hardenByDefault: true,
-}
-
-// AdobePDFEnhancedSecurity switches on Enhanced Security setting under
-// "Security (Enhanced)".
-// (enabled by default in current versions)
-// (HKEY_CURRENT_USER\SOFTWARE\Adobe\Acrobat Reader\DC\TrustManager -> bEnhancedSecurityInBrowser = 1 & bEnhancedSecurityStandalone = 1)
-var AdobePDFEnhancedSecurity = &MultiHardenInterfaces{
-	shortName: "Adobe Enhanced Security",
-	longName:  "Acrobat Reader Enhanced Security",
-	description: "Enables Acrobat Reader Enhanced Security. This is already\n" +
-		"enabled by default in current Acrobat Reader versions.",
-	hardenByDefault: true,
-	hardenInterfaces: []HardenInterface{
-		&AdobeRegistryRegExSingleDWORD{
-			RootKey:       registry.CURRENT_USER,
-			PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\TrustManager",
-			ValueName:     "bEnhancedSecurityInBrowser",
-			HardenedValue: 1,
-			AdobeVersions: standardAdobeVersions,
-			shortName:     "AdobePDFEnhancedSecurity_bEnhancedSecurityInBrowser",
-		},
-		&AdobeRegistryRegExSingleDWORD{
-			RootKey:       registry.CURRENT_USER,
-			PathRegEx:     "SOFTWARE\\Adobe\\Acrobat Reader\\%s\\TrustManager",
-			ValueName:     "bEnhancedSecurityStandalone",
-			HardenedValue: 1,
-			AdobeVersions: standardAdobeVersions,
-			shortName:     "AdobePDFEnhancedSecurity_bEnhancedSecurityStandalone",
-		},
-	},
-}
-
-// Harden hardens / restores AdobeRegistryRegExSingleDWORD registry keys.
-func (adobeRegEx *AdobeRegistryRegExSingleDWORD) Harden(harden bool) error {
-	// Harden.
-	for _, adobeVersion := range adobeRegEx.AdobeVersions {
-		path := fmt.Sprintf(adobeRegEx.PathRegEx, adobeVersion)
+// path returns the registry path of install.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) path(install adobeInstall) string {
+	return strings.NewReplacer(placeholderAdobeProduct, install.Product,
+		placeholderAdobeVersion, install.Version).Replace(adobeRegEx.PathTemplate)
+}
+
+// products returns the Adobe products the value is hardened for.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) products() []string {
+	if !strings.Contains(adobeRegEx.PathTemplate, placeholderAdobeProduct) {
+		return []string{adobeProductReader}
+	}
+	return stringsOrDefault(adobeRegEx.AdobeProducts, standardAdobeProducts)
+}
+
+// installedValues returns a RegistrySingleValueDWORD for every install that
+// is covered by adobeRegEx.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) installedValues(installs []adobeInstall) []HardenInterface {
+	var children []HardenInterface
+	for _, install := range installs {
+		if !adobeRegEx.covers(install) {
+			continue
+		}
 
 		// Build a RegistrySingleValueDWORD so we can reuse the Harden() method.
 		var singleDWORD = &RegistrySingleValueDWORD{
 			RootKey:       adobeRegEx.RootKey,
-			Path:          path,
+			Path:          adobeRegEx.path(install),
 			ValueName:     adobeRegEx.ValueName,
 			HardenedValue: adobeRegEx.HardenedValue,
 			shortName:     adobeRegEx.shortName,
@@ -176,40 +135,92 @@ func (adobeRegEx *AdobeRegistryRegExSingleDWORD) Harden(harden bool) error {
 			description:   adobeRegEx.description,
 		}
 
-		// Call RegistrySingleValueDWORD Harden method to Harden or Restore.
+		children = append(children, singleDWORD)
+	}
+	return children
+}
+
+// covers returns true if install is hardened by adobeRegEx.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) covers(install adobeInstall) bool {
+	return containsFold(adobeRegEx.products(), install.Product) &&
+		(len(adobeRegEx.AdobeVersions) == 0 || containsFold(adobeRegEx.AdobeVersions, install.Version))
+}
+
+// Harden hardens / restores AdobeRegistryRegExSingleDWORD registry keys of
+// all installed Adobe versions. All values are hardened in a transaction, so
+// either all or none of them are changed.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) Harden(harden bool) error {
+	children := adobeRegEx.installedValues(detectAdobeInstalls())
+
+	if harden {
+		return hardenTransactionally(children)
+	}
+	// Call RegistrySingleValueDWORD Harden method to Restore.
+	for _, singleDWORD := range children {
 		err := singleDWORD.Harden(harden)
 		if err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-// IsHardened checks if AdobeRegistryRegExSingleDWORD is hardened.
+// IsHardened checks if AdobeRegistryRegExSingleDWORD is hardened for all
+// installed Adobe versions.
 func (adobeRegEx *AdobeRegistryRegExSingleDWORD) IsHardened() bool {
-	var hardened = true
+	return adobeRegEx.Status().State == StateHardened
+}
 
-	for _, adobeVersion := range adobeRegEx.AdobeVersions {
-		path := fmt.Sprintf(adobeRegEx.PathRegEx, adobeVersion)
+// Status returns the status of every installed Adobe version. Versions that
+// are not in standardAdobeVersions are marked as unknown, but hardened all
+// the same. Installs that are not covered are not applicable.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) Status() HardenStatus {
+	var children []HardenStatus
 
-		// Build a RegistrySingleValueDWORD so we can reuse the isHardened()
-		// method.
-		var singleDWORD = &RegistrySingleValueDWORD{
-			RootKey:       adobeRegEx.RootKey,
-			Path:          path,
-			ValueName:     adobeRegEx.ValueName,
-			HardenedValue: adobeRegEx.HardenedValue,
-			shortName:     adobeRegEx.shortName,
-			longName:      adobeRegEx.longName,
-			description:   adobeRegEx.description,
+	for _, install := range detectAdobeInstalls() {
+		name := install.String()
+		if !containsFold(standardAdobeVersions, install.Version) {
+			name += " (unknown version)"
+		}
+		if !adobeRegEx.covers(install) {
+			children = append(children, HardenStatus{
+				Name:   name,
+				State:  StateNotApplicable,
+				Reason: "not covered",
+			})
+			continue
 		}
+		children = append(children, combineHardenStatus(name, []HardenStatus{
+			registryValueStatus(adobeRegEx.RootKey, adobeRegEx.path(install),
+				adobeRegEx.ValueName, dwordValue(adobeRegEx.HardenedValue)),
+		}))
+	}
+	if len(children) == 0 {
+		children = append(children, HardenStatus{
+			Name:   strings.Join(adobeRegEx.products(), ", "),
+			State:  StateNotApplicable,
+			Reason: "Adobe Reader not installed",
+		})
+	}
+	return combineHardenStatus(adobeRegEx.shortName, children)
+}
 
-		if !singleDWORD.IsHardened() {
-			hardened = false
+// RegistrySettings returns the registry values set by hardening for all
+// products and standard versions (or AdobeVersions), whether they are
+// installed or not.
+func (adobeRegEx *AdobeRegistryRegExSingleDWORD) RegistrySettings() ([]registrySetting, error) {
+	var settings []registrySetting
+	for _, product := range adobeRegEx.products() {
+		for _, adobeVersion := range stringsOrDefault(adobeRegEx.AdobeVersions, standardAdobeVersions) {
+			settings = append(settings, registrySetting{
+				RootKey:   adobeRegEx.RootKey,
+				Path:      adobeRegEx.path(adobeInstall{product, adobeVersion}),
+				ValueName: adobeRegEx.ValueName,
+				Value:     dwordValue(adobeRegEx.HardenedValue),
+			})
 		}
 	}
-	return hardened
+	return settings, nil
 }
 
 // Name returns name of hardening modulels.
@@ -0,0 +1,304 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// In all users mode, the harden subjects that only change HKEY_CURRENT_USER
+// are also applied to the other user profiles of the machine. Profiles are
+// taken from the ProfileList. The hive of a user that is logged on is used
+// below HKEY_USERS, the NTUSER.DAT of all other users is loaded temporarily.
+// While a profile is processed, HKEY_CURRENT_USER is redirected to its hive
+// (see currentUserHive), so the hardentools status and the backup journal
+// are stored in the hive of the user, who can restore them later.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	profileListKey = "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\ProfileList"
+	// userHiveMountPrefix is the prefix of the names below HKEY_USERS that
+	// offline hives are loaded as.
+	userHiveMountPrefix = "Hardentools_"
+)
+
+// allUsersMode is set if the HKEY_CURRENT_USER harden subjects should also
+// be applied to all other user profiles.
+var allUsersMode bool
+
+var environmentVariableRegEx = regexp.MustCompile(`%([^%]+)%`)
+
+// userProfile is a user profile of the machine.
+type userProfile struct {
+	SID  string
+	Path string // Profile directory containing NTUSER.DAT.
+}
+
+// String returns SID and directory of profile.
+func (profile userProfile) String() string {
+	return profile.SID + " (" + profile.Path + ")"
+}
+
+// listUserProfiles returns the profiles of all local and domain users sorted
+// by SID. System accounts are skipped.
+func listUserProfiles() ([]userProfile, error) {
+	key, err := registryBackend.OpenKey(HKLM, profileListKey, keyRead)
+	if err != nil {
+		return nil, fmt.Errorf("could not read profile list: %s", err.Error())
+	}
+	defer key.Close()
+	sids, err := key.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("could not read profile list: %s", err.Error())
+	}
+
+	var profiles []userProfile
+	for _, sid := range sids {
+		if !strings.HasPrefix(sid, "S-1-5-21-") || strings.HasSuffix(sid, ".bak") {
+			continue
+		}
+		profileKey, err := registryBackend.OpenKey(HKLM, profileListKey+"\\"+sid, keyRead)
+		if err != nil {
+			continue
+		}
+		path, _, err := profileKey.GetStringValue("ProfileImagePath")
+		profileKey.Close()
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, userProfile{SID: sid, Path: expandEnvironmentVariables(path)})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].SID < profiles[j].SID })
+	return profiles, nil
+}
+
+// expandEnvironmentVariables replaces %name% in s with the value of the
+// environment variable (as stored in REG_EXPAND_SZ values).
+func expandEnvironmentVariables(s string) string {
+	return environmentVariableRegEx.ReplaceAllStringFunc(s, func(variable string) string {
+		if value, ok := os.LookupEnv(variable[1 : len(variable)-1]); ok {
+			return value
+		}
+		return variable
+	})
+}
+
+// withUserHive runs fn with HKEY_CURRENT_USER redirected to the hive of
+// profile. If the user is not logged on, the NTUSER.DAT of the profile is
+// loaded for that time.
+func withUserHive(profile userProfile, fn func() error) error {
+	hive := profile.SID
+	if !registryKeyExists(HKU, hive) {
+		loader, ok := registryBackend.(hiveLoader)
+		if !ok {
+			return fmt.Errorf("loading the hive of %s is not supported", profile.SID)
+		}
+		hive = userHiveMountPrefix + profile.SID
+		file := strings.TrimSuffix(profile.Path, "\\") + "\\NTUSER.DAT"
+		if err := loader.LoadHive(hive, file); err != nil {
+			return fmt.Errorf("could not load %s: %s", file, err.Error())
+		}
+		defer func() {
+			if err := loader.UnloadHive(hive); err != nil {
+				Info.Printf("Could not unload %s: %s", file, err.Error())
+			}
+		}()
+	}
+
+	previousHive := currentUserHive
+	currentUserHive = hive
+	defer func() { currentUserHive = previousHive }()
+	return fn()
+}
+
+// isPerUserSubject returns true if hardenSubject only changes
+// HKEY_CURRENT_USER.
+func isPerUserSubject(hardenSubject HardenInterface) bool {
+	return isRegistrySubject(hardenSubject, func(rootKey RegistryRootKey) bool {
+		return rootKey == HKCU
+	})
+}
+
+// perUserSubjects returns the harden subjects of allHardenSubjects that only
+// change HKEY_CURRENT_USER.
+func perUserSubjects() []HardenInterface {
+	var subjects []HardenInterface
+	for _, hardenSubject := range allHardenSubjects {
+		if isPerUserSubject(hardenSubject) {
+			subjects = append(subjects, hardenSubject)
+		}
+	}
+	return subjects
+}
+
+// userProfileResult is the result of hardening or restoring a user profile.
+type userProfileResult struct {
+	Profile userProfile
+	Changed []string // Names of the hardened or restored subjects.
+	Errors  []error
+}
+
+// hardenUserProfiles hardens (or restores if harden is false) the per-user
+// harden subjects in all user profiles. The subjects given with
+// -harden-subject or -restore-subject are used, otherwise the default ones
+// are hardened and all hardened ones are restored.
+func hardenUserProfiles(harden bool) ([]userProfileResult, error) {
+	profiles, err := listUserProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	names := restoreSubjectNames
+	if harden {
+		names = hardenSubjectNames
+	}
+	var results []userProfileResult
+	for _, profile := range profiles {
+		result := userProfileResult{Profile: profile}
+		err := withUserHive(profile, func() error {
+			hardenUserProfile(&result, harden, names)
+			return nil
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// hardenUserProfile hardens or restores the per-user harden subjects in the
+// hive HKEY_CURRENT_USER currently refers to.
+func hardenUserProfile(result *userProfileResult, harden bool, names []string) {
+	hardened := checkStatus()
+	if !harden && !hardened {
+		return
+	}
+	if !harden {
+		markRestoring(true)
+		defer markRestoring(false)
+	}
+
+	for _, hardenSubject := range perUserSubjects() {
+		if len(names) > 0 && !containsFold(names, hardenSubject.Name()) {
+			continue
+		}
+		if len(names) == 0 && harden && !hardenSubject.HardenByDefault() {
+			continue
+		}
+		if harden == hardenSubject.IsHardened() {
+			continue
+		}
+
+		var err error
+		if harden {
+			err = hardenOrRestoreSubject(hardenSubject, true)
+		} else {
+			err = restoreSubject(hardenSubject)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %s", hardenSubject.Name(), err.Error()))
+			continue
+		}
+		result.Changed = append(result.Changed, hardenSubject.Name())
+	}
+
+	if harden && !hardened && len(result.Changed) > 0 {
+		markStatus(true)
+	} else if !harden && len(names) == 0 && len(result.Errors) == 0 {
+		// Values of the user's own machine-wide hardening are kept.
+		err := restoreJournalRecords(func(entry *journalEntry) bool {
+			return entry.Root == "CURRENT_USER"
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			return
+		}
+		if journal, err := loadBackupJournal(); err == nil && len(journal.Records) == 0 && len(journal.States) == 0 {
+			markStatus(false)
+		}
+	}
+}
+
+// printUserProfileResults writes the results of hardenUserProfiles to w.
+func printUserProfileResults(w io.Writer, results []userProfileResult, harden bool) {
+	action := "restored"
+	if harden {
+		action = "hardened"
+	}
+	for _, result := range results {
+		fmt.Fprintf(w, "User %s:\n", result.Profile)
+		if len(result.Changed) == 0 && len(result.Errors) == 0 {
+			fmt.Fprintln(w, "  nothing to do")
+		}
+		for _, name := range result.Changed {
+			fmt.Fprintf(w, "  %s: %s\n", name, action)
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintf(w, "  error: %s\n", err.Error())
+		}
+	}
+}
+
+// printUserProfilesStatus writes the status of the per-user harden subjects
+// of all user profiles to w.
+func printUserProfilesStatus(w io.Writer) error {
+	profiles, err := listUserProfiles()
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		fmt.Fprintf(w, "User %s:\n", profile)
+		err := withUserHive(profile, func() error {
+			for _, hardenSubject := range perUserSubjects() {
+				printHardenStatus(w, getHardenStatus(hardenSubject), 1)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(w, "  error: %s\n", err.Error())
+		}
+	}
+	return nil
+}
+
+// cmdHardenUserProfiles hardens or restores all user profiles after the
+// current user has been hardened or restored. The results are added to
+// report and it is written, if it is not nil. It exits with an error if a
+// profile failed.
+func cmdHardenUserProfiles(harden bool, report *hardenReport) {
+	results, err := hardenUserProfiles(harden)
+	if err != nil {
+		fmt.Println("Could not process user profiles: " + err.Error())
+		os.Exit(-1)
+	}
+	if report != nil {
+		report.addUserProfiles(results)
+		writeReportOrExit(report)
+	} else {
+		printUserProfileResults(os.Stdout, results, harden)
+	}
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			os.Exit(-1)
+		}
+	}
+}
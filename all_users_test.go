@@ -0,0 +1,134 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	loggedOnSID = "S-1-5-21-1-1001"
+	offlineSID  = "S-1-5-21-1-1002"
+)
+
+// addUserProfiles creates a profile of a logged on user with WSH enabled, a
+// profile of a user that is not logged on and a system profile.
+func addUserProfiles(t *testing.T, reg *memoryRegistry) {
+	t.Helper()
+	for sid, path := range map[string]string{
+		loggedOnSID:  "%SystemDrive%\\Users\\anna",
+		offlineSID:   "C:\\Users\\bob",
+		"S-1-5-18":   "C:\\Windows\\system32\\config\\systemprofile",
+		"S-1-5-21-2": "",
+	} {
+		key, _, _ := reg.CreateKey(HKLM, profileListKey+"\\"+sid, keyAllAccess)
+		if path != "" {
+			key.SetExpandStringValue("ProfileImagePath", path)
+		}
+		key.Close()
+	}
+	key, _, _ := reg.CreateKey(HKU, loggedOnSID+"\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings", keyAllAccess)
+	key.SetDWordValue("Enabled", 1)
+	key.Close()
+	reg.AddHiveFile("C:\\Users\\bob\\NTUSER.DAT")
+}
+
+func TestListUserProfiles(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	addUserProfiles(t, reg)
+	t.Setenv("SystemDrive", "D:")
+
+	profiles, err := listUserProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []userProfile{{loggedOnSID, "D:\\Users\\anna"}, {offlineSID, "C:\\Users\\bob"}}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("profiles = %v", profiles)
+	}
+
+	useSubjects(t, WSH, UAC, Cmd, AdobePDFLockdown, OfficeMacros)
+	var names []string
+	for _, subject := range perUserSubjects() {
+		names = append(names, subject.Name())
+	}
+	if !reflect.DeepEqual(names, []string{WSH.Name(), Cmd.Name(), OfficeMacros.Name()}) {
+		t.Errorf("per-user subjects = %v", names)
+	}
+}
+
+func TestHardenUserProfiles(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	addUserProfiles(t, reg)
+	t.Setenv("SystemDrive", "C:")
+	useSubjects(t, WSH, UAC, Cmd)
+	before := dumpRegistry(t, reg)
+
+	results, err := hardenUserProfiles(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if !reflect.DeepEqual(result.Changed, []string{WSH.Name()}) || len(result.Errors) != 0 {
+			t.Errorf("result for %s: changed %v, errors %v", result.Profile, result.Changed, result.Errors)
+		}
+	}
+	after := dumpRegistry(t, reg)
+	if value := after["USERS\\"+loggedOnSID+"\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled"]; value != "4:0" {
+		t.Errorf("WSH of logged on user = %q", value)
+	}
+	for name := range after {
+		if strings.HasPrefix(name, "CURRENT_USER\\") || strings.HasPrefix(name, "LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Policies") ||
+			strings.HasPrefix(name, "USERS\\"+userHiveMountPrefix) {
+			t.Errorf("%s has been changed", name)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := printUserProfilesStatus(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "User "+loggedOnSID+" (C:\\Users\\anna):\n  WSH: hardened\n  Disable cmd.exe: not hardened\n") ||
+		!strings.Contains(out.String(), "User "+offlineSID+" (C:\\Users\\bob):\n  WSH: hardened\n") {
+		t.Errorf("status:\n%s", out.String())
+	}
+
+	// The backup journal is kept in the hive of every user.
+	results, err = hardenUserProfiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if !reflect.DeepEqual(result.Changed, []string{WSH.Name()}) || len(result.Errors) != 0 {
+			t.Errorf("result for %s: changed %v, errors %v", result.Profile, result.Changed, result.Errors)
+		}
+	}
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+	withUserHive(userProfile{offlineSID, "C:\\Users\\bob"}, func() error {
+		for name, value := range dumpRegistry(t, reg) {
+			if strings.HasPrefix(name, "CURRENT_USER\\") || strings.HasPrefix(name, "USERS\\"+userHiveMountPrefix) {
+				t.Errorf("offline hive after restore: %s = %s", name, value)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,195 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// The audit compares the hardened values recorded in the backup journal with
+// the current registry to find settings that have been changed after
+// hardening (e.g. by malware or by the user).
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// auditExitDrift is the exit code of -audit if settings have drifted.
+const auditExitDrift = 2
+
+// auditDrift is a hardened setting that has been changed since hardening.
+type auditDrift struct {
+	Subject  string
+	Setting  string
+	Expected string
+	Current  string
+}
+
+// auditReport is the result of an audit.
+type auditReport struct {
+	Checked int
+	Drifts  []auditDrift
+}
+
+// auditBackupJournal checks every value, deleted key and DisallowRun entry
+// recorded in the backup journal against the current system.
+func auditBackupJournal() (*auditReport, error) {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &auditReport{}
+	for _, entry := range journal.Records {
+		current, drifted, err := entry.checkDrift()
+		if err != nil {
+			return nil, err
+		}
+		report.Checked++
+		if drifted {
+			report.add(entry.Subject, entry.String(), entry.expected(), current)
+		}
+	}
+
+	for _, state := range journal.States {
+		if strings.HasPrefix(state.Feature, disallowRunFeaturePrefix) {
+			report.Checked++
+		}
+	}
+	missing, err := missingDisallowRunEntries(journal)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range missing {
+		report.add(state.Subject, disallowRunEntryName(state), "(existing)", "(not existing)")
+	}
+	return report, nil
+}
+
+// checkDrift returns the current data of the value (or key) of entry and
+// whether it differs from the hardened state.
+func (entry *journalEntry) checkDrift() (current string, drifted bool, err error) {
+	rootKey, err := getRootKeyFromName(entry.Root)
+	if err != nil {
+		return "", false, err
+	}
+
+	if entry.Key != nil {
+		if registryKeyExists(rootKey, entry.Path) {
+			return "(existing)", true, nil
+		}
+		return "(not existing)", false, nil
+	}
+
+	var value *registryValue
+	key, err := registryBackend.OpenKey(rootKey, entry.Path, keyRead)
+	if err == nil {
+		value, err = readRegistryValue(key, entry.Name)
+		key.Close()
+	}
+	if err != nil && err != errRegistryNotExist {
+		return "(could not be read: " + err.Error() + ")", true, nil
+	}
+	return describeValue(value), !entry.Hardened.Equal(value), nil
+}
+
+// expected returns the hardened data of the value (or key) of entry.
+func (entry *journalEntry) expected() string {
+	if entry.Key != nil {
+		return "(not existing)"
+	}
+	return describeValue(entry.Hardened)
+}
+
+// missingDisallowRunEntries returns the DisallowRun states of journal whose
+// executable is not in the DisallowRun list anymore.
+func missingDisallowRunEntries(journal *backupJournal) ([]*journalState, error) {
+	var entries []disallowRunEntry
+	key, err := registryBackend.OpenKey(HKCU, explorerDisallowRunKey, keyRead)
+	if err == nil {
+		entries, err = readDisallowRunEntries(key)
+		key.Close()
+	}
+	if err != nil && err != errRegistryNotExist {
+		return nil, fmt.Errorf("could not read DisallowRun list: %s", err.Error())
+	}
+
+	var missing []*journalState
+	for _, state := range journal.States {
+		if strings.HasPrefix(state.Feature, disallowRunFeaturePrefix) &&
+			findOwnedDisallowRunEntry(entries, state) < 0 {
+			missing = append(missing, state)
+		}
+	}
+	return missing, nil
+}
+
+// disallowRunEntryName returns the name of the DisallowRun entry of state.
+func disallowRunEntryName(state *journalState) string {
+	return "CURRENT_USER\\" + explorerDisallowRunKey + " entry " + disallowRunStateExecutable(state)
+}
+
+// add adds a drifted setting to report.
+func (report *auditReport) add(subject, setting, expected, current string) {
+	report.Drifts = append(report.Drifts, auditDrift{subject, setting, expected, current})
+}
+
+// describeValue returns type and data of value.
+func describeValue(value *registryValue) string {
+	if value == nil {
+		return value.String()
+	}
+	return registryValueTypeName(value.Type) + " " + value.String()
+}
+
+// printAuditReport writes report to w.
+func printAuditReport(w io.Writer, report *auditReport) {
+	if len(report.Drifts) == 0 {
+		fmt.Fprintf(w, "All %d hardened settings are unchanged.\n", report.Checked)
+		return
+	}
+	fmt.Fprintf(w, "%d of %d hardened settings have been changed since hardening:\n",
+		len(report.Drifts), report.Checked)
+	for _, drift := range report.Drifts {
+		if drift.Subject == "" {
+			// Saved by an older version that did not record the subject.
+			fmt.Fprintf(w, "  %s\n", drift.Setting)
+		} else {
+			fmt.Fprintf(w, "  %s: %s\n", drift.Subject, drift.Setting)
+		}
+		fmt.Fprintf(w, "    expected: %s\n", drift.Expected)
+		fmt.Fprintf(w, "    current:  %s\n", drift.Current)
+	}
+}
+
+// cmdAudit prints all hardened settings that have been changed since
+// hardening. It exits with auditExitDrift if there are any.
+func cmdAudit() {
+	report, err := auditBackupJournal()
+	if err != nil {
+		fmt.Println("Audit failed: " + err.Error())
+		os.Exit(-1)
+	}
+	if report.Checked == 0 {
+		fmt.Println("Nothing has been hardened.")
+		os.Exit(0)
+	}
+	printAuditReport(os.Stdout, report)
+	if len(report.Drifts) > 0 {
+		os.Exit(auditExitDrift)
+	}
+	os.Exit(0)
+}
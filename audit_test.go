@@ -0,0 +1,75 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditBackupJournal(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCR, "ms-msdt", keyAllAccess)
+	key.SetStringValue("URL Protocol", "")
+	key.Close()
+	msdt := &RegistryKeyAbsent{RootKey: HKCR, Path: "ms-msdt", shortName: "MSDT"}
+
+	for _, subject := range []HardenInterface{WSH, ShowFileExt, Cmd, msdt} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+	}
+	report, err := auditBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked < 5 || len(report.Drifts) != 0 {
+		t.Errorf("audit after hardening: %d checked, drifts %v", report.Checked, report.Drifts)
+	}
+
+	// Tamper with a value, the DisallowRun list and the deleted key.
+	key, _ = reg.OpenKey(HKCU, "SOFTWARE\\Microsoft\\Windows Script Host\\Settings", keyAllAccess)
+	key.SetDWordValue("Enabled", 1)
+	key.Close()
+	key, _ = reg.OpenKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	key.DeleteValue("1")
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCR, "ms-msdt", keyAllAccess)
+	key.Close()
+
+	report, err = auditBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []auditDrift{
+		{WSH.Name(), "CURRENT_USER\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled",
+			"REG_DWORD 0", "REG_DWORD 1"},
+		{"MSDT", "CLASSES_ROOT\\ms-msdt", "(not existing)", "(existing)"},
+		{Cmd.Name(), "CURRENT_USER\\" + explorerDisallowRunKey + " entry cmd.exe", "(existing)", "(not existing)"},
+	}
+	if !reflect.DeepEqual(report.Drifts, expected) {
+		t.Errorf("drifts = %v", report.Drifts)
+	}
+
+	var out bytes.Buffer
+	printAuditReport(&out, report)
+	if !strings.HasPrefix(out.String(), "3 of ") || !strings.Contains(out.String(), "    current:  REG_DWORD 1\n") {
+		t.Errorf("report:\n%s", out.String())
+	}
+}
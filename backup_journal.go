@@ -0,0 +1,379 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// The backup journal contains the original state of everything hardentools
+// changed. It is stored as JSON in the hardentools registry key (value
+// backupJournalValueName) and replaces the old format that encoded root key,
+// path and value name in the names of registry values (SavedStateNew_...).
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// backupJournalValueName is the name of the registry value in the
+	// hardentools key that contains the backup journal.
+	backupJournalValueName = "BackupJournal"
+	// backupJournalVersion is the current version of the journal format.
+	backupJournalVersion = 1
+)
+
+// journalSubject is the name of the harden subject that is currently
+// hardened or restored. It is recorded as owner of all saved values.
+var journalSubject string
+
+// backupJournal is the versioned document stored in the registry.
+type backupJournal struct {
+	Version int             `json:"version"`
+	Records []*journalEntry `json:"records"`
+	States  []*journalState `json:"states,omitempty"`
+}
+
+// journalEntry records a single changed registry value. Original is nil if
+// the value did not exist before hardening. If a whole key has been deleted,
+// Key contains its original content and Name, Original and Hardened are
+// unused.
+type journalEntry struct {
+	Subject   string               `json:"subject"`
+	Root      string               `json:"root"`
+	Path      string               `json:"path"`
+	Name      string               `json:"name"`
+	Original  *registryValue       `json:"original"`
+	Hardened  *registryValue       `json:"hardened"`
+	Key       *registryKeySnapshot `json:"key,omitempty"`
+	Timestamp time.Time            `json:"timestamp"`
+}
+
+// journalState records the original state of a harden subject that is not
+// stored in the registry (e.g. an optional Windows feature).
+type journalState struct {
+	Subject   string    `json:"subject"`
+	Feature   string    `json:"feature"`
+	State     string    `json:"state"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// String returns the full path of the registry value (or key) of entry.
+func (entry *journalEntry) String() string {
+	if entry.Key != nil {
+		return entry.Root + "\\" + entry.Path
+	}
+	return entry.Root + "\\" + entry.Path + "\\" + entry.Name
+}
+
+// loadBackupJournal reads the backup journal. An empty journal is returned if
+// none has been saved yet.
+func loadBackupJournal() (*backupJournal, error) {
+	journal := &backupJournal{Version: backupJournalVersion}
+
+	hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyQueryValue)
+	if err == errRegistryNotExist {
+		return journal, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer hardentoolsKey.Close()
+
+	data, _, err := hardentoolsKey.GetStringValue(backupJournalValueName)
+	if err == errRegistryNotExist {
+		return journal, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(data), journal); err != nil {
+		return nil, fmt.Errorf("invalid backup journal: %s", err.Error())
+	}
+	if journal.Version != backupJournalVersion {
+		return nil, fmt.Errorf("unsupported backup journal version %d", journal.Version)
+	}
+	return journal, nil
+}
+
+// save writes the backup journal to the registry. An empty journal is
+// removed.
+func (journal *backupJournal) save() error {
+	if len(journal.Records) == 0 && len(journal.States) == 0 {
+		hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+		if err == errRegistryNotExist {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer hardentoolsKey.Close()
+		if err := hardentoolsKey.DeleteValue(backupJournalValueName); err != nil && err != errRegistryNotExist {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+
+	hardentoolsKey, _, err := registryBackend.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	if err != nil {
+		return err
+	}
+	defer hardentoolsKey.Close()
+
+	return hardentoolsKey.SetStringValue(backupJournalValueName, string(data))
+}
+
+// findEntry returns the entry for a registry value or nil.
+func (journal *backupJournal) findEntry(rootKeyName, path, valueName string) *journalEntry {
+	for _, entry := range journal.Records {
+		if entry.Key == nil && entry.Root == rootKeyName && strings.EqualFold(entry.Path, path) &&
+			strings.EqualFold(entry.Name, valueName) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// findKeyEntry returns the entry for a deleted registry key or nil.
+func (journal *backupJournal) findKeyEntry(rootKeyName, path string) *journalEntry {
+	for _, entry := range journal.Records {
+		if entry.Key != nil && entry.Root == rootKeyName && strings.EqualFold(entry.Path, path) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// findState returns the state record of feature or nil.
+func (journal *backupJournal) findState(feature string) *journalState {
+	for _, state := range journal.States {
+		if state.Feature == feature {
+			return state
+		}
+	}
+	return nil
+}
+
+// recordOriginalValue saves the current value of a registry value in the
+// backup journal before it is changed to hardenedValue. If the value has
+// already been recorded, the first (real) original value is kept.
+func recordOriginalValue(rootKey RegistryRootKey, path, valueName string, hardenedValue *registryValue) error {
+	rootKeyName, err := getRootKeyName(rootKey)
+	if err != nil {
+		return err
+	}
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+
+	var currentValue *registryValue
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead)
+	if err == nil {
+		currentValue, err = readRegistryValue(key, valueName)
+		key.Close()
+	}
+	if err != nil && err != errRegistryNotExist {
+		return fmt.Errorf("couldn't save original value of %s\\%s\\%s: %s",
+			rootKeyName, path, valueName, err.Error())
+	}
+
+	if currentValue != nil && hardenedValue != nil && currentValue.Type != hardenedValue.Type {
+		Info.Printf("Changing type of %s\\%s\\%s from %s to %s", rootKeyName, path, valueName,
+			registryValueTypeName(currentValue.Type), registryValueTypeName(hardenedValue.Type))
+	}
+
+	entry := journal.findEntry(rootKeyName, path, valueName)
+	if currentTransaction != nil {
+		currentTransaction.logValueChange(journalEntry{
+			Root:     rootKeyName,
+			Path:     path,
+			Name:     valueName,
+			Original: currentValue,
+		}, entry == nil)
+	}
+	if entry != nil {
+		Trace.Printf("Original value of %s has already been saved", entry)
+		entry.Hardened = hardenedValue
+		return journal.save()
+	}
+
+	entry = &journalEntry{
+		Subject:   journalSubject,
+		Root:      rootKeyName,
+		Path:      path,
+		Name:      valueName,
+		Original:  currentValue,
+		Hardened:  hardenedValue,
+		Timestamp: time.Now().UTC(),
+	}
+	Trace.Printf("Saving original value of %s: %s", entry, currentValue)
+	journal.Records = append(journal.Records, entry)
+	return journal.save()
+}
+
+// recordOriginalKey saves path below rootKey with all values and subkeys in
+// the backup journal before it is deleted. If the key has already been
+// recorded, the first (real) original content is kept.
+func recordOriginalKey(rootKey RegistryRootKey, path string) error {
+	rootKeyName, err := getRootKeyName(rootKey)
+	if err != nil {
+		return err
+	}
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := readRegistryKeySnapshot(rootKey, path)
+	if err != nil {
+		return fmt.Errorf("couldn't save original key %s\\%s: %s",
+			rootKeyName, path, err.Error())
+	}
+
+	entry := journal.findKeyEntry(rootKeyName, path)
+	if currentTransaction != nil {
+		currentTransaction.logValueChange(journalEntry{
+			Root: rootKeyName,
+			Path: path,
+			Key:  snapshot,
+		}, entry == nil)
+	}
+	if entry != nil {
+		Trace.Printf("Original content of %s has already been saved", entry)
+		return nil
+	}
+
+	entry = &journalEntry{
+		Subject:   journalSubject,
+		Root:      rootKeyName,
+		Path:      path,
+		Key:       snapshot,
+		Timestamp: time.Now().UTC(),
+	}
+	Trace.Printf("Saving original content of %s", entry)
+	journal.Records = append(journal.Records, entry)
+	return journal.save()
+}
+
+// restore restores the original value (or key) of entry.
+func (entry *journalEntry) restore() error {
+	rootKey, err := getRootKeyFromName(entry.Root)
+	if err != nil {
+		return err
+	}
+
+	if entry.Key != nil {
+		// Key has been deleted when hardening. Anything created there in
+		// the meantime is replaced by the original content.
+		err := deleteRegistryKeyTree(rootKey, entry.Path)
+		if err != nil && err != errRegistryNotExist {
+			return err
+		}
+		Trace.Printf("restoreSavedRegistryKeys: Recreating registry key %s", entry)
+		return entry.Key.write(rootKey, entry.Path)
+	}
+
+	if entry.Original == nil {
+		// Value did not exist before hardening.
+		key, err := registryBackend.OpenKey(rootKey, entry.Path, keyAllAccess)
+		if err == errRegistryNotExist {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer key.Close()
+
+		Trace.Printf("restoreSavedRegistryKeys: Deleting registry value %s", entry)
+		err = key.DeleteValue(entry.Name)
+		if err == errRegistryNotExist {
+			return nil
+		}
+		return err
+	}
+
+	key, _, err := registryBackend.CreateKey(rootKey, entry.Path, keyAllAccess)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	Trace.Printf("restoreSavedRegistryKeys: Restoring registry value %s = %s",
+		entry, entry.Original)
+	return writeRegistryValue(key, entry.Name, entry.Original)
+}
+
+// restoreBackupJournal restores all registry values recorded in the backup
+// journal (in reverse order) and removes the restored entries from it.
+// Entries that could not be restored are kept.
+func restoreBackupJournal() error {
+	return restoreJournalRecords(func(entry *journalEntry) bool { return true })
+}
+
+// restoreSubjectBackup restores only the registry values saved by the harden
+// subject named subject. All other entries are kept.
+func restoreSubjectBackup(subject string) error {
+	return restoreJournalRecords(func(entry *journalEntry) bool {
+		return entry.Subject == subject
+	})
+}
+
+// restoreJournalRecords restores the registry values of all entries selected
+// by restoreEntry (in reverse order) and removes them from the backup
+// journal. Entries that could not be restored are kept.
+func restoreJournalRecords(restoreEntry func(entry *journalEntry) bool) error {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+
+	var kept []*journalEntry
+	var firstErr error
+	restored := 0
+	for i := len(journal.Records) - 1; i >= 0; i-- {
+		entry := journal.Records[i]
+		if !restoreEntry(entry) {
+			kept = append([]*journalEntry{entry}, kept...)
+			continue
+		}
+		restored++
+		journalSubject = entry.Subject
+		err := entry.restore()
+		journalSubject = ""
+		if err != nil {
+			Info.Printf("Could not restore registry value %s due to error: %s",
+				entry, err.Error())
+			kept = append([]*journalEntry{entry}, kept...)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("could not restore %s: %s", entry, err.Error())
+			}
+		}
+	}
+
+	if restored == 0 {
+		return firstErr
+	}
+	journal.Records = kept
+	if err := journal.save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
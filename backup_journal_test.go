@@ -0,0 +1,232 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryValueJSON(t *testing.T) {
+	values := []*registryValue{
+		dwordValue(0xffffffff),
+		{Type: regQWORD, Integer: 1 << 40},
+		stringValue("text"),
+		{Type: regExpandSZ, Str: "%SystemRoot%"},
+		{Type: regMultiSZ, Strings: []string{"a", "b"}},
+		{Type: regBinary, Binary: []byte{0, 1, 0xff}},
+		{Type: regNone, Binary: []byte{}},
+		{Type: 8, Binary: []byte{1, 2}}, // REG_RESOURCE_LIST
+	}
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("Marshal(%s) = %s", value, err)
+		}
+		var decoded registryValue
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal(%s) = %s", data, err)
+		}
+		if !value.Equal(&decoded) {
+			t.Errorf("%s decoded as %#v", data, decoded)
+		}
+	}
+
+	var decoded registryValue
+	if err := json.Unmarshal([]byte(`{"type":"REG_DWORD","data":4294967296}`), &decoded); err == nil {
+		t.Error("out of range REG_DWORD has been decoded")
+	}
+	if err := json.Unmarshal([]byte(`{"type":"REG_LINK","data":""}`), &decoded); err == nil {
+		t.Error("unsupported type has been decoded")
+	}
+}
+
+func TestRawRegistryValues(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	const path = "Software\\Example\\Raw"
+	key, _, _ := reg.CreateKey(HKCU, path, keyAllAccess)
+	key.SetRawValue("None", regNone, nil)
+	key.SetRawValue("Link", 6, encodeUTF16LE("\\Registry\\Machine"))
+	key.SetRawValue("Number", regDWORD, []byte{1, 0, 0, 0})
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	// Values of all types can be saved and written back.
+	snapshot, err := readRegistryKeySnapshot(HKCU, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := snapshot.Values[1].Value
+	if link.Type != 6 || !bytes.Equal(link.Binary, encodeUTF16LE("\\Registry\\Machine")) {
+		t.Errorf("REG_LINK value read as %#v", link)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded registryKeySnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteRegistryKeyTree(HKCU, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.write(HKCU, path); err != nil {
+		t.Fatal(err)
+	}
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after writing back:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestBackupJournalRoundTrip(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	// Names containing the separators of the old format.
+	const path = "Software\\Some_Vendor\\Test____Key"
+	key, _, _ := reg.CreateKey(HKCU, path, keyAllAccess)
+	key.SetStringsValue("Multi____Value", []string{"a", "b"})
+	key.SetExpandStringValue("Expand_Value", "%TEMP%")
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	journalSubject = "Test"
+	defer func() { journalSubject = "" }()
+	if err := hardenKey(HKCU, path, "Multi____Value", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardenKeySZ(HKCU, path, "Expand_Value", "hardened"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardenKey(HKCU, path, "New", 1); err != nil {
+		t.Fatal(err)
+	}
+	// Hardening a value twice keeps the first original value.
+	if err := hardenKey(HKCU, path, "multi____value", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Records) != 3 {
+		t.Fatalf("journal contains %d records, expected 3", len(journal.Records))
+	}
+	entry := journal.Records[0]
+	if entry.Subject != "Test" || entry.Root != "CURRENT_USER" || entry.Path != path ||
+		entry.Name != "Multi____Value" || entry.Timestamp.IsZero() {
+		t.Errorf("unexpected record %#v", entry)
+	}
+	if !entry.Original.Equal(&registryValue{Type: regMultiSZ, Strings: []string{"a", "b"}}) ||
+		!entry.Hardened.Equal(dwordValue(2)) {
+		t.Errorf("record %s: original = %s, hardened = %s", entry, entry.Original, entry.Hardened)
+	}
+	if journal.Records[2].Original != nil {
+		t.Errorf("original of not existing value = %s", journal.Records[2].Original)
+	}
+
+	if err := restoreSavedRegistryKeys(); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(false)
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestBackupJournalRestoreFailure(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	if err := hardenKey(HKLM, "Software\\Policies\\Test", "Value", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardenKey(HKCU, "Software\\Test", "Value", 1); err != nil {
+		t.Fatal(err)
+	}
+	reg.SetAccessDenied(HKLM, "", true)
+
+	if err := restoreSavedRegistryKeys(); err == nil {
+		t.Error("restore without privileges did not fail")
+	}
+	journal, _ := loadBackupJournal()
+	if len(journal.Records) != 1 || journal.Records[0].Root != "LOCAL_MACHINE" {
+		t.Errorf("journal after failed restore = %v", journal.Records)
+	}
+
+	// Removing the status never removes the values that are still saved.
+	markStatus(true)
+	markStatus(false)
+	if checkStatus() {
+		t.Error("status has not been removed")
+	}
+	if journal, _ := loadBackupJournal(); len(journal.Records) != 1 {
+		t.Errorf("journal after removing the status = %v", journal.Records)
+	}
+}
+
+func TestBackupJournalInvalid(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	key.SetStringValue(backupJournalValueName, `{"version":99,"records":[]}`)
+	key.Close()
+
+	if _, err := loadBackupJournal(); err == nil {
+		t.Error("journal with unknown version has been loaded")
+	}
+	if err := hardenKey(HKCU, "Software\\Test", "Value", 1); err == nil {
+		t.Error("hardening with unreadable journal did not fail")
+	}
+}
+
+func TestLegacySavedStateRestore(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Test", keyAllAccess)
+	key.SetDWordValue("DWORD", 1)
+	key.SetStringValue("SZ", "hardened")
+	key.SetDWordValue("New", 1)
+	key.Close()
+
+	key, _, _ = reg.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	key.SetDWordValue("SavedStateNew_CURRENT_USER\\Software\\Test____DWORD", 0)
+	key.SetStringValue("SavedStateNewSZ_CURRENT_USER\\Software\\Test____SZ", "original")
+	key.SetDWordValue("SavedStateNotExisting_CURRENT_USER\\Software\\Test____New", 0)
+	key.SetStringValue("SavedStateNonReg_recall", "enabled")
+	key.Close()
+
+	if state, err := getSavedHardenState("recall"); state != "enabled" || err != nil {
+		t.Errorf("getSavedHardenState = %q, %v", state, err)
+	}
+	if err := restoreSavedRegistryKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ = reg.OpenKey(HKCU, "Software\\Test", keyRead)
+	defer key.Close()
+	if val, _, _ := key.GetIntegerValue("DWORD"); val != 0 {
+		t.Errorf("DWORD = %d after restore", val)
+	}
+	if val, _, _ := key.GetStringValue("SZ"); val != "original" {
+		t.Errorf("SZ = %s after restore", val)
+	}
+	if _, _, err := key.GetIntegerValue("New"); err != errRegistryNotExist {
+		t.Errorf("New has not been deleted: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCommandTimeout is the maximum time an external command (e.g.
+// PowerShell.exe) may run. Enabling/disabling optional Windows features can
+// take several minutes.
+const defaultCommandTimeout = 10 * time.Minute
+
+// errCommandTimeout is returned if a command did not finish in time.
+var errCommandTimeout = errors.New("command timed out")
+
+// CommandExitError is returned if a command exited with a non-zero exit code.
+type CommandExitError struct {
+	Command  string
+	ExitCode int
+}
+
+func (e *CommandExitError) Error() string {
+	return fmt.Sprintf("%s: exit status %d", e.Command, e.ExitCode)
+}
+
+// CommandRunner is the interface every external command (PowerShell.exe,
+// cmd.exe) of hardentools is executed with. It returns the combined output
+// (stdout and stderr) of the command.
+type CommandRunner interface {
+	Run(name string, args ...string) (output string, err error)
+}
+
+// commandRunner is the CommandRunner used by all harden subjects.
+var commandRunner CommandRunner = systemCommandRunner{timeout: defaultCommandTimeout}
+
+// Helper method for executing cmd commands (does not open cmd window).
+func executeCommand(cmd string, args ...string) (string, error) {
+	return commandRunner.Run(cmd, args...)
+}
+
+// commandLine returns name and args as a single string (for logging and
+// comparing commands only, no quoting is done).
+func commandLine(name string, args ...string) string {
+	return strings.Join(append([]string{name}, args...), " ")
+}
+
+// systemCommandRunner executes commands on the local system.
+type systemCommandRunner struct {
+	timeout time.Duration
+}
+
+// Run executes the command, hiding the console window on Windows. Commands
+// blocked with an Image File Execution Options debugger (e.g. cmd.exe by
+// "Disable cmd.exe machine-wide") are executed anyway.
+func (runner systemCommandRunner) Run(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), runner.timeout)
+	defer cancel()
+
+	command := exec.CommandContext(ctx, name, args...)
+	hideCommandWindow(command)
+	var out []byte
+	var err error
+	if debugger := ifeoDebugger(name); debugger != "" {
+		Trace.Printf("%s is redirected to %s by its Image File Execution Options, executing it as debuggee",
+			name, debugger)
+		out, err = runIgnoringIFEO(command)
+	} else {
+		out, err = command.CombinedOutput()
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return string(out), errCommandTimeout
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), &CommandExitError{commandLine(name, args...), exitErr.ExitCode()}
+	}
+	return string(out), err
+}
+
+// ifeoDebugger returns the Image File Execution Options debugger Windows
+// starts instead of executable name ("" if there is none).
+func ifeoDebugger(name string) string {
+	if registryBackend == nil {
+		return ""
+	}
+	key, err := registryBackend.OpenKey(HKLM, ifeoKey+"\\"+filepath.Base(name), keyQueryValue)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+
+	debugger, _, err := key.GetStringValue("Debugger")
+	if err != nil {
+		return ""
+	}
+	return debugger
+}
+
+// commandTranscriptEntry is a single recorded command execution.
+type commandTranscriptEntry struct {
+	Command  []string `json:"command"`
+	Output   string   `json:"output"`
+	ExitCode int      `json:"exitCode"`
+	TimedOut bool     `json:"timedOut,omitempty"`
+}
+
+// commandTranscript is the file format of recorded command executions.
+type commandTranscript struct {
+	Version  int                      `json:"version"`
+	Commands []commandTranscriptEntry `json:"commands"`
+}
+
+const commandTranscriptVersion = 1
+
+// loadCommandTranscript reads a transcript written by saveCommandTranscript.
+func loadCommandTranscript(path string) ([]commandTranscriptEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var transcript commandTranscript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, fmt.Errorf("invalid command transcript %s: %s", path, err.Error())
+	}
+	if transcript.Version != commandTranscriptVersion {
+		return nil, fmt.Errorf("unsupported command transcript version %d in %s",
+			transcript.Version, path)
+	}
+	return transcript.Commands, nil
+}
+
+// saveCommandTranscript writes entries as transcript file.
+func saveCommandTranscript(path string, entries []commandTranscriptEntry) error {
+	data, err := json.MarshalIndent(commandTranscript{commandTranscriptVersion, entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// recordingCommandRunner executes commands with another CommandRunner and
+// records every execution. The recorded transcript can be saved with
+// saveCommandTranscript and replayed with scriptedCommandRunner, e.g. to
+// turn a run on a real Windows system into a test case.
+type recordingCommandRunner struct {
+	runner  CommandRunner
+	mutex   sync.Mutex
+	entries []commandTranscriptEntry
+}
+
+// Run executes and records the command.
+func (recorder *recordingCommandRunner) Run(name string, args ...string) (string, error) {
+	out, err := recorder.runner.Run(name, args...)
+
+	entry := commandTranscriptEntry{
+		Command: append([]string{name}, args...),
+		Output:  out,
+	}
+	var exitErr *CommandExitError
+	if errors.As(err, &exitErr) {
+		entry.ExitCode = exitErr.ExitCode
+	} else if err == errCommandTimeout {
+		entry.TimedOut = true
+	} else if err != nil {
+		entry.ExitCode = -1
+	}
+
+	recorder.mutex.Lock()
+	recorder.entries = append(recorder.entries, entry)
+	recorder.mutex.Unlock()
+
+	return out, err
+}
+
+// Transcript returns all recorded executions.
+func (recorder *recordingCommandRunner) Transcript() []commandTranscriptEntry {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return append([]commandTranscriptEntry(nil), recorder.entries...)
+}
+
+// scriptedCommandRunner is a fake CommandRunner that replays a transcript.
+// Commands must be executed in the recorded order; the recorded output, exit
+// code or timeout is returned instead of executing anything.
+type scriptedCommandRunner struct {
+	mutex      sync.Mutex
+	entries    []commandTranscriptEntry
+	position   int
+	unexpected []string
+}
+
+// newScriptedCommandRunner returns a scriptedCommandRunner for entries.
+func newScriptedCommandRunner(entries []commandTranscriptEntry) *scriptedCommandRunner {
+	return &scriptedCommandRunner{entries: entries}
+}
+
+// Run replays the next transcript entry.
+func (runner *scriptedCommandRunner) Run(name string, args ...string) (string, error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	got := commandLine(name, args...)
+	if runner.position >= len(runner.entries) {
+		runner.unexpected = append(runner.unexpected, got)
+		return "", fmt.Errorf("unexpected command (transcript finished): %s", got)
+	}
+
+	entry := runner.entries[runner.position]
+	expected := commandLine(entry.Command[0], entry.Command[1:]...)
+	if !strings.EqualFold(got, expected) {
+		runner.unexpected = append(runner.unexpected, got)
+		return "", fmt.Errorf("unexpected command: %s (expected: %s)", got, expected)
+	}
+	runner.position++
+
+	if entry.TimedOut {
+		return entry.Output, errCommandTimeout
+	}
+	if entry.ExitCode != 0 {
+		return entry.Output, &CommandExitError{got, entry.ExitCode}
+	}
+	return entry.Output, nil
+}
+
+// Verify returns an error if unexpected commands have been executed or not
+// all transcript entries have been replayed.
+func (runner *scriptedCommandRunner) Verify() error {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	if len(runner.unexpected) > 0 {
+		return fmt.Errorf("unexpected commands: %s", strings.Join(runner.unexpected, "; "))
+	}
+	if runner.position < len(runner.entries) {
+		entry := runner.entries[runner.position]
+		return fmt.Errorf("%d commands not executed, next one: %s",
+			len(runner.entries)-runner.position, commandLine(entry.Command[0], entry.Command[1:]...))
+	}
+	return nil
+}
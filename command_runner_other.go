@@ -1,5 +1,5 @@
 // Hardentools
-// Copyright (C) 2023 Security Without Borders
+// Copyright (C) 2017-2025 Security Without Borders
 //
 // This program is free software: you can redistribute it and/or modify
 // it under the terms of the GNU General Public License as published by
@@ -14,22 +14,14 @@
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
+//go:build !windows
+
 package main
 
-import (
-	"golang.org/x/sys/windows/registry"
-)
+import "os/exec"
 
-// OneNoteBlockExtensions blocks certain types of files in OneNote client
-var OneNoteBlockExtensions = &OfficeRegistryRegExSingleDWORD{
-	RootKey:         registry.CURRENT_USER,
-	PathRegEx:       "SOFTWARE\\Microsoft\\Office\\%s\\%s\\Options",
-	ValueName:       "DisableEmbeddedFiles",
-	HardenedValue:   1,
-	OfficeApps:      []string{"onenote"},
-	OfficeVersions:  standardOfficeVersions,
-	shortName:       "OneNote Attachments",
-	longName:        "Block OneNote Attachments",
-	description:     "Disables opening of attachments in OneNote",
-	hardenByDefault: true,
+// runIgnoringIFEO runs command normally, Image File Execution Options only
+// exist on Windows.
+func runIgnoringIFEO(command *exec.Cmd) ([]byte, error) {
+	return command.CombinedOutput()
 }
@@ -0,0 +1,136 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// useCommandTranscript replaces the command runner with a scripted runner
+// replaying testdata/commands/<name> and verifies at the end of the test
+// that exactly the recorded commands have been executed.
+func useCommandTranscript(t *testing.T, name string) *scriptedCommandRunner {
+	t.Helper()
+	entries, err := loadCommandTranscript(filepath.Join("testdata", "commands", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := commandRunner
+	runner := newScriptedCommandRunner(entries)
+	commandRunner = runner
+	t.Cleanup(func() {
+		commandRunner = previous
+		if err := runner.Verify(); err != nil {
+			t.Errorf("transcript %s: %s", name, err)
+		}
+	})
+	return runner
+}
+
+func TestScriptedCommandRunner(t *testing.T) {
+	runner := newScriptedCommandRunner([]commandTranscriptEntry{
+		{Command: []string{"cmd.exe", "/C", "assoc .js"}, Output: ".js=JSFile\r\n"},
+		{Command: []string{"cmd.exe", "/C", "assoc .hta"}, Output: "not found\r\n", ExitCode: 1},
+		{Command: []string{"PowerShell.exe", "-Command", "Get-MpPreference"}, TimedOut: true},
+	})
+
+	if out, err := runner.Run("cmd.exe", "/C", "assoc .js"); out != ".js=JSFile\r\n" || err != nil {
+		t.Errorf("Run = %q, %v", out, err)
+	}
+	out, err := runner.Run("cmd.exe", "/C", "assoc .hta")
+	var exitErr *CommandExitError
+	if out != "not found\r\n" || !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+		t.Errorf("Run = %q, %v", out, err)
+	}
+	if err := runner.Verify(); err == nil {
+		t.Error("Verify did not report missing command")
+	}
+	if _, err := runner.Run("powershell.exe", "-Command", "Get-MpPreference"); err != errCommandTimeout {
+		t.Errorf("Run = %v, expected timeout", err)
+	}
+	if err := runner.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := runner.Run("cmd.exe"); err == nil {
+		t.Error("Run after end of transcript did not fail")
+	}
+	if err := runner.Verify(); err == nil {
+		t.Error("Verify did not report unexpected command")
+	}
+}
+
+func TestRecordingCommandRunner(t *testing.T) {
+	entries := []commandTranscriptEntry{
+		{Command: []string{"cmd.exe", "/C", "assoc .js"}, Output: ".js=JSFile\r\n"},
+		{Command: []string{"cmd.exe", "/C", "assoc .hta"}, Output: "not found\r\n", ExitCode: 1},
+		{Command: []string{"PowerShell.exe", "-Command", "Get-MpPreference"}, TimedOut: true},
+	}
+	recorder := &recordingCommandRunner{runner: newScriptedCommandRunner(entries)}
+	for _, entry := range entries {
+		recorder.Run(entry.Command[0], entry.Command[1:]...)
+	}
+
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	if err := saveCommandTranscript(path, recorder.Transcript()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCommandTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, entries) {
+		t.Errorf("recorded transcript = %v, expected %v", loaded, entries)
+	}
+}
+
+func TestSystemCommandRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses /bin/sh")
+	}
+	runner := systemCommandRunner{timeout: time.Second}
+
+	if out, err := runner.Run("/bin/sh", "-c", "echo hello"); out != "hello\n" || err != nil {
+		t.Errorf("Run = %q, %v", out, err)
+	}
+	_, err := runner.Run("/bin/sh", "-c", "exit 3")
+	var exitErr *CommandExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Errorf("Run = %v, expected exit code 3", err)
+	}
+
+	// Commands blocked with an Image File Execution Options debugger are
+	// executed anyway.
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKLM, ifeoKey+"\\sh", keyAllAccess)
+	key.SetStringValue("Debugger", ifeoBlockDebugger)
+	key.Close()
+	if out, err := runner.Run("/bin/sh", "-c", "echo hello"); out != "hello\n" || err != nil {
+		t.Errorf("Run of blocked command = %q, %v", out, err)
+	}
+
+	runner.timeout = 50 * time.Millisecond
+	if _, err := runner.Run("/bin/sh", "-c", "exec sleep 5"); err != errCommandTimeout {
+		t.Errorf("Run = %v, expected timeout", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	procDebugActiveProcessStop = kernel32.NewProc("DebugActiveProcessStop")
+)
+
+// runIgnoringIFEO runs command like exec.Cmd.CombinedOutput, but without
+// starting the Image File Execution Options debugger of the executable
+// instead: Windows ignores it for processes created for debugging. Command
+// is therefore created as debuggee, and the creating thread detaches from it
+// right away.
+func runIgnoringIFEO(command *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	command.Stdout = &out
+	command.Stderr = &out
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.CreationFlags |= windows.DEBUG_ONLY_THIS_PROCESS
+
+	// The debugger of a process is the thread that created it.
+	runtime.LockOSThread()
+	err := command.Start()
+	if err == nil {
+		ret, _, errno := procDebugActiveProcessStop.Call(uintptr(command.Process.Pid))
+		if ret == 0 {
+			err = fmt.Errorf("cannot detach from %s: %w", command.Path, errno)
+			_ = command.Process.Kill()
+			_ = command.Wait()
+		}
+	}
+	runtime.UnlockOSThread()
+	if err != nil {
+		return out.Bytes(), err
+	}
+
+	err = command.Wait()
+	return out.Bytes(), err
+}
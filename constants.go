@@ -18,9 +18,13 @@ package main
 
 const (
 	hardentoolsKeyPath            = "SOFTWARE\\Security Without Borders\\"
-	logPath                       = "hardentools.log"
+	logFileName                   = "hardentools.log"
 	defaultLogLevel               = "Info"
 	explorerPoliciesKey           = "Software\\Microsoft\\Windows\\CurrentVersion\\Policies\\Explorer"
 	explorerDisallowRunKey        = "Software\\Microsoft\\Windows\\CurrentVersion\\Policies\\Explorer\\DisallowRun"
 	errorRestoreDisallowRunFailed = "Fully restoring DisableRun settings failed"
+	ifeoKey                       = "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\Image File Execution Options"
+	// ifeoBlockDebugger is set as Debugger of blocked executables. It exits
+	// immediately, so the executable is not started.
+	ifeoBlockDebugger = "systray.exe"
 )
@@ -0,0 +1,451 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Executables are blocked with the Explorer DisallowRun policy:
+//
+//	[HKEY_CURRENT_USER\SOFTWARE\Microsoft\Windows\CurrentVersion\Policies\Explorer]
+//	"DisallowRun"=dword:00000001
+//	[HKEY_CURRENT_USER\SOFTWARE\Microsoft\Windows\CurrentVersion\Policies\Explorer\DisallowRun]
+//	"1"="cmd.exe"
+//	"2"="powershell.exe"
+//
+// The list is shared with other software and by all DisallowRun subjects, so
+// every entry added by hardentools is recorded as harden state
+// (disallowRunFeaturePrefix + executable) with its value name. Restoring only
+// deletes these entries and moves the remaining ones added by hardentools to
+// the lowest free value names, so the list stays compact. Entries that
+// existed before are never renumbered.
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// disallowRunFeaturePrefix is the prefix of the harden states that
+	// record the DisallowRun entries added by hardentools.
+	disallowRunFeaturePrefix = "DisallowRun\\"
+	// disallowRunJournalSubject owns the saved original value of the
+	// DisallowRun policy flag. It is shared by all DisallowRun subjects and
+	// restored when the last entry has been removed.
+	disallowRunJournalSubject = "DisallowRun"
+	// disallowRunValueName is the name of the policy flag in
+	// explorerPoliciesKey.
+	disallowRunValueName = "DisallowRun"
+)
+
+// DisallowRunList is a harden subject that blocks Executables with the
+// Explorer DisallowRun policy.
+type DisallowRunList struct {
+	Executables     []string
+	shortName       string
+	longName        string
+	description     string
+	hardenByDefault bool
+}
+
+// disallowRunEntry is a numbered value of the DisallowRun key.
+type disallowRunEntry struct {
+	number     int
+	executable string
+}
+
+// Harden adds the executables to the DisallowRun list or, when restoring,
+// removes the ones added by hardentools.
+func (disallowRun *DisallowRunList) Harden(harden bool) error {
+	if harden {
+		return addDisallowRunEntries(disallowRun.Executables)
+	}
+	return removeDisallowRunEntries(disallowRun.Executables)
+}
+
+// IsHardened verifies if harden object of type DisallowRunList is already
+// hardened.
+func (disallowRun *DisallowRunList) IsHardened() bool {
+	return disallowRun.Status().State == StateHardened
+}
+
+// Status returns the status of the policy flag and of every executable.
+func (disallowRun *DisallowRunList) Status() HardenStatus {
+	children := []HardenStatus{registryValueStatus(HKCU, explorerPoliciesKey,
+		disallowRunValueName, dwordValue(1))}
+
+	var entries []disallowRunEntry
+	key, err := registryBackend.OpenKey(HKCU, explorerDisallowRunKey, keyRead)
+	if err == nil {
+		entries, err = readDisallowRunEntries(key)
+		key.Close()
+	}
+	listed := false
+	for _, executable := range disallowRun.Executables {
+		status := HardenStatus{Name: "DisallowRun " + executable}
+		switch {
+		case err != nil && err != errRegistryNotExist:
+			status.State = StateError
+			status.Reason = err.Error()
+		case findDisallowRunEntry(entries, executable) >= 0:
+			status.State = StateHardened
+			listed = true
+		default:
+			status.State = StateNotHardened
+			status.Reason = "not in list"
+		}
+		children = append(children, status)
+	}
+	status := combineHardenStatus(disallowRun.shortName, children)
+	if status.State == StatePartiallyHardened && !listed {
+		// The policy flag is shared with other subjects (and the user), it
+		// does not harden anything without listed executables.
+		status.State = StateNotHardened
+	}
+	return status
+}
+
+// Name returns the (short) name of the harden item.
+func (disallowRun *DisallowRunList) Name() string {
+	return disallowRun.shortName
+}
+
+// LongName returns the long name of the harden item.
+func (disallowRun *DisallowRunList) LongName() string {
+	return disallowRun.longName
+}
+
+// Description of the harden item.
+func (disallowRun *DisallowRunList) Description() string {
+	return disallowRun.description
+}
+
+// HardenByDefault returns if subject should be hardened by default.
+func (disallowRun *DisallowRunList) HardenByDefault() bool {
+	return disallowRun.hardenByDefault
+}
+
+// readDisallowRunEntries returns the numbered entries of the DisallowRun key
+// sorted by number. Values with other names are ignored.
+func readDisallowRunEntries(key RegistryKey) ([]disallowRunEntry, error) {
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []disallowRunEntry
+	for _, name := range names {
+		number, err := strconv.Atoi(name)
+		if err != nil || number < 1 || strconv.Itoa(number) != name {
+			continue
+		}
+		executable, _, err := key.GetStringValue(name)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, disallowRunEntry{number, executable})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].number < entries[j].number })
+	return entries, nil
+}
+
+// findDisallowRunEntry returns the index of executable in entries or -1.
+func findDisallowRunEntry(entries []disallowRunEntry, executable string) int {
+	for i, entry := range entries {
+		if strings.EqualFold(entry.executable, executable) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextDisallowRunNumber returns the lowest number not used by entries.
+func nextDisallowRunNumber(entries []disallowRunEntry) int {
+	number := 1
+	for _, entry := range entries {
+		if entry.number != number {
+			break
+		}
+		number++
+	}
+	return number
+}
+
+// addDisallowRunEntries adds all executables that are not in the DisallowRun
+// list yet and records them as added by hardentools. If adding fails, the
+// entries added so far are removed again.
+func addDisallowRunEntries(executables []string) error {
+	key, _, err := registryBackend.CreateKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	if err != nil {
+		return fmt.Errorf("Could not open DisallowRun key due to error %s", err.Error())
+	}
+	defer key.Close()
+
+	entries, err := readDisallowRunEntries(key)
+	if err != nil {
+		return fmt.Errorf("Could not read DisallowRun list due to error %s", err.Error())
+	}
+
+	var added []string
+	for _, executable := range executables {
+		if findDisallowRunEntry(entries, executable) >= 0 {
+			Trace.Printf("%s is already in the DisallowRun list", executable)
+			continue
+		}
+
+		number := nextDisallowRunNumber(entries)
+		err := key.SetStringValue(strconv.Itoa(number), executable)
+		if err == nil {
+			err = saveHardenState(disallowRunFeaturePrefix+strings.ToLower(executable), strconv.Itoa(number))
+			if err != nil {
+				key.DeleteValue(strconv.Itoa(number))
+			}
+		}
+		if err != nil {
+			removeDisallowRunEntries(added)
+			return fmt.Errorf("Could not disable %s due to error %s", executable, err.Error())
+		}
+		entries = append(entries, disallowRunEntry{number, executable})
+		sort.Slice(entries, func(i, j int) bool { return entries[i].number < entries[j].number })
+		added = append(added, executable)
+	}
+
+	if err := enableDisallowRun(); err != nil {
+		removeDisallowRunEntries(added)
+		return fmt.Errorf("Could not enable DisallowRun due to error %s", err.Error())
+	}
+	return nil
+}
+
+// enableDisallowRun sets the DisallowRun policy flag. Its original value is
+// owned by disallowRunJournalSubject, so restoring a single DisallowRun
+// subject does not disable the policy for the others.
+func enableDisallowRun() error {
+	key, err := registryBackend.OpenKey(HKCU, explorerPoliciesKey, keyRead)
+	if err == nil {
+		value, err := readRegistryValue(key, disallowRunValueName)
+		key.Close()
+		if err == nil && value.Equal(dwordValue(1)) {
+			return nil
+		}
+	}
+
+	if err := hardenKey(HKCU, explorerPoliciesKey, disallowRunValueName, 1); err != nil {
+		return err
+	}
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+	entry := journal.findEntry("CURRENT_USER", explorerPoliciesKey, disallowRunValueName)
+	if entry == nil || entry.Subject == disallowRunJournalSubject {
+		return nil
+	}
+	entry.Subject = disallowRunJournalSubject
+	return journal.save()
+}
+
+// removeDisallowRunEntries removes the executables added by hardentools from
+// the DisallowRun list and compacts the list (see compactDisallowRunEntries).
+// Entries that existed before are kept, unless the system has been hardened
+// by an older hardentools version that did not record its entries.
+func removeDisallowRunEntries(executables []string) error {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+	legacy := !journal.hasDisallowRunStates() && hasLegacySavedState()
+
+	key, err := registryBackend.OpenKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	if err == errRegistryNotExist {
+		for _, executable := range executables {
+			if journal.findState(disallowRunFeaturePrefix+strings.ToLower(executable)) != nil {
+				deleteSavedHardenState(disallowRunFeaturePrefix + strings.ToLower(executable))
+			}
+		}
+		return disableDisallowRun(false, legacy)
+	} else if err != nil {
+		return fmt.Errorf("Could not open DisallowRun key due to error %s", err.Error())
+	}
+	defer key.Close()
+
+	entries, err := readDisallowRunEntries(key)
+	if err != nil {
+		return fmt.Errorf("Could not read DisallowRun list due to error %s", err.Error())
+	}
+
+	for _, executable := range executables {
+		feature := disallowRunFeaturePrefix + strings.ToLower(executable)
+		state := journal.findState(feature)
+		if state == nil && !legacy {
+			Trace.Printf("Keeping %s in the DisallowRun list, it has not been added by hardentools", executable)
+			continue
+		}
+		// The entry added by hardentools is removed. Older versions did
+		// not record their entries, so all matching ones are removed.
+		find := func() int { return findDisallowRunEntry(entries, executable) }
+		if state != nil {
+			find = func() int { return findOwnedDisallowRunEntry(entries, state) }
+		}
+		for i := find(); i >= 0; i = find() {
+			if err := key.DeleteValue(strconv.Itoa(entries[i].number)); err != nil {
+				return fmt.Errorf("Could not restore %s by deleting corresponding registry value due to error: %s",
+					executable, err.Error())
+			}
+			Trace.Printf("Restored %s by deleting corresponding registry value", executable)
+			entries = append(entries[:i], entries[i+1:]...)
+			if state != nil {
+				break
+			}
+		}
+		if state != nil {
+			if err := deleteSavedHardenState(feature); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := compactDisallowRunEntries(key); err != nil {
+		return fmt.Errorf("%s: %s", errorRestoreDisallowRunFailed, err.Error())
+	}
+
+	names, err := key.ReadValueNames(0)
+	key.Close()
+	return disableDisallowRun(err == nil && len(names) == 0, legacy)
+}
+
+// compactDisallowRunEntries moves the entries added by hardentools to the
+// lowest free value names of the DisallowRun list and updates their harden
+// states. Entries that have not been added by hardentools keep their value
+// names, as other software might reference them.
+func compactDisallowRunEntries(key RegistryKey) error {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+	entries, err := readDisallowRunEntries(key)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[int]*journalState)
+	for _, state := range journal.States {
+		if !strings.HasPrefix(state.Feature, disallowRunFeaturePrefix) {
+			continue
+		}
+		if i := findOwnedDisallowRunEntry(entries, state); i >= 0 {
+			owners[entries[i].number] = state
+		}
+	}
+
+	// Entries only move to lower value names, so every entry is visited
+	// once while the list is kept sorted.
+	for i := range entries {
+		entry := entries[i]
+		state := owners[entry.number]
+		number := nextDisallowRunNumber(entries)
+		if state == nil || number > entry.number {
+			continue
+		}
+
+		// The entry is added under its new name and recorded before the
+		// old one is deleted, so it is never lost.
+		if err := key.SetStringValue(strconv.Itoa(number), entry.executable); err != nil {
+			return err
+		}
+		state.State = strconv.Itoa(number)
+		if err := journal.save(); err != nil {
+			key.DeleteValue(strconv.Itoa(number))
+			return err
+		}
+		if err := key.DeleteValue(strconv.Itoa(entry.number)); err != nil {
+			return err
+		}
+		Trace.Printf("Moved %s in the DisallowRun list from %d to %d", entry.executable, entry.number, number)
+
+		entries[i].number = number
+		sort.Slice(entries, func(i, j int) bool { return entries[i].number < entries[j].number })
+	}
+	return nil
+}
+
+// findOwnedDisallowRunEntry returns the index of the entry recorded in state
+// in entries or -1. If the recorded value name is unknown or does not contain
+// the executable (anymore), the entry is found by executable.
+func findOwnedDisallowRunEntry(entries []disallowRunEntry, state *journalState) int {
+	executable := disallowRunStateExecutable(state)
+	if number, err := strconv.Atoi(state.State); err == nil {
+		for i, entry := range entries {
+			if entry.number == number && strings.EqualFold(entry.executable, executable) {
+				return i
+			}
+		}
+	}
+	return findDisallowRunEntry(entries, executable)
+}
+
+// disallowRunStateExecutable returns the executable of the DisallowRun entry
+// recorded in state.
+func disallowRunStateExecutable(state *journalState) string {
+	return strings.TrimPrefix(state.Feature, disallowRunFeaturePrefix)
+}
+
+// disableDisallowRun deletes the DisallowRun key if the list is empty. If no
+// entry added by hardentools is left, the original value of the policy flag
+// is restored. legacy deletes the flag if the list is empty and its original
+// value is unknown.
+func disableDisallowRun(empty, legacy bool) error {
+	if empty {
+		err := registryBackend.DeleteKey(HKCU, explorerDisallowRunKey)
+		if err != nil && err != errRegistryNotExist && err != errRegistryHasSubKeys {
+			return fmt.Errorf("%s: %s", errorRestoreDisallowRunFailed, err.Error())
+		}
+	}
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+	if journal.hasDisallowRunStates() {
+		return nil
+	}
+	if journal.findEntry("CURRENT_USER", explorerPoliciesKey, disallowRunValueName) != nil {
+		return restoreSubjectBackup(disallowRunJournalSubject)
+	}
+	if !legacy || !empty {
+		return nil
+	}
+	keyExplorer, err := registryBackend.OpenKey(HKCU, explorerPoliciesKey, keyAllAccess)
+	if err != nil {
+		return nil
+	}
+	defer keyExplorer.Close()
+	if err := keyExplorer.DeleteValue(disallowRunValueName); err != nil && err != errRegistryNotExist {
+		return fmt.Errorf("%s: %s", errorRestoreDisallowRunFailed, err.Error())
+	}
+	return nil
+}
+
+// hasDisallowRunStates returns true if the journal records DisallowRun
+// entries added by hardentools.
+func (journal *backupJournal) hasDisallowRunStates() bool {
+	for _, state := range journal.States {
+		if strings.HasPrefix(state.Feature, disallowRunFeaturePrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// disallowRunList returns the DisallowRun list (without the key path).
+func disallowRunList(t *testing.T, reg *memoryRegistry) map[string]string {
+	t.Helper()
+	prefix := "CURRENT_USER\\" + explorerDisallowRunKey + "\\"
+	list := make(map[string]string)
+	for name, value := range dumpRegistry(t, reg) {
+		if strings.HasPrefix(name, prefix) {
+			list[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return list
+}
+
+func TestDisallowRunKeepsExistingEntries(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	key.SetStringValue("1", "notepad.exe")
+	key.SetStringValue("2", "PowerShell.exe")
+	key.SetStringValue("6", "regedit.exe")
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	for _, subject := range []HardenInterface{PowerShell, Cmd} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+		if !subject.IsHardened() {
+			t.Errorf("%s is not hardened", subject.Name())
+		}
+	}
+	expected := map[string]string{"1": "1:notepad.exe", "2": "1:PowerShell.exe",
+		"3": "1:powershell_ise.exe", "4": "1:cmd.exe", "6": "1:regedit.exe"}
+	if list := disallowRunList(t, reg); !reflect.DeepEqual(list, expected) {
+		t.Errorf("DisallowRun list after hardening = %v", list)
+	}
+
+	// Restoring Powershell keeps the existing entries and the policy for
+	// cmd.exe, which moves to the free value name.
+	if err := restoreSubject(PowerShell); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{"1": "1:notepad.exe", "2": "1:PowerShell.exe", "3": "1:cmd.exe",
+		"6": "1:regedit.exe"}
+	if list := disallowRunList(t, reg); !reflect.DeepEqual(list, expected) {
+		t.Errorf("DisallowRun list after restoring %s = %v", PowerShell.Name(), list)
+	}
+	journal, err := loadBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := journal.findState(disallowRunFeaturePrefix + "cmd.exe"); state == nil || state.State != "3" ||
+		state.Subject != Cmd.Name() {
+		t.Errorf("state of cmd.exe = %+v", state)
+	}
+	if !Cmd.IsHardened() {
+		t.Errorf("%s is not hardened anymore", Cmd.Name())
+	}
+
+	if err := restoreSubject(Cmd); err != nil {
+		t.Fatal(err)
+	}
+	after := dumpRegistry(t, reg)
+	deleteBackupJournal(after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestDisallowRunManyExecutables(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	before := dumpRegistry(t, reg)
+
+	subject := &DisallowRunList{shortName: "Many"}
+	for i := 1; i <= 150; i++ {
+		subject.Executables = append(subject.Executables, "tool"+strconv.Itoa(i)+".exe")
+	}
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	list := disallowRunList(t, reg)
+	if len(list) != 150 || list["150"] != "1:tool150.exe" {
+		t.Errorf("DisallowRun list has %d entries, 150 = %q", len(list), list["150"])
+	}
+	if !subject.IsHardened() {
+		t.Error("not hardened")
+	}
+
+	// Removing entries from the middle compacts the list (keeping the
+	// order) and updates the recorded value names.
+	if err := removeDisallowRunEntries([]string{"tool1.exe", "tool75.exe"}); err != nil {
+		t.Fatal(err)
+	}
+	list = disallowRunList(t, reg)
+	_, has149 := list["149"]
+	if len(list) != 148 || has149 || list["1"] != "1:tool2.exe" || list["74"] != "1:tool76.exe" ||
+		list["148"] != "1:tool150.exe" {
+		t.Errorf("DisallowRun list after removal has %d entries: 1 = %q, 74 = %q, 148 = %q",
+			len(list), list["1"], list["74"], list["148"])
+	}
+	journal, err := loadBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := journal.findState(disallowRunFeaturePrefix + "tool150.exe"); state == nil || state.State != "148" {
+		t.Errorf("state of tool150.exe = %+v", state)
+	}
+
+	// Hardening again appends to the list.
+	if err := addDisallowRunEntries([]string{"tool75.exe"}); err != nil {
+		t.Fatal(err)
+	}
+	if list = disallowRunList(t, reg); list["149"] != "1:tool75.exe" {
+		t.Errorf("DisallowRun entry 149 = %q", list["149"])
+	}
+
+	if err := restoreSubject(subject); err != nil {
+		t.Fatal(err)
+	}
+	after := dumpRegistry(t, reg)
+	deleteBackupJournal(after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestDisallowRunLegacyRestore(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	// Hardened by an older version that did not record its entries.
+	key, _, _ := reg.CreateKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	key.SetStringValue("1", "powershell_ise.exe")
+	key.SetStringValue("2", "powershell.exe")
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCU, explorerPoliciesKey, keyAllAccess)
+	key.SetDWordValue("DisallowRun", 1)
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	key.SetStringValue(legacyStateNonRegPrefix+"Example", "1")
+	key.Close()
+
+	if err := hardenOrRestoreSubject(PowerShell, false); err != nil {
+		t.Fatal(err)
+	}
+	if list := disallowRunList(t, reg); len(list) != 0 {
+		t.Errorf("DisallowRun list after legacy restore = %v", list)
+	}
+	if key, err := reg.OpenKey(HKCU, explorerPoliciesKey, keyRead); err == nil {
+		if _, _, err := key.GetIntegerValue("DisallowRun"); err != errRegistryNotExist {
+			t.Errorf("DisallowRun flag has not been deleted: %v", err)
+		}
+		key.Close()
+	}
+}
@@ -17,9 +17,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-
-	"golang.org/x/sys/windows/registry"
+	"strings"
 )
 
 // What better not to disable:
@@ -115,7 +115,7 @@ func (explAssoc ExplorerAssociations) Harden(harden bool) error {
 		for _, extension := range explAssoc.extensions {
 			var openWithProgidsDoesNotExist = false
 			regKeyString := fmt.Sprintf("SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FileExts\\%s\\OpenWithProgids", extension.ext)
-			regKey, err := registry.OpenKey(registry.CURRENT_USER, regKeyString, registry.ALL_ACCESS)
+			regKey, err := registryBackend.OpenKey(HKCU, regKeyString, keyAllAccess)
 			if err != nil {
 				Trace.Println("Could not open: CURRENT_USER\\", regKeyString)
 
@@ -123,8 +123,9 @@ func (explAssoc ExplorerAssociations) Harden(harden bool) error {
 				// that this does not exist for different extensions;
 				// just remember this for later.
 				openWithProgidsDoesNotExist = true
+			} else {
+				defer regKey.Close()
 			}
-			defer regKey.Close()
 
 			// Step 1: Remove association (system wide default).
 			assocString := fmt.Sprintf("assoc %s=", extension.ext)
@@ -151,6 +152,52 @@ func (explAssoc ExplorerAssociations) Harden(harden bool) error {
 	return nil
 }
 
+// Plan returns the association changes and user associations that Harden
+// would remove or restore.
+func (explAssoc ExplorerAssociations) Plan(harden bool) ([]plannedOperation, error) {
+	var operations []plannedOperation
+
+	for _, extension := range explAssoc.extensions {
+		current := "(none)"
+		out, err := executeCommand("cmd.exe", "/E:ON", "/C", "assoc "+extension.ext)
+		if err == nil {
+			current = strings.TrimSpace(out)
+			current = current[strings.Index(current, "=")+1:]
+		}
+
+		operation := plannedOperation{Action: "assoc", Target: extension.ext, Current: current}
+		if !harden {
+			operation.New = extension.assoc
+			operations = append(operations, operation)
+			continue
+		}
+		operation.New = "(none)"
+		operations = append(operations, operation)
+
+		// User associations.
+		regKeyString := fmt.Sprintf("SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FileExts\\%s\\OpenWithProgids", extension.ext)
+		regKey, err := registryBackend.OpenKey(HKCU, regKeyString, keyRead)
+		if err != nil {
+			continue
+		}
+		valueNames, _ := regKey.ReadValueNames(100)
+		for _, valueName := range valueNames {
+			current := "REG_NONE"
+			if value, err := readRegistryValue(regKey, valueName); err == nil {
+				current = formatPlannedValue(value)
+			}
+			operations = append(operations, plannedOperation{
+				Action:  "delete",
+				Target:  "CURRENT_USER\\" + regKeyString + "\\" + valueName,
+				Current: current,
+				New:     formatPlannedValue(nil),
+			})
+		}
+		regKey.Close()
+	}
+	return operations, nil
+}
+
 // IsHardened returns true, even if only one extension is hardened (to prevent
 // restore from not being executed), due to errors in hardening quite common.
 func (explAssoc ExplorerAssociations) IsHardened() (isHardened bool) {
@@ -173,6 +220,31 @@ func (explAssoc ExplorerAssociations) IsHardened() (isHardened bool) {
 	return hardened
 }
 
+// Status returns the association status of every extension. Unlike
+// IsHardened, it reports partially hardened if only some extensions are
+// unassociated.
+func (explAssoc ExplorerAssociations) Status() HardenStatus {
+	var children []HardenStatus
+
+	for _, extension := range explAssoc.extensions {
+		child := HardenStatus{Name: extension.ext}
+		out, err := executeCommand("cmd.exe", "/E:ON", "/C", "assoc "+extension.ext)
+		var exitErr *CommandExitError
+		if errors.As(err, &exitErr) {
+			// assoc fails if there is no association.
+			child.State = StateHardened
+		} else if err != nil {
+			child.State = StateUnknown
+			child.Reason = err.Error()
+		} else {
+			child.State = StateNotHardened
+			child.Reason = "associated: " + strings.TrimSpace(out)
+		}
+		children = append(children, child)
+	}
+	return combineHardenStatus(explAssoc.shortName, children)
+}
+
 // Name returns the (short) name of the harden item.
 func (explAssoc ExplorerAssociations) Name() string {
 	return explAssoc.shortName
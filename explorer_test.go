@@ -0,0 +1,69 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestFileAssociationsIsHardened(t *testing.T) {
+	tests := []struct {
+		transcript string
+		hardened   bool
+	}{
+		{"assoc_not_hardened.json", false},
+		{"assoc_hardened.json", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.transcript, func(t *testing.T) {
+			useMemoryRegistry(t)
+			useCommandTranscript(t, test.transcript)
+
+			if hardened := FileAssociations.IsHardened(); hardened != test.hardened {
+				t.Errorf("IsHardened() = %v, expected %v", hardened, test.hardened)
+			}
+		})
+	}
+}
+
+func TestFileAssociationsHarden(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	userAssoc := "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FileExts\\.js\\OpenWithProgids"
+	key, _, _ := reg.CreateKey(HKCU, userAssoc, keyAllAccess)
+	key.SetBinaryValue("JSFile", nil)
+	key.Close()
+
+	useCommandTranscript(t, "assoc_harden.json")
+	if err := FileAssociations.Harden(true); err != nil {
+		t.Fatalf("Harden(true) = %s", err)
+	}
+
+	// User association has been removed.
+	key, _ = reg.OpenKey(HKCU, userAssoc, keyRead)
+	defer key.Close()
+	if names, _ := key.ReadValueNames(0); len(names) != 0 {
+		t.Errorf("user associations left after hardening: %v", names)
+	}
+}
+
+func TestFileAssociationsRestore(t *testing.T) {
+	useMemoryRegistry(t)
+	useCommandTranscript(t, "assoc_restore.json")
+
+	if err := FileAssociations.Harden(false); err != nil {
+		t.Errorf("Harden(false) = %s", err)
+	}
+}
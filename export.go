@@ -0,0 +1,236 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// The registry values of registry based harden subjects can be exported as
+// .reg file and as Group Policy Registry.pol files, so the same
+// configuration can be applied without hardentools. An undo .reg file
+// restores the original values saved in the backup journal.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// registrySetting is a registry value set by a harden subject. Value is nil
+// if the value is deleted. If DeleteKey is set, the whole key is deleted, if
+// CreateKey is set, the key is created (without values); ValueName and Value
+// are unused for both.
+type registrySetting struct {
+	RootKey   RegistryRootKey
+	Path      string
+	ValueName string
+	Value     *registryValue
+	DeleteKey bool
+	CreateKey bool
+}
+
+// String returns the full path of the registry value (or key).
+func (setting registrySetting) String() string {
+	rootKeyName, _ := getRootKeyName(setting.RootKey)
+	if setting.DeleteKey || setting.CreateKey {
+		return rootKeyName + "\\" + setting.Path
+	}
+	return rootKeyName + "\\" + setting.Path + "\\" + setting.ValueName
+}
+
+// RegistrySettingsLister is implemented by harden subjects that only set
+// registry values. RegistrySettings returns all values Harden(true) sets.
+type RegistrySettingsLister interface {
+	RegistrySettings() ([]registrySetting, error)
+}
+
+// getRegistrySettings returns the registry values set by hardenSubject or
+// an error if hardenSubject does more than setting registry values.
+func getRegistrySettings(hardenSubject HardenInterface) ([]registrySetting, error) {
+	lister, ok := hardenSubject.(RegistrySettingsLister)
+	if !ok {
+		return nil, fmt.Errorf("%s does not only set registry values", hardenSubject.Name())
+	}
+	return lister.RegistrySettings()
+}
+
+// isRegistrySubject returns true if hardenSubject only changes registry
+// values below the root keys accepted by accept.
+func isRegistrySubject(hardenSubject HardenInterface, accept func(RegistryRootKey) bool) bool {
+	switch subject := hardenSubject.(type) {
+	case *DisallowRunList:
+		return accept(HKCU)
+	case *MultiHardenInterfaces:
+		for _, member := range subject.hardenInterfaces {
+			if !isRegistrySubject(member, accept) {
+				return false
+			}
+		}
+		return len(subject.hardenInterfaces) > 0
+	}
+
+	settings, err := getRegistrySettings(hardenSubject)
+	if err != nil || len(settings) == 0 {
+		return false
+	}
+	for _, setting := range settings {
+		if !accept(setting.RootKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectExportSubjects sets expertConfig to the harden subjects that should
+// be exported: the hardened ones if the system is hardened, otherwise the
+// ones hardened by default.
+func selectExportSubjects() {
+	hardened := checkStatus()
+	expertConfig = make(map[string]bool)
+	for _, hardenSubject := range allHardenSubjects {
+		if hardened {
+			expertConfig[hardenSubject.Name()] = hardenSubject.IsHardened()
+		} else {
+			expertConfig[hardenSubject.Name()] = hardenSubject.HardenByDefault()
+		}
+	}
+}
+
+// exportSettings returns the registry values of all harden subjects selected
+// in expertConfig. Subjects that don't only set registry values are skipped
+// and returned as errors.
+func exportSettings() (settings []registrySetting, errs []error) {
+	for _, hardenSubject := range allHardenSubjects {
+		if expertConfig[hardenSubject.Name()] == false {
+			continue
+		}
+		subjectSettings, err := getRegistrySettings(hardenSubject)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		settings = append(settings, subjectSettings...)
+	}
+	return settings, errs
+}
+
+// undoSettings returns the original values saved in the backup journal for
+// settings. Values without saved original had the hardened value already
+// before and are left out. Deleted keys are recreated with all their values
+// and subkeys. Created keys are left out, restoring keeps them as well.
+func undoSettings(settings []registrySetting) ([]registrySetting, error) {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	var undo []registrySetting
+	for _, setting := range settings {
+		rootKeyName, err := getRootKeyName(setting.RootKey)
+		if err != nil {
+			return nil, err
+		}
+		if setting.CreateKey {
+			continue
+		}
+		if setting.DeleteKey {
+			if entry := journal.findKeyEntry(rootKeyName, setting.Path); entry != nil {
+				undo = append(undo, setting)
+				undo = append(undo, entry.Key.settings(setting.RootKey, setting.Path)...)
+			}
+			continue
+		}
+		if entry := journal.findEntry(rootKeyName, setting.Path, setting.ValueName); entry != nil {
+			undo = append(undo, registrySetting{RootKey: setting.RootKey, Path: setting.Path,
+				ValueName: setting.ValueName, Value: entry.Original})
+		}
+	}
+	return undo, nil
+}
+
+// cmdExport writes the registry values of the selected harden subjects to
+// the .reg file regFileName, the Group Policy directory polDir and the undo
+// .reg file undoFileName. Empty names are skipped.
+func cmdExport(regFileName, polDir, undoFileName string) {
+	selectHardenSubjects()
+	selectExportSubjects()
+
+	settings, errs := exportSettings()
+	for _, err := range errs {
+		fmt.Println("Skipping " + err.Error())
+	}
+
+	var err error
+	if regFileName != "" {
+		err = os.WriteFile(regFileName, formatRegFile(settings), 0o644)
+		if err == nil {
+			fmt.Printf("Exported %d registry values to %s\n", len(settings), regFileName)
+		}
+	}
+	if err == nil && polDir != "" {
+		err = writeRegistryPolFiles(polDir, settings)
+	}
+	if err == nil && undoFileName != "" {
+		var undo []registrySetting
+		undo, err = undoSettings(settings)
+		if err == nil {
+			err = os.WriteFile(undoFileName, formatRegFile(undo), 0o644)
+		}
+		if err == nil {
+			fmt.Printf("Exported %d original registry values to %s\n", len(undo), undoFileName)
+		}
+	}
+	if err != nil {
+		fmt.Println("Export failed: " + err.Error())
+		os.Exit(-1)
+	}
+	os.Exit(0)
+}
+
+// writeRegistryPolFiles writes the settings below HKEY_LOCAL_MACHINE to
+// Machine\Registry.pol and the ones below HKEY_CURRENT_USER to
+// User\Registry.pol in polDir, which is laid out like a Group Policy Object.
+// Other root keys can't be set by Group Policy and are skipped.
+func writeRegistryPolFiles(polDir string, settings []registrySetting) error {
+	policySettings := map[RegistryRootKey][]registrySetting{}
+	for _, setting := range settings {
+		switch setting.RootKey {
+		case HKLM, HKCU:
+			policySettings[setting.RootKey] = append(policySettings[setting.RootKey], setting)
+		default:
+			fmt.Printf("Skipping %s in Registry.pol, only HKEY_LOCAL_MACHINE and HKEY_CURRENT_USER are supported\n", setting)
+		}
+	}
+
+	scopes := []struct {
+		rootKey RegistryRootKey
+		dir     string
+	}{{HKLM, "Machine"}, {HKCU, "User"}}
+	for _, scope := range scopes {
+		rootKey := scope.rootKey
+		if len(policySettings[rootKey]) == 0 {
+			continue
+		}
+		dir := filepath.Join(polDir, scope.dir)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		fileName := filepath.Join(dir, "Registry.pol")
+		if err := os.WriteFile(fileName, formatRegistryPol(policySettings[rootKey]), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d registry values to %s\n", len(policySettings[rootKey]), fileName)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatRegFile(t *testing.T) {
+	settings := []registrySetting{
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Enabled", Value: dwordValue(0xb5)},
+		{RootKey: HKLM, Path: "SOFTWARE\\Policies\\Example", ValueName: "Flags", Value: dwordValue(1)},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Path", Value: stringValue("C:\\Program Files\\\"Example\"")},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "", Value: stringValue("default")},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Expand", Value: &registryValue{Type: regExpandSZ, Str: "%ProgramFiles%\\Example\\Example.exe"}},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Extensions", Value: &registryValue{Type: regMultiSZ, Strings: []string{".exe", ".js"}}},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Quota", Value: &registryValue{Type: regQWORD, Integer: 1 << 40}},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Key", Value: &registryValue{Type: regBinary, Binary: bytes.Repeat([]byte{0xab}, 40)}},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Legacy", Value: nil},
+	}
+	data := formatRegFile(settings)
+	if !bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		t.Errorf("missing UTF-16LE BOM")
+	}
+
+	file, err := parseRegFile("export.reg", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Keys) != 2 || file.Keys[0].Path != "Software\\Example" || file.Keys[1].RootKey != HKLM {
+		t.Fatalf("parsed keys %+v", file.Keys)
+	}
+	var parsed []registrySetting
+	for _, key := range file.Keys {
+		for _, value := range key.Values {
+			parsed = append(parsed, registrySetting{RootKey: key.RootKey, Path: key.Path,
+				ValueName: value.Name, Value: value.Value})
+		}
+	}
+	expected := append([]registrySetting{settings[0]}, settings[2:]...)
+	expected = append(expected, settings[1])
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("parsed:\n%v\nexpected:\n%v", parsed, expected)
+	}
+
+	text := decodeRegFileText(data)
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > 80 {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+}
+
+func TestFormatRegistryPol(t *testing.T) {
+	data := formatRegistryPol([]registrySetting{
+		{RootKey: HKLM, Path: "Software\\A", ValueName: "B", Value: dwordValue(2)},
+		{RootKey: HKLM, Path: "Software\\A", ValueName: "C", Value: nil},
+	})
+
+	utf16 := func(s string) []byte { return encodeUTF16LE(s) }
+	dword := func(i uint32) []byte { return binary.LittleEndian.AppendUint32(nil, i) }
+	var expected []byte
+	for _, part := range [][]byte{
+		[]byte("PReg"), dword(1),
+		utf16("[Software\\A\x00;B\x00;"), dword(regDWORD), utf16(";"), dword(4), utf16(";"), dword(2), utf16("]"),
+		utf16("[Software\\A\x00;**del.C\x00;"), dword(regSZ), utf16(";"), dword(4), utf16(";"), utf16(" \x00"), utf16("]"),
+	} {
+		expected = append(expected, part...)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("formatRegistryPol:\n% x\nexpected:\n% x", data, expected)
+	}
+}
+
+func TestFormatKeyDeletion(t *testing.T) {
+	settings := []registrySetting{
+		{RootKey: HKCR, Path: "ms-msdt", DeleteKey: true},
+		{RootKey: HKCU, Path: "Software\\Example\\Old", DeleteKey: true},
+		{RootKey: HKCU, Path: "Software\\Example", ValueName: "Enabled", Value: dwordValue(0)},
+	}
+
+	file, err := parseRegFile("export.reg", formatRegFile(settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Keys) != 3 || !file.Keys[0].Delete || file.Keys[0].RootKey != HKCR ||
+		!file.Keys[1].Delete || file.Keys[1].Path != "Software\\Example\\Old" || file.Keys[2].Delete {
+		t.Errorf("parsed keys %+v", file.Keys)
+	}
+
+	// The data of **DeleteKeys is the subkey relative to the entry's key.
+	data := formatRegistryPol([]registrySetting{
+		settings[1],
+		{RootKey: HKCU, Path: "Example", DeleteKey: true},
+		{RootKey: HKCU, Path: "Software\\Example\\Empty", CreateKey: true},
+	})
+	utf16 := func(s string) []byte { return encodeUTF16LE(s) }
+	dword := func(i uint32) []byte { return binary.LittleEndian.AppendUint32(nil, i) }
+	var expected []byte
+	for _, part := range [][]byte{
+		[]byte("PReg"), dword(1),
+		utf16("[Software\\Example\x00;**DeleteKeys\x00;"), dword(regSZ), utf16(";"), dword(8), utf16(";"),
+		utf16("Old\x00"), utf16("]"),
+		utf16("[\x00;**DeleteKeys\x00;"), dword(regSZ), utf16(";"), dword(16), utf16(";"),
+		utf16("Example\x00"), utf16("]"),
+		utf16("[Software\\Example\\Empty\x00;\x00;"), dword(regNone), utf16(";"), dword(0), utf16(";"), utf16("]"),
+	} {
+		expected = append(expected, part...)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("formatRegistryPol:\n% x\nexpected:\n% x", data, expected)
+	}
+}
+
+func TestExportSettings(t *testing.T) {
+	useSubjects(t, OfficeOLE, Cmd, AdobePDFJS)
+
+	settings, errs := exportSettings()
+	officeValues := len(standardOfficeVersions) * len(standardOfficeApps)
+	if len(settings) != officeValues+len(standardAdobeProducts)*len(standardAdobeVersions) {
+		t.Errorf("exported %d settings: %v", len(settings), settings)
+	}
+	if settings[0].String() != "CURRENT_USER\\SOFTWARE\\Microsoft\\Office\\"+standardOfficeVersions[0]+"\\Excel\\Security\\PackagerPrompt" ||
+		!settings[0].Value.Equal(dwordValue(2)) {
+		t.Errorf("first exported setting %s = %v", settings[0], settings[0].Value)
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), Cmd.Name()+" ") {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestUndoSettings(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	before := dumpRegistry(t, reg)
+	useSubjects(t, WSH, OfficeMacros, ShowFileExt)
+	for _, subject := range allHardenSubjects {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings, errs := exportSettings()
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	undo, err := undoSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undo) == 0 || undo[0].String() != "CURRENT_USER\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled" ||
+		!undo[0].Value.Equal(dwordValue(1)) {
+		t.Errorf("undo settings %v", undo)
+	}
+
+	// Applying the undo .reg file restores the values before hardening.
+	file, err := parseRegFile("undo.reg", formatRegFile(undo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := regFileSubject("undo.reg", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := subject.Harden(true); err != nil {
+		t.Fatal(err)
+	}
+	restored := dumpRegistry(t, reg)
+	deleteBackupJournal(restored)
+	if !reflect.DeepEqual(restored, before) {
+		t.Errorf("registry after undo:\n%v\nexpected:\n%v", restored, before)
+	}
+}
+
+func TestUndoDeletedKey(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Example\\Old", keyAllAccess)
+	key.SetDWordValue("Enabled", 1)
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCU, "Software\\Example\\Old\\Empty", keyAllAccess)
+	key.Close()
+
+	subject := &RegistryKeyAbsent{RootKey: HKCU, Path: "Software\\Example\\Old", shortName: "Old"}
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	settings, _ := subject.RegistrySettings()
+	undo, err := undoSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying the undo .reg file recreates the key including its empty
+	// subkey.
+	file, err := parseRegFile("undo.reg", formatRegFile(undo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	undoSubject, err := regFileSubject("undo.reg", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := undoSubject.Harden(true); err != nil {
+		t.Fatal(err)
+	}
+	if !registryKeyExists(HKCU, "Software\\Example\\Old\\Empty") {
+		t.Errorf("empty subkey has not been recreated, undo settings %v", undo)
+	}
+	if value := dumpRegistry(t, reg)["CURRENT_USER\\Software\\Example\\Old\\Enabled"]; value != "4:1" {
+		t.Errorf("Enabled = %q after undo", value)
+	}
+}
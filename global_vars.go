@@ -16,7 +16,45 @@
 
 package main
 
-import "log"
+import (
+	"log"
+	"slices"
+)
+
+// Registry based harden subjects defined in the embedded subject definition
+// files (see subject_definitions.go).
+var (
+	WSH                                   = embeddedSubject("WSH")
+	OfficeOLE                             = embeddedSubject("Office OLE")
+	OfficeMacros                          = embeddedSubject("Office Macros")
+	OfficeActiveX                         = embeddedSubject("Office ActiveX")
+	OfficeDDE                             = embeddedSubject("Office DDE")
+	AdobePDFJS                            = embeddedSubject("Adobe JavaScript")
+	AdobePDFObjects                       = embeddedSubject("Adobe Objects")
+	AdobePDFProtectedMode                 = embeddedSubject("Adobe Protected Mode")
+	AdobePDFProtectedView                 = embeddedSubject("Adobe Protected View")
+	AdobePDFEnhancedSecurity              = embeddedSubject("Adobe Enhanced Security")
+	AdobePDFLockdown                      = embeddedSubject("Adobe Lockdown")
+	ShowFileExt                           = embeddedSubject("Show File Ext")
+	OneNoteBlockExtensions                = embeddedSubject("OneNote Attachments")
+	Autorun                               = embeddedSubject("Autorun")
+	PowerShell                            = embeddedSubject("Powershell")
+	Cmd                                   = embeddedSubject("Disable cmd.exe")
+	PowerShellMachineWide                 = embeddedSubject("Powershell machine-wide")
+	CmdMachineWide                        = embeddedSubject("Disable cmd.exe machine-wide")
+	UAC                                   = embeddedSubject("UAC")
+	LSA                                   = embeddedSubject("LSA")
+	PUA                                   = embeddedSubject("PUA Protection")
+	LibreOfficeMacroSecurityLevel         = embeddedSubject("LibreOffice Macro Security")
+	LibreOfficeHyperlinksWithCtrlClick    = embeddedSubject("LibreOffice Ctrl-Click Hyperlinks")
+	LibreOfficeBlockUntrustedRefererLinks = embeddedSubject("LibreOffice Block Untrusted Referer Links")
+	LibreOfficeUpdateCheck                = embeddedSubject("LibreOffice Enforce Update Checks")
+	LibreOfficeDisableUpdateLink          = embeddedSubject("LibreOffice Disable Links")
+)
+
+// LOLBins contains a harden subject for every binary of the LOLBin catalog
+// (see lolbins.go).
+var LOLBins = lolbinSubjects()
 
 // allHardenSubjects contains all top level harden subjects that should
 // be considered.
@@ -35,7 +73,8 @@ var hardenSubjectsForUnprivilegedUsers = []HardenInterface{
 	ShowFileExt,
 	OneNoteBlockExtensions,
 }
-var hardenSubjectsForPrivilegedUsers = append(hardenSubjectsForUnprivilegedUsers, []HardenInterface{
+var hardenSubjectsForPrivilegedUsers = slices.Concat(hardenSubjectsForUnprivilegedUsers, []HardenInterface{
+	AdobePDFLockdown,
 	Autorun,
 	PowerShell,
 	Cmd,
@@ -50,12 +89,39 @@ var hardenSubjectsForPrivilegedUsers = append(hardenSubjectsForUnprivilegedUsers
 	LibreOfficeUpdateCheck,
 	LibreOfficeDisableUpdateLink,
 	Recall,
-}...)
+}, LOLBins, []HardenInterface{
+	// The Image File Execution Options blocks of cmd.exe and PowerShell.exe
+	// are hardened last and restored first (see triggerAll), as they also
+	// apply to the commands executed by other harden subjects.
+	PowerShellMachineWide,
+	CmdMachineWide,
+})
 
 var expertConfig map[string]bool
 
+// hardentoolsVersion is the version of hardentools. It is set when building
+// a release with -ldflags "-X main.hardentoolsVersion=...".
+var hardentoolsVersion = "dev"
+
+// atomicHardening is set if all harden subjects of a run should be rolled
+// back if one of them fails.
+var atomicHardening bool
+
+// dryRunMode is set if harden or restore should only list the planned
+// changes instead of applying them.
+var dryRunMode bool
+
+// hardenSubjectNames contains the names of the harden subjects that should
+// be hardened instead of the default ones.
+var hardenSubjectNames []string
+
+// restoreSubjectNames contains the names of the harden subjects that should
+// be restored if not everything should be restored.
+var restoreSubjectNames []string
+
 // Loggers for log output (we only need info and trace, errors have to be
-// displayed in the GUI).
+// displayed in the GUI). They log to the slog handler set up by initLogging
+// (see logging.go).
 var (
 	Trace *log.Logger // set this logger to get trace level verbosity logging output
 	Info  *log.Logger // set this logger to get standard logging output
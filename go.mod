@@ -4,13 +4,13 @@ go 1.24.6
 
 require (
 	fyne.io/fyne/v2 v2.6.2
+	github.com/BurntSushi/toml v1.4.0
 	github.com/akavel/rsrc v0.10.2
 	golang.org/x/sys v0.35.0
 )
 
 require (
 	fyne.io/systray v1.11.0 // indirect
-	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
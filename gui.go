@@ -61,11 +61,7 @@ func createMainGUIContent(elevationStatus bool) {
 	var mainWindowContainer *fyne.Container
 
 	// Check if we are running with elevated rights.
-	if elevationStatus == false {
-		allHardenSubjects = hardenSubjectsForUnprivilegedUsers
-	} else {
-		allHardenSubjects = hardenSubjectsForPrivilegedUsers
-	}
+	allHardenSubjects = hardenSubjectsFor(elevationStatus)
 
 	// Check hardening status.
 	var status = checkStatus()
@@ -74,26 +70,30 @@ func createMainGUIContent(elevationStatus bool) {
 	expertConfig = make(map[string]bool)
 	expertCompWidgetArray := make([]*fyne.Container, len(allHardenSubjects))
 
+	var owners map[string]bool
+	if status {
+		owners = journalOwners()
+	}
 	for i, hardenSubject := range allHardenSubjects {
-		var subjectIsHardened = hardenSubject.IsHardened()
 		var enableField bool
 
 		if status == false {
+			var subjectIsHardened = hardenSubject.IsHardened()
+
 			// All checkboxes checked by default, disabled only if subject is already hardened.
 			expertConfig[hardenSubject.Name()] = !subjectIsHardened && hardenSubject.HardenByDefault()
 
 			// Only enable, if not already hardened.
 			enableField = !subjectIsHardened
 		} else {
-			// Restore: only checkboxes checked which are hardened.
-			expertConfig[hardenSubject.Name()] = subjectIsHardened
-
-			// Disable all, since the user must restore all settings because otherwise
-			// consecutive execution of hardentools might fail (e.g. starting powershell
-			// or cmd commands) or might be ineffectiv (settings are already hardened) or
-			// hardened settings might get saved as "before" settings, so user
-			// can't revert to the state "before".
-			enableField = false
+			// Restore: all checkboxes checked which are (partially)
+			// hardened or have saved values.
+			expertConfig[hardenSubject.Name()] = needsRestore(hardenSubject, owners)
+
+			// These settings can be deselected to keep them hardened.
+			// Their saved original values are kept, so they can still be
+			// restored later.
+			enableField = expertConfig[hardenSubject.Name()]
 		}
 
 		// setup check box widget
@@ -130,7 +130,7 @@ func createMainGUIContent(elevationStatus bool) {
 		buttonText = "Restore..."
 		buttonFunc = restoreAll
 		labelText = "We have already hardened some risky features.\nDo you want to restore them?"
-		expertSettingsText = "The following hardened features are going to be restored:"
+		expertSettingsText = "The following hardened features are going to be restored.\nDeselected features stay hardened:"
 		enableHardenAdditionalButton = true
 	}
 
@@ -372,33 +372,15 @@ func ShowFailure(name, failureText string) {
 	}
 }
 
-// ShowIsHardened sets GUI result for name to is hardened
-func ShowIsHardened(name string) {
-	label := stateLabels[name]
-	if label != nil {
-		fyne.Do(func() {
-			label.SetText("is hardened")
-		})
-	} else {
-		stateLabels[name] = widget.NewLabel("is hardened")
-
-		fyne.Do(func() {
-			firstColumn.Add(container.NewHBox(widget.NewLabel(name)))
-			secondColumn.Add(container.NewHBox(widget.NewLabel("not selected")))
-			thirdColumn.Add(container.NewHBox(stateLabels[name]))
-		})
-	}
-}
-
-// ShowNotHardened sets GUI result for name to not hardened
-func ShowNotHardened(name string) {
+// ShowStatus sets GUI result for name to status
+func ShowStatus(name string, status HardenStatus) {
 	label := stateLabels[name]
 	if label != nil {
 		fyne.Do(func() {
-			label.SetText("not hardened")
+			label.SetText(status.String())
 		})
 	} else {
-		stateLabels[name] = widget.NewLabel("not hardened")
+		stateLabels[name] = widget.NewLabel(status.String())
 
 		fyne.Do(func() {
 			firstColumn.Add(container.NewHBox(widget.NewLabel(name)))
@@ -443,12 +425,27 @@ func restoreAll() {
 
 	// Use goroutine to allow gui to update window.
 	go func() {
+		completeRestore := isCompleteRestore()
+		markRestoring(true)
 		triggerAll(false)
-		restoreSavedRegistryKeys() // TODO: add error handling/visibility to user
-		markStatus(false)
+		if completeRestore {
+			// Values that could not be restored stay in the backup
+			// journal, so the system stays marked as hardened.
+			if err := restoreSavedRegistryKeys(); err != nil {
+				ShowFailure("Restore saved registry values", err.Error())
+				showErrorDialog("Some settings could not be restored, please restore again: " + err.Error())
+			} else {
+				markStatus(false)
+			}
+		}
+		markRestoring(false)
 		showStatus()
 
-		showEndDialog("Done! Restored settings to their original state.\nFor all changes to take effect please restart Windows.")
+		if completeRestore {
+			showEndDialog("Done! Restored settings to their original state.\nFor all changes to take effect please restart Windows.")
+		} else {
+			showEndDialog("Done! Restored selected settings to their original state, all others stay hardened.\nFor all changes to take effect please restart Windows.")
+		}
 		os.Exit(0)
 	}()
 }
@@ -461,9 +458,16 @@ func hardenDefaultsAgain() {
 	// Use goroutine to allow gui to update window.
 	go func() {
 		// Restore hardened settings.
+		markRestoring(true)
 		triggerAll(false)
-		restoreSavedRegistryKeys()
-		markStatus(false)
+		if err := restoreSavedRegistryKeys(); err != nil {
+			// The values that could not be restored are kept in the
+			// backup journal and hardening keeps them.
+			ShowFailure("Restore saved registry values", err.Error())
+		} else {
+			markStatus(false)
+		}
+		markRestoring(false)
 
 		// Reset expertConfig (is set to currently already hardened settings
 		// in case of restore).
@@ -16,6 +16,8 @@
 
 package main
 
+import "fmt"
+
 // HardenInterface is the general interface which should be used for every
 // harden subject.
 type HardenInterface interface {
@@ -37,8 +39,12 @@ type MultiHardenInterfaces struct {
 }
 
 // Harden hardens (if harden == true) or restores (if harden == false)
-// MultiHardenInterfaces.
+// MultiHardenInterfaces. Hardening is done in a transaction, so either all
+// or none of the members are hardened.
 func (mhInterfaces *MultiHardenInterfaces) Harden(harden bool) error {
+	if harden {
+		return hardenTransactionally(mhInterfaces.hardenInterfaces)
+	}
 	for _, mhInterface := range mhInterfaces.hardenInterfaces {
 		err := mhInterface.Harden(harden)
 		if err != nil {
@@ -50,15 +56,30 @@ func (mhInterfaces *MultiHardenInterfaces) Harden(harden bool) error {
 
 // IsHardened verifies if all MultiHardenInterfaces members are hardened.
 func (mhInterfaces *MultiHardenInterfaces) IsHardened() bool {
-	var hardened = true
+	return mhInterfaces.Status().State == StateHardened
+}
 
+// Status returns the combined status of all MultiHardenInterfaces members.
+func (mhInterfaces *MultiHardenInterfaces) Status() HardenStatus {
+	var children []HardenStatus
 	for _, mhInterface := range mhInterfaces.hardenInterfaces {
-		if !mhInterface.IsHardened() {
-			hardened = false
-		}
+		children = append(children, getHardenStatus(mhInterface))
 	}
+	return combineHardenStatus(mhInterfaces.shortName, children)
+}
 
-	return hardened
+// RegistrySettings returns the registry values set by all members. It fails
+// if a member does more than setting registry values.
+func (mhInterfaces *MultiHardenInterfaces) RegistrySettings() ([]registrySetting, error) {
+	var settings []registrySetting
+	for _, mhInterface := range mhInterfaces.hardenInterfaces {
+		memberSettings, err := getRegistrySettings(mhInterface)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mhInterfaces.shortName, err)
+		}
+		settings = append(settings, memberSettings...)
+	}
+	return settings, nil
 }
 
 // Name returns the (short) name of the harden item.
@@ -0,0 +1,525 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// registryOnlySubjects contains all harden subjects that only use the
+// registry (and can therefore be tested with the in-memory registry).
+var registryOnlySubjects = append([]HardenInterface{
+	WSH,
+	OfficeOLE,
+	OfficeMacros,
+	OfficeActiveX,
+	OfficeDDE,
+	AdobePDFJS,
+	AdobePDFObjects,
+	AdobePDFProtectedMode,
+	AdobePDFProtectedView,
+	AdobePDFEnhancedSecurity,
+	ShowFileExt,
+	OneNoteBlockExtensions,
+	AdobePDFLockdown,
+	Autorun,
+	PowerShell,
+	Cmd,
+	PowerShellMachineWide,
+	CmdMachineWide,
+	UAC,
+	LSA,
+	PUA,
+	LibreOfficeMacroSecurityLevel,
+	LibreOfficeHyperlinksWithCtrlClick,
+	LibreOfficeBlockUntrustedRefererLinks,
+	LibreOfficeUpdateCheck,
+	LibreOfficeDisableUpdateLink,
+}, LOLBins...)
+
+// seedRegistry creates some values that already exist before hardening.
+func seedRegistry(t *testing.T, reg *memoryRegistry) {
+	t.Helper()
+	setDWORD := func(rootKey RegistryRootKey, path, name string, value uint32) {
+		key, _, err := reg.CreateKey(rootKey, path, keyAllAccess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer key.Close()
+		key.SetDWordValue(name, value)
+	}
+	setSZ := func(rootKey RegistryRootKey, path, name string, value string) {
+		key, _, err := reg.CreateKey(rootKey, path, keyAllAccess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer key.Close()
+		key.SetStringValue(name, value)
+	}
+
+	setDWORD(HKCU, "SOFTWARE\\Microsoft\\Windows Script Host\\Settings", "Enabled", 1)
+	setDWORD(HKCU, "SOFTWARE\\Microsoft\\Office\\16.0\\Word\\Security", "VBAWarnings", 2)
+	setSZ(HKLM, appPathsKey+"\\winword.exe", "", "C:\\Program Files\\Microsoft Office\\root\\Office16\\WINWORD.EXE")
+	setSZ(HKLM, appPathsKey+"\\onenote.exe", "", "C:\\Program Files\\Microsoft Office\\root\\Office16\\ONENOTE.EXE")
+	setDWORD(HKCU, "SOFTWARE\\Adobe\\Acrobat Reader\\DC\\JSPrefs", "bEnableJS", 1)
+	setSZ(HKLM, "SOFTWARE\\WOW6432Node\\Adobe\\Acrobat Reader\\DC\\InstallPath", "", "C:\\Program Files (x86)\\Adobe\\Acrobat Reader DC\\Reader")
+	setDWORD(HKCU, "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced", "HideFileExt", 1)
+	setDWORD(HKCU, explorerPoliciesKey, "DisallowRun", 1)
+	setSZ(HKCU, explorerDisallowRunKey, "1", "notepad.exe")
+	setDWORD(HKLM, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Policies\\System", "ConsentPromptBehaviorAdmin", 5)
+	setSZ(HKLM, "SOFTWARE\\Policies\\LibreOffice\\org.openoffice.Office.Common\\Security\\Scripting\\MacroSecurityLevel", "Value", "2")
+}
+
+// restoreForTest restores a harden subject the same way cmdHardenRestore does.
+func restoreForTest(t *testing.T, subject HardenInterface) {
+	t.Helper()
+	if err := hardenOrRestoreSubject(subject, false); err != nil {
+		t.Errorf("restore failed: %s", err)
+	}
+	if err := restoreSavedRegistryKeys(); err != nil {
+		t.Errorf("restoreSavedRegistryKeys failed: %s", err)
+	}
+	markStatus(false)
+}
+
+// deleteBackupJournal removes the backup journal from values returned by
+// dumpRegistry.
+func deleteBackupJournal(values map[string]string) {
+	for name := range values {
+		if strings.HasSuffix(name, "\\"+backupJournalValueName) {
+			delete(values, name)
+		}
+	}
+}
+
+func TestHardenRestoreRoundTrip(t *testing.T) {
+	for _, subject := range registryOnlySubjects {
+		t.Run(subject.Name(), func(t *testing.T) {
+			reg := useMemoryRegistry(t)
+			seedRegistry(t, reg)
+			before := dumpRegistry(t, reg)
+
+			if subject.IsHardened() {
+				t.Fatal("subject is hardened before hardening")
+			}
+
+			if err := hardenOrRestoreSubject(subject, true); err != nil {
+				t.Fatalf("harden failed: %s", err)
+			}
+			markStatus(true)
+
+			journal, err := loadBackupJournal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range journal.Records {
+				if entry.Subject != subject.Name() {
+					t.Errorf("%s is owned by %q", entry, entry.Subject)
+				}
+			}
+
+			if !subject.IsHardened() {
+				t.Error("subject is not hardened after hardening")
+			}
+			if !checkStatus() {
+				t.Error("hardentools status is not set after hardening")
+			}
+
+			restoreForTest(t, subject)
+
+			if subject.IsHardened() {
+				t.Error("subject is still hardened after restore")
+			}
+			if checkStatus() {
+				t.Error("hardentools status is still set after restore")
+			}
+			after := dumpRegistry(t, reg)
+			if !reflect.DeepEqual(before, after) {
+				t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+			}
+		})
+	}
+}
+
+func TestHardenWithoutPrivileges(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	reg.SetAccessDenied(HKLM, "", true)
+
+	if err := UAC.Harden(true); err == nil {
+		t.Error("hardening HKLM without privileges did not fail")
+	}
+	if err := WSH.Harden(true); err != nil {
+		t.Errorf("hardening HKCU failed: %s", err)
+	}
+}
+
+func TestSelectiveRestore(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	before := dumpRegistry(t, reg)
+	useSubjects(t, WSH, Cmd, ShowFileExt)
+
+	if err := triggerAll(true); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(true)
+
+	restoreSubjectNames = []string{" " + strings.ToUpper(Cmd.Name())}
+	defer func() { restoreSubjectNames = nil }()
+	if err := selectRestoreSubjects(); err != nil {
+		t.Fatal(err)
+	}
+	if isCompleteRestore() {
+		t.Fatal("restoring a single subject is a complete restore")
+	}
+	if err := triggerAll(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if Cmd.IsHardened() {
+		t.Errorf("%s is still hardened", Cmd.Name())
+	}
+	if !WSH.IsHardened() || !ShowFileExt.IsHardened() || !checkStatus() {
+		t.Error("subjects that have not been selected are not hardened anymore")
+	}
+	journal, err := loadBackupJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := make(map[string]int)
+	for _, entry := range journal.Records {
+		owners[entry.Subject]++
+	}
+	if owners[Cmd.Name()] != 0 || owners[WSH.Name()] != 1 || owners[ShowFileExt.Name()] != 3 {
+		t.Errorf("journal owners after selective restore = %v", owners)
+	}
+
+	// Restoring everything else restores the original state.
+	expertConfig = map[string]bool{WSH.Name(): true, ShowFileExt.Name(): true}
+	if !isCompleteRestore() {
+		t.Fatal("restoring all hardened subjects is not a complete restore")
+	}
+	if err := triggerAll(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreSavedRegistryKeys(); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(false)
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+
+	restoreSubjectNames = []string{"no such subject"}
+	if err := selectRestoreSubjects(); err == nil {
+		t.Error("unknown subject has been selected")
+	}
+}
+
+func TestRestoreDriftedSubject(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	before := dumpRegistry(t, reg)
+	useSubjects(t, WSH, UAC, Cmd)
+	expertConfig[Cmd.Name()] = false
+
+	if err := triggerAll(true); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(true)
+
+	// Changed after hardening, UAC is only partially hardened now.
+	key, _ := reg.OpenKey(HKLM, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Policies\\System", keyAllAccess)
+	key.SetDWordValue("EnableLUA", 0)
+	key.Close()
+
+	expertConfig = defaultExpertConfig(checkStatus())
+	expected := map[string]bool{WSH.Name(): true, UAC.Name(): true, Cmd.Name(): false}
+	if !reflect.DeepEqual(expertConfig, expected) {
+		t.Fatalf("restore selection = %v, expected %v", expertConfig, expected)
+	}
+	if !isCompleteRestore() {
+		t.Fatal("restoring all subjects is not a complete restore")
+	}
+	if err := triggerAll(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreSavedRegistryKeys(); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(false)
+
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+	if checkStatus() {
+		t.Error("still marked as hardened after restore")
+	}
+}
+
+func TestHardenTypeChange(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Example", keyAllAccess)
+	key.SetStringValue("Enabled", "0")
+	key.SetStringValue("Extensions", ".exe")
+	key.SetDWordValue("Quota", 5)
+	key.SetExpandStringValue("Signature", "%TEMP%")
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	subject := &RegistryMultiValue{
+		ArraySingleDWORD: []*RegistrySingleValueDWORD{{RootKey: HKCU, Path: "Software\\Example", ValueName: "Enabled"}},
+		ArraySingleValue: []*RegistrySingleValue{
+			{RootKey: HKCU, Path: "Software\\Example", ValueName: "Extensions", HardenedValue: multiStringValue(".exe", ".js")},
+			{RootKey: HKCU, Path: "Software\\Example", ValueName: "Quota", HardenedValue: qwordValue(5)},
+			{RootKey: HKCU, Path: "Software\\Example", ValueName: "Signature", HardenedValue: binaryValue([]byte{0xde, 0xad})},
+			{RootKey: HKCU, Path: "Software\\Example", ValueName: "Path", HardenedValue: expandStringValue("%ProgramFiles%")},
+		},
+		shortName: "Types",
+	}
+
+	status := getHardenStatus(subject)
+	if status.State != StateNotHardened || len(status.Children) != 5 ||
+		status.Children[0].Reason != "is REG_SZ 0, hardened value is REG_DWORD 0" ||
+		status.Children[2].Reason != "is REG_DWORD 5, hardened value is REG_QWORD 5" {
+		t.Errorf("status before hardening = %s %v", status, status.Children)
+	}
+
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	if !subject.IsHardened() {
+		t.Errorf("status after hardening = %s", getHardenStatus(subject))
+	}
+	after := dumpRegistry(t, reg)
+	for name, expected := range map[string]string{
+		"Enabled":    "4:0",
+		"Extensions": `7:[".exe" ".js"]`,
+		"Quota":      "11:5",
+		"Signature":  "3:dead",
+		"Path":       "2:%ProgramFiles%",
+	} {
+		if value := after["CURRENT_USER\\Software\\Example\\"+name]; value != expected {
+			t.Errorf("%s = %q after hardening, expected %q", name, value, expected)
+		}
+	}
+
+	restoreForTest(t, subject)
+	if restored := dumpRegistry(t, reg); !reflect.DeepEqual(before, restored) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, restored)
+	}
+}
+
+func TestHardenKeyAbsent(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCR, "ms-msdt\\shell\\open\\command", keyAllAccess)
+	key.SetExpandStringValue("", "%SystemRoot%\\system32\\msdt.exe %1")
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCR, "ms-msdt", keyAllAccess)
+	key.SetStringValue("", "URL:ms-msdt")
+	key.SetStringValue("URL Protocol", "")
+	key.SetBinaryValue("EditFlags", []byte{0x00, 0x00, 0x20, 0x00})
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCR, "ms-msdt\\DefaultIcon", keyAllAccess)
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	subject := &RegistryKeyAbsent{RootKey: HKCR, Path: "ms-msdt", shortName: "MSDT"}
+	if status := getHardenStatus(subject); status.State != StateNotHardened || status.Reason != "exists" {
+		t.Errorf("status before hardening = %s", status)
+	}
+	lines := planLines(planSingleSubject(subject, true), "MSDT")
+	if len(lines) != 5 || lines[4] != "delete key CLASSES_ROOT\\ms-msdt" || !registryKeyExists(HKCR, "ms-msdt\\shell") {
+		t.Errorf("planned %v", lines)
+	}
+
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	if registryKeyExists(HKCR, "ms-msdt") || !subject.IsHardened() {
+		t.Error("key has not been deleted")
+	}
+	journal, _ := loadBackupJournal()
+	if entry := journal.findKeyEntry("CLASSES_ROOT", "ms-msdt"); entry == nil ||
+		len(entry.Key.Values) != 3 || len(entry.Key.SubKeys) != 2 {
+		t.Errorf("saved key %+v", entry)
+	}
+
+	restoreForTest(t, subject)
+	after := dumpRegistry(t, reg)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+	if !registryKeyExists(HKCR, "ms-msdt\\DefaultIcon") {
+		t.Error("empty subkey has not been restored")
+	}
+
+	// A failure after deleting the key rolls the deletion back.
+	reg.SetAccessDenied(HKLM, "", true)
+	multiValue := &RegistryMultiValue{
+		ArrayKeyAbsent:   []*RegistryKeyAbsent{subject},
+		ArraySingleDWORD: []*RegistrySingleValueDWORD{{RootKey: HKLM, Path: "SOFTWARE\\Test", ValueName: "A"}},
+		shortName:        "MSDT and HKLM",
+	}
+	if err := hardenOrRestoreSubject(multiValue, true); !isRolledBack(err) {
+		t.Fatalf("hardening returned %v, expected rollback", err)
+	}
+	after = dumpRegistry(t, reg)
+	deleteBackupJournal(after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after rollback:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestHardenIFEOBlock(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKLM, ifeoKey+"\\powershell.exe", keyAllAccess)
+	key.SetStringValue("Debugger", "vsjitdebugger.exe")
+	key.SetDWordValue("GlobalFlag", 2)
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	if err := hardenOrRestoreSubject(PowerShellMachineWide, true); err != nil {
+		t.Fatal(err)
+	}
+	after := dumpRegistry(t, reg)
+	for _, executable := range []string{"powershell.exe", "powershell_ise.exe"} {
+		name := "LOCAL_MACHINE\\" + ifeoKey + "\\" + executable + "\\Debugger"
+		if after[name] != "1:"+ifeoBlockDebugger {
+			t.Errorf("%s = %q after hardening", name, after[name])
+		}
+	}
+	if !PowerShellMachineWide.IsHardened() || PowerShell.IsHardened() {
+		t.Errorf("%s is not hardened or %s is hardened", PowerShellMachineWide.Name(), PowerShell.Name())
+	}
+
+	if err := restoreSubject(PowerShellMachineWide); err != nil {
+		t.Fatal(err)
+	}
+	after = dumpRegistry(t, reg)
+	deleteBackupJournal(after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+// ifeoCommandRunner is a fake CommandRunner that fails like Windows would
+// for commands redirected by an Image File Execution Options debugger.
+type ifeoCommandRunner struct {
+	redirected []string
+}
+
+func (runner *ifeoCommandRunner) Run(name string, args ...string) (string, error) {
+	if debugger := ifeoDebugger(name); debugger != "" {
+		runner.redirected = append(runner.redirected, commandLine(name, args...))
+		return "", fmt.Errorf("%s has been redirected to %s", name, debugger)
+	}
+	return "", nil
+}
+
+func TestHardenIFEOBlockOrder(t *testing.T) {
+	useMemoryRegistry(t)
+	runner := &ifeoCommandRunner{}
+	previous := commandRunner
+	commandRunner = runner
+	defer func() { commandRunner = previous }()
+
+	// The harden subjects executing cmd.exe or PowerShell.exe and the ones
+	// blocking them, in the order of a privileged run.
+	names := map[string]bool{
+		FileAssociations.Name():      true,
+		WindowsASR.Name():            true,
+		Recall.Name():                true,
+		PowerShellMachineWide.Name(): true,
+		CmdMachineWide.Name():        true,
+	}
+	var subjects []HardenInterface
+	for _, hardenSubject := range hardenSubjectsForPrivilegedUsers {
+		if names[hardenSubject.Name()] {
+			subjects = append(subjects, hardenSubject)
+		}
+	}
+	useSubjects(t, subjects...)
+
+	triggerAll(true)
+	if !PowerShellMachineWide.IsHardened() || !CmdMachineWide.IsHardened() {
+		t.Fatal("cmd.exe or PowerShell.exe has not been blocked")
+	}
+	if len(runner.redirected) > 0 {
+		t.Errorf("commands executed while blocked when hardening: %v", runner.redirected)
+	}
+
+	runner.redirected = nil
+	triggerAll(false)
+	if len(runner.redirected) > 0 {
+		t.Errorf("commands executed while blocked when restoring: %v", runner.redirected)
+	}
+}
+
+func TestHardenAdobeLockdown(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKLM, "SOFTWARE\\Adobe\\Adobe Acrobat\\DC\\InstallPath", keyAllAccess)
+	key.Close()
+	// An existing policy that allows JavaScript.
+	lockdownKey := "SOFTWARE\\Policies\\Adobe\\Adobe Acrobat\\DC\\FeatureLockDown"
+	key, _, _ = reg.CreateKey(HKLM, lockdownKey, keyAllAccess)
+	key.SetDWordValue("bDisableJavaScript", 0)
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	if err := hardenOrRestoreSubject(AdobePDFLockdown, true); err != nil {
+		t.Fatal(err)
+	}
+	after := dumpRegistry(t, reg)
+	for _, name := range []string{"bDisableJavaScript", "bEnableProtectedModeAppContainer", "bEnhancedSecurityStandalone"} {
+		if value := after["LOCAL_MACHINE\\"+lockdownKey+"\\"+name]; value != "4:1" {
+			t.Errorf("%s = %q after hardening", name, value)
+		}
+	}
+	for name := range after {
+		if strings.Contains(name, "\\Acrobat Reader\\") {
+			t.Errorf("%s has been hardened, but Acrobat Reader is not installed", name)
+		}
+	}
+	if !AdobePDFLockdown.IsHardened() {
+		t.Error("not hardened")
+	}
+
+	if err := restoreSubject(AdobePDFLockdown); err != nil {
+		t.Fatal(err)
+	}
+	after = dumpRegistry(t, reg)
+	deleteBackupJournal(after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after restore:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+func TestAdobeLockdownNotHardenedByDefault(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKLM, "SOFTWARE\\Adobe\\Acrobat Reader\\DC\\InstallPath", keyAllAccess)
+	key.Close()
+	useSubjects(t, AdobePDFJS, AdobePDFLockdown)
+
+	expected := map[string]bool{AdobePDFJS.Name(): true, AdobePDFLockdown.Name(): false}
+	if config := defaultExpertConfig(false); !reflect.DeepEqual(config, expected) {
+		t.Errorf("default selection = %v, expected %v", config, expected)
+	}
+}
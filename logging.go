@@ -0,0 +1,467 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Logging is done with log/slog. The Trace and Info loggers are adapters
+// that log every message as record of the respective level, structured
+// attributes can be added by using logger directly. Records are written to
+// the console (command line version) and appended to a log file in the data
+// directory of the user. The log file is rotated by size and old log files
+// are removed by age, so the log of hardening is still there when restoring
+// weeks later.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LevelTrace is the level of the Trace logger, it is more verbose than
+// slog.LevelDebug.
+const LevelTrace = slog.Level(-8)
+
+// Rotation of log files.
+const (
+	maxLogFileSize = 5 << 20 // Rotate if the log file gets larger.
+	maxLogBackups  = 10      // Number of rotated log files to keep.
+	maxLogAge      = 180 * 24 * time.Hour
+)
+
+// logger is the structured logger. It writes to the same handler as Trace
+// and Info.
+var logger = slog.New(slog.DiscardHandler)
+
+// logFormat is the format of log records, "text" or "json".
+var logFormat = "text"
+
+// logDir is the directory of the log file. If empty, no log file is written.
+var logDir = defaultLogDir()
+
+// logFile is the currently open log file.
+var logFile *rotatingLogFile
+
+// loggingSetUp is set once initLoggingWithCmdParameters has set up logging,
+// loggingCmd tells if it has been set up for the command line.
+var loggingSetUp, loggingCmd bool
+
+// fileOnlyKey marks contexts of records that are only written to the log
+// file, not to the console.
+type fileOnlyKey struct{}
+
+// logFileOnly is the context for records only written to the log file.
+var logFileOnly = context.WithValue(context.Background(), fileOnlyKey{}, true)
+
+// logOptions configures initLogging.
+type logOptions struct {
+	Level    slog.Level
+	Off      bool      // Disables logging.
+	JSON     bool      // Write records as JSON lines instead of text.
+	Console  io.Writer // Console output, nil if there is none (GUI).
+	Dir      string    // Directory of the log file, no log file if empty.
+	FileName string
+}
+
+// defaultLogDir returns the directory of the log file in the data directory
+// of the user (%LOCALAPPDATA%\Hardentools\Logs on Windows).
+func defaultLogDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "Hardentools", "Logs")
+}
+
+// parseLogLevel returns the level with name (case insensitive). "Off"
+// disables logging. Unknown names select the info level.
+func parseLogLevel(name string) (level slog.Level, off bool) {
+	switch {
+	case strings.EqualFold(name, "Off"):
+		return slog.LevelInfo, true
+	case strings.EqualFold(name, "Trace"):
+		return LevelTrace, false
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo, false
+	}
+	return level, false
+}
+
+// initLogging sets up logger, Trace and Info. The previous log file is
+// closed. An error is returned if the log file can't be opened, the console
+// is used nonetheless.
+func initLogging(options logOptions) error {
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	if options.Off {
+		setLogHandler(slog.DiscardHandler)
+		return nil
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: options.Level, ReplaceAttr: replaceLogLevel}
+	var handlers multiLogHandler
+	if options.Console != nil && options.JSON {
+		handlers = append(handlers, consoleOnly(slog.NewJSONHandler(options.Console, handlerOptions)))
+	} else if options.Console != nil {
+		handlers = append(handlers, &consoleLogHandler{output: options.Console, level: options.Level, mutex: new(sync.Mutex)})
+	}
+
+	var err error
+	if options.Dir != "" {
+		logFile, err = openRotatingLogFile(filepath.Join(options.Dir, options.FileName))
+		if err == nil && options.JSON {
+			handlers = append(handlers, slog.NewJSONHandler(logFile, handlerOptions))
+		} else if err == nil {
+			handlers = append(handlers, slog.NewTextHandler(logFile, handlerOptions))
+		}
+	}
+
+	switch len(handlers) {
+	case 0:
+		setLogHandler(slog.DiscardHandler)
+	case 1:
+		setLogHandler(handlers[0])
+	default:
+		setLogHandler(handlers)
+	}
+	return err
+}
+
+// setLogHandler makes all loggers write to handler.
+func setLogHandler(handler slog.Handler) {
+	logger = slog.New(handler)
+	Trace = slog.NewLogLogger(handler, LevelTrace)
+	Info = slog.NewLogLogger(handler, slog.LevelInfo)
+	slog.SetDefault(logger)
+}
+
+// replaceLogLevel names LevelTrace "TRACE" instead of "DEBUG-4".
+func replaceLogLevel(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok && level <= LevelTrace {
+			attr.Value = slog.StringValue("TRACE")
+		}
+	}
+	return attr
+}
+
+// initLoggingWithCmdParameters initializes logging considering if cli version specifics
+func initLoggingWithCmdParameters(logLevelPtr *string, cmd bool) {
+	if loggingSetUp && loggingCmd == cmd {
+		return
+	}
+	loggingSetUp, loggingCmd = true, cmd
+
+	level, off := parseLogLevel(*logLevelPtr)
+	options := logOptions{
+		Level:    level,
+		Off:      off,
+		JSON:     strings.EqualFold(logFormat, "json"),
+		Dir:      logDir,
+		FileName: logFileName,
+	}
+	if cmd {
+		// command line => also log to stdout
+		options.Console = os.Stdout
+	}
+	if err := initLogging(options); err != nil {
+		Info.Printf("Could not open log file: %s", err.Error())
+	}
+	logger.InfoContext(logFileOnly, "Hardentools started",
+		"version", hardentoolsVersion,
+		"arguments", os.Args[1:],
+		"elevated", isElevated(),
+		"command_line", cmd)
+}
+
+// multiLogHandler passes records to several handlers.
+type multiLogHandler []slog.Handler
+
+// Enabled returns true if any of the handlers handles level.
+func (handlers multiLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle passes record to all handlers that handle its level.
+func (handlers multiLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, handler := range handlers {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WithAttrs returns the handlers with attrs.
+func (handlers multiLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	result := make(multiLogHandler, len(handlers))
+	for i, handler := range handlers {
+		result[i] = handler.WithAttrs(attrs)
+	}
+	return result
+}
+
+// WithGroup returns the handlers with group name.
+func (handlers multiLogHandler) WithGroup(name string) slog.Handler {
+	result := make(multiLogHandler, len(handlers))
+	for i, handler := range handlers {
+		result[i] = handler.WithGroup(name)
+	}
+	return result
+}
+
+// consoleOnlyHandler is a console handler that skips records only meant for
+// the log file.
+type consoleOnlyHandler struct {
+	slog.Handler
+}
+
+// consoleOnly returns handler skipping records only meant for the log file.
+func consoleOnly(handler slog.Handler) slog.Handler {
+	return consoleOnlyHandler{handler}
+}
+
+// Enabled returns false for records only meant for the log file.
+func (handler consoleOnlyHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return ctx.Value(fileOnlyKey{}) == nil && handler.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs returns the handler with attrs.
+func (handler consoleOnlyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return consoleOnlyHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns the handler with group name.
+func (handler consoleOnlyHandler) WithGroup(name string) slog.Handler {
+	return consoleOnlyHandler{handler.Handler.WithGroup(name)}
+}
+
+// consoleLogHandler writes the message of records followed by their
+// attributes, like the command line version always did (without time and
+// level).
+type consoleLogHandler struct {
+	output io.Writer
+	level  slog.Level
+	attrs  string // Preformatted attributes of WithAttrs.
+	group  string // Prefix of attribute keys.
+	mutex  *sync.Mutex
+}
+
+// Enabled returns true if level is enabled and the record is not only meant
+// for the log file.
+func (handler *consoleLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= handler.level && ctx.Value(fileOnlyKey{}) == nil
+}
+
+// Handle writes record.
+func (handler *consoleLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var line strings.Builder
+	line.WriteString(record.Message)
+	line.WriteString(handler.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendConsoleAttr(&line, handler.group, attr)
+		return true
+	})
+	line.WriteString("\n")
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	_, err := io.WriteString(handler.output, line.String())
+	return err
+}
+
+// WithAttrs returns the handler with attrs.
+func (handler *consoleLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var line strings.Builder
+	line.WriteString(handler.attrs)
+	for _, attr := range attrs {
+		appendConsoleAttr(&line, handler.group, attr)
+	}
+	result := *handler
+	result.attrs = line.String()
+	return &result
+}
+
+// WithGroup returns the handler with group name.
+func (handler *consoleLogHandler) WithGroup(name string) slog.Handler {
+	result := *handler
+	result.group += name + "."
+	return &result
+}
+
+// appendConsoleAttr appends " key=value" to line.
+func appendConsoleAttr(line *strings.Builder, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			group += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			appendConsoleAttr(line, group, groupAttr)
+		}
+		return
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \"=\n") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(line, " %s%s=%s", group, attr.Key, value)
+}
+
+// rotatingLogFile is a log file that is appended to. If it gets larger than
+// maxSize, it is renamed to a backup with the time of rotation in its name
+// and a new one is started. Backups older than maxAge and all but the latest
+// maxBackups are removed.
+type rotatingLogFile struct {
+	path       string
+	file       *os.File
+	size       int64
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	mutex      sync.Mutex
+}
+
+// openRotatingLogFile opens path for appending, creating it and its
+// directory if needed.
+func openRotatingLogFile(path string) (*rotatingLogFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	logFile := &rotatingLogFile{
+		path:       path,
+		maxSize:    maxLogFileSize,
+		maxBackups: maxLogBackups,
+		maxAge:     maxLogAge,
+	}
+	if err := logFile.open(); err != nil {
+		return nil, err
+	}
+	logFile.removeOldBackups()
+	return logFile, nil
+}
+
+// open opens the log file for appending.
+func (logFile *rotatingLogFile) open() error {
+	file, err := os.OpenFile(logFile.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	logFile.file, logFile.size = file, info.Size()
+	return nil
+}
+
+// Write appends p to the log file, rotating it before if it would get too
+// large.
+func (logFile *rotatingLogFile) Write(p []byte) (int, error) {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+
+	if logFile.file == nil {
+		return 0, os.ErrClosed
+	}
+	if logFile.size > 0 && logFile.size+int64(len(p)) > logFile.maxSize {
+		if err := logFile.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := logFile.file.Write(p)
+	logFile.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (logFile *rotatingLogFile) Close() error {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+
+	if logFile.file == nil {
+		return nil
+	}
+	err := logFile.file.Close()
+	logFile.file = nil
+	return err
+}
+
+// backupPrefix returns the start of the names of backups of the log file.
+func (logFile *rotatingLogFile) backupPrefix() string {
+	return strings.TrimSuffix(logFile.path, filepath.Ext(logFile.path)) + "-"
+}
+
+// rotate renames the log file to a backup and starts a new one.
+func (logFile *rotatingLogFile) rotate() error {
+	if err := logFile.file.Close(); err != nil {
+		return err
+	}
+	logFile.file = nil
+	backup := logFile.backupPrefix() + time.Now().UTC().Format("20060102T150405.000") + filepath.Ext(logFile.path)
+	if err := os.Rename(logFile.path, backup); err != nil {
+		// Keep appending to the current file.
+		return logFile.open()
+	}
+	if err := logFile.open(); err != nil {
+		return err
+	}
+	logFile.removeOldBackups()
+	return nil
+}
+
+// removeOldBackups removes backups older than maxAge and all but the latest
+// maxBackups.
+func (logFile *rotatingLogFile) removeOldBackups() {
+	backups, err := filepath.Glob(logFile.backupPrefix() + "*" + filepath.Ext(logFile.path))
+	if err != nil {
+		return
+	}
+	// The names contain the time of rotation, so the latest come first.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		info, err := os.Stat(backup)
+		if err != nil {
+			continue
+		}
+		if i >= logFile.maxBackups || time.Since(info.ModTime()) > logFile.maxAge {
+			os.Remove(backup)
+		}
+	}
+}
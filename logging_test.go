@@ -0,0 +1,149 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLogFile returns the lines of the log file in dir.
+func readLogFile(t *testing.T, dir string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestLogging(t *testing.T) {
+	dir := t.TempDir()
+	t.Cleanup(func() { initLogging(logOptions{Off: true}) })
+
+	var console bytes.Buffer
+	err := initLogging(logOptions{Level: slog.LevelInfo, Console: &console, Dir: dir, FileName: logFileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Trace.Println("not logged")
+	Info.Println("Now we are hardening...")
+	logger.Error("Hardening failed", "subject", "WSH", "error", errors.New("access denied"))
+	logger.InfoContext(logFileOnly, "Hardentools started", "version", "dev")
+
+	expected := "Now we are hardening...\nHardening failed subject=WSH error=\"access denied\"\n"
+	if console.String() != expected {
+		t.Errorf("console output is %q", console.String())
+	}
+	lines := readLogFile(t, dir)
+	if len(lines) != 3 || !strings.Contains(lines[0], `level=INFO msg="Now we are hardening..."`) ||
+		!strings.Contains(lines[1], `level=ERROR msg="Hardening failed" subject=WSH error="access denied"`) ||
+		!strings.Contains(lines[2], `msg="Hardentools started" version=dev`) {
+		t.Errorf("unexpected log file %q", lines)
+	}
+
+	// The log file is appended to, also in another format.
+	console.Reset()
+	err = initLogging(logOptions{Level: LevelTrace, JSON: true, Console: &console, Dir: dir, FileName: logFileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Trace.Printf("IsHardened?: %s", "hardened")
+	lines = readLogFile(t, dir)
+	var record map[string]interface{}
+	if len(lines) != 4 || json.Unmarshal([]byte(lines[3]), &record) != nil ||
+		record["level"] != "TRACE" || record["msg"] != "IsHardened?: hardened" {
+		t.Errorf("unexpected log file %q", lines)
+	}
+	if !strings.Contains(console.String(), `"level":"TRACE"`) {
+		t.Errorf("console output is %q", console.String())
+	}
+
+	initLogging(logOptions{Off: true})
+	Info.Println("logging is off")
+	if lines = readLogFile(t, dir); len(lines) != 4 {
+		t.Errorf("logged although logging is off: %q", lines)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Level
+		off   bool
+	}{
+		{"Info", slog.LevelInfo, false},
+		{"trace", LevelTrace, false},
+		{"Debug", slog.LevelDebug, false},
+		{"WARN", slog.LevelWarn, false},
+		{"Off", slog.LevelInfo, true},
+		{"verbose", slog.LevelInfo, false},
+	}
+	for _, test := range tests {
+		if level, off := parseLogLevel(test.name); level != test.level || off != test.off {
+			t.Errorf("parseLogLevel(%q) = %s, %t", test.name, level, off)
+		}
+	}
+}
+
+func TestRotatingLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, logFileName)
+
+	// An outdated backup is removed when opening the log file.
+	outdated := filepath.Join(dir, "hardentools-20200101T000000.000.log")
+	os.WriteFile(outdated, []byte("old\n"), 0600)
+	old := time.Now().Add(-maxLogAge - time.Hour)
+	os.Chtimes(outdated, old, old)
+
+	logFile, err := openRotatingLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	if _, err := os.Stat(outdated); !os.IsNotExist(err) {
+		t.Error("outdated backup has not been removed")
+	}
+
+	logFile.maxSize = 10
+	logFile.maxBackups = 2
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := logFile.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Backups are named by the time of rotation.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "fourth\n" {
+		t.Errorf("log file contains %q", data)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "hardentools-*.log"))
+	if len(backups) != 2 {
+		t.Fatalf("%d backups have been kept", len(backups))
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != "second\n" {
+		t.Errorf("oldest backup contains %q", data)
+	}
+}
@@ -0,0 +1,88 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Living-off-the-land binaries (LOLBins) are executables shipped with
+// Windows that attackers use to download, decode or run malicious code
+// without dropping their own tools. Every binary of the catalog is a harden
+// subject of its own that blocks it with the Explorer DisallowRun policy
+// (see disallow_run.go). Binaries that are also used by installers or
+// Windows itself are not hardened by default.
+//
+// Note that DisallowRun is only enforced by Explorer, i.e. for programs
+// started by the user (e.g. by opening a file or a link). It does not stop
+// a program that has already been started from running these binaries.
+
+// lolbin is an entry of the LOLBin catalog.
+type lolbin struct {
+	executable      string
+	risk            string
+	hardenByDefault bool
+}
+
+// lolbinCatalog contains the curated LOLBins that can be blocked.
+var lolbinCatalog = []lolbin{
+	{"mshta.exe", "Runs HTML applications (.hta) with full user\n" +
+		"rights. Often used by phishing attachments and links.", true},
+	{"wscript.exe", "Runs VBScript and JScript files in a window.\n" +
+		"Often used by malicious e-mail attachments.", true},
+	{"cscript.exe", "Runs VBScript and JScript files on the console.\n" +
+		"Often used by malicious e-mail attachments.", true},
+	{"certutil.exe", "Certificate tool that can download files and\n" +
+		"decode base64, used to fetch and unpack malware.", true},
+	{"bitsadmin.exe", "Creates background download jobs, used to\n" +
+		"download malware and to keep it running.", true},
+	{"hh.exe", "Opens compiled HTML help files (.chm), which can\n" +
+		"contain scripts that run malicious code.", true},
+	{"cmstp.exe", "Installs connection manager profiles, used to\n" +
+		"run code and to bypass UAC.", true},
+	{"scriptrunner.exe", "Runs scripts and executables on behalf of\n" +
+		"other programs to hide their origin.", true},
+	{"regsvr32.exe", "Registers DLLs and can run remote scriptlets\n" +
+		"(\"Squiblydoo\"). Also used by some installers.", false},
+	{"rundll32.exe", "Runs functions of DLLs, used to run malicious\n" +
+		"DLLs. Also used by Windows and many programs.", false},
+	{"msbuild.exe", "Builds .NET projects and can compile and run\n" +
+		"inline code. Needed by software developers.", false},
+	{"installutil.exe", "Runs installer classes of .NET assemblies,\n" +
+		"used to run code past application whitelisting.", false},
+	{"regasm.exe", "Registers .NET assemblies and can run code\n" +
+		"while doing so. Needed by some installers.", false},
+	{"regsvcs.exe", "Registers .NET services and can run code while\n" +
+		"doing so. Needed by some installers.", false},
+	{"wmic.exe", "Queries and controls Windows management, used\n" +
+		"to run code and move through networks.", false},
+	{"forfiles.exe", "Runs a command for a set of files, used to\n" +
+		"start programs indirectly.", false},
+}
+
+// lolbinSubjects returns a DisallowRun harden subject for every LOLBin of
+// the catalog.
+func lolbinSubjects() []HardenInterface {
+	subjects := make([]HardenInterface, 0, len(lolbinCatalog))
+	for _, entry := range lolbinCatalog {
+		subjects = append(subjects, &DisallowRunList{
+			Executables: []string{entry.executable},
+			shortName:   "Disable " + entry.executable,
+			longName:    "Disable " + entry.executable,
+			description: entry.risk + "\nYou will not be able to start " +
+				entry.executable + " anymore.",
+			hardenByDefault: entry.hardenByDefault,
+		})
+	}
+	return subjects
+}
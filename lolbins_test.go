@@ -0,0 +1,72 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLOLBinCatalog(t *testing.T) {
+	names := make(map[string]bool)
+	for _, subject := range hardenSubjectsForPrivilegedUsers {
+		if names[subject.Name()] {
+			t.Errorf("harden subject %q is defined twice", subject.Name())
+		}
+		names[subject.Name()] = true
+	}
+
+	for _, entry := range lolbinCatalog {
+		if !strings.HasSuffix(entry.executable, ".exe") || strings.Contains(entry.executable, "\\") {
+			t.Errorf("invalid executable %q", entry.executable)
+		}
+		if entry.executable == "cmd.exe" || strings.HasPrefix(entry.executable, "powershell") {
+			t.Errorf("%s is already blocked by another harden subject", entry.executable)
+		}
+		if entry.risk == "" {
+			t.Errorf("%s has no risk description", entry.executable)
+		}
+	}
+	if len(LOLBins) != len(lolbinCatalog) {
+		t.Errorf("%d LOLBin subjects for %d catalog entries", len(LOLBins), len(lolbinCatalog))
+	}
+}
+
+func TestHardenSelectedLOLBins(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	useSubjects(t, append([]HardenInterface{WSH}, LOLBins...)...)
+
+	if err := selectNamedSubjects([]string{"disable mshta.exe", " Disable certutil.exe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := triggerAll(true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"1": "1:mshta.exe", "2": "1:certutil.exe"}
+	if list := disallowRunList(t, reg); !reflect.DeepEqual(list, expected) {
+		t.Errorf("DisallowRun list = %v", list)
+	}
+	if WSH.IsHardened() {
+		t.Errorf("%s has been hardened although it has not been selected", WSH.Name())
+	}
+
+	if err := selectNamedSubjects([]string{"Disable notepad.exe"}); err == nil {
+		t.Error("unknown subject has been selected")
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"flag"
 	"fmt"
 	"image/color"
+	"os"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -91,21 +93,112 @@ func (m myTheme) Icon(name fyne.ThemeIconName) fyne.Resource {
 // Main method for hardentools.
 func main() {
 	// parse command line parameters/flags
-	logLevelPtr := flag.String("log-level", defaultLogLevel, "\"Info\": Enables logging with standard verbosity; \"Trace\": Verbose logging; \"Off\": Disables logging")
+	logLevelPtr := flag.String("log-level", defaultLogLevel, "\"Info\": Enables logging with standard verbosity; \"Trace\": Verbose logging; \"Off\": Disables logging (also \"Debug\", \"Warn\" and \"Error\")")
+	logFormatPtr := flag.String("log-format", logFormat, "format of log records: \"text\" or \"json\"")
+	logDirPtr := flag.String("log-dir", logDir, "directory of the rotated log files (empty: no log file)")
 	restorePtr := flag.Bool("restore", false, "restore in command line mode")
 	hardenPtr := flag.Bool("harden", false, "harden with default settings in command line mode")
+	atomicPtr := flag.Bool("atomic", false, "with -harden: roll back all changes if any harden subject fails")
+	dryRunPtr := flag.Bool("dry-run", false, "with -harden or -restore: only list the changes that would be made")
+	migrateStatePtr := flag.Bool("migrate-state", false, "migrate saved state of older hardentools versions in command line mode")
+	hardenSubjectPtr := flag.String("harden-subject", "", "harden only the given comma separated harden subjects (also if already hardened) in command line mode")
+	restoreSubjectPtr := flag.String("restore-subject", "", "restore only the given comma separated harden subjects in command line mode")
+	statusPtr := flag.Bool("status", false, "show detailed status of all harden subjects in command line mode")
+	formatPtr := flag.String("format", reportFormatText, "with -status, -harden or -restore: format of the output (text, json, csv or sarif)")
+	allUsersPtr := flag.Bool("all-users", false, "with -harden, -restore or -status: also apply the settings of the current user to all user profiles (needs admin privileges)")
+	offlineHivePtr := flag.String("offline-hive", "", "work on the given comma separated hive files of an offline Windows installation (e.g. SOFTWARE,NTUSER.DAT) instead of this system in command line mode")
+	auditPtr := flag.Bool("audit", false, "list hardened settings that have been changed since hardening in command line mode (exits with code 2 if any)")
+	watchPtr := flag.Bool("watch", false, "re-apply hardened settings whenever they are changed in command line mode")
+	watchExcludePtr := flag.String("watch-exclude", "", "with -watch or -install-watch-service: comma separated harden subjects that should not be re-applied")
+	watchUserPtr := flag.String("watch-user", "", "with -watch: SID of the user whose settings are watched (used by the watch service)")
+	installWatchServicePtr := flag.Bool("install-watch-service", false, "install a Windows service that runs -watch for the current user")
+	uninstallWatchServicePtr := flag.Bool("uninstall-watch-service", false, "uninstall the Windows service installed with -install-watch-service")
+	subjectsDirPtr := flag.String("subjects-dir", "", "directory with additional harden subject definitions (.toml or .json), by default %ProgramData%\\Hardentools\\subjects if only administrators can change it")
+	applyRegPtr := flag.String("apply-reg", "", "harden the registry values of a .reg file in command line mode")
+	restoreRegPtr := flag.String("restore-reg", "", "restore the registry values hardened with -apply-reg in command line mode")
+	exportRegPtr := flag.String("export-reg", "", "export the registry values of the selected harden subjects to a .reg file in command line mode")
+	exportPolPtr := flag.String("export-pol", "", "export the registry values of the selected harden subjects as Registry.pol files to a directory in command line mode")
+	exportUndoPtr := flag.String("export-undo", "", "export the saved original registry values to a .reg file in command line mode")
 	flag.Parse()
+	if err := useReportFormat(*formatPtr); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	logFormat = *logFormatPtr
+	logDir = *logDirPtr
+	dryRunMode = *dryRunPtr
+	subjectsDir = *subjectsDirPtr
+	allUsersMode = *allUsersPtr
+	if *hardenSubjectPtr != "" {
+		hardenSubjectNames = strings.Split(*hardenSubjectPtr, ",")
+	}
+	if *restoreSubjectPtr != "" {
+		restoreSubjectNames = strings.Split(*restoreSubjectPtr, ",")
+	}
+	if *watchExcludePtr != "" {
+		watchExcludedSubjects = strings.Split(*watchExcludePtr, ",")
+	}
+	if *watchUserPtr != "" && !*watchPtr {
+		fmt.Println("Parameter -watch-user can only be used together with -watch.")
+		os.Exit(-1)
+	}
+
+	if *offlineHivePtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		useOfflineHives(*offlineHivePtr)
+	}
 
-	if *hardenPtr == true {
-		// no GUI, just harden with default settings
+	if *migrateStatePtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdMigrateState()
+	}
+	if *statusPtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdStatus()
+	}
+	if *auditPtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdAudit()
+	}
+	if *watchPtr == true {
+		// The watch service runs as LocalSystem and watches the settings of
+		// the user that installed it.
+		currentUserHive = *watchUserPtr
 		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdWatch()
+	}
+	if *installWatchServicePtr == true || *uninstallWatchServicePtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdWatchService(*installWatchServicePtr)
+	}
+	if *applyRegPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdApplyReg(*applyRegPtr, true)
+	}
+	if *restoreRegPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdApplyReg(*restoreRegPtr, false)
+	}
+	if *exportRegPtr != "" || *exportPolPtr != "" || *exportUndoPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdExport(*exportRegPtr, *exportPolPtr, *exportUndoPtr)
+	}
+
+	if *hardenPtr == true || len(hardenSubjectNames) > 0 {
+		// no GUI, just harden with default (or the given) settings
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		atomicHardening = *atomicPtr
 		cmdHarden()
 	}
-	if *restorePtr == true {
+	if *restorePtr == true || len(restoreSubjectNames) > 0 {
 		// no GUI, just restore
 		initLoggingWithCmdParameters(logLevelPtr, true)
 		cmdRestore()
 	}
+	if offlineHives != nil {
+		// The GUI only works on this system.
+		cmdStatus()
+	}
 
 	initLoggingWithCmdParameters(logLevelPtr, false)
 
@@ -146,14 +239,8 @@ func main() {
 // (checks real status on system)
 func showStatus() {
 	for _, hardenSubject := range allHardenSubjects {
-		if hardenSubject.IsHardened() {
-			eventText := fmt.Sprintf("%s is now hardened\r\n", hardenSubject.Name())
-			ShowIsHardened(hardenSubject.Name())
-			Info.Print(eventText)
-		} else {
-			eventText := fmt.Sprintf("%s is now NOT hardened\r\n", hardenSubject.Name())
-			ShowNotHardened(hardenSubject.Name())
-			Info.Print(eventText)
-		}
+		status := getHardenStatus(hardenSubject)
+		ShowStatus(hardenSubject.Name(), status)
+		printHardenStatus(Info.Writer(), status, 0)
 	}
 }
@@ -21,27 +21,119 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 )
 
 // Main method for hardentools.
 func main() {
-	fmt.Println("Welcome to the command line version of hardentools.")
 	// parse command line parameters/flags
-	logLevelPtr := flag.String("log-level", defaultLogLevel, "\"Info\": Enables logging with standard verbosity; \"Trace\": Verbose logging; \"Off\": Disables logging")
+	logLevelPtr := flag.String("log-level", defaultLogLevel, "\"Info\": Enables logging with standard verbosity; \"Trace\": Verbose logging; \"Off\": Disables logging (also \"Debug\", \"Warn\" and \"Error\")")
+	logFormatPtr := flag.String("log-format", logFormat, "format of log records: \"text\" or \"json\"")
+	logDirPtr := flag.String("log-dir", logDir, "directory of the rotated log files (empty: no log file)")
 	restorePtr := flag.Bool("restore", false, "restore")
 	hardenPtr := flag.Bool("harden", false, "harden with default settings")
+	atomicPtr := flag.Bool("atomic", false, "with -harden: roll back all changes if any harden subject fails")
+	dryRunPtr := flag.Bool("dry-run", false, "with -harden or -restore: only list the changes that would be made")
+	migrateStatePtr := flag.Bool("migrate-state", false, "migrate saved state of older hardentools versions")
+	hardenSubjectPtr := flag.String("harden-subject", "", "harden only the given comma separated harden subjects (also if already hardened)")
+	restoreSubjectPtr := flag.String("restore-subject", "", "restore only the given comma separated harden subjects")
+	statusPtr := flag.Bool("status", false, "show detailed status of all harden subjects")
+	formatPtr := flag.String("format", reportFormatText, "with -status, -harden or -restore: format of the output (text, json, csv or sarif)")
+	allUsersPtr := flag.Bool("all-users", false, "with -harden, -restore or -status: also apply the settings of the current user to all user profiles (needs admin privileges)")
+	offlineHivePtr := flag.String("offline-hive", "", "work on the given comma separated hive files of an offline Windows installation (e.g. SOFTWARE,NTUSER.DAT) instead of this system")
+	auditPtr := flag.Bool("audit", false, "list hardened settings that have been changed since hardening (exits with code 2 if any)")
+	watchPtr := flag.Bool("watch", false, "re-apply hardened settings whenever they are changed")
+	watchExcludePtr := flag.String("watch-exclude", "", "with -watch or -install-watch-service: comma separated harden subjects that should not be re-applied")
+	watchUserPtr := flag.String("watch-user", "", "with -watch: SID of the user whose settings are watched (used by the watch service)")
+	installWatchServicePtr := flag.Bool("install-watch-service", false, "install a Windows service that runs -watch for the current user")
+	uninstallWatchServicePtr := flag.Bool("uninstall-watch-service", false, "uninstall the Windows service installed with -install-watch-service")
+	subjectsDirPtr := flag.String("subjects-dir", "", "directory with additional harden subject definitions (.toml or .json), by default %ProgramData%\\Hardentools\\subjects if only administrators can change it")
+	applyRegPtr := flag.String("apply-reg", "", "harden the registry values of a .reg file")
+	restoreRegPtr := flag.String("restore-reg", "", "restore the registry values hardened with -apply-reg")
+	exportRegPtr := flag.String("export-reg", "", "export the registry values of the selected harden subjects to a .reg file")
+	exportPolPtr := flag.String("export-pol", "", "export the registry values of the selected harden subjects as Registry.pol files to a directory")
+	exportUndoPtr := flag.String("export-undo", "", "export the saved original registry values to a .reg file")
 	flag.Parse()
+	if err := useReportFormat(*formatPtr); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	fmt.Println("Welcome to the command line version of hardentools.")
+	logFormat = *logFormatPtr
+	logDir = *logDirPtr
+	dryRunMode = *dryRunPtr
+	subjectsDir = *subjectsDirPtr
+	allUsersMode = *allUsersPtr
+	atomicHardening = *atomicPtr
+	if *hardenSubjectPtr != "" {
+		hardenSubjectNames = strings.Split(*hardenSubjectPtr, ",")
+	}
+	if *restoreSubjectPtr != "" {
+		restoreSubjectNames = strings.Split(*restoreSubjectPtr, ",")
+	}
+	if *watchExcludePtr != "" {
+		watchExcludedSubjects = strings.Split(*watchExcludePtr, ",")
+	}
+	if *watchUserPtr != "" && !*watchPtr {
+		fmt.Println("Parameter -watch-user can only be used together with -watch.")
+		os.Exit(-1)
+	}
+
+	if *offlineHivePtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		useOfflineHives(*offlineHivePtr)
+	}
+
+	if *migrateStatePtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdMigrateState()
+	}
+	if *statusPtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdStatus()
+	}
+	if *auditPtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdAudit()
+	}
+	if *watchPtr == true {
+		// The watch service runs as LocalSystem and watches the settings of
+		// the user that installed it.
+		currentUserHive = *watchUserPtr
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdWatch()
+	}
+	if *installWatchServicePtr == true || *uninstallWatchServicePtr == true {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdWatchService(*installWatchServicePtr)
+	}
+	if *applyRegPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdApplyReg(*applyRegPtr, true)
+	}
+	if *restoreRegPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdApplyReg(*restoreRegPtr, false)
+	}
+	if *exportRegPtr != "" || *exportPolPtr != "" || *exportUndoPtr != "" {
+		initLoggingWithCmdParameters(logLevelPtr, true)
+		cmdExport(*exportRegPtr, *exportPolPtr, *exportUndoPtr)
+	}
 
 	status := checkStatus()
 	if status {
-		if *restorePtr == true {
+		if *restorePtr == true || len(restoreSubjectNames) > 0 {
 			initLoggingWithCmdParameters(logLevelPtr, true)
 			cmdRestore()
+		} else if len(hardenSubjectNames) > 0 {
+			initLoggingWithCmdParameters(logLevelPtr, true)
+			cmdHarden()
 		} else {
 			fmt.Println("System is currently hardened. Use parameter -restore to restore to not hardened state.")
 		}
 	} else {
-		if *hardenPtr == true {
+		if *hardenPtr == true || len(hardenSubjectNames) > 0 {
 			initLoggingWithCmdParameters(logLevelPtr, true)
 			cmdHarden()
 		} else {
@@ -54,12 +146,6 @@ func main() {
 // (checks real status on system)
 func showStatus() {
 	for _, hardenSubject := range allHardenSubjects {
-		if hardenSubject.IsHardened() {
-			eventText := fmt.Sprintf("%s is now hardened\r\n", hardenSubject.Name())
-			Info.Print(eventText)
-		} else {
-			eventText := fmt.Sprintf("%s is now NOT hardened\r\n", hardenSubject.Name())
-			Info.Print(eventText)
-		}
+		printHardenStatus(Info.Writer(), getHardenStatus(hardenSubject), 0)
 	}
 }
@@ -0,0 +1,249 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Installed Office versions and applications are detected from:
+//   - the Office registration keys of MSI installs
+//     (HKLM\SOFTWARE\Microsoft\Office\<version>\<app>\InstallRoot),
+//   - the Click-to-Run configuration of Microsoft 365 and Office 2019 and
+//     newer (HKLM\SOFTWARE\Microsoft\Office\ClickToRun\Configuration),
+//   - the App Paths of the Office executables, which contain the version in
+//     the installation directory (e.g. ...\root\Office16\WINWORD.EXE).
+// All keys are read in the 64 and the 32 bit registry view, as the 32 bit
+// release builds would only see the 32 bit view otherwise. Office settings
+// are only hardened for the detected installs, or for all versions and
+// applications if no install has been detected.
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sources of detected Office installs.
+const (
+	officeSourceRegistration = "Office registration"
+	officeSourceClickToRun   = "Click-to-Run"
+	officeSourceAppPaths     = "App Paths"
+	officeSourceNotDetected  = "no Office install detected"
+)
+
+const (
+	officeClickToRunKey = "SOFTWARE\\Microsoft\\Office\\ClickToRun\\Configuration"
+	appPathsKey         = "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\App Paths"
+)
+
+// officeRegistrationKey contains the Office registration keys (in the
+// registry view of the install).
+const officeRegistrationKey = "SOFTWARE\\Microsoft\\Office"
+
+// officeAppExecutables maps the Office applications (as named in the Office
+// registry keys) to their executables.
+var officeAppExecutables = map[string]string{
+	"Access":     "msaccess.exe",
+	"Excel":      "excel.exe",
+	"OneNote":    "onenote.exe",
+	"Outlook":    "outlook.exe",
+	"PowerPoint": "powerpnt.exe",
+	"Publisher":  "mspub.exe",
+	"Word":       "winword.exe",
+}
+
+var (
+	officeVersionRegEx    = regexp.MustCompile(`^\d+\.0$`)
+	officeInstallDirRegEx = regexp.MustCompile(`(?i)\\Office(\d+)\\`)
+)
+
+// officeInstall is an installed Office application.
+type officeInstall struct {
+	Version string   // e.g. 16.0
+	App     string   // e.g. Word
+	Sources []string // where the install has been found
+}
+
+// String returns version, application and sources of install.
+func (install officeInstall) String() string {
+	return "Office " + install.Version + " " + install.App + " (" + strings.Join(install.Sources, ", ") + ")"
+}
+
+// detectOfficeInstalls returns all installed Office applications sorted by
+// version and application.
+func detectOfficeInstalls() []officeInstall {
+	installs := make(map[string]*officeInstall)
+	add := func(version, app, source string) {
+		id := version + "\\" + strings.ToLower(app)
+		install, ok := installs[id]
+		if !ok {
+			install = &officeInstall{Version: version, App: app}
+			installs[id] = install
+		}
+		for _, existing := range install.Sources {
+			if existing == source {
+				return
+			}
+		}
+		install.Sources = append(install.Sources, source)
+	}
+
+	for _, view := range registryViews {
+		for _, version := range registrySubKeyNames(HKLM, officeRegistrationKey, view) {
+			if !officeVersionRegEx.MatchString(version) {
+				continue
+			}
+			for _, app := range registrySubKeyNames(HKLM, officeRegistrationKey+"\\"+version, view) {
+				if registryKeyExistsInView(HKLM, officeRegistrationKey+"\\"+version+"\\"+app+"\\InstallRoot", view) {
+					add(version, app, officeSourceRegistration)
+				}
+			}
+		}
+
+		version, apps := detectClickToRunApps(view)
+		for _, app := range apps {
+			add(version, app, officeSourceClickToRun)
+		}
+
+		for app, executable := range officeAppExecutables {
+			key, err := registryBackend.OpenKey(HKLM, appPathsKey+"\\"+executable, keyRead|view)
+			if err != nil {
+				continue
+			}
+			path, _, err := key.GetStringValue("")
+			key.Close()
+			if err != nil {
+				continue
+			}
+			if match := officeInstallDirRegEx.FindStringSubmatch(path); match != nil {
+				add(match[1]+".0", app, officeSourceAppPaths)
+			}
+		}
+	}
+
+	result := make([]officeInstall, 0, len(installs))
+	for _, install := range installs {
+		result = append(result, *install)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Version != result[j].Version {
+			return result[i].Version < result[j].Version
+		}
+		return result[i].App < result[j].App
+	})
+	return result
+}
+
+// detectClickToRunApps returns the version and the applications of the
+// Click-to-Run install in the registry view. Suites contain all applications
+// that are not listed in <product>.ExcludedApps, other products only the
+// application they are named after (e.g. WordRetail).
+func detectClickToRunApps(view uint32) (version string, apps []string) {
+	key, err := registryBackend.OpenKey(HKLM, officeClickToRunKey, keyRead|view)
+	if err != nil {
+		return "", nil
+	}
+	defer key.Close()
+
+	versionToReport, _, err := key.GetStringValue("VersionToReport")
+	if err != nil {
+		return "", nil
+	}
+	parts := strings.SplitN(versionToReport, ".", 3)
+	if len(parts) < 2 {
+		return "", nil
+	}
+	version = parts[0] + "." + parts[1]
+	productIDs, _, err := key.GetStringValue("ProductReleaseIds")
+	if err != nil {
+		return "", nil
+	}
+
+	installed := make(map[string]bool)
+	for _, productID := range strings.Split(productIDs, ",") {
+		productID = strings.TrimSpace(productID)
+		lowerID := strings.ToLower(productID)
+		if lowerID == "" || strings.HasPrefix(lowerID, "visio") || strings.HasPrefix(lowerID, "project") {
+			continue
+		}
+
+		standalone := false
+		for app := range officeAppExecutables {
+			if strings.HasPrefix(lowerID, strings.ToLower(app)) {
+				installed[app] = true
+				standalone = true
+			}
+		}
+		if standalone {
+			continue
+		}
+
+		excluded, _, _ := key.GetStringValue(productID + ".ExcludedApps")
+		excludedApps := make(map[string]bool)
+		for _, app := range strings.Split(excluded, ",") {
+			excludedApps[strings.ToLower(strings.TrimSpace(app))] = true
+		}
+		for app := range officeAppExecutables {
+			if !excludedApps[strings.ToLower(app)] {
+				installed[app] = true
+			}
+		}
+	}
+
+	for app := range installed {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return version, apps
+}
+
+// printOfficeInstalls writes the detected Office installs to w.
+func printOfficeInstalls(w io.Writer) {
+	installs := detectOfficeInstalls()
+	if len(installs) == 0 {
+		fmt.Fprintln(w, "No Office installs found.")
+		return
+	}
+	fmt.Fprintln(w, "Office installs found:")
+	for _, install := range installs {
+		fmt.Fprintln(w, "  "+install.String())
+	}
+}
+
+// findOfficeInstall returns the install of app in version or nil.
+func findOfficeInstall(installs []officeInstall, version, app string) *officeInstall {
+	for i := range installs {
+		if installs[i].Version == version && strings.EqualFold(installs[i].App, app) {
+			return &installs[i]
+		}
+	}
+	return nil
+}
+
+// registrySubKeyNames returns the names of the subkeys of path in the
+// registry view or nil if it can't be read.
+func registrySubKeyNames(rootKey RegistryRootKey, path string, view uint32) []string {
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead|view)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+	names, err := key.ReadSubKeyNames(0)
+	if err != nil {
+		return nil
+	}
+	return names
+}
@@ -0,0 +1,145 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectOfficeInstalls(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	setSZ := func(path, name, value string) {
+		key, _, err := reg.CreateKey(HKLM, path, keyAllAccess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer key.Close()
+		key.SetStringValue(name, value)
+	}
+
+	// Office 2010 Excel (32 bit MSI install).
+	setSZ("SOFTWARE\\WOW6432Node\\Microsoft\\Office\\14.0\\Excel\\InstallRoot", "Path", "C:\\Office14\\")
+	setSZ("SOFTWARE\\WOW6432Node\\Microsoft\\Office\\14.0\\Common\\General", "Xlstart", "XLSTART")
+	// Microsoft 365 without Outlook and OneNote plus standalone Visio.
+	setSZ(officeClickToRunKey, "VersionToReport", "16.0.17029.20068")
+	setSZ(officeClickToRunKey, "ProductReleaseIds", "O365ProPlusRetail,VisioProRetail")
+	setSZ(officeClickToRunKey, "O365ProPlusRetail.ExcludedApps", "groove,outlook,onenote,lync")
+	setSZ(appPathsKey+"\\winword.exe", "", "C:\\Program Files\\Microsoft Office\\root\\Office16\\WINWORD.EXE")
+	// Ancient Office 2007 PowerPoint only known from App Paths.
+	setSZ(appPathsKey+"\\powerpnt.exe", "", "C:\\Program Files\\Microsoft Office\\Office12\\POWERPNT.EXE")
+
+	var installs []string
+	for _, install := range detectOfficeInstalls() {
+		installs = append(installs, install.String())
+	}
+	expected := []string{
+		"Office 12.0 PowerPoint (App Paths)",
+		"Office 14.0 Excel (Office registration)",
+		"Office 16.0 Access (Click-to-Run)",
+		"Office 16.0 Excel (Click-to-Run)",
+		"Office 16.0 PowerPoint (Click-to-Run)",
+		"Office 16.0 Publisher (Click-to-Run)",
+		"Office 16.0 Word (Click-to-Run, App Paths)",
+	}
+	if !reflect.DeepEqual(installs, expected) {
+		t.Errorf("detected %q, expected %q", installs, expected)
+	}
+}
+
+func TestDetectOfficeInstalls64Bit(t *testing.T) {
+	// 64 bit Microsoft 365 and Office 2013 Word, detected by a 32 bit process.
+	reg := useWow64Registry(t)
+	key, _, _ := reg.CreateKey(HKLM, officeClickToRunKey, keyAllAccess)
+	key.SetStringValue("VersionToReport", "16.0.17029.20068")
+	key.SetStringValue("ProductReleaseIds", "ExcelRetail")
+	key.Close()
+	key, _, _ = reg.CreateKey(HKLM, "SOFTWARE\\Microsoft\\Office\\15.0\\Word\\InstallRoot", keyAllAccess)
+	key.SetStringValue("Path", "C:\\Office15\\")
+	key.Close()
+
+	var installs []string
+	for _, install := range detectOfficeInstalls() {
+		installs = append(installs, install.String())
+	}
+	expected := []string{
+		"Office 15.0 Word (Office registration)",
+		"Office 16.0 Excel (Click-to-Run)",
+	}
+	if !reflect.DeepEqual(installs, expected) {
+		t.Errorf("detected %q, expected %q", installs, expected)
+	}
+}
+
+func TestHardenOfficeWithoutDetectedInstalls(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	if err := hardenOrRestoreSubject(OfficeMacros, true); err != nil {
+		t.Fatal(err)
+	}
+	values := dumpRegistry(t, reg)
+	for _, version := range standardOfficeVersions {
+		for _, app := range standardOfficeApps {
+			name := "CURRENT_USER\\SOFTWARE\\Microsoft\\Office\\" + version + "\\" + app + "\\Security\\VBAWarnings"
+			if values[name] != "4:4" {
+				t.Errorf("%s = %q after hardening", name, values[name])
+			}
+		}
+	}
+	if status := getHardenStatus(OfficeMacros); status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+}
+
+func TestHardenOnlyInstalledOffice(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKLM, appPathsKey+"\\excel.exe", keyAllAccess)
+	key.SetStringValue("", "C:\\Program Files\\Microsoft Office\\Office15\\EXCEL.EXE")
+	key.Close()
+	key, _, _ = reg.CreateKey(HKLM, "SOFTWARE\\Microsoft\\Office\\17.0\\Word\\InstallRoot", keyAllAccess)
+	key.SetStringValue("Path", "C:\\Office17\\")
+	key.Close()
+
+	if err := hardenOrRestoreSubject(OfficeMacros, true); err != nil {
+		t.Fatal(err)
+	}
+	for name := range dumpRegistry(t, reg) {
+		if strings.HasPrefix(name, "CURRENT_USER\\SOFTWARE\\Microsoft\\Office\\") &&
+			!strings.HasPrefix(name, "CURRENT_USER\\SOFTWARE\\Microsoft\\Office\\15.0\\Excel\\") {
+			t.Errorf("%s has been hardened, but is not installed", name)
+		}
+	}
+
+	status := getHardenStatus(OfficeMacros)
+	if status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+	found := map[string]HardenState{}
+	for _, child := range status.Children {
+		if child.State != StateNotApplicable || child.Reason != "Office not installed" {
+			found[child.Name] = child.State
+		}
+	}
+	expected := map[string]HardenState{
+		"Office 15.0 Excel (App Paths)":          StateHardened,
+		"Office 17.0 Word (Office registration)": StateNotApplicable,
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("installs in status = %v", found)
+	}
+}
@@ -0,0 +1,170 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Planning (dry run) lists every change harden or restore would make
+// without changing anything. Harden subjects that only change the registry
+// are planned by executing them on a dryRunRegistry; subjects that execute
+// commands implement HardenPlanner.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HardenPlanner is implemented by harden subjects that do more than changing
+// registry values (e.g. executing PowerShell commands). Plan returns the
+// changes Harden(harden) would make, without changing anything; it may
+// execute commands that only query the current state.
+type HardenPlanner interface {
+	Plan(harden bool) ([]plannedOperation, error)
+}
+
+// plannedOperation is a single change harden or restore would make.
+type plannedOperation struct {
+	Subject string
+	Action  string // e.g. "set", "delete", "assoc", "ASR rule"
+	Target  string // e.g. the full path of a registry value
+	Current string
+	New     string
+}
+
+// String returns the operation as a single line.
+func (operation plannedOperation) String() string {
+	if operation.Current == "" && operation.New == "" {
+		return operation.Action + " " + operation.Target
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", operation.Action, operation.Target,
+		operation.Current, operation.New)
+}
+
+// formatPlannedValue formats a registry value for a planned operation.
+func formatPlannedValue(value *registryValue) string {
+	if value == nil {
+		return "(not existing)"
+	}
+	return registryValueTypeName(value.Type) + " " + value.String()
+}
+
+// errCommandInDryRun is returned if a harden subject without HardenPlanner
+// implementation executes a command during planning.
+var errCommandInDryRun = errors.New("can't plan harden subject that executes commands")
+
+// dryRunCommandRunner refuses to execute commands.
+type dryRunCommandRunner struct{}
+
+// Run returns errCommandInDryRun.
+func (dryRunCommandRunner) Run(name string, args ...string) (string, error) {
+	return "", errCommandInDryRun
+}
+
+// planAll returns the changes triggerAll(harden) (and, if restoring
+// everything, restoreSavedRegistryKeys) would make with the current
+// expertConfig. Nothing is changed.
+func planAll(harden bool) []plannedOperation {
+	completeRestore := !harden && isCompleteRestore()
+
+	dryRun := newDryRunRegistry(registryBackend)
+	previousBackend := registryBackend
+	registryBackend = dryRun
+	defer func() { registryBackend = previousBackend }()
+
+	for _, hardenSubject := range allHardenSubjects {
+		if expertConfig[hardenSubject.Name()] == true {
+			planSubject(dryRun, hardenSubject, harden)
+		}
+	}
+
+	if completeRestore {
+		if err := restoreSavedRegistryKeys(); err != nil {
+			dryRun.operations = append(dryRun.operations, plannedOperation{
+				Subject: "Saved original values",
+				Action:  "fails",
+				Target:  err.Error(),
+			})
+		}
+	}
+	for i := range dryRun.operations {
+		if dryRun.operations[i].Subject == "" {
+			// Saved by an older hardentools version.
+			dryRun.operations[i].Subject = "Saved original values"
+		}
+	}
+	return dryRun.operations
+}
+
+// planSingleSubject returns the changes hardening or restoring only
+// hardenSubject would make. Nothing is changed.
+func planSingleSubject(hardenSubject HardenInterface, harden bool) []plannedOperation {
+	dryRun := newDryRunRegistry(registryBackend)
+	previousBackend := registryBackend
+	registryBackend = dryRun
+	defer func() { registryBackend = previousBackend }()
+
+	planSubject(dryRun, hardenSubject, harden)
+	return dryRun.operations
+}
+
+// planSubject adds the operations of a single harden subject to dryRun.
+func planSubject(dryRun *dryRunRegistry, hardenSubject HardenInterface, harden bool) {
+	var operations []plannedOperation
+	var err error
+
+	if planner, ok := hardenSubject.(HardenPlanner); ok {
+		operations, err = planner.Plan(harden)
+	} else {
+		start := len(dryRun.operations)
+		previousRunner := commandRunner
+		commandRunner = dryRunCommandRunner{}
+		if harden {
+			err = hardenOrRestoreSubject(hardenSubject, harden)
+		} else {
+			err = restoreSubject(hardenSubject)
+		}
+		commandRunner = previousRunner
+
+		operations = append([]plannedOperation(nil), dryRun.operations[start:]...)
+		dryRun.operations = dryRun.operations[:start]
+	}
+
+	if err != nil {
+		// Operations done before the error are rolled back.
+		operations = []plannedOperation{{Action: "fails", Target: err.Error()}}
+	}
+	for _, operation := range operations {
+		operation.Subject = hardenSubject.Name()
+		dryRun.operations = append(dryRun.operations, operation)
+	}
+}
+
+// printPlan writes the planned operations grouped by harden subject.
+func printPlan(w io.Writer, operations []plannedOperation) {
+	if len(operations) == 0 {
+		fmt.Fprintln(w, "Nothing to do.")
+		return
+	}
+
+	subject := ""
+	for i, operation := range operations {
+		if i == 0 || operation.Subject != subject {
+			subject = operation.Subject
+			fmt.Fprintf(w, "%s:\n", subject)
+		}
+		fmt.Fprintf(w, "  %s\n", operation)
+	}
+}
@@ -0,0 +1,149 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useSubjects selects the harden subjects for triggerAll and planAll for the
+// duration of the test.
+func useSubjects(t *testing.T, subjects ...HardenInterface) {
+	t.Helper()
+	previousSubjects, previousConfig := allHardenSubjects, expertConfig
+	allHardenSubjects = subjects
+	expertConfig = make(map[string]bool)
+	for _, subject := range subjects {
+		expertConfig[subject.Name()] = true
+	}
+	t.Cleanup(func() {
+		allHardenSubjects, expertConfig = previousSubjects, previousConfig
+	})
+}
+
+// planLines returns the planned operations of subject as strings.
+func planLines(operations []plannedOperation, subject string) []string {
+	var lines []string
+	for _, operation := range operations {
+		if operation.Subject == subject {
+			lines = append(lines, operation.String())
+		}
+	}
+	return lines
+}
+
+func TestPlanHarden(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	reg.SetAccessDenied(HKLM, "", true)
+	useSubjects(t, WSH, Cmd, UAC)
+	before := dumpRegistry(t, reg)
+
+	operations := planAll(true)
+
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry has been changed by planning:\nbefore: %v\nafter:  %v", before, after)
+	}
+
+	expected := []string{"set CURRENT_USER\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled: REG_DWORD 1 -> REG_DWORD 0"}
+	if lines := planLines(operations, WSH.Name()); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("plan of %s = %q", WSH.Name(), lines)
+	}
+	// The DisallowRun flag is already set.
+	expected = []string{
+		"DisallowRun set CURRENT_USER\\" + explorerDisallowRunKey + "\\2: (not existing) -> REG_SZ cmd.exe",
+	}
+	if lines := planLines(operations, Cmd.Name()); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("plan of %s = %q", Cmd.Name(), lines)
+	}
+	lines := planLines(operations, UAC.Name())
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "fails ") {
+		t.Errorf("plan of %s without privileges = %q", UAC.Name(), lines)
+	}
+
+	for _, operation := range operations {
+		if strings.Contains(operation.Target, "Security Without Borders") {
+			t.Errorf("hardentools state is part of the plan: %s", operation)
+		}
+	}
+}
+
+func TestPlanRestore(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	useSubjects(t, WSH, ShowFileExt)
+
+	if err := triggerAll(true); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(true)
+	before := dumpRegistry(t, reg)
+
+	operations := planAll(false)
+
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry has been changed by planning:\nbefore: %v\nafter:  %v", before, after)
+	}
+	expected := []string{"set CURRENT_USER\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled: REG_DWORD 0 -> REG_DWORD 1"}
+	if lines := planLines(operations, WSH.Name()); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("plan of %s = %q", WSH.Name(), lines)
+	}
+	expected = []string{
+		"delete CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced\\ShowSuperHidden: REG_DWORD 1 -> (not existing)",
+		"delete CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced\\Hidden: REG_DWORD 1 -> (not existing)",
+		"set CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced\\HideFileExt: REG_DWORD 0 -> REG_DWORD 1",
+	}
+	if lines := planLines(operations, ShowFileExt.Name()); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("plan of %s = %q", ShowFileExt.Name(), lines)
+	}
+}
+
+func TestPlanFileAssociations(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	useCommandTranscript(t, "assoc_not_hardened.json")
+	key, _, _ := reg.CreateKey(HKCU, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FileExts\\.js\\OpenWithProgids", keyAllAccess)
+	key.SetStringValue("JSFile", "")
+	key.Close()
+	useSubjects(t, FileAssociations)
+
+	lines := planLines(planAll(true), FileAssociations.Name())
+	if len(lines) != 12 || lines[0] != "assoc .hta: htafile -> (none)" ||
+		lines[2] != "delete CURRENT_USER\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FileExts\\.js\\OpenWithProgids\\JSFile: REG_SZ  -> (not existing)" {
+		t.Errorf("plan = %q", lines)
+	}
+}
+
+func TestPlanWindowsASR(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	setWindowsVersion(t, reg, "19045")
+	useCommandTranscript(t, "asr_audit_mode.json")
+	useSubjects(t, WindowsASR)
+
+	var out bytes.Buffer
+	printPlan(&out, planAll(true))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(ruleIDArray)+1 || lines[0] != WindowsASR.Name()+":" {
+		t.Fatalf("plan = %s", out.String())
+	}
+	if lines[1] != "  ASR rule "+ruleIDArray[0]+": Enabled -> Enabled" ||
+		lines[5] != "  ASR rule "+ruleIDArray[4]+": Audit -> Enabled" {
+		t.Errorf("plan = %s", out.String())
+	}
+}
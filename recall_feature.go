@@ -113,19 +113,13 @@ func (recall RecallStruct) Harden(harden bool) error {
 
 // IsHardened checks if Recall is already hardened.
 func (recall RecallStruct) IsHardened() bool {
-	psStringTest := "Get-WindowsOptionalFeature -Online -FeatureName \"Recall\" | Select-Object -ExpandProperty State"
-	Info.Printf("Recall: Executing Powershell.exe with command \"%s\"", psStringTest)
-	out, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psStringTest)
+	state, err := getRecallState()
 	if err != nil {
-		Info.Printf("ERROR: Recall: Executing Powershell.exe with command \"%s\" failed", psStringTest)
-		Info.Printf("ERROR: Recall: Powershell Output was: %s", out)
 		return false
 	}
 
-	Info.Printf("Recall: Powershell output for test of status was:\n%s", out)
-	out = strings.ReplaceAll(out, "\r\n", "")
 	// Output should start with "Disabled", e.g. it should be "DisabledWithPayloadRemoved"
-	if strings.HasPrefix(out, "Disabled") {
+	if strings.HasPrefix(state, "Disabled") {
 		Info.Print("Recall: Is hardened")
 		return true
 	}
@@ -133,6 +127,59 @@ func (recall RecallStruct) IsHardened() bool {
 	return false
 }
 
+// Status returns the state of the Recall feature. It is not applicable if
+// Windows doesn't know the feature and unknown if PowerShell didn't run.
+func (recall RecallStruct) Status() HardenStatus {
+	state, err := getRecallState()
+	var exitErr *CommandExitError
+	switch {
+	case errors.As(err, &exitErr), err == nil && state == "":
+		return HardenStatus{State: StateNotApplicable, Reason: "Recall is not available"}
+	case err != nil:
+		return HardenStatus{State: StateUnknown, Reason: "PowerShell failed: " + err.Error()}
+	case strings.HasPrefix(state, "Disabled"):
+		return HardenStatus{State: StateHardened, Reason: state}
+	}
+	return HardenStatus{State: StateNotHardened, Reason: state}
+}
+
+// Plan returns the state change of the Recall feature Harden would make.
+func (recall RecallStruct) Plan(harden bool) ([]plannedOperation, error) {
+	state, err := getRecallState()
+	if err != nil {
+		return nil, errors.New("could not get state of Recall feature")
+	}
+
+	operation := plannedOperation{Action: "optional feature", Target: "Recall", Current: state}
+	if harden {
+		operation.New = "DisabledWithPayloadRemoved"
+	} else {
+		savedState, err := getSavedHardenState(featureName)
+		if err != nil || savedState != "enabled" {
+			// Harden(false) will not restore anything.
+			return nil, nil
+		}
+		operation.New = "Enabled"
+	}
+	return []plannedOperation{operation}, nil
+}
+
+// getRecallState returns the state of the Recall feature (e.g. "Enabled",
+// "DisabledWithPayloadRemoved").
+func getRecallState() (string, error) {
+	psStringTest := "Get-WindowsOptionalFeature -Online -FeatureName \"Recall\" | Select-Object -ExpandProperty State"
+	Info.Printf("Recall: Executing Powershell.exe with command \"%s\"", psStringTest)
+	out, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psStringTest)
+	if err != nil {
+		Info.Printf("ERROR: Recall: Executing Powershell.exe with command \"%s\" failed", psStringTest)
+		Info.Printf("ERROR: Recall: Powershell Output was: %s", out)
+		return "", err
+	}
+
+	Info.Printf("Recall: Powershell output for test of status was:\n%s", out)
+	return strings.ReplaceAll(out, "\r\n", ""), nil
+}
+
 // Name returns Name.
 func (recall RecallStruct) Name() string {
 	return recall.shortName
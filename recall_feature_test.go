@@ -0,0 +1,56 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestRecallHardenRestore(t *testing.T) {
+	useMemoryRegistry(t)
+	useCommandTranscript(t, "recall_harden_restore.json")
+
+	if err := Recall.Harden(true); err != nil {
+		t.Fatalf("Harden(true) = %s", err)
+	}
+	if state, _ := getSavedHardenState(featureName); state != "enabled" {
+		t.Errorf("saved state = %q, expected \"enabled\"", state)
+	}
+
+	if err := Recall.Harden(false); err != nil {
+		t.Fatalf("Harden(false) = %s", err)
+	}
+	if _, err := getSavedHardenState(featureName); err == nil {
+		t.Error("saved state has not been deleted after restore")
+	}
+}
+
+func TestRecallNotAvailable(t *testing.T) {
+	useMemoryRegistry(t)
+	useCommandTranscript(t, "recall_not_available.json")
+
+	if Recall.IsHardened() {
+		t.Error("IsHardened() = true if Recall feature is unknown")
+	}
+}
+
+func TestRecallHardenTimeout(t *testing.T) {
+	useMemoryRegistry(t)
+	useCommandTranscript(t, "recall_harden_timeout.json")
+
+	if err := Recall.Harden(true); err == nil {
+		t.Error("Harden(true) did not fail after timeout")
+	}
+}
@@ -0,0 +1,522 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Parser for Windows Registry Editor (.reg) files as written by regedit:
+//
+//	Windows Registry Editor Version 5.00
+//
+//	; comment
+//	[HKEY_CURRENT_USER\Software\Example]
+//	"String"="text with \"quotes\" and \\ backslashes"
+//	"Number"=dword:00000001
+//	"Binary"=hex:01,02,03
+//	"Multi"=hex(7):61,00,00,00,00,00
+//	"Deleted"=-
+//	@="default value"
+//
+//	[-HKEY_CURRENT_USER\Software\Deleted]
+//
+// Long hex lists are continued on the next line after a trailing backslash.
+// regedit writes version 5 files in UTF-16LE; strings in hex(1), hex(2)
+// and hex(7) data are UTF-16LE as well, except in REGEDIT4 files.
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Headers of .reg files.
+const (
+	regFileHeader  = "Windows Registry Editor Version 5.00"
+	regFileHeader4 = "REGEDIT4"
+)
+
+// regFileRootKeyNames contains the root key names written to .reg files.
+var regFileRootKeyNames = map[RegistryRootKey]string{
+	HKCR: "HKEY_CLASSES_ROOT",
+	HKCU: "HKEY_CURRENT_USER",
+	HKLM: "HKEY_LOCAL_MACHINE",
+	HKU:  "HKEY_USERS",
+	HKCC: "HKEY_CURRENT_CONFIG",
+}
+
+// regFileRootKeys contains the root key names accepted in .reg files.
+var regFileRootKeys = map[string]RegistryRootKey{
+	"HKEY_CLASSES_ROOT":   HKCR,
+	"HKEY_CURRENT_USER":   HKCU,
+	"HKEY_LOCAL_MACHINE":  HKLM,
+	"HKEY_USERS":          HKU,
+	"HKEY_CURRENT_CONFIG": HKCC,
+	"HKCR":                HKCR,
+	"HKCU":                HKCU,
+	"HKLM":                HKLM,
+	"HKU":                 HKU,
+	"HKCC":                HKCC,
+}
+
+// regFile is the content of a .reg file.
+type regFile struct {
+	Keys []*regFileKey
+}
+
+// regFileKey is a key section of a .reg file.
+type regFileKey struct {
+	Line    int // Line of the section header.
+	RootKey RegistryRootKey
+	Path    string
+	Delete  bool // Key is deleted ([-HKEY_...]).
+	Values  []regFileValue
+}
+
+// regFileValue is a value of a key section. Value is nil if the value is
+// deleted ("name"=-).
+type regFileValue struct {
+	Line  int
+	Name  string // Empty for the default value (@).
+	Value *registryValue
+}
+
+// loadRegFile reads and parses the .reg file fileName.
+func loadRegFile(fileName string) (*regFile, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return parseRegFile(filepath.Base(fileName), data)
+}
+
+// parseRegFile parses the content of a .reg file. name is only used in error
+// messages.
+func parseRegFile(name string, data []byte) (*regFile, error) {
+	lines := strings.Split(decodeRegFileText(data), "\n")
+	file := &regFile{}
+	headerSeen := false
+	unicode := true
+	var key *regFileKey
+
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(lines[i])
+
+		// Join continued lines.
+		for strings.HasSuffix(line, "\\") && !strings.HasPrefix(line, "[") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + strings.TrimSpace(lines[i])
+		}
+
+		if !headerSeen {
+			// The first non-empty line must be the header.
+			switch line {
+			case "":
+				continue
+			case regFileHeader:
+			case regFileHeader4:
+				unicode = false
+			default:
+				return nil, fmt.Errorf("%s:%d: not a registry file, expected %q", name, lineNumber, regFileHeader)
+			}
+			headerSeen = true
+			continue
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "["):
+			var err error
+			key, err = parseRegFileKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+			}
+			key.Line = lineNumber
+			file.Keys = append(file.Keys, key)
+		default:
+			if key == nil {
+				return nil, fmt.Errorf("%s:%d: value outside of a key", name, lineNumber)
+			}
+			if key.Delete {
+				return nil, fmt.Errorf("%s:%d: value of a deleted key", name, lineNumber)
+			}
+			value, err := parseRegFileValue(line, unicode)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+			}
+			value.Line = lineNumber
+			key.Values = append(key.Values, value)
+		}
+	}
+
+	if !headerSeen {
+		return nil, fmt.Errorf("%s: not a registry file, expected %q", name, regFileHeader)
+	}
+	return file, nil
+}
+
+// decodeRegFileText returns the text of a .reg file encoded in UTF-16LE
+// (with byte order mark) or UTF-8 with normalized line endings.
+func decodeRegFileText(data []byte) string {
+	var text string
+	switch {
+	case len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe:
+		text = decodeUTF16LE(data[2:])
+	case len(data) >= 3 && data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf:
+		text = string(data[3:])
+	default:
+		text = string(data)
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// decodeUTF16LE decodes UTF-16LE data. A trailing odd byte is ignored.
+func decodeUTF16LE(data []byte) string {
+	codes := make([]uint16, len(data)/2)
+	for i := range codes {
+		codes[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(codes))
+}
+
+// parseRegFileKey parses a key section header like [HKEY_CURRENT_USER\Path]
+// or [-HKEY_CURRENT_USER\Path].
+func parseRegFileKey(line string) (*regFileKey, error) {
+	if !strings.HasSuffix(line, "]") {
+		return nil, fmt.Errorf("missing ] in key %s", line)
+	}
+	fullPath := line[1 : len(line)-1]
+	key := &regFileKey{}
+	if strings.HasPrefix(fullPath, "-") {
+		key.Delete = true
+		fullPath = fullPath[1:]
+	}
+
+	rootKeyName, path, _ := strings.Cut(fullPath, "\\")
+	rootKey, ok := regFileRootKeys[strings.ToUpper(rootKeyName)]
+	if !ok {
+		return nil, fmt.Errorf("invalid root key %q", rootKeyName)
+	}
+	path = strings.Trim(path, "\\")
+	if path == "" {
+		return nil, errors.New("root keys can't be changed")
+	}
+	key.RootKey = rootKey
+	key.Path = path
+	return key, nil
+}
+
+// parseRegFileValue parses a value line like "name"=dword:00000001.
+func parseRegFileValue(line string, unicode bool) (regFileValue, error) {
+	var value regFileValue
+	var rest string
+
+	if strings.HasPrefix(line, "@") {
+		rest = line[1:]
+	} else if strings.HasPrefix(line, "\"") {
+		var err error
+		value.Name, rest, err = parseRegFileString(line)
+		if err != nil {
+			return value, err
+		}
+	} else {
+		return value, fmt.Errorf("invalid value %s", line)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return value, fmt.Errorf("missing = after value name %q", value.Name)
+	}
+	data := strings.TrimSpace(rest[1:])
+
+	var err error
+	value.Value, err = parseRegFileData(data, unicode)
+	if err != nil {
+		return value, fmt.Errorf("value %q: %w", value.Name, err)
+	}
+	return value, nil
+}
+
+// parseRegFileString parses a quoted string with \\ and \" escapes at the
+// start of s and returns the unescaped string and the rest of s.
+func parseRegFileString(s string) (str string, rest string, err error) {
+	var builder strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", errors.New("unterminated string")
+			}
+			i++
+			builder.WriteByte(s[i])
+		case '"':
+			return builder.String(), s[i+1:], nil
+		default:
+			builder.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// parseRegFileData parses the data of a value. It returns nil if the value
+// is deleted.
+func parseRegFileData(data string, unicode bool) (*registryValue, error) {
+	lowerData := strings.ToLower(data)
+
+	switch {
+	case data == "-":
+		return nil, nil
+	case strings.HasPrefix(data, "\""):
+		str, rest, err := parseRegFileString(data)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return stringValue(str), nil
+	case strings.HasPrefix(lowerData, "dword:"):
+		digits := data[len("dword:"):]
+		if len(digits) == 0 || len(digits) > 8 {
+			return nil, fmt.Errorf("invalid dword %q", digits)
+		}
+		number, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dword %q", digits)
+		}
+		return dwordValue(uint32(number)), nil
+	case strings.HasPrefix(lowerData, "hex:"):
+		bytes, err := parseRegFileHex(data[len("hex:"):])
+		if err != nil {
+			return nil, err
+		}
+		return &registryValue{Type: regBinary, Binary: bytes}, nil
+	case strings.HasPrefix(lowerData, "hex("):
+		typeEnd := strings.Index(lowerData, "):")
+		if typeEnd < 0 {
+			return nil, fmt.Errorf("invalid data %s", data)
+		}
+		valtype, err := strconv.ParseUint(data[len("hex("):typeEnd], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type in %s", data)
+		}
+		bytes, err := parseRegFileHex(data[typeEnd+2:])
+		if err != nil {
+			return nil, err
+		}
+		return regFileHexValue(uint32(valtype), bytes, unicode)
+	}
+	return nil, fmt.Errorf("invalid data %s", data)
+}
+
+// parseRegFileHex parses comma separated hex bytes.
+func parseRegFileHex(data string) ([]byte, error) {
+	bytes := []byte{}
+	if strings.TrimSpace(data) == "" {
+		return bytes, nil
+	}
+	for _, hexByte := range strings.Split(data, ",") {
+		hexByte = strings.TrimSpace(hexByte)
+		if len(hexByte) != 2 {
+			return nil, fmt.Errorf("invalid hex byte %q", hexByte)
+		}
+		decoded, err := hex.DecodeString(hexByte)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex byte %q", hexByte)
+		}
+		bytes = append(bytes, decoded[0])
+	}
+	return bytes, nil
+}
+
+// regFileHexValue converts the bytes of hex(valtype) data to a value.
+func regFileHexValue(valtype uint32, bytes []byte, unicode bool) (*registryValue, error) {
+	decodeString := func() string {
+		if unicode {
+			return decodeUTF16LE(bytes)
+		}
+		return string(bytes)
+	}
+
+	value := &registryValue{Type: valtype}
+	switch valtype {
+	case regSZ, regExpandSZ:
+		value.Str = strings.TrimRight(decodeString(), "\x00")
+	case regMultiSZ:
+		value.Strings = []string{}
+		if str := strings.TrimRight(decodeString(), "\x00"); str != "" {
+			value.Strings = strings.Split(str, "\x00")
+		}
+	case regBinary:
+		value.Binary = bytes
+	case regDWORD:
+		if len(bytes) != 4 {
+			return nil, fmt.Errorf("REG_DWORD needs 4 bytes, got %d", len(bytes))
+		}
+		value.Integer = uint64(binary.LittleEndian.Uint32(bytes))
+	case regQWORD:
+		if len(bytes) != 8 {
+			return nil, fmt.Errorf("REG_QWORD needs 8 bytes, got %d", len(bytes))
+		}
+		value.Integer = binary.LittleEndian.Uint64(bytes)
+	default:
+		// hex(0) (REG_NONE) and other types are kept as raw data.
+		value.Binary = bytes
+	}
+	return value, nil
+}
+
+// formatRegFile returns a .reg file that sets (or deletes) all settings, in
+// the format written by regedit (UTF-16LE with CRLF line endings).
+func formatRegFile(settings []registrySetting) []byte {
+	type regFileSection struct {
+		header string
+		lines  []string
+	}
+	var sections []*regFileSection
+	sectionsByKey := make(map[string]*regFileSection)
+
+	for _, setting := range settings {
+		header := "[" + regFileRootKeyNames[setting.RootKey] + "\\" + setting.Path + "]"
+		if setting.DeleteKey {
+			header = "[-" + header[1:]
+		}
+		section, ok := sectionsByKey[strings.ToLower(header)]
+		if !ok {
+			section = &regFileSection{header: header}
+			sectionsByKey[strings.ToLower(header)] = section
+			sections = append(sections, section)
+		}
+		if !setting.DeleteKey && !setting.CreateKey {
+			section.lines = append(section.lines, formatRegFileValue(setting.ValueName, setting.Value))
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(regFileHeader + "\n\n")
+	for _, section := range sections {
+		builder.WriteString(section.header + "\n")
+		for _, line := range section.lines {
+			builder.WriteString(line + "\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	text := strings.ReplaceAll(builder.String(), "\n", "\r\n")
+	return append([]byte{0xff, 0xfe}, encodeUTF16LE(text)...)
+}
+
+// formatRegFileValue returns the .reg file line for a value. value is nil if
+// the value is deleted.
+func formatRegFileValue(name string, value *registryValue) string {
+	escape := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace
+	line := "@="
+	if name != "" {
+		line = "\"" + escape(name) + "\"="
+	}
+
+	switch {
+	case value == nil:
+		return line + "-"
+	case value.Type == regSZ:
+		return line + "\"" + escape(value.Str) + "\""
+	case value.Type == regDWORD:
+		return line + fmt.Sprintf("dword:%08x", value.Integer)
+	case value.Type == regBinary:
+		return formatRegFileHex(line+"hex:", value.rawData())
+	}
+	return formatRegFileHex(line+fmt.Sprintf("hex(%x):", value.Type), value.rawData())
+}
+
+// formatRegFileHex returns prefix followed by the comma separated hex bytes
+// of data, continued on indented lines like regedit does.
+func formatRegFileHex(prefix string, data []byte) string {
+	var builder strings.Builder
+	line := prefix
+	for i, b := range data {
+		item := fmt.Sprintf("%02x", b)
+		if i < len(data)-1 {
+			item += ","
+		}
+		if len(line)+len(item) > 79 {
+			builder.WriteString(line + "\\\n")
+			line = "  "
+		}
+		line += item
+	}
+	builder.WriteString(line)
+	return builder.String()
+}
+
+// regFileSubject returns a harden subject named name that sets (or deletes)
+// all values and deletes all keys of file. Key sections without values
+// create the key. Keys are deleted before any value is set.
+func regFileSubject(name string, file *regFile) (*RegistryMultiValue, error) {
+	subject := &RegistryMultiValue{
+		shortName:       name,
+		longName:        "Registry file " + name,
+		description:     "Sets the registry values of " + name + ".",
+		hardenByDefault: true,
+	}
+	for _, key := range file.Keys {
+		rootKeyName, _ := getRootKeyName(key.RootKey)
+		if key.Delete {
+			subject.ArrayKeyAbsent = append(subject.ArrayKeyAbsent, &RegistryKeyAbsent{
+				RootKey:   key.RootKey,
+				Path:      key.Path,
+				shortName: rootKeyName + "\\" + key.Path,
+			})
+			continue
+		}
+		if len(key.Values) == 0 {
+			subject.ArrayKeyPresent = append(subject.ArrayKeyPresent, &RegistryKeyPresent{
+				RootKey:   key.RootKey,
+				Path:      key.Path,
+				shortName: rootKeyName + "\\" + key.Path,
+			})
+		}
+		for _, value := range key.Values {
+			subject.ArraySingleValue = append(subject.ArraySingleValue, &RegistrySingleValue{
+				RootKey:       key.RootKey,
+				Path:          key.Path,
+				ValueName:     value.Name,
+				HardenedValue: value.Value,
+				shortName:     rootKeyName + "\\" + key.Path + "\\" + value.Name,
+			})
+		}
+	}
+	if len(subject.ArraySingleValue) == 0 && len(subject.ArrayKeyAbsent) == 0 && len(subject.ArrayKeyPresent) == 0 {
+		return nil, fmt.Errorf("%s contains no registry values", name)
+	}
+	return subject, nil
+}
+
+// loadRegFileSubject returns the harden subject for the .reg file fileName.
+// It is named after the file, so the values it hardened can be restored
+// later with the same file.
+func loadRegFileSubject(fileName string) (*RegistryMultiValue, error) {
+	file, err := loadRegFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return regFileSubject(filepath.Base(fileName), file)
+}
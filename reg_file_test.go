@@ -0,0 +1,213 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegFile(t *testing.T) {
+	file, err := loadRegFile(filepath.Join("testdata", "reg", "hardening.reg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Keys) != 2 || file.Keys[0].RootKey != HKCU || file.Keys[0].Path != "Software\\Example\\Security" ||
+		file.Keys[1].RootKey != HKLM || file.Keys[1].Path != "SOFTWARE\\Policies\\Example" {
+		t.Fatalf("parsed keys %+v", file.Keys)
+	}
+	expected := []regFileValue{
+		{5, "Enabled", dwordValue(0)},
+		{6, "Level", dwordValue(0x1f)},
+		{7, "Mode", stringValue("strict")},
+		{8, "Path", stringValue("C:\\Program Files\\Example \"Safe\"")},
+		{9, "", stringValue("default")},
+		{10, "ExpandPath", &registryValue{Type: regExpandSZ, Str: "%ProgramFiles%"}},
+		{12, "Extensions", &registryValue{Type: regMultiSZ, Strings: []string{".exe", ".js"}}},
+		{14, "Quota", &registryValue{Type: regQWORD, Integer: 1 << 32}},
+		{15, "Key", &registryValue{Type: regBinary, Binary: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		{16, "Legacy", nil},
+	}
+	if !reflect.DeepEqual(file.Keys[0].Values, expected) {
+		t.Errorf("parsed values:\n%+v\nexpected:\n%+v", file.Keys[0].Values, expected)
+	}
+	if values := file.Keys[1].Values; len(values) != 1 || !values[0].Value.Equal(dwordValue(0x201)) {
+		t.Errorf("parsed hex(4) value %+v", values)
+	}
+}
+
+func TestParseRegFileREGEDIT4(t *testing.T) {
+	data := "REGEDIT4\n\n[HKCU\\Software\\Example]\n\"Expand\"=hex(2):25,54,45,4d,50,25,00\n\n[-HKCU\\Software\\Example\\Old]\n"
+	file, err := parseRegFile("old.reg", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Keys) != 2 || !file.Keys[1].Delete ||
+		!file.Keys[0].Values[0].Value.Equal(&registryValue{Type: regExpandSZ, Str: "%TEMP%"}) {
+		t.Errorf("parsed %+v", file.Keys)
+	}
+	subject, err := regFileSubject("old.reg", file)
+	if err != nil || len(subject.ArrayKeyAbsent) != 1 || subject.ArrayKeyAbsent[0].Path != "Software\\Example\\Old" {
+		t.Errorf("regFileSubject with deleted key returned %+v, %v", subject, err)
+	}
+}
+
+func TestRegFileRawValuesAndEmptyKeys(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	data := regFileHeader + "\n\n[HKCU\\Software\\Example]\n\"None\"=hex(0):\n\"List\"=hex(8):01,02\n\n" +
+		"[HKCU\\Software\\Example\\Empty]\n"
+	file, err := parseRegFile("raw.reg", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := file.Keys[0].Values
+	if len(values) != 2 || !values[0].Value.Equal(&registryValue{Type: regNone, Binary: []byte{}}) ||
+		!values[1].Value.Equal(&registryValue{Type: 8, Binary: []byte{1, 2}}) {
+		t.Errorf("parsed values %+v", values)
+	}
+
+	subject, err := regFileSubject("raw.reg", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subject.ArrayKeyPresent) != 1 || subject.ArrayKeyPresent[0].Path != "Software\\Example\\Empty" {
+		t.Fatalf("regFileSubject with empty key returned %+v", subject)
+	}
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	if !registryKeyExists(HKCU, "Software\\Example\\Empty") {
+		t.Error("empty key has not been created")
+	}
+	if after := dumpRegistry(t, reg); after["CURRENT_USER\\Software\\Example\\List"] != "8:0102" ||
+		after["CURRENT_USER\\Software\\Example\\None"] != "0:" {
+		t.Errorf("raw values have not been set: %v", after)
+	}
+	if status := getHardenStatus(subject); status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+
+	// Exporting the subject results in the same file.
+	settings, err := subject.RegistrySettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := parseRegFile("exported.reg", formatRegFile(settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutLines := func(keys []*regFileKey) []regFileKey {
+		var result []regFileKey
+		for _, key := range keys {
+			stripped := *key
+			stripped.Line = 0
+			stripped.Values = nil
+			for _, value := range key.Values {
+				value.Line = 0
+				stripped.Values = append(stripped.Values, value)
+			}
+			result = append(result, stripped)
+		}
+		return result
+	}
+	if got, expected := withoutLines(exported.Keys), withoutLines(file.Keys); !reflect.DeepEqual(got, expected) {
+		t.Errorf("exported keys %+v, expected %+v", got, expected)
+	}
+}
+
+func TestParseRegFileErrors(t *testing.T) {
+	header := regFileHeader + "\n"
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"", "not a registry file"},
+		{"[HKEY_CURRENT_USER\\Software]\n", "test.reg:1: not a registry file"},
+		{header + "\"A\"=dword:1\n", "test.reg:2: value outside of a key"},
+		{header + "[HKEY_CURRENT_USER\\Software\n", "missing ]"},
+		{header + "[HKEY_NOWHERE\\Software]\n", "invalid root key"},
+		{header + "[HKEY_CURRENT_USER]\n", "root keys can't be changed"},
+		{header + "[-HKCU\\Software]\n\"A\"=-\n", "value of a deleted key"},
+		{header + "[HKCU\\Software]\n\"A=dword:1\n", "unterminated string"},
+		{header + "[HKCU\\Software]\n\"A\"dword:1\n", "missing ="},
+		{header + "[HKCU\\Software]\n\"A\"=dword:100000000\n", "invalid dword"},
+		{header + "[HKCU\\Software]\n\"A\"=hex:1,2\n", "invalid hex byte"},
+		{header + "[HKCU\\Software]\n\"A\"=hex(4):01,02\n", "REG_DWORD needs 4 bytes"},
+		{header + "[HKCU\\Software]\n\"A\"=\"x\" y\n", "unexpected"},
+		{header + "[HKCU\\Software]\n\"A\"=word:1\n", "test.reg:3: value \"A\": invalid data"},
+	}
+	for _, test := range tests {
+		_, err := parseRegFile("test.reg", []byte(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("parseRegFile(%q) = %v, expected %q", test.data, err, test.expected)
+		}
+	}
+}
+
+func TestApplyRegFile(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Example\\Security", keyAllAccess)
+	key.SetStringValue("Mode", "lax")
+	key.SetDWordValue("Legacy", 1)
+	key.Close()
+	before := dumpRegistry(t, reg)
+
+	subject, err := loadRegFileSubject(filepath.Join("testdata", "reg", "hardening.reg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject.Name() != "hardening.reg" || len(subject.ArraySingleValue) != 11 {
+		t.Fatalf("subject %s with %d values", subject.Name(), len(subject.ArraySingleValue))
+	}
+	if status := getHardenStatus(subject); status.State != StateNotHardened {
+		t.Errorf("status before hardening = %s", status)
+	}
+
+	if err := hardenOrRestoreSubject(subject, true); err != nil {
+		t.Fatal(err)
+	}
+	after := dumpRegistry(t, reg)
+	if _, ok := after["CURRENT_USER\\Software\\Example\\Security\\Legacy"]; ok {
+		t.Errorf("Legacy has not been deleted: %v", after)
+	}
+	if after["CURRENT_USER\\Software\\Example\\Security\\Extensions"] == "" ||
+		after["LOCAL_MACHINE\\SOFTWARE\\Policies\\Example\\Flags"] == "" {
+		t.Errorf("values have not been set: %v", after)
+	}
+	if status := getHardenStatus(subject); status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+
+	if err := restoreSubject(subject); err != nil {
+		t.Fatal(err)
+	}
+	restored := dumpRegistry(t, reg)
+	deleteBackupJournal(restored)
+	for name, value := range before {
+		if restored[name] != value {
+			t.Errorf("%s = %q after restore, expected %q", name, restored[name], value)
+		}
+	}
+	for name := range restored {
+		if _, ok := before[name]; !ok {
+			t.Errorf("%s still exists after restore", name)
+		}
+	}
+}
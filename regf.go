@@ -0,0 +1,1032 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Registry hive files (regf format) start with a 4096 byte base block
+// followed by hive bins. A hive bin ("hbin") is a multiple of 4096 bytes
+// and contains cells: a signed 32 bit size (negative if the cell is
+// allocated) followed by the cell data. Cells reference each other by their
+// offset relative to the first hive bin. Keys are stored in "nk" cells,
+// values in "vk" cells, subkey lists in "lf", "lh", "li" and "ri" cells,
+// security descriptors in "sk" cells and value data larger than 16344 bytes
+// in "db" cells (big data).
+//
+// Windows writes changes to the transaction logs (.LOG1 and .LOG2) first, so
+// a hive file can be outdated or incomplete ("dirty"). The log entries are
+// applied when the hive is read (see recoverRegfHive). Hives are written as
+// a whole with a sequence number higher than any log entry, so Windows
+// ignores the old logs.
+//
+// The format is described in the "Windows registry file format
+// specification" by Maxim Suhanov.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	regfBaseBlockSize    = 4096
+	regfBinHeaderSize    = 32
+	regfBinAlignment     = 4096
+	regfChecksumOffset   = 0x1fc
+	regfLogBaseBlockSize = 512
+	// regfNoCell is the offset of cells that don't exist.
+	regfNoCell = 0xffffffff
+	// regfBigDataSegmentSize is the maximum size of a value data cell.
+	// Larger data is split into segments (minor version 4 and later).
+	regfBigDataSegmentSize = 16344
+	// regfMaxListEntries is the number of subkeys per subkey list. Keys with
+	// more subkeys get an index ("ri") of several lists.
+	regfMaxListEntries = 511
+	// regfMaxDepth limits the nesting of keys, as Windows does.
+	regfMaxDepth = 512
+	// regfDefaultMinorVersion is used for hives created by hardentools.
+	regfDefaultMinorVersion = 5
+	// regfMarvinSeed is the seed of the Marvin32 hashes of log entries.
+	regfMarvinSeed = 0x82ef4d887a4e55c5
+)
+
+// File types of the base block.
+const (
+	regfFileTypePrimary = 0
+	regfFileTypeLog     = 6 // Transaction log of Windows 8.1 and later.
+)
+
+// Flags of nk and vk records.
+const (
+	regfKeyHiveEntry     = 0x0004
+	regfKeyNoDelete      = 0x0008
+	regfKeyCompName      = 0x0020
+	regfValueCompName    = 0x0001
+	regfValueInlineFlag  = 0x80000000
+	regfFiletimeUnixDiff = 116444736000000000 // 100ns intervals 1601-1970.
+)
+
+var errRegfDirty = errors.New("hive file has not been written completely and there is no transaction log to recover it")
+
+// regfHive is the content of a hive file.
+type regfHive struct {
+	Sequence     uint32 // Sequence number of the last write.
+	LastWritten  uint64 // FILETIME of the last write.
+	MinorVersion uint32
+	FileName     string // Path of the hive file, as stored by Windows.
+	Root         *regfKey
+}
+
+// regfKey is a key of a hive file.
+type regfKey struct {
+	Name        string
+	Class       []byte // Raw class name (UTF-16LE), nil if there is none.
+	LastWritten uint64 // FILETIME
+	Flags       uint16 // Flags of the nk record, name compression excluded.
+	AccessBits  uint32
+	Security    []byte // Self-relative security descriptor.
+	SubKeys     []*regfKey
+	Values      []*regfValue
+}
+
+// regfValue is a value of a hive file. Data is kept as stored, so values
+// hardentools doesn't touch are written back unchanged.
+type regfValue struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// regfChecksum returns the checksum of a base block: the XOR of its first
+// 127 DWORDs, where 0 and 0xffffffff are not allowed.
+func regfChecksum(base []byte) uint32 {
+	var checksum uint32
+	for i := 0; i < regfChecksumOffset; i += 4 {
+		checksum ^= binary.LittleEndian.Uint32(base[i:])
+	}
+	switch checksum {
+	case 0xffffffff:
+		return 0xfffffffe
+	case 0:
+		return 1
+	}
+	return checksum
+}
+
+// checkRegfBaseBlock verifies signature and checksum of the base block of a
+// hive or transaction log file.
+func checkRegfBaseBlock(data []byte) error {
+	if len(data) < regfLogBaseBlockSize || string(data[:4]) != "regf" {
+		return errors.New("not a registry hive file")
+	}
+	if regfChecksum(data) != binary.LittleEndian.Uint32(data[regfChecksumOffset:]) {
+		return errors.New("base block checksum mismatch")
+	}
+	if major := binary.LittleEndian.Uint32(data[0x14:]); major != 1 {
+		return fmt.Errorf("hive format version %d is not supported", major)
+	}
+	return nil
+}
+
+// regfTimestamp returns t as FILETIME.
+func regfTimestamp(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100 + regfFiletimeUnixDiff)
+}
+
+// readRegfHiveFile reads the hive file and applies its transaction logs.
+func readRegfHiveFile(file string) (*regfHive, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var logs [][]byte
+	for _, suffix := range []string{".LOG1", ".LOG2", ".log1", ".log2"} {
+		if log, err := os.ReadFile(file + suffix); err == nil && len(log) > 0 {
+			logs = append(logs, log)
+		}
+		if len(logs) == 2 {
+			break
+		}
+	}
+	if data, err = recoverRegfHive(data, logs); err != nil {
+		return nil, err
+	}
+	return parseRegfHive(data)
+}
+
+// writeRegfHiveFile writes hive to file. The new hive is checked by parsing
+// it again and replaces the file only after it has been written completely.
+func writeRegfHiveFile(file string, hive *regfHive) error {
+	data := hive.marshal()
+	if _, err := parseRegfHive(data); err != nil {
+		return fmt.Errorf("created invalid hive: %s", err.Error())
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	temporary := file + ".hardentools"
+	if err := os.WriteFile(temporary, data, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, file); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	return nil
+}
+
+// parseRegfHive parses a hive file. The hive must not be dirty, see
+// recoverRegfHive.
+func parseRegfHive(data []byte) (*regfHive, error) {
+	if len(data) < regfBaseBlockSize {
+		return nil, errors.New("not a registry hive file")
+	}
+	if err := checkRegfBaseBlock(data); err != nil {
+		return nil, err
+	}
+	base := data[:regfBaseBlockSize]
+	if fileType := binary.LittleEndian.Uint32(base[0x1c:]); fileType != regfFileTypePrimary {
+		return nil, fmt.Errorf("not a primary hive file (file type %d)", fileType)
+	}
+	if binary.LittleEndian.Uint32(base[4:]) != binary.LittleEndian.Uint32(base[8:]) {
+		return nil, errRegfDirty
+	}
+	binsSize := uint64(binary.LittleEndian.Uint32(base[0x28:]))
+	if regfBaseBlockSize+binsSize > uint64(len(data)) {
+		return nil, errors.New("hive file is truncated")
+	}
+
+	reader := &regfReader{
+		bins:         data[regfBaseBlockSize : regfBaseBlockSize+binsSize],
+		minorVersion: binary.LittleEndian.Uint32(base[0x18:]),
+		visited:      make(map[uint32]bool),
+		security:     make(map[uint32][]byte),
+	}
+	root, err := reader.readKey(binary.LittleEndian.Uint32(base[0x24:]), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &regfHive{
+		Sequence:     binary.LittleEndian.Uint32(base[4:]),
+		LastWritten:  binary.LittleEndian.Uint64(base[0xc:]),
+		MinorVersion: reader.minorVersion,
+		FileName:     strings.TrimRight(decodeUTF16LE(base[0x30:0x70]), "\x00"),
+		Root:         root,
+	}, nil
+}
+
+// regfReader reads the cells of the hive bins of a hive file.
+type regfReader struct {
+	bins         []byte
+	minorVersion uint32
+	visited      map[uint32]bool   // Offsets of the keys read so far.
+	security     map[uint32][]byte // Security descriptors by sk offset.
+}
+
+// cell returns the data of the allocated cell at offset.
+func (reader *regfReader) cell(offset uint32) ([]byte, error) {
+	if offset == regfNoCell || uint64(offset)+4 > uint64(len(reader.bins)) {
+		return nil, fmt.Errorf("invalid cell offset 0x%x", offset)
+	}
+	size := int32(binary.LittleEndian.Uint32(reader.bins[offset:]))
+	if size >= 0 {
+		return nil, fmt.Errorf("cell at 0x%x is not allocated", offset)
+	}
+	end := uint64(offset) + uint64(-int64(size))
+	if -int64(size) < 4 || end > uint64(len(reader.bins)) {
+		return nil, fmt.Errorf("invalid size of cell at 0x%x", offset)
+	}
+	return reader.bins[offset+4 : end], nil
+}
+
+// record returns the data of the cell at offset, which must be a record
+// with the given signature and at least minSize bytes.
+func (reader *regfReader) record(offset uint32, signature string, minSize int) ([]byte, error) {
+	data, err := reader.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < minSize || string(data[:2]) != signature {
+		return nil, fmt.Errorf("cell at 0x%x is not a valid %s record", offset, signature)
+	}
+	return data, nil
+}
+
+// readKey reads the nk record at offset including all subkeys and values.
+func (reader *regfReader) readKey(offset uint32, depth int) (*regfKey, error) {
+	if depth > regfMaxDepth {
+		return nil, errors.New("keys are nested too deeply")
+	}
+	if reader.visited[offset] {
+		return nil, fmt.Errorf("key at 0x%x is referenced twice", offset)
+	}
+	reader.visited[offset] = true
+
+	data, err := reader.record(offset, "nk", 0x4c)
+	if err != nil {
+		return nil, err
+	}
+	flags := binary.LittleEndian.Uint16(data[2:])
+	nameLength := int(binary.LittleEndian.Uint16(data[0x48:]))
+	classLength := int(binary.LittleEndian.Uint16(data[0x4a:]))
+	if 0x4c+nameLength > len(data) {
+		return nil, fmt.Errorf("invalid name length of key at 0x%x", offset)
+	}
+	key := &regfKey{
+		Name:        decodeRegfName(data[0x4c:0x4c+nameLength], flags&regfKeyCompName != 0),
+		LastWritten: binary.LittleEndian.Uint64(data[4:]),
+		Flags:       flags &^ regfKeyCompName,
+		AccessBits:  binary.LittleEndian.Uint32(data[0xc:]),
+	}
+
+	if classOffset := binary.LittleEndian.Uint32(data[0x30:]); classOffset != regfNoCell && classLength > 0 {
+		class, err := reader.cell(classOffset)
+		if err != nil {
+			return nil, err
+		}
+		if classLength > len(class) {
+			return nil, fmt.Errorf("invalid class name of key %s", key.Name)
+		}
+		key.Class = append([]byte(nil), class[:classLength]...)
+	}
+	if securityOffset := binary.LittleEndian.Uint32(data[0x2c:]); securityOffset != regfNoCell {
+		if key.Security, err = reader.readSecurity(securityOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	if subKeyCount := binary.LittleEndian.Uint32(data[0x14:]); subKeyCount > 0 {
+		offsets, err := reader.readSubKeyList(binary.LittleEndian.Uint32(data[0x1c:]), true)
+		if err != nil {
+			return nil, err
+		}
+		if uint32(len(offsets)) != subKeyCount {
+			return nil, fmt.Errorf("subkey list of key %s has %d instead of %d entries",
+				key.Name, len(offsets), subKeyCount)
+		}
+		for _, subKeyOffset := range offsets {
+			subKey, err := reader.readKey(subKeyOffset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			key.SubKeys = append(key.SubKeys, subKey)
+		}
+	}
+
+	if valueCount := binary.LittleEndian.Uint32(data[0x24:]); valueCount > 0 {
+		list, err := reader.cell(binary.LittleEndian.Uint32(data[0x28:]))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(valueCount)*4 > uint64(len(list)) {
+			return nil, fmt.Errorf("invalid value list of key %s", key.Name)
+		}
+		for i := uint32(0); i < valueCount; i++ {
+			value, err := reader.readValue(binary.LittleEndian.Uint32(list[4*i:]))
+			if err != nil {
+				return nil, err
+			}
+			key.Values = append(key.Values, value)
+		}
+	}
+	return key, nil
+}
+
+// readSecurity returns the security descriptor of the sk record at offset.
+func (reader *regfReader) readSecurity(offset uint32) ([]byte, error) {
+	if descriptor, ok := reader.security[offset]; ok {
+		return descriptor, nil
+	}
+	data, err := reader.record(offset, "sk", 0x14)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(binary.LittleEndian.Uint32(data[0x10:]))
+	if 0x14+size > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid security descriptor at 0x%x", offset)
+	}
+	descriptor := append([]byte(nil), data[0x14:0x14+size]...)
+	reader.security[offset] = descriptor
+	return descriptor, nil
+}
+
+// readSubKeyList returns the nk offsets of the subkey list at offset. Index
+// ("ri") lists are only allowed at the top level.
+func (reader *regfReader) readSubKeyList(offset uint32, allowIndex bool) ([]uint32, error) {
+	data, err := reader.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid subkey list at 0x%x", offset)
+	}
+	count := int(binary.LittleEndian.Uint16(data[2:]))
+	entrySize := 4
+	switch string(data[:2]) {
+	case "lf", "lh":
+		entrySize = 8
+	case "li":
+	case "ri":
+		if !allowIndex {
+			return nil, fmt.Errorf("nested subkey index at 0x%x", offset)
+		}
+	default:
+		return nil, fmt.Errorf("cell at 0x%x is not a subkey list", offset)
+	}
+	if 4+count*entrySize > len(data) {
+		return nil, fmt.Errorf("invalid subkey list at 0x%x", offset)
+	}
+
+	var offsets []uint32
+	for i := 0; i < count; i++ {
+		entry := binary.LittleEndian.Uint32(data[4+i*entrySize:])
+		if string(data[:2]) != "ri" {
+			offsets = append(offsets, entry)
+			continue
+		}
+		list, err := reader.readSubKeyList(entry, false)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, list...)
+	}
+	return offsets, nil
+}
+
+// readValue reads the vk record at offset including its data.
+func (reader *regfReader) readValue(offset uint32) (*regfValue, error) {
+	data, err := reader.record(offset, "vk", 0x14)
+	if err != nil {
+		return nil, err
+	}
+	nameLength := int(binary.LittleEndian.Uint16(data[2:]))
+	dataSize := binary.LittleEndian.Uint32(data[4:])
+	flags := binary.LittleEndian.Uint16(data[0x10:])
+	if 0x14+nameLength > len(data) {
+		return nil, fmt.Errorf("invalid name length of value at 0x%x", offset)
+	}
+	value := &regfValue{
+		Name: decodeRegfName(data[0x14:0x14+nameLength], flags&regfValueCompName != 0),
+		Type: binary.LittleEndian.Uint32(data[0xc:]),
+	}
+
+	switch {
+	case dataSize&regfValueInlineFlag != 0:
+		// Up to 4 bytes are stored in the data offset field.
+		size := dataSize &^ regfValueInlineFlag
+		if size > 4 {
+			return nil, fmt.Errorf("invalid data size of value %s", value.Name)
+		}
+		value.Data = append([]byte{}, data[8:8+size]...)
+	case dataSize == 0:
+		value.Data = []byte{}
+	default:
+		value.Data, err = reader.readValueData(binary.LittleEndian.Uint32(data[8:]), dataSize)
+		if err != nil {
+			return nil, fmt.Errorf("value %s: %s", value.Name, err.Error())
+		}
+	}
+	return value, nil
+}
+
+// readValueData returns size bytes of value data stored at offset, either
+// in a single cell or in the segments of a db record.
+func (reader *regfReader) readValueData(offset, size uint32) ([]byte, error) {
+	data, err := reader.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if reader.minorVersion < 4 || size <= regfBigDataSegmentSize || len(data) < 8 || string(data[:2]) != "db" {
+		if uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid data size %d", size)
+		}
+		return append([]byte(nil), data[:size]...), nil
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[2:]))
+	list, err := reader.cell(binary.LittleEndian.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+	if count*4 > len(list) {
+		return nil, errors.New("invalid big data segment list")
+	}
+	value := make([]byte, 0, size)
+	for i := 0; i < count && uint32(len(value)) < size; i++ {
+		segment, err := reader.cell(binary.LittleEndian.Uint32(list[4*i:]))
+		if err != nil {
+			return nil, err
+		}
+		segment = segment[:min(len(segment), regfBigDataSegmentSize, int(size)-len(value))]
+		value = append(value, segment...)
+	}
+	if uint32(len(value)) != size {
+		return nil, fmt.Errorf("big data has %d instead of %d bytes", len(value), size)
+	}
+	return value, nil
+}
+
+// decodeRegfName decodes the name of a key or value, which is stored as
+// Latin-1 if compressed and as UTF-16LE otherwise.
+func decodeRegfName(data []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16LE(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// encodeRegfName encodes name as Latin-1 if possible, otherwise as UTF-16LE.
+func encodeRegfName(name string) (data []byte, compressed bool) {
+	for _, r := range name {
+		if r > 0xff {
+			return encodeUTF16LE(name), false
+		}
+		data = append(data, byte(r))
+	}
+	return data, true
+}
+
+// regfNameLength returns the length of name in bytes as UTF-16LE, which is
+// used for the maximum name lengths of nk records.
+func regfNameLength(name string) uint32 {
+	return uint32(2 * len(utf16.Encode([]rune(name))))
+}
+
+// regfNameHash returns the hash of a key name used in lh lists.
+func regfNameHash(name string) uint32 {
+	var hash uint32
+	for _, code := range utf16.Encode([]rune(strings.ToUpper(name))) {
+		hash = hash*37 + uint32(code)
+	}
+	return hash
+}
+
+// marshal returns hive as hive file. All cells are laid out anew, so the
+// file contains no free space apart from the end of the hive bins.
+func (hive *regfHive) marshal() []byte {
+	minorVersion := hive.MinorVersion
+	if minorVersion == 0 {
+		minorVersion = regfDefaultMinorVersion
+	}
+	writer := &regfWriter{
+		minorVersion: minorVersion,
+		lastWritten:  hive.LastWritten,
+		security:     make(map[string]uint32),
+		securityRefs: make(map[uint32]uint32),
+	}
+	root := writer.writeKey(hive.Root, regfNoCell, nil)
+	writer.linkSecurity()
+	writer.closeBin()
+
+	base := make([]byte, regfBaseBlockSize)
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[4:], hive.Sequence)
+	binary.LittleEndian.PutUint32(base[8:], hive.Sequence)
+	binary.LittleEndian.PutUint64(base[0xc:], hive.LastWritten)
+	binary.LittleEndian.PutUint32(base[0x14:], 1)
+	binary.LittleEndian.PutUint32(base[0x18:], minorVersion)
+	binary.LittleEndian.PutUint32(base[0x1c:], regfFileTypePrimary)
+	binary.LittleEndian.PutUint32(base[0x20:], 1) // Direct memory load.
+	binary.LittleEndian.PutUint32(base[0x24:], root)
+	binary.LittleEndian.PutUint32(base[0x28:], uint32(len(writer.bins)))
+	binary.LittleEndian.PutUint32(base[0x2c:], 1) // Clustering factor.
+	fileName := encodeUTF16LE(hive.FileName)
+	if len(fileName) > 64 {
+		// Windows keeps the end of the path.
+		fileName = fileName[len(fileName)-64:]
+	}
+	copy(base[0x30:0x70], fileName)
+	binary.LittleEndian.PutUint32(base[regfChecksumOffset:], regfChecksum(base))
+	return append(base, writer.bins...)
+}
+
+// regfWriter lays out the cells of a hive in hive bins.
+type regfWriter struct {
+	bins          []byte
+	used          int // End of the last cell in the current hive bin.
+	minorVersion  uint32
+	lastWritten   uint64
+	security      map[string]uint32 // Offsets of sk records by descriptor.
+	securityOrder []uint32
+	securityRefs  map[uint32]uint32 // Number of keys using an sk record.
+}
+
+// alloc allocates a cell for size bytes and returns its offset. A new hive
+// bin is started if the cell doesn't fit into the current one.
+func (writer *regfWriter) alloc(size int) uint32 {
+	size = (size + 4 + 7) &^ 7
+	if writer.used+size > len(writer.bins) {
+		writer.closeBin()
+		binSize := (size + regfBinHeaderSize + regfBinAlignment - 1) &^ (regfBinAlignment - 1)
+		start := len(writer.bins)
+		writer.bins = append(writer.bins, make([]byte, binSize)...)
+		bin := writer.bins[start:]
+		copy(bin, "hbin")
+		binary.LittleEndian.PutUint32(bin[4:], uint32(start))
+		binary.LittleEndian.PutUint32(bin[8:], uint32(binSize))
+		if start == 0 {
+			binary.LittleEndian.PutUint64(bin[0x14:], writer.lastWritten)
+		}
+		writer.used = start + regfBinHeaderSize
+	}
+	offset := writer.used
+	binary.LittleEndian.PutUint32(writer.bins[offset:], uint32(-int32(size)))
+	writer.used += size
+	return uint32(offset)
+}
+
+// closeBin marks the unused rest of the current hive bin as free cell.
+func (writer *regfWriter) closeBin() {
+	if rest := len(writer.bins) - writer.used; rest > 0 {
+		binary.LittleEndian.PutUint32(writer.bins[writer.used:], uint32(rest))
+	}
+	writer.used = len(writer.bins)
+}
+
+// cell returns the data of the cell at offset. The slice is only valid
+// until the next allocation.
+func (writer *regfWriter) cell(offset uint32) []byte {
+	size := uint32(-int32(binary.LittleEndian.Uint32(writer.bins[offset:])))
+	return writer.bins[offset+4 : offset+size]
+}
+
+// writeCell allocates a cell containing data and returns its offset.
+func (writer *regfWriter) writeCell(data []byte) uint32 {
+	offset := writer.alloc(len(data))
+	copy(writer.cell(offset), data)
+	return offset
+}
+
+// writeKey writes key with all its subkeys and values and returns the offset
+// of its nk record. Keys without security descriptor get the one of their
+// parent.
+func (writer *regfWriter) writeKey(key *regfKey, parent uint32, parentSecurity []byte) uint32 {
+	name, compressed := encodeRegfName(key.Name)
+	offset := writer.alloc(0x4c + len(name))
+
+	security := key.Security
+	if len(security) == 0 {
+		security = parentSecurity
+	}
+	if len(security) == 0 {
+		security = defaultRegfSecurity()
+	}
+	securityOffset := writer.securityCell(security)
+
+	// Windows requires subkey lists to be sorted by the upper case names.
+	subKeys := append([]*regfKey(nil), key.SubKeys...)
+	sort.SliceStable(subKeys, func(i, j int) bool {
+		return strings.ToUpper(subKeys[i].Name) < strings.ToUpper(subKeys[j].Name)
+	})
+	var subKeyOffsets []uint32
+	var maxSubKeyName, maxSubKeyClass uint32
+	for _, subKey := range subKeys {
+		subKeyOffsets = append(subKeyOffsets, writer.writeKey(subKey, offset, security))
+		maxSubKeyName = max(maxSubKeyName, regfNameLength(subKey.Name))
+		maxSubKeyClass = max(maxSubKeyClass, uint32(len(subKey.Class)))
+	}
+	subKeyList := writer.writeSubKeyList(subKeys, subKeyOffsets)
+
+	var valueList []byte
+	var maxValueName, maxValueData uint32
+	for _, value := range key.Values {
+		valueList = binary.LittleEndian.AppendUint32(valueList, writer.writeValue(value))
+		maxValueName = max(maxValueName, regfNameLength(value.Name))
+		maxValueData = max(maxValueData, uint32(len(value.Data)))
+	}
+	valueListOffset := uint32(regfNoCell)
+	if len(valueList) > 0 {
+		valueListOffset = writer.writeCell(valueList)
+	}
+	classOffset := uint32(regfNoCell)
+	if len(key.Class) > 0 {
+		classOffset = writer.writeCell(key.Class)
+	}
+
+	flags := key.Flags
+	if compressed {
+		flags |= regfKeyCompName
+	}
+	if parent == regfNoCell {
+		flags |= regfKeyHiveEntry | regfKeyNoDelete
+		parent = 0
+	}
+	nk := writer.cell(offset)
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], flags)
+	binary.LittleEndian.PutUint64(nk[4:], key.LastWritten)
+	binary.LittleEndian.PutUint32(nk[0xc:], key.AccessBits)
+	binary.LittleEndian.PutUint32(nk[0x10:], parent)
+	binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(subKeys)))
+	binary.LittleEndian.PutUint32(nk[0x18:], 0) // Volatile subkeys.
+	binary.LittleEndian.PutUint32(nk[0x1c:], subKeyList)
+	binary.LittleEndian.PutUint32(nk[0x20:], regfNoCell)
+	binary.LittleEndian.PutUint32(nk[0x24:], uint32(len(key.Values)))
+	binary.LittleEndian.PutUint32(nk[0x28:], valueListOffset)
+	binary.LittleEndian.PutUint32(nk[0x2c:], securityOffset)
+	binary.LittleEndian.PutUint32(nk[0x30:], classOffset)
+	binary.LittleEndian.PutUint32(nk[0x34:], maxSubKeyName)
+	binary.LittleEndian.PutUint32(nk[0x38:], maxSubKeyClass)
+	binary.LittleEndian.PutUint32(nk[0x3c:], maxValueName)
+	binary.LittleEndian.PutUint32(nk[0x40:], maxValueData)
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	binary.LittleEndian.PutUint16(nk[0x4a:], uint16(len(key.Class)))
+	copy(nk[0x4c:], name)
+	return offset
+}
+
+// writeSubKeyList writes the subkey list of the sorted subKeys with the nk
+// records at offsets. Hives before minor version 5 use lf lists (with the
+// first characters of the name as hint) instead of lh lists (with a hash).
+func (writer *regfWriter) writeSubKeyList(subKeys []*regfKey, offsets []uint32) uint32 {
+	if len(offsets) == 0 {
+		return regfNoCell
+	}
+
+	var lists []uint32
+	for start := 0; start < len(offsets); start += regfMaxListEntries {
+		end := min(start+regfMaxListEntries, len(offsets))
+		list := make([]byte, 4, 4+8*(end-start))
+		copy(list, "lh")
+		if writer.minorVersion < 5 {
+			copy(list, "lf")
+		}
+		binary.LittleEndian.PutUint16(list[2:], uint16(end-start))
+		for i := start; i < end; i++ {
+			list = binary.LittleEndian.AppendUint32(list, offsets[i])
+			if writer.minorVersion < 5 {
+				hint, _ := encodeRegfName(subKeys[i].Name)
+				list = append(list, append(hint, 0, 0, 0, 0)[:4]...)
+			} else {
+				list = binary.LittleEndian.AppendUint32(list, regfNameHash(subKeys[i].Name))
+			}
+		}
+		lists = append(lists, writer.writeCell(list))
+	}
+	if len(lists) == 1 {
+		return lists[0]
+	}
+
+	index := []byte("ri")
+	index = binary.LittleEndian.AppendUint16(index, uint16(len(lists)))
+	for _, list := range lists {
+		index = binary.LittleEndian.AppendUint32(index, list)
+	}
+	return writer.writeCell(index)
+}
+
+// writeValue writes the vk record of value including its data and returns
+// its offset.
+func (writer *regfWriter) writeValue(value *regfValue) uint32 {
+	name, compressed := encodeRegfName(value.Name)
+	offset := writer.alloc(0x14 + len(name))
+
+	dataSize := uint32(len(value.Data))
+	dataOffset := uint32(regfNoCell)
+	switch {
+	case len(value.Data) <= 4:
+		dataSize |= regfValueInlineFlag
+	case len(value.Data) > regfBigDataSegmentSize && writer.minorVersion >= 4:
+		dataOffset = writer.writeBigData(value.Data)
+	default:
+		dataOffset = writer.writeCell(value.Data)
+	}
+
+	var flags uint16
+	if compressed && len(name) > 0 {
+		flags |= regfValueCompName
+	}
+	vk := writer.cell(offset)
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[2:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[4:], dataSize)
+	if dataSize&regfValueInlineFlag != 0 {
+		copy(vk[8:12], value.Data)
+	} else {
+		binary.LittleEndian.PutUint32(vk[8:], dataOffset)
+	}
+	binary.LittleEndian.PutUint32(vk[0xc:], value.Type)
+	binary.LittleEndian.PutUint16(vk[0x10:], flags)
+	copy(vk[0x14:], name)
+	return offset
+}
+
+// writeBigData writes data in segments and returns the offset of the db
+// record.
+func (writer *regfWriter) writeBigData(data []byte) uint32 {
+	var segments []byte
+	count := 0
+	for start := 0; start < len(data); start += regfBigDataSegmentSize {
+		end := min(start+regfBigDataSegmentSize, len(data))
+		segments = binary.LittleEndian.AppendUint32(segments, writer.writeCell(data[start:end]))
+		count++
+	}
+	record := []byte("db")
+	record = binary.LittleEndian.AppendUint16(record, uint16(count))
+	record = binary.LittleEndian.AppendUint32(record, writer.writeCell(segments))
+	record = binary.LittleEndian.AppendUint32(record, 0)
+	return writer.writeCell(record)
+}
+
+// securityCell returns the offset of the sk record of descriptor, which is
+// shared by all keys with the same descriptor.
+func (writer *regfWriter) securityCell(descriptor []byte) uint32 {
+	offset, ok := writer.security[string(descriptor)]
+	if !ok {
+		offset = writer.alloc(0x14 + len(descriptor))
+		sk := writer.cell(offset)
+		copy(sk, "sk")
+		binary.LittleEndian.PutUint32(sk[0x10:], uint32(len(descriptor)))
+		copy(sk[0x14:], descriptor)
+		writer.security[string(descriptor)] = offset
+		writer.securityOrder = append(writer.securityOrder, offset)
+	}
+	writer.securityRefs[offset]++
+	return offset
+}
+
+// linkSecurity sets the reference counts of all sk records and links them
+// to the circular list Windows expects.
+func (writer *regfWriter) linkSecurity() {
+	count := len(writer.securityOrder)
+	for i, offset := range writer.securityOrder {
+		sk := writer.cell(offset)
+		binary.LittleEndian.PutUint32(sk[4:], writer.securityOrder[(i+1)%count])
+		binary.LittleEndian.PutUint32(sk[8:], writer.securityOrder[(i+count-1)%count])
+		binary.LittleEndian.PutUint32(sk[0xc:], writer.securityRefs[offset])
+	}
+}
+
+// defaultRegfSecurity returns the security descriptor for hives that don't
+// have one: full access for SYSTEM and Administrators, read access for
+// Users, inherited by all subkeys.
+func defaultRegfSecurity() []byte {
+	system := []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}
+	administrators := []byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 0x20, 2, 0, 0}
+	users := []byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 0x21, 2, 0, 0}
+
+	var aces []byte
+	for _, ace := range []struct {
+		sid  []byte
+		mask uint32
+	}{{system, keyAllAccess}, {administrators, keyAllAccess}, {users, keyRead}} {
+		// ACCESS_ALLOWED_ACE_TYPE, CONTAINER_INHERIT_ACE
+		aces = append(aces, 0, 2)
+		aces = binary.LittleEndian.AppendUint16(aces, uint16(8+len(ace.sid)))
+		aces = binary.LittleEndian.AppendUint32(aces, ace.mask)
+		aces = append(aces, ace.sid...)
+	}
+	acl := []byte{2, 0}
+	acl = binary.LittleEndian.AppendUint16(acl, uint16(8+len(aces)))
+	acl = binary.LittleEndian.AppendUint16(acl, 3)
+	acl = binary.LittleEndian.AppendUint16(acl, 0)
+	acl = append(acl, aces...)
+
+	// Self-relative descriptor with DACL, owned by the Administrators.
+	descriptor := []byte{1, 0}
+	descriptor = binary.LittleEndian.AppendUint16(descriptor, 0x8004)
+	descriptor = binary.LittleEndian.AppendUint32(descriptor, 20)
+	descriptor = binary.LittleEndian.AppendUint32(descriptor, uint32(20+len(administrators)))
+	descriptor = binary.LittleEndian.AppendUint32(descriptor, 0)
+	descriptor = binary.LittleEndian.AppendUint32(descriptor, uint32(20+len(administrators)+len(system)))
+	descriptor = append(descriptor, administrators...)
+	descriptor = append(descriptor, system...)
+	return append(descriptor, acl...)
+}
+
+// regfLogEntry is an entry of a transaction log: the pages of the hive bins
+// that have been changed by one write.
+type regfLogEntry struct {
+	sequence uint32
+	binsSize uint32
+	pages    []regfDirtyPage
+}
+
+// regfDirtyPage is a changed page of the hive bins.
+type regfDirtyPage struct {
+	offset uint32 // Relative to the first hive bin.
+	data   []byte
+}
+
+// parseRegfLog returns the valid entries of a transaction log. An entry is
+// valid if its hashes match; everything after the first invalid entry is
+// ignored since it might have been written partially.
+func parseRegfLog(data []byte) ([]*regfLogEntry, error) {
+	if err := checkRegfBaseBlock(data); err != nil {
+		return nil, err
+	}
+	if fileType := binary.LittleEndian.Uint32(data[0x1c:]); fileType != regfFileTypeLog {
+		return nil, fmt.Errorf("transaction log format (file type %d) is not supported", fileType)
+	}
+
+	var entries []*regfLogEntry
+	offset := regfLogBaseBlockSize
+entries:
+	for offset+0x28 <= len(data) && string(data[offset:offset+4]) == "HvLE" {
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size < 0x28 || size%512 != 0 || offset+size > len(data) {
+			break
+		}
+		entry := data[offset : offset+size]
+		if marvin32(regfMarvinSeed, entry[:0x20]) != binary.LittleEndian.Uint64(entry[0x20:]) ||
+			marvin32(regfMarvinSeed, entry[0x28:]) != binary.LittleEndian.Uint64(entry[0x18:]) {
+			break
+		}
+
+		parsed := &regfLogEntry{
+			sequence: binary.LittleEndian.Uint32(entry[0xc:]),
+			binsSize: binary.LittleEndian.Uint32(entry[0x10:]),
+		}
+		count := int(binary.LittleEndian.Uint32(entry[0x14:]))
+		pageData := 0x28 + 8*count
+		if count < 0 || pageData > size {
+			break
+		}
+		for i := 0; i < count; i++ {
+			pageOffset := binary.LittleEndian.Uint32(entry[0x28+8*i:])
+			pageSize := int(binary.LittleEndian.Uint32(entry[0x2c+8*i:]))
+			if pageSize < 0 || pageData+pageSize > size {
+				break entries
+			}
+			parsed.pages = append(parsed.pages, regfDirtyPage{pageOffset, entry[pageData : pageData+pageSize]})
+			pageData += pageSize
+		}
+		entries = append(entries, parsed)
+		offset += size
+	}
+	return entries, nil
+}
+
+// recoverRegfHive applies the entries of the transaction logs that are newer
+// than the hive file data. The entries are applied in the order of their
+// sequence numbers, starting with the secondary sequence number of the hive
+// (the last complete write). The returned hive is clean and has a sequence
+// number higher than all log entries.
+func recoverRegfHive(data []byte, logs [][]byte) ([]byte, error) {
+	if len(data) < regfBaseBlockSize {
+		return nil, errors.New("not a registry hive file")
+	}
+	if err := checkRegfBaseBlock(data); err != nil {
+		return nil, err
+	}
+	base := data[:regfBaseBlockSize]
+	dirty := binary.LittleEndian.Uint32(base[4:]) != binary.LittleEndian.Uint32(base[8:])
+	secondary := binary.LittleEndian.Uint32(base[8:])
+	if len(logs) == 0 {
+		if dirty {
+			return nil, errRegfDirty
+		}
+		return data, nil
+	}
+
+	entries := make(map[uint32]*regfLogEntry)
+	first, last := uint32(regfNoCell), secondary
+	for _, log := range logs {
+		parsed, err := parseRegfLog(log)
+		if err != nil {
+			if dirty {
+				return nil, fmt.Errorf("could not read transaction log: %s", err.Error())
+			}
+			continue
+		}
+		for _, entry := range parsed {
+			last = max(last, entry.sequence)
+			if entry.sequence < secondary || entries[entry.sequence] != nil {
+				continue
+			}
+			entries[entry.sequence] = entry
+			first = min(first, entry.sequence)
+		}
+	}
+	if len(entries) == 0 {
+		if dirty {
+			return nil, errRegfDirty
+		}
+		return data, nil
+	}
+
+	binsSize := uint64(binary.LittleEndian.Uint32(base[0x28:]))
+	if regfBaseBlockSize+binsSize > uint64(len(data)) {
+		return nil, errors.New("hive file is truncated")
+	}
+	bins := append([]byte(nil), data[regfBaseBlockSize:regfBaseBlockSize+binsSize]...)
+	for sequence := first; entries[sequence] != nil; sequence++ {
+		entry := entries[sequence]
+		if int(entry.binsSize) > len(bins) {
+			bins = append(bins, make([]byte, int(entry.binsSize)-len(bins))...)
+		}
+		bins = bins[:entry.binsSize]
+		for _, page := range entry.pages {
+			if uint64(page.offset)+uint64(len(page.data)) > uint64(len(bins)) {
+				return nil, fmt.Errorf("log entry %d changes data beyond the hive bins", sequence)
+			}
+			copy(bins[page.offset:], page.data)
+		}
+		Trace.Printf("Applied transaction log entry %d", sequence)
+	}
+
+	recovered := append([]byte(nil), base...)
+	binary.LittleEndian.PutUint32(recovered[4:], last+1)
+	binary.LittleEndian.PutUint32(recovered[8:], last+1)
+	binary.LittleEndian.PutUint32(recovered[0x28:], uint32(len(bins)))
+	binary.LittleEndian.PutUint32(recovered[regfChecksumOffset:], regfChecksum(recovered))
+	return append(recovered, bins...), nil
+}
+
+// marvin32 returns the 64 bit Marvin32 hash of data, which is used to
+// verify the entries of transaction logs.
+func marvin32(seed uint64, data []byte) uint64 {
+	lo, hi := uint32(seed), uint32(seed>>32)
+	block := func() {
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 20)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 9)
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 27)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 19)
+	}
+
+	for ; len(data) >= 4; data = data[4:] {
+		lo += binary.LittleEndian.Uint32(data)
+		block()
+	}
+	switch len(data) {
+	case 0:
+		lo += 0x80
+	case 1:
+		lo += 0x8000 | uint32(data[0])
+	case 2:
+		lo += 0x800000 | uint32(binary.LittleEndian.Uint16(data))
+	case 3:
+		lo += 0x80000000 | uint32(data[2])<<16 | uint32(binary.LittleEndian.Uint16(data))
+	}
+	block()
+	block()
+	return uint64(hi)<<32 | uint64(lo)
+}
@@ -0,0 +1,363 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleRegfHive returns a hive with the structures hardentools has to
+// preserve: class names, security descriptors, non Latin-1 names, all value
+// types, big data and more subkeys than fit into one subkey list.
+func sampleRegfHive() *regfHive {
+	many := &regfKey{Name: "Many"}
+	for i := 0; i < 1200; i++ {
+		many.SubKeys = append(many.SubKeys, &regfKey{Name: fmt.Sprintf("Key%04d", i), LastWritten: uint64(i)})
+	}
+	return &regfHive{
+		Sequence:    7,
+		LastWritten: 133000000000000000,
+		FileName:    "\\??\\C:\\Users\\test\\ntuser.dat",
+		Root: &regfKey{
+			Name:        "ROOT",
+			LastWritten: 133000000000000001,
+			Security:    defaultRegfSecurity(),
+			SubKeys: []*regfKey{
+				{
+					Name:        "Software",
+					Class:       encodeUTF16LE("Shell"),
+					LastWritten: 133000000000000002,
+					AccessBits:  2,
+					Values: []*regfValue{
+						{Name: "", Type: regSZ, Data: encodeUTF16LE("default\x00")},
+						{Name: "Dword", Type: regDWORD, Data: []byte{1, 0, 0, 0}},
+						{Name: "Qword", Type: regQWORD, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+						{Name: "Multi", Type: regMultiSZ, Data: encodeUTF16LE("a\x00b\x00\x00")},
+						{Name: "Empty", Type: regBinary, Data: []byte{}},
+						{Name: "Big", Type: regBinary, Data: bytes.Repeat([]byte("0123456789"), 5000)},
+						{Name: "Ünicode ✓", Type: regSZ, Data: encodeUTF16LE("✓\x00")},
+					},
+					SubKeys: []*regfKey{{Name: "Приложение", LastWritten: 3}},
+				},
+				many,
+			},
+		},
+	}
+}
+
+// findRegfKey returns the key at path below key.
+func findRegfKey(key *regfKey, path string) *regfKey {
+	for _, name := range splitRegistryPath(path) {
+		var next *regfKey
+		for _, subKey := range key.SubKeys {
+			if strings.EqualFold(subKey.Name, name) {
+				next = subKey
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		key = next
+	}
+	return key
+}
+
+func TestRegfRoundTrip(t *testing.T) {
+	hive := sampleRegfHive()
+	data := hive.marshal()
+	if len(data)%regfBinAlignment != 0 {
+		t.Errorf("hive size %d is not a multiple of %d", len(data), regfBinAlignment)
+	}
+
+	parsed, err := parseRegfHive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Sequence != 7 || parsed.MinorVersion != regfDefaultMinorVersion || parsed.FileName != hive.FileName {
+		t.Errorf("unexpected base block %+v", parsed)
+	}
+
+	// Subkeys are sorted, inherit the security descriptor of their parent
+	// and the root flags are added when writing.
+	root := hive.Root
+	root.Flags = regfKeyHiveEntry | regfKeyNoDelete
+	root.SubKeys[0], root.SubKeys[1] = root.SubKeys[1], root.SubKeys[0]
+	var inherit func(key *regfKey)
+	inherit = func(key *regfKey) {
+		for _, subKey := range key.SubKeys {
+			subKey.Security = key.Security
+			inherit(subKey)
+		}
+	}
+	inherit(root)
+	if !reflect.DeepEqual(parsed.Root, hive.Root) {
+		t.Errorf("keys differ after round trip")
+		software := findRegfKey(parsed.Root, "Software")
+		for i, value := range software.Values {
+			if !reflect.DeepEqual(value, findRegfKey(root, "Software").Values[i]) {
+				t.Errorf("value %q differs: %+v", value.Name, value)
+			}
+		}
+	}
+
+	// Writing the parsed hive again gives the same file.
+	if again := parsed.marshal(); !bytes.Equal(again, data) {
+		t.Error("hive changed when written again")
+	}
+}
+
+func TestRegfParseHandMadeHive(t *testing.T) {
+	// Root key with a subkey in an li list, an inline DWORD and a REG_SZ in
+	// its own cell, laid out as Windows XP would (minor version 3).
+	bin := make([]byte, 4096)
+	copy(bin, "hbin")
+	binary.LittleEndian.PutUint32(bin[8:], 4096)
+	cell := func(offset int, size int, data []byte) {
+		binary.LittleEndian.PutUint32(bin[offset:], uint32(-int32(size)))
+		copy(bin[offset+4:], data)
+	}
+	nk := func(name string, subKeys, subKeyList, values, valueList uint32) []byte {
+		data := make([]byte, 0x4c)
+		copy(data, "nk")
+		binary.LittleEndian.PutUint16(data[2:], regfKeyCompName)
+		binary.LittleEndian.PutUint32(data[0x14:], subKeys)
+		binary.LittleEndian.PutUint32(data[0x1c:], subKeyList)
+		binary.LittleEndian.PutUint32(data[0x24:], values)
+		binary.LittleEndian.PutUint32(data[0x28:], valueList)
+		binary.LittleEndian.PutUint32(data[0x2c:], regfNoCell)
+		binary.LittleEndian.PutUint32(data[0x30:], regfNoCell)
+		binary.LittleEndian.PutUint16(data[0x48:], uint16(len(name)))
+		return append(data, name...)
+	}
+	vk := func(name string, valtype, size, offset uint32) []byte {
+		data := make([]byte, 0x14)
+		copy(data, "vk")
+		binary.LittleEndian.PutUint16(data[2:], uint16(len(name)))
+		binary.LittleEndian.PutUint32(data[4:], size)
+		binary.LittleEndian.PutUint32(data[8:], offset)
+		binary.LittleEndian.PutUint32(data[0xc:], valtype)
+		return append(data, name...) // Not compressed, name is UTF-16LE.
+	}
+	cell(0x20, 0x60, nk("Root", 1, 0x80, 2, 0x100))
+	cell(0x80, 0x10, append([]byte("li\x01\x00"), 0x90, 0, 0, 0))
+	cell(0x90, 0x60, nk("Policies", 0, regfNoCell, 0, regfNoCell))
+	cell(0x100, 0x10, []byte{0x10, 1, 0, 0, 0x40, 1, 0, 0})
+	cell(0x110, 0x30, vk(string(encodeUTF16LE("Flag")), regDWORD, 0x80000004, 1))
+	cell(0x140, 0x30, vk(string(encodeUTF16LE("Path")), regSZ, 8, 0x170))
+	cell(0x170, 0x10, encodeUTF16LE("C:\\\x00"))
+	binary.LittleEndian.PutUint32(bin[0x180:], 4096-0x180)
+
+	base := make([]byte, regfBaseBlockSize)
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[4:], 3)
+	binary.LittleEndian.PutUint32(base[8:], 3)
+	binary.LittleEndian.PutUint32(base[0x14:], 1)
+	binary.LittleEndian.PutUint32(base[0x18:], 3)
+	binary.LittleEndian.PutUint32(base[0x24:], 0x20)
+	binary.LittleEndian.PutUint32(base[0x28:], 4096)
+	binary.LittleEndian.PutUint32(base[regfChecksumOffset:], regfChecksum(base))
+	data := append(base, bin...)
+
+	hive, err := parseRegfHive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &regfKey{
+		Name:    "Root",
+		SubKeys: []*regfKey{{Name: "Policies"}},
+		Values: []*regfValue{
+			{Name: "Flag", Type: regDWORD, Data: []byte{1, 0, 0, 0}},
+			{Name: "Path", Type: regSZ, Data: encodeUTF16LE("C:\\\x00")},
+		},
+	}
+	if !reflect.DeepEqual(hive.Root, expected) {
+		t.Errorf("got %+v, expected %+v", hive.Root, expected)
+	}
+
+	// Hives of older versions are written with lf lists.
+	written := hive.marshal()
+	if _, err := parseRegfHive(written); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(written, []byte("lf\x01\x00")) || bytes.Contains(written, []byte("lh\x01\x00")) {
+		t.Error("subkey list of minor version 3 is not an lf list")
+	}
+}
+
+func TestRegfRejectsInvalidHives(t *testing.T) {
+	data := sampleRegfHive().marshal()
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[0x30] ^= 1
+	if _, err := parseRegfHive(corrupt); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("checksum mismatch not detected: %v", err)
+	}
+
+	dirty := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(dirty[4:], 8)
+	binary.LittleEndian.PutUint32(dirty[regfChecksumOffset:], regfChecksum(dirty))
+	if _, err := parseRegfHive(dirty); err != errRegfDirty {
+		t.Errorf("dirty hive not detected: %v", err)
+	}
+	if _, err := recoverRegfHive(dirty, nil); err != errRegfDirty {
+		t.Errorf("dirty hive without logs recovered: %v", err)
+	}
+
+	if _, err := parseRegfHive(data[:len(data)-4096]); err == nil {
+		t.Error("truncated hive not detected")
+	}
+	if _, err := parseRegfHive([]byte("PReg")); err == nil {
+		t.Error("no error for a file that is not a hive")
+	}
+}
+
+func TestMarvin32(t *testing.T) {
+	// Test vectors of the Marvin32 reference implementation.
+	const seed = 0x004fb61a001bdbcc
+	for _, test := range []struct {
+		data     []byte
+		expected uint64
+	}{
+		{[]byte{}, 0x30ed35c100cd3c7d},
+		{[]byte{0xaf}, 0x48e73fc77d75ddc1},
+		{[]byte{0xe7, 0x0f}, 0xb5f6e1fc485dbff8},
+		{[]byte{0x37, 0xf4, 0x95}, 0xf0b07c789b8cf7e8},
+		{[]byte{0x86, 0x42, 0xdc, 0x59}, 0x7008f2e87e9cf556},
+	} {
+		if hash := marvin32(seed, test.data); hash != test.expected {
+			t.Errorf("marvin32(%x) = %x, expected %x", test.data, hash, test.expected)
+		}
+	}
+}
+
+// regfLogFile returns a transaction log for base with one entry per hive bins
+// data in changes, containing the pages that differ from the previous one.
+func regfLogFile(base []byte, first uint32, previous []byte, changes ...[]byte) []byte {
+	log := append([]byte(nil), base[:regfLogBaseBlockSize]...)
+	binary.LittleEndian.PutUint32(log[0x1c:], regfFileTypeLog)
+	binary.LittleEndian.PutUint32(log[regfChecksumOffset:], regfChecksum(log))
+
+	for i, bins := range changes {
+		var refs, pages []byte
+		count := 0
+		for offset := 0; offset < len(bins); offset += 4096 {
+			page := bins[offset : offset+4096]
+			if offset+4096 <= len(previous) && bytes.Equal(page, previous[offset:offset+4096]) {
+				continue
+			}
+			refs = binary.LittleEndian.AppendUint32(refs, uint32(offset))
+			refs = binary.LittleEndian.AppendUint32(refs, 4096)
+			pages = append(pages, page...)
+			count++
+		}
+		entry := make([]byte, 0x28)
+		entry = append(entry, refs...)
+		entry = append(entry, pages...)
+		entry = append(entry, make([]byte, (512-len(entry)%512)%512)...)
+		copy(entry, "HvLE")
+		binary.LittleEndian.PutUint32(entry[4:], uint32(len(entry)))
+		binary.LittleEndian.PutUint32(entry[0xc:], first+uint32(i))
+		binary.LittleEndian.PutUint32(entry[0x10:], uint32(len(bins)))
+		binary.LittleEndian.PutUint32(entry[0x14:], uint32(count))
+		binary.LittleEndian.PutUint64(entry[0x18:], marvin32(regfMarvinSeed, entry[0x28:]))
+		binary.LittleEndian.PutUint64(entry[0x20:], marvin32(regfMarvinSeed, entry[:0x20]))
+		log = append(log, entry...)
+		previous = bins
+	}
+	return log
+}
+
+func TestRegfRecoverFromTransactionLogs(t *testing.T) {
+	initLogging(logOptions{Off: true})
+	hive := sampleRegfHive()
+	original := hive.marshal()
+
+	// Two writes that are only in the log: a changed value and a new key
+	// that makes the hive bins grow.
+	software := findRegfKey(hive.Root, "Software")
+	software.Values[1].Data = []byte{2, 0, 0, 0}
+	second := hive.marshal()
+	for i := 0; i < 300; i++ {
+		software.SubKeys = append(software.SubKeys, &regfKey{Name: fmt.Sprintf("New%03d", i)})
+	}
+	third := hive.marshal()
+	if len(third) <= len(second) {
+		t.Fatal("hive bins did not grow")
+	}
+
+	// The hive file has been marked dirty before the log was written.
+	dirty := append([]byte(nil), original...)
+	binary.LittleEndian.PutUint32(dirty[4:], 8)
+	binary.LittleEndian.PutUint32(dirty[regfChecksumOffset:], regfChecksum(dirty))
+	// An outdated entry from before the last write has to be ignored.
+	stale := regfLogFile(original, 5, nil, original[regfBaseBlockSize:])
+	log := regfLogFile(original, 7, original[regfBaseBlockSize:], second[regfBaseBlockSize:], third[regfBaseBlockSize:])
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "NTUSER.DAT")
+	for name, data := range map[string][]byte{file: dirty, file + ".LOG1": stale, file + ".LOG2": log} {
+		if err := os.WriteFile(name, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recovered, err := readRegfHiveFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.Sequence != 9 {
+		t.Errorf("recovered hive has sequence number %d instead of 9", recovered.Sequence)
+	}
+	key := findRegfKey(recovered.Root, "Software")
+	if !bytes.Equal(key.Values[1].Data, []byte{2, 0, 0, 0}) || len(key.SubKeys) != 301 {
+		t.Errorf("log entries have not been applied: %x, %d subkeys", key.Values[1].Data, len(key.SubKeys))
+	}
+
+	// A damaged entry and everything after it is ignored.
+	log[regfLogBaseBlockSize+0x30] ^= 1
+	if err := os.WriteFile(file+".LOG2", log, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRegfHiveFile(file); err != errRegfDirty {
+		t.Errorf("dirty hive with damaged log recovered: %v", err)
+	}
+}
+
+func TestWriteRegfHiveFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "SOFTWARE")
+	hive := sampleRegfHive()
+	if err := writeRegfHiveFile(file, hive); err != nil {
+		t.Fatal(err)
+	}
+	written, err := readRegfHiveFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findRegfKey(written.Root, "Many\\Key1199") == nil {
+		t.Error("written hive is incomplete")
+	}
+	if _, err := os.Stat(file + ".hardentools"); !os.IsNotExist(err) {
+		t.Error("temporary file has not been removed")
+	}
+}
@@ -0,0 +1,164 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// RegistryRootKey identifies one of the predefined registry root keys
+// (HKEY_CURRENT_USER etc.). The values are identical to the Windows handles
+// so the Windows backend can use them directly.
+type RegistryRootKey uint32
+
+// Predefined registry root keys.
+const (
+	HKCR RegistryRootKey = 0x80000000 // HKEY_CLASSES_ROOT
+	HKCU RegistryRootKey = 0x80000001 // HKEY_CURRENT_USER
+	HKLM RegistryRootKey = 0x80000002 // HKEY_LOCAL_MACHINE
+	HKU  RegistryRootKey = 0x80000003 // HKEY_USERS
+	HKPD RegistryRootKey = 0x80000004 // HKEY_PERFORMANCE_DATA
+	HKCC RegistryRootKey = 0x80000005 // HKEY_CURRENT_CONFIG
+)
+
+// Registry key access rights (same values as the Windows KEY_* constants).
+const (
+	keyQueryValue = 0x00001
+	keyRead       = 0x20019
+	keyWrite      = 0x20006
+	keyAllAccess  = 0xf003f
+)
+
+// Registry views of 64 bit Windows (same values as the Windows
+// KEY_WOW64_64KEY and KEY_WOW64_32KEY access rights). Without them, 32 bit
+// processes only see the 32 bit view of HKEY_LOCAL_MACHINE\SOFTWARE.
+const (
+	keyWow6464Key = 0x00100
+	keyWow6432Key = 0x00200
+)
+
+// registryViews contains both registry views, e.g. to detect 64 and 32 bit
+// installs of an application.
+var registryViews = []uint32{keyWow6464Key, keyWow6432Key}
+
+// Registry value types (same values as the Windows REG_* constants).
+const (
+	regNone     uint32 = 0
+	regSZ       uint32 = 1
+	regExpandSZ uint32 = 2
+	regBinary   uint32 = 3
+	regDWORD    uint32 = 4
+	regMultiSZ  uint32 = 7
+	regQWORD    uint32 = 11
+)
+
+// Errors returned by all registry backends.
+var (
+	errRegistryNotExist       = errors.New("registry key or value does not exist")
+	errRegistryAccessDenied   = errors.New("access to registry key denied")
+	errRegistryUnexpectedType = errors.New("unexpected key value type")
+	errRegistryHasSubKeys     = errors.New("registry key has subkeys")
+)
+
+// RegistryBackend is the interface every registry access of hardentools goes
+// through. On Windows it is implemented by the real registry, for tests an
+// in-memory implementation is available (see memoryRegistry).
+type RegistryBackend interface {
+	// OpenKey opens an existing key below rootKey with the given access
+	// rights.
+	OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error)
+	// CreateKey creates (including all missing parent keys) or opens a key
+	// below rootKey. openedExisting is true if the key already existed.
+	CreateKey(rootKey RegistryRootKey, path string, access uint32) (key RegistryKey, openedExisting bool, err error)
+	// DeleteKey deletes a key without subkeys.
+	DeleteKey(rootKey RegistryRootKey, path string) error
+}
+
+// hiveLoader is implemented by registry backends that can load the hive
+// files of other users (NTUSER.DAT) below HKEY_USERS.
+type hiveLoader interface {
+	// LoadHive loads the hive file as HKEY_USERS\mountName.
+	LoadHive(mountName, file string) error
+	// UnloadHive unloads the hive loaded as HKEY_USERS\mountName.
+	UnloadHive(mountName string) error
+}
+
+// currentUserHive is the key below HKEY_USERS that all backends use as
+// HKEY_CURRENT_USER instead of the hive of the process, if it is set (e.g.
+// to harden the profiles of other users).
+var currentUserHive string
+
+// resolveCurrentUser returns rootKey and path with HKEY_CURRENT_USER
+// replaced by currentUserHive below HKEY_USERS.
+func resolveCurrentUser(rootKey RegistryRootKey, path string) (RegistryRootKey, string) {
+	if rootKey != HKCU || currentUserHive == "" {
+		return rootKey, path
+	}
+	if path == "" {
+		return HKU, currentUserHive
+	}
+	return HKU, currentUserHive + "\\" + path
+}
+
+// resolveRegistryView returns path as stored by backends without WOW64
+// redirection (see memoryRegistry): they contain the 64 bit view, with the
+// 32 bit view of HKEY_LOCAL_MACHINE\SOFTWARE below SOFTWARE\WOW6432Node.
+func resolveRegistryView(rootKey RegistryRootKey, path string, access uint32) string {
+	if access&keyWow6432Key == 0 || rootKey != HKLM {
+		return path
+	}
+	components := splitRegistryPath(path)
+	if len(components) == 0 || !strings.EqualFold(components[0], "SOFTWARE") ||
+		(len(components) > 1 && strings.EqualFold(components[1], "WOW6432Node")) {
+		return path
+	}
+	return strings.Join(append([]string{"SOFTWARE", "WOW6432Node"}, components[1:]...), "\\")
+}
+
+// RegistryKey is an opened registry key. The methods follow the semantics of
+// golang.org/x/sys/windows/registry.Key, including returning the actual
+// value type together with errRegistryUnexpectedType on type mismatches.
+type RegistryKey interface {
+	Close() error
+
+	GetIntegerValue(name string) (val uint64, valtype uint32, err error)
+	GetStringValue(name string) (val string, valtype uint32, err error)
+	GetStringsValue(name string) (val []string, valtype uint32, err error)
+	GetBinaryValue(name string) (val []byte, valtype uint32, err error)
+	// GetRawValue returns the data of a value of any type as stored in the
+	// registry.
+	GetRawValue(name string) (val []byte, valtype uint32, err error)
+
+	SetDWordValue(name string, value uint32) error
+	SetQWordValue(name string, value uint64) error
+	SetStringValue(name, value string) error
+	SetExpandStringValue(name, value string) error
+	SetStringsValue(name string, value []string) error
+	SetBinaryValue(name string, value []byte) error
+	// SetRawValue sets a value of type valtype with data as stored in the
+	// registry. It is used for types without a typed setter (e.g. REG_NONE).
+	SetRawValue(name string, valtype uint32, value []byte) error
+
+	DeleteValue(name string) error
+	ReadValueNames(maxCount int) ([]string, error)
+	ReadSubKeyNames(maxCount int) ([]string, error)
+}
+
+// registryBackend is the registry used by all harden subjects. It is set to
+// the Windows registry on startup (see registry_backend_windows.go).
+var registryBackend RegistryBackend
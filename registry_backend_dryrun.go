@@ -0,0 +1,252 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRunRegistry is a copy-on-write RegistryBackend used for planning. Keys
+// are copied from the real registry into an in-memory overlay when they are
+// accessed first; all changes go to the overlay only and are recorded as
+// planned operations.
+type dryRunRegistry struct {
+	real       RegistryBackend
+	overlay    *memoryRegistry
+	loaded     map[string]bool
+	operations []plannedOperation
+}
+
+// dryRunKey is a key opened in a dryRunRegistry.
+type dryRunKey struct {
+	RegistryKey
+	registry *dryRunRegistry
+	rootKey  RegistryRootKey
+	path     string
+}
+
+// newDryRunRegistry returns a dryRunRegistry on top of real.
+func newDryRunRegistry(real RegistryBackend) *dryRunRegistry {
+	return &dryRunRegistry{
+		real:    real,
+		overlay: newMemoryRegistry(),
+		loaded:  make(map[string]bool),
+	}
+}
+
+// load copies path and all its parent keys from the real registry into the
+// overlay (if this has not been done before).
+func (reg *dryRunRegistry) load(rootKey RegistryRootKey, path string) {
+	parts := splitRegistryPath(path)
+	for i := 0; i <= len(parts); i++ {
+		keyPath := strings.Join(parts[:i], "\\")
+		id := fmt.Sprintf("%d\\%s", rootKey, strings.ToLower(keyPath))
+		if reg.loaded[id] {
+			continue
+		}
+		reg.loaded[id] = true
+
+		realKey, err := reg.real.OpenKey(rootKey, keyPath, keyRead)
+		if err != nil {
+			// Sub keys can't exist either.
+			return
+		}
+		overlayKey, _, _ := reg.overlay.CreateKey(rootKey, keyPath, keyAllAccess)
+
+		names, _ := realKey.ReadValueNames(0)
+		for _, name := range names {
+			if value, err := readRegistryValue(realKey, name); err == nil {
+				writeRegistryValue(overlayKey, name, value)
+			}
+		}
+		// Sub keys are created empty and loaded when they are accessed.
+		subKeys, _ := realKey.ReadSubKeyNames(0)
+		for _, subKey := range subKeys {
+			subPath := subKey
+			if keyPath != "" {
+				subPath = keyPath + "\\" + subKey
+			}
+			if key, _, err := reg.overlay.CreateKey(rootKey, subPath, keyRead); err == nil {
+				key.Close()
+			}
+		}
+
+		overlayKey.Close()
+		realKey.Close()
+	}
+}
+
+// checkWriteAccess returns errRegistryAccessDenied if the real registry would
+// deny write access to path (or the nearest existing parent key).
+func (reg *dryRunRegistry) checkWriteAccess(rootKey RegistryRootKey, path string, access uint32) error {
+	if !wantsWriteAccess(access) {
+		return nil
+	}
+	parts := splitRegistryPath(path)
+	for i := len(parts); i >= 0; i-- {
+		key, err := reg.real.OpenKey(rootKey, strings.Join(parts[:i], "\\"), access)
+		if err == nil {
+			key.Close()
+			return nil
+		} else if err == errRegistryAccessDenied {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenKey opens a key of the overlay. Keys opened in a registry view are
+// only read (e.g. to detect installs), they are opened in the real registry
+// as the overlay has no views.
+func (reg *dryRunRegistry) OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error) {
+	if access&(keyWow6464Key|keyWow6432Key) != 0 && !wantsWriteAccess(access) {
+		return reg.real.OpenKey(rootKey, path, access)
+	}
+	reg.load(rootKey, path)
+	if err := reg.checkWriteAccess(rootKey, path, access); err != nil {
+		return nil, err
+	}
+	key, err := reg.overlay.OpenKey(rootKey, path, access)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunKey{key, reg, rootKey, path}, nil
+}
+
+// CreateKey creates or opens a key of the overlay.
+func (reg *dryRunRegistry) CreateKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, bool, error) {
+	reg.load(rootKey, path)
+	if err := reg.checkWriteAccess(rootKey, path, access); err != nil {
+		return nil, false, err
+	}
+	key, openedExisting, err := reg.overlay.CreateKey(rootKey, path, access)
+	if err != nil {
+		return nil, false, err
+	}
+	return &dryRunKey{key, reg, rootKey, path}, openedExisting, nil
+}
+
+// DeleteKey deletes a key of the overlay and records the deletion.
+func (reg *dryRunRegistry) DeleteKey(rootKey RegistryRootKey, path string) error {
+	reg.load(rootKey, path)
+	if err := reg.checkWriteAccess(rootKey, path, keyAllAccess); err != nil {
+		return err
+	}
+	if err := reg.overlay.DeleteKey(rootKey, path); err != nil {
+		return err
+	}
+	reg.record(rootKey, path, "", "delete key", nil, nil)
+	return nil
+}
+
+// record adds a planned registry operation. Changes of hardentools' own
+// state are not recorded.
+func (reg *dryRunRegistry) record(rootKey RegistryRootKey, path, valueName, action string, current, new *registryValue) {
+	if rootKey == HKCU && strings.HasPrefix(strings.ToLower(path+"\\"),
+		strings.ToLower(hardentoolsKeyPath)) {
+		return
+	}
+
+	rootKeyName, _ := getRootKeyName(rootKey)
+	target := rootKeyName + "\\" + path
+	if action != "delete key" {
+		target += "\\" + valueName
+		if strings.EqualFold(path, explorerDisallowRunKey) {
+			action = "DisallowRun " + action
+		}
+	}
+
+	operation := plannedOperation{
+		Subject: journalSubject,
+		Action:  action,
+		Target:  target,
+		Current: formatPlannedValue(current),
+		New:     formatPlannedValue(new),
+	}
+	if action == "delete key" {
+		operation.Current, operation.New = "", ""
+	}
+	reg.operations = append(reg.operations, operation)
+}
+
+// currentValue returns the value name of the key in the overlay or nil.
+func (key *dryRunKey) currentValue(name string) *registryValue {
+	readKey, err := key.registry.overlay.OpenKey(key.rootKey, key.path, keyRead)
+	if err != nil {
+		return nil
+	}
+	defer readKey.Close()
+
+	value, _ := readRegistryValue(readKey, name)
+	return value
+}
+
+// setValue sets the value in the overlay and records the change.
+func (key *dryRunKey) setValue(name string, value *registryValue) error {
+	current := key.currentValue(name)
+	if err := writeRegistryValue(key.RegistryKey, name, value); err != nil {
+		return err
+	}
+	key.registry.record(key.rootKey, key.path, name, "set", current, value)
+	return nil
+}
+
+// SetDWordValue sets a REG_DWORD value in the overlay.
+func (key *dryRunKey) SetDWordValue(name string, value uint32) error {
+	return key.setValue(name, dwordValue(value))
+}
+
+// SetQWordValue sets a REG_QWORD value in the overlay.
+func (key *dryRunKey) SetQWordValue(name string, value uint64) error {
+	return key.setValue(name, &registryValue{Type: regQWORD, Integer: value})
+}
+
+// SetStringValue sets a REG_SZ value in the overlay.
+func (key *dryRunKey) SetStringValue(name, value string) error {
+	return key.setValue(name, stringValue(value))
+}
+
+// SetExpandStringValue sets a REG_EXPAND_SZ value in the overlay.
+func (key *dryRunKey) SetExpandStringValue(name, value string) error {
+	return key.setValue(name, &registryValue{Type: regExpandSZ, Str: value})
+}
+
+// SetStringsValue sets a REG_MULTI_SZ value in the overlay.
+func (key *dryRunKey) SetStringsValue(name string, value []string) error {
+	return key.setValue(name, &registryValue{Type: regMultiSZ, Strings: value})
+}
+
+// SetBinaryValue sets a REG_BINARY value in the overlay.
+func (key *dryRunKey) SetBinaryValue(name string, value []byte) error {
+	return key.setValue(name, &registryValue{Type: regBinary, Binary: value})
+}
+
+// SetRawValue sets a value of any type in the overlay.
+func (key *dryRunKey) SetRawValue(name string, valtype uint32, value []byte) error {
+	return key.setValue(name, rawRegistryValue(valtype, value))
+}
+
+// DeleteValue deletes the value in the overlay and records the change.
+func (key *dryRunKey) DeleteValue(name string) error {
+	current := key.currentValue(name)
+	if err := key.RegistryKey.DeleteValue(name); err != nil {
+		return err
+	}
+	key.registry.record(key.rootKey, key.path, name, "delete", current, nil)
+	return nil
+}
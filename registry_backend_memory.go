@@ -0,0 +1,566 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// Access rights checked by the in-memory registry.
+const (
+	accessQueryValue       = 0x0001
+	accessSetValue         = 0x0002
+	accessCreateSubKey     = 0x0004
+	accessEnumerateSubKeys = 0x0008
+)
+
+// memoryRegistry is a RegistryBackend that keeps the whole registry in
+// memory. It models keys and subkeys, value types, case insensitive names,
+// missing keys/values, access denied errors (see SetAccessDenied) and the
+// 32 bit registry view (see resolveRegistryView), so harden subjects can be
+// tested without a Windows registry.
+type memoryRegistry struct {
+	mutex  sync.Mutex
+	roots  map[RegistryRootKey]*memoryRegistryNode
+	hives  map[string]*memoryRegistryNode // Hive files by lower case name.
+	mounts map[string]string              // Files of loaded hives by mount name.
+}
+
+// memoryRegistryNode is a single key of the in-memory registry.
+type memoryRegistryNode struct {
+	name         string
+	parent       *memoryRegistryNode
+	subKeys      map[string]*memoryRegistryNode
+	subKeyOrder  []string
+	values       map[string]*memoryRegistryValue
+	valueOrder   []string
+	accessDenied bool
+	deleted      bool
+}
+
+// memoryRegistryValue is a single value of the in-memory registry.
+type memoryRegistryValue struct {
+	name    string
+	valtype uint32
+	integer uint64
+	str     string
+	strs    []string
+	bin     []byte
+}
+
+// newMemoryRegistryValue returns value as value name of the in-memory
+// registry.
+func newMemoryRegistryValue(name string, value *registryValue) *memoryRegistryValue {
+	return &memoryRegistryValue{name: name, valtype: value.Type, integer: value.Integer,
+		str: value.Str, strs: value.Strings, bin: value.Binary}
+}
+
+// registryValue returns the typed value.
+func (value *memoryRegistryValue) registryValue() *registryValue {
+	return &registryValue{Type: value.valtype, Integer: value.integer, Str: value.str,
+		Strings: value.strs, Binary: value.bin}
+}
+
+// memoryRegistryKey is an opened key of the in-memory registry.
+type memoryRegistryKey struct {
+	registry *memoryRegistry
+	node     *memoryRegistryNode
+	access   uint32
+	closed   bool
+}
+
+// newMemoryRegistry returns an empty in-memory registry with all predefined
+// root keys.
+func newMemoryRegistry() *memoryRegistry {
+	reg := &memoryRegistry{
+		roots:  make(map[RegistryRootKey]*memoryRegistryNode),
+		hives:  make(map[string]*memoryRegistryNode),
+		mounts: make(map[string]string),
+	}
+	for _, rootKey := range []RegistryRootKey{HKCR, HKCU, HKLM, HKU, HKPD, HKCC} {
+		reg.roots[rootKey] = newMemoryRegistryNode("", nil)
+	}
+	return reg
+}
+
+func newMemoryRegistryNode(name string, parent *memoryRegistryNode) *memoryRegistryNode {
+	return &memoryRegistryNode{
+		name:    name,
+		parent:  parent,
+		subKeys: make(map[string]*memoryRegistryNode),
+		values:  make(map[string]*memoryRegistryValue),
+	}
+}
+
+// splitRegistryPath splits a registry path into its components, ignoring
+// leading, trailing and duplicate backslashes.
+func splitRegistryPath(path string) []string {
+	var components []string
+	for _, component := range strings.Split(path, "\\") {
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+// find returns the node for path below rootKey or nil if it doesn't exist.
+// Caller must hold the mutex.
+func (reg *memoryRegistry) find(rootKey RegistryRootKey, path string) *memoryRegistryNode {
+	node := reg.roots[rootKey]
+	if node == nil {
+		return nil
+	}
+	for _, component := range splitRegistryPath(path) {
+		node = node.subKeys[strings.ToLower(component)]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// isAccessDenied returns true if node or one of its parents has been marked
+// with SetAccessDenied.
+func (node *memoryRegistryNode) isAccessDenied() bool {
+	for n := node; n != nil; n = n.parent {
+		if n.accessDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsWriteAccess returns true if access contains any modifying right.
+func wantsWriteAccess(access uint32) bool {
+	return access&(accessSetValue|accessCreateSubKey) != 0
+}
+
+// SetAccessDenied marks the key path below rootKey (and everything below
+// it) as writable only with elevated privileges: the key can still be
+// opened for reading, but opening it for writing, creating subkeys or
+// deleting it fails with errRegistryAccessDenied. Missing keys are created.
+func (reg *memoryRegistry) SetAccessDenied(rootKey RegistryRootKey, path string, denied bool) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.createNode(rootKey, path).accessDenied = denied
+}
+
+// createNode returns the node for path below rootKey, creating all missing
+// nodes. Caller must hold the mutex.
+func (reg *memoryRegistry) createNode(rootKey RegistryRootKey, path string) *memoryRegistryNode {
+	node := reg.roots[rootKey]
+	for _, component := range splitRegistryPath(path) {
+		lower := strings.ToLower(component)
+		child := node.subKeys[lower]
+		if child == nil {
+			child = newMemoryRegistryNode(component, node)
+			node.subKeys[lower] = child
+			node.subKeyOrder = append(node.subKeyOrder, lower)
+		}
+		node = child
+	}
+	return node
+}
+
+// OpenKey opens an existing key.
+func (reg *memoryRegistry) OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	rootKey, path = resolveCurrentUser(rootKey, path)
+	path = resolveRegistryView(rootKey, path, access)
+
+	node := reg.find(rootKey, path)
+	if node == nil {
+		return nil, errRegistryNotExist
+	}
+	if wantsWriteAccess(access) && node.isAccessDenied() {
+		return nil, errRegistryAccessDenied
+	}
+	return &memoryRegistryKey{registry: reg, node: node, access: access}, nil
+}
+
+// CreateKey creates or opens a key including all missing parent keys.
+func (reg *memoryRegistry) CreateKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, bool, error) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	rootKey, path = resolveCurrentUser(rootKey, path)
+	path = resolveRegistryView(rootKey, path, access)
+
+	if reg.roots[rootKey] == nil {
+		return nil, false, errRegistryNotExist
+	}
+
+	// Find deepest existing key to check access rights before creating
+	// anything.
+	node := reg.roots[rootKey]
+	components := splitRegistryPath(path)
+	existing := 0
+	for _, component := range components {
+		child := node.subKeys[strings.ToLower(component)]
+		if child == nil {
+			break
+		}
+		node = child
+		existing++
+	}
+	openedExisting := existing == len(components)
+	if (!openedExisting || wantsWriteAccess(access)) && node.isAccessDenied() {
+		return nil, false, errRegistryAccessDenied
+	}
+
+	node = reg.createNode(rootKey, path)
+	return &memoryRegistryKey{registry: reg, node: node, access: access}, openedExisting, nil
+}
+
+// DeleteKey deletes a key. Like the Windows API it fails if the key still
+// has subkeys.
+func (reg *memoryRegistry) DeleteKey(rootKey RegistryRootKey, path string) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	rootKey, path = resolveCurrentUser(rootKey, path)
+
+	node := reg.find(rootKey, path)
+	if node == nil || node.parent == nil {
+		return errRegistryNotExist
+	}
+	if node.isAccessDenied() {
+		return errRegistryAccessDenied
+	}
+	if len(node.subKeys) > 0 {
+		return errRegistryHasSubKeys
+	}
+
+	lower := strings.ToLower(node.name)
+	delete(node.parent.subKeys, lower)
+	node.parent.subKeyOrder = removeString(node.parent.subKeyOrder, lower)
+	node.deleted = true
+	return nil
+}
+
+// mount attaches node (the root key of a hive) as path below rootKey,
+// replacing an existing key with that name.
+func (reg *memoryRegistry) mount(rootKey RegistryRootKey, path string, node *memoryRegistryNode) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	components := splitRegistryPath(path)
+	if len(components) == 0 {
+		node.name = ""
+		node.parent = nil
+		reg.roots[rootKey] = node
+		return
+	}
+	parent := reg.createNode(rootKey, strings.Join(components[:len(components)-1], "\\"))
+	node.name = components[len(components)-1]
+	node.parent = parent
+	lower := strings.ToLower(node.name)
+	if parent.subKeys[lower] == nil {
+		parent.subKeyOrder = append(parent.subKeyOrder, lower)
+	}
+	parent.subKeys[lower] = node
+}
+
+// AddHiveFile creates an empty hive file that can be loaded with LoadHive.
+func (reg *memoryRegistry) AddHiveFile(file string) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.hives[strings.ToLower(file)] = newMemoryRegistryNode("", nil)
+}
+
+// LoadHive mounts a hive file created with AddHiveFile below HKEY_USERS.
+func (reg *memoryRegistry) LoadHive(mountName, file string) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	hive := reg.hives[strings.ToLower(file)]
+	if hive == nil {
+		return errRegistryNotExist
+	}
+	users := reg.roots[HKU]
+	lower := strings.ToLower(mountName)
+	if users.subKeys[lower] != nil {
+		return errRegistryAccessDenied
+	}
+	hive.name = mountName
+	hive.parent = users
+	users.subKeys[lower] = hive
+	users.subKeyOrder = append(users.subKeyOrder, lower)
+	delete(reg.hives, strings.ToLower(file))
+	reg.mounts[lower] = strings.ToLower(file)
+	return nil
+}
+
+// UnloadHive unmounts a hive loaded with LoadHive and keeps its content in
+// the hive file.
+func (reg *memoryRegistry) UnloadHive(mountName string) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	lower := strings.ToLower(mountName)
+	file, ok := reg.mounts[lower]
+	if !ok {
+		return errRegistryNotExist
+	}
+	users := reg.roots[HKU]
+	hive := users.subKeys[lower]
+	delete(users.subKeys, lower)
+	users.subKeyOrder = removeString(users.subKeyOrder, lower)
+	delete(reg.mounts, lower)
+	hive.parent = nil
+	reg.hives[file] = hive
+	return nil
+}
+
+// removeString returns list without the first occurrence of s.
+func removeString(list []string, s string) []string {
+	for i, element := range list {
+		if element == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// check verifies that the key can be used with the requested access right.
+// Caller must hold the mutex.
+func (key *memoryRegistryKey) check(access uint32) error {
+	if key.closed || key.node.deleted {
+		return errRegistryNotExist
+	}
+	if key.access&access != access {
+		return errRegistryAccessDenied
+	}
+	return nil
+}
+
+// Close closes the key. Closing a key twice is allowed.
+func (key *memoryRegistryKey) Close() error {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	key.closed = true
+	return nil
+}
+
+// getValue returns the value name of the key.
+func (key *memoryRegistryKey) getValue(name string) (*memoryRegistryValue, error) {
+	if err := key.check(accessQueryValue); err != nil {
+		return nil, err
+	}
+	value := key.node.values[strings.ToLower(name)]
+	if value == nil {
+		return nil, errRegistryNotExist
+	}
+	return value, nil
+}
+
+// GetIntegerValue returns a DWORD or QWORD value.
+func (key *memoryRegistryKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	value, err := key.getValue(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	if value.valtype != regDWORD && value.valtype != regQWORD {
+		return 0, value.valtype, errRegistryUnexpectedType
+	}
+	return value.integer, value.valtype, nil
+}
+
+// GetStringValue returns a SZ or EXPAND_SZ value.
+func (key *memoryRegistryKey) GetStringValue(name string) (string, uint32, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	value, err := key.getValue(name)
+	if err != nil {
+		return "", 0, err
+	}
+	if value.valtype != regSZ && value.valtype != regExpandSZ {
+		return "", value.valtype, errRegistryUnexpectedType
+	}
+	return value.str, value.valtype, nil
+}
+
+// GetStringsValue returns a MULTI_SZ value.
+func (key *memoryRegistryKey) GetStringsValue(name string) ([]string, uint32, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	value, err := key.getValue(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if value.valtype != regMultiSZ {
+		return nil, value.valtype, errRegistryUnexpectedType
+	}
+	return append([]string(nil), value.strs...), value.valtype, nil
+}
+
+// GetBinaryValue returns a BINARY value.
+func (key *memoryRegistryKey) GetBinaryValue(name string) ([]byte, uint32, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	value, err := key.getValue(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if value.valtype != regBinary {
+		return nil, value.valtype, errRegistryUnexpectedType
+	}
+	return append([]byte(nil), value.bin...), value.valtype, nil
+}
+
+// GetRawValue returns the data of a value of any type.
+func (key *memoryRegistryKey) GetRawValue(name string) ([]byte, uint32, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	value, err := key.getValue(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value.registryValue().rawData(), value.valtype, nil
+}
+
+// setValue stores value (replacing an existing value with the same name).
+func (key *memoryRegistryKey) setValue(value *memoryRegistryValue) error {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	if err := key.check(accessSetValue); err != nil {
+		return err
+	}
+	lower := strings.ToLower(value.name)
+	if existing := key.node.values[lower]; existing != nil {
+		// Windows keeps the original spelling of the value name.
+		value.name = existing.name
+	} else {
+		key.node.valueOrder = append(key.node.valueOrder, lower)
+	}
+	key.node.values[lower] = value
+	return nil
+}
+
+// SetDWordValue sets a DWORD value.
+func (key *memoryRegistryKey) SetDWordValue(name string, value uint32) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regDWORD, integer: uint64(value)})
+}
+
+// SetQWordValue sets a QWORD value.
+func (key *memoryRegistryKey) SetQWordValue(name string, value uint64) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regQWORD, integer: value})
+}
+
+// SetStringValue sets a SZ value.
+func (key *memoryRegistryKey) SetStringValue(name, value string) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regSZ, str: value})
+}
+
+// SetExpandStringValue sets an EXPAND_SZ value.
+func (key *memoryRegistryKey) SetExpandStringValue(name, value string) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regExpandSZ, str: value})
+}
+
+// SetStringsValue sets a MULTI_SZ value.
+func (key *memoryRegistryKey) SetStringsValue(name string, value []string) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regMultiSZ,
+		strs: append([]string(nil), value...)})
+}
+
+// SetBinaryValue sets a BINARY value.
+func (key *memoryRegistryKey) SetBinaryValue(name string, value []byte) error {
+	return key.setValue(&memoryRegistryValue{name: name, valtype: regBinary,
+		bin: append([]byte(nil), value...)})
+}
+
+// SetRawValue sets a value of any type from its raw data.
+func (key *memoryRegistryKey) SetRawValue(name string, valtype uint32, value []byte) error {
+	return key.setValue(newMemoryRegistryValue(name, rawRegistryValue(valtype, append([]byte(nil), value...))))
+}
+
+// DeleteValue deletes a value.
+func (key *memoryRegistryKey) DeleteValue(name string) error {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	if err := key.check(accessSetValue); err != nil {
+		return err
+	}
+	lower := strings.ToLower(name)
+	if key.node.values[lower] == nil {
+		return errRegistryNotExist
+	}
+	delete(key.node.values, lower)
+	key.node.valueOrder = removeString(key.node.valueOrder, lower)
+	return nil
+}
+
+// ReadValueNames returns the value names in creation order. Like the
+// Windows implementation it returns io.EOF if maxCount is positive and
+// larger than the number of values.
+func (key *memoryRegistryKey) ReadValueNames(maxCount int) ([]string, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	if err := key.check(accessQueryValue); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(key.node.valueOrder))
+	for _, lower := range key.node.valueOrder {
+		names = append(names, key.node.values[lower].name)
+	}
+	return limitNames(names, maxCount)
+}
+
+// ReadSubKeyNames returns the subkey names in creation order.
+func (key *memoryRegistryKey) ReadSubKeyNames(maxCount int) ([]string, error) {
+	key.registry.mutex.Lock()
+	defer key.registry.mutex.Unlock()
+
+	if err := key.check(accessEnumerateSubKeys); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(key.node.subKeyOrder))
+	for _, lower := range key.node.subKeyOrder {
+		names = append(names, key.node.subKeys[lower].name)
+	}
+	return limitNames(names, maxCount)
+}
+
+// limitNames applies the maxCount semantics of ReadValueNames and
+// ReadSubKeyNames.
+func limitNames(names []string, maxCount int) ([]string, error) {
+	if maxCount <= 0 {
+		return names, nil
+	}
+	if maxCount < len(names) {
+		return names[:maxCount], nil
+	}
+	if maxCount > len(names) {
+		return names, io.EOF
+	}
+	return names, nil
+}
@@ -0,0 +1,246 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// useMemoryRegistry replaces the registry backend with an empty in-memory
+// registry for the duration of the test.
+func useMemoryRegistry(t *testing.T) *memoryRegistry {
+	t.Helper()
+	initLogging(logOptions{Off: true})
+
+	previous := registryBackend
+	reg := newMemoryRegistry()
+	registryBackend = reg
+	t.Cleanup(func() { registryBackend = previous })
+	return reg
+}
+
+// wow64Registry is a memoryRegistry as seen by a 32 bit process on 64 bit
+// Windows (like the 386 release builds): keys opened without a registry view
+// are opened in the 32 bit view.
+type wow64Registry struct {
+	*memoryRegistry
+}
+
+// useWow64Registry is useMemoryRegistry for a 32 bit process.
+func useWow64Registry(t *testing.T) *memoryRegistry {
+	t.Helper()
+	reg := useMemoryRegistry(t)
+	registryBackend = wow64Registry{reg}
+	return reg
+}
+
+func (reg wow64Registry) OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error) {
+	if access&(keyWow6464Key|keyWow6432Key) == 0 {
+		access |= keyWow6432Key
+	}
+	return reg.memoryRegistry.OpenKey(rootKey, path, access)
+}
+
+func (reg wow64Registry) CreateKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, bool, error) {
+	if access&(keyWow6464Key|keyWow6432Key) == 0 {
+		access |= keyWow6432Key
+	}
+	return reg.memoryRegistry.CreateKey(rootKey, path, access)
+}
+
+// dumpRegistry returns all values of the registry as a map of
+// "root\path\name" to "type:data".
+func dumpRegistry(t *testing.T, reg RegistryBackend) map[string]string {
+	t.Helper()
+	values := make(map[string]string)
+	for _, rootKey := range []RegistryRootKey{HKCR, HKCU, HKLM, HKU, HKCC} {
+		rootKeyName, _ := getRootKeyName(rootKey)
+		dumpRegistryKey(t, reg, rootKey, rootKeyName, "", values)
+	}
+	return values
+}
+
+func dumpRegistryKey(t *testing.T, reg RegistryBackend, rootKey RegistryRootKey, prefix, path string, values map[string]string) {
+	key, err := reg.OpenKey(rootKey, path, keyRead)
+	if err != nil {
+		t.Fatalf("could not open %s\\%s: %s", prefix, path, err)
+	}
+	defer key.Close()
+
+	names, _ := key.ReadValueNames(0)
+	for _, name := range names {
+		values[prefix+"\\"+path+"\\"+name] = formatTestValue(t, key, name)
+	}
+
+	subKeys, _ := key.ReadSubKeyNames(0)
+	for _, subKey := range subKeys {
+		subPath := subKey
+		if path != "" {
+			subPath = path + "\\" + subKey
+		}
+		dumpRegistryKey(t, reg, rootKey, prefix, subPath, values)
+	}
+}
+
+func formatTestValue(t *testing.T, key RegistryKey, name string) string {
+	_, valtype, _ := key.GetBinaryValue(name)
+	switch valtype {
+	case regDWORD, regQWORD:
+		val, _, _ := key.GetIntegerValue(name)
+		return fmt.Sprintf("%d:%d", valtype, val)
+	case regSZ, regExpandSZ:
+		val, _, _ := key.GetStringValue(name)
+		return fmt.Sprintf("%d:%s", valtype, val)
+	case regMultiSZ:
+		val, _, _ := key.GetStringsValue(name)
+		return fmt.Sprintf("%d:%q", valtype, val)
+	default:
+		val, _, _ := key.GetRawValue(name)
+		return fmt.Sprintf("%d:%x", valtype, val)
+	}
+}
+
+func TestMemoryRegistryValues(t *testing.T) {
+	reg := newMemoryRegistry()
+
+	key, openedExisting, err := reg.CreateKey(HKCU, "Software\\Test\\Sub", keyAllAccess)
+	if err != nil || openedExisting {
+		t.Fatalf("CreateKey = %v, %v", openedExisting, err)
+	}
+	if err := key.SetDWordValue("DWord", 42); err != nil {
+		t.Fatal(err)
+	}
+	key.SetQWordValue("QWord", 1<<40)
+	key.SetStringValue("SZ", "text")
+	key.SetExpandStringValue("ExpandSZ", "%SystemRoot%")
+	key.SetStringsValue("MultiSZ", []string{"a", "b"})
+	key.SetBinaryValue("Binary", []byte{1, 2, 3})
+	key.Close()
+
+	// Names are case insensitive and parent keys have been created.
+	key, err = reg.OpenKey(HKCU, "SOFTWARE\\test\\SUB\\", keyRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	if val, valtype, err := key.GetIntegerValue("dword"); val != 42 || valtype != regDWORD || err != nil {
+		t.Errorf("GetIntegerValue(DWord) = %d, %d, %v", val, valtype, err)
+	}
+	if val, valtype, err := key.GetIntegerValue("QWord"); val != 1<<40 || valtype != regQWORD || err != nil {
+		t.Errorf("GetIntegerValue(QWord) = %d, %d, %v", val, valtype, err)
+	}
+	if val, valtype, err := key.GetStringValue("ExpandSZ"); val != "%SystemRoot%" || valtype != regExpandSZ || err != nil {
+		t.Errorf("GetStringValue(ExpandSZ) = %s, %d, %v", val, valtype, err)
+	}
+	if val, _, err := key.GetStringsValue("MultiSZ"); !reflect.DeepEqual(val, []string{"a", "b"}) || err != nil {
+		t.Errorf("GetStringsValue(MultiSZ) = %v, %v", val, err)
+	}
+	if val, _, err := key.GetBinaryValue("Binary"); !reflect.DeepEqual(val, []byte{1, 2, 3}) || err != nil {
+		t.Errorf("GetBinaryValue(Binary) = %v, %v", val, err)
+	}
+
+	// Type mismatches report the real type.
+	if _, valtype, err := key.GetIntegerValue("SZ"); err != errRegistryUnexpectedType || valtype != regSZ {
+		t.Errorf("GetIntegerValue(SZ) = %d, %v", valtype, err)
+	}
+	if _, _, err := key.GetStringValue("missing"); err != errRegistryNotExist {
+		t.Errorf("GetStringValue(missing) = %v", err)
+	}
+
+	names, err := key.ReadValueNames(0)
+	expected := []string{"DWord", "QWord", "SZ", "ExpandSZ", "MultiSZ", "Binary"}
+	if !reflect.DeepEqual(names, expected) || err != nil {
+		t.Errorf("ReadValueNames = %v, %v", names, err)
+	}
+	if names, err := key.ReadValueNames(100); len(names) != 6 || err != io.EOF {
+		t.Errorf("ReadValueNames(100) = %v, %v", names, err)
+	}
+
+	// Key has been opened read only.
+	if err := key.SetDWordValue("DWord", 1); err != errRegistryAccessDenied {
+		t.Errorf("SetDWordValue on read only key = %v", err)
+	}
+	if err := key.DeleteValue("DWord"); err != errRegistryAccessDenied {
+		t.Errorf("DeleteValue on read only key = %v", err)
+	}
+}
+
+func TestMemoryRegistryKeys(t *testing.T) {
+	reg := newMemoryRegistry()
+
+	if _, err := reg.OpenKey(HKLM, "Software\\Missing", keyRead); err != errRegistryNotExist {
+		t.Errorf("OpenKey(missing) = %v", err)
+	}
+
+	key, _, _ := reg.CreateKey(HKLM, "Software\\Parent\\Child", keyAllAccess)
+	key.Close()
+	if _, openedExisting, _ := reg.CreateKey(HKLM, "Software\\Parent", keyRead); !openedExisting {
+		t.Error("CreateKey of existing key returned openedExisting = false")
+	}
+
+	if err := reg.DeleteKey(HKLM, "Software\\Parent"); err != errRegistryHasSubKeys {
+		t.Errorf("DeleteKey with subkeys = %v", err)
+	}
+	if err := reg.DeleteKey(HKLM, "Software\\Parent\\Child"); err != nil {
+		t.Errorf("DeleteKey = %v", err)
+	}
+	if err := reg.DeleteKey(HKLM, "Software\\Parent\\Child"); err != errRegistryNotExist {
+		t.Errorf("DeleteKey(deleted) = %v", err)
+	}
+
+	// Operations on an open handle of a deleted key fail.
+	if err := key.SetDWordValue("Value", 1); err != errRegistryNotExist {
+		t.Errorf("SetDWordValue on deleted key = %v", err)
+	}
+}
+
+func TestMemoryRegistryAccessDenied(t *testing.T) {
+	reg := newMemoryRegistry()
+	key, _, _ := reg.CreateKey(HKLM, "Software\\Policies", keyAllAccess)
+	key.SetDWordValue("Existing", 1)
+	key.Close()
+	reg.SetAccessDenied(HKLM, "Software", true)
+
+	// Reading is still possible.
+	key, err := reg.OpenKey(HKLM, "Software\\Policies", keyRead)
+	if err != nil {
+		t.Fatalf("OpenKey for reading = %v", err)
+	}
+	if val, _, _ := key.GetIntegerValue("Existing"); val != 1 {
+		t.Errorf("GetIntegerValue = %d", val)
+	}
+	key.Close()
+
+	if _, err := reg.OpenKey(HKLM, "Software\\Policies", keyAllAccess); err != errRegistryAccessDenied {
+		t.Errorf("OpenKey for writing = %v", err)
+	}
+	if _, _, err := reg.CreateKey(HKLM, "Software\\Policies\\New", keyWrite); err != errRegistryAccessDenied {
+		t.Errorf("CreateKey = %v", err)
+	}
+	if err := reg.DeleteKey(HKLM, "Software\\Policies"); err != errRegistryAccessDenied {
+		t.Errorf("DeleteKey = %v", err)
+	}
+
+	// Other root keys are not affected.
+	if _, _, err := reg.CreateKey(HKCU, "Software\\Policies\\New", keyWrite); err != nil {
+		t.Errorf("CreateKey in HKCU = %v", err)
+	}
+}
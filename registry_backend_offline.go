@@ -0,0 +1,347 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// offlineMountPoint is the key a hive file is loaded as.
+type offlineMountPoint struct {
+	rootKey RegistryRootKey
+	path    string
+}
+
+// offlineMountPoints contains the keys Windows loads its hive files as, by
+// lower case file name.
+var offlineMountPoints = map[string]offlineMountPoint{
+	"ntuser.dat": {HKCU, ""},
+	"software":   {HKLM, "SOFTWARE"},
+	"system":     {HKLM, "SYSTEM"},
+	"default":    {HKU, ".DEFAULT"},
+}
+
+// offlineHives is the registry of the hive files given with -offline-hive,
+// or nil if the registry of the running system is used.
+var offlineHives *offlineRegistry
+
+// offlineRegistry is a RegistryBackend for the hive files of a Windows
+// installation that is not running, e.g. of a mounted disk image. The hives
+// are read into a memoryRegistry where Windows would load them (see
+// offlineMountPoints) and written back by save. Keys outside the hives can't
+// be changed, except the hardentools key if no NTUSER.DAT is given.
+type offlineRegistry struct {
+	*memoryRegistry
+	hives      []*offlineHive
+	controlSet string // Key of the SYSTEM hive CurrentControlSet refers to.
+}
+
+// offlineHive is a hive file loaded into an offlineRegistry. The original
+// keys and value data are kept to write back everything hardentools doesn't
+// change as it was.
+type offlineHive struct {
+	file   string
+	mount  offlineMountPoint
+	hive   *regfHive
+	keys   map[*memoryRegistryNode]*regfKey
+	values map[*memoryRegistryValue][]byte
+}
+
+// openOfflineRegistry loads the hive files. Files are mounted by name (see
+// offlineMountPoints) unless they are given as ROOT\path=file, e.g.
+// "LOCAL_MACHINE\SOFTWARE=D:\software.hiv".
+func openOfflineRegistry(files []string) (*offlineRegistry, error) {
+	reg := &offlineRegistry{memoryRegistry: newMemoryRegistry()}
+	for _, spec := range files {
+		file, mount, err := parseOfflineHiveSpec(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range reg.hives {
+			if other.mount.rootKey == mount.rootKey &&
+				(other.mount.path == "" || mount.path == "" || strings.EqualFold(other.mount.path, mount.path) ||
+					hasPathPrefixFold(mount.path, other.mount.path) || hasPathPrefixFold(other.mount.path, mount.path)) {
+				return nil, fmt.Errorf("%s and %s would be loaded into each other", other.file, file)
+			}
+		}
+
+		hive, err := readRegfHiveFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", file, err.Error())
+		}
+		offline := &offlineHive{
+			file:   file,
+			mount:  mount,
+			hive:   hive,
+			keys:   make(map[*memoryRegistryNode]*regfKey),
+			values: make(map[*memoryRegistryValue][]byte),
+		}
+		reg.mount(mount.rootKey, mount.path, offline.load(hive.Root, nil))
+		reg.hives = append(reg.hives, offline)
+	}
+
+	// CurrentControlSet is a link created at boot time.
+	if key, err := reg.memoryRegistry.OpenKey(HKLM, "SYSTEM\\Select", keyRead); err == nil {
+		if current, _, err := key.GetIntegerValue("Current"); err == nil {
+			reg.controlSet = fmt.Sprintf("ControlSet%03d", current)
+		}
+		key.Close()
+	}
+	return reg, nil
+}
+
+// parseOfflineHiveSpec returns file and mount point of an -offline-hive
+// entry.
+func parseOfflineHiveSpec(spec string) (string, offlineMountPoint, error) {
+	if key, file, ok := strings.Cut(spec, "="); ok {
+		rootKeyName, path, _ := strings.Cut(key, "\\")
+		rootKey, err := getRootKeyFromName(strings.TrimPrefix(strings.ToUpper(rootKeyName), "HKEY_"))
+		if err != nil {
+			return "", offlineMountPoint{}, fmt.Errorf("invalid key %s for %s", key, file)
+		}
+		return file, offlineMountPoint{rootKey, strings.Join(splitRegistryPath(path), "\\")}, nil
+	}
+
+	mount, ok := offlineMountPoints[strings.ToLower(filepath.Base(spec))]
+	if !ok {
+		return "", offlineMountPoint{}, fmt.Errorf("don't know where to load %s, use ROOT\\path=%s", spec, spec)
+	}
+	return spec, mount, nil
+}
+
+// load returns the memoryRegistryNode for key and all its subkeys and
+// remembers their original content.
+func (offline *offlineHive) load(key *regfKey, parent *memoryRegistryNode) *memoryRegistryNode {
+	node := newMemoryRegistryNode(key.Name, parent)
+	offline.keys[node] = key
+	for _, value := range key.Values {
+		lower := strings.ToLower(value.Name)
+		if node.values[lower] != nil {
+			continue
+		}
+		decoded := decodeRegfValue(value)
+		offline.values[decoded] = value.Data
+		node.values[lower] = decoded
+		node.valueOrder = append(node.valueOrder, lower)
+	}
+	for _, subKey := range key.SubKeys {
+		lower := strings.ToLower(subKey.Name)
+		if node.subKeys[lower] != nil {
+			continue
+		}
+		node.subKeys[lower] = offline.load(subKey, node)
+		node.subKeyOrder = append(node.subKeyOrder, lower)
+	}
+	return node
+}
+
+// store returns the regfKey for node and all its subkeys. Keys whose values
+// or subkeys have been changed get timestamp as last write time.
+func (offline *offlineHive) store(node *memoryRegistryNode, timestamp uint64) *regfKey {
+	key := &regfKey{Name: node.name, LastWritten: timestamp}
+	original := offline.keys[node]
+	changed := original == nil
+	if original != nil {
+		key.Class = original.Class
+		key.LastWritten = original.LastWritten
+		key.Flags = original.Flags
+		key.AccessBits = original.AccessBits
+		key.Security = original.Security
+		changed = len(original.Values) != len(node.valueOrder) || len(original.SubKeys) != len(node.subKeyOrder)
+	}
+
+	for _, lower := range node.valueOrder {
+		value := node.values[lower]
+		data, ok := offline.values[value]
+		if !ok {
+			data = encodeRegfValue(value)
+			changed = true
+		}
+		key.Values = append(key.Values, &regfValue{Name: value.name, Type: value.valtype, Data: data})
+	}
+	for _, lower := range node.subKeyOrder {
+		child := node.subKeys[lower]
+		if offline.keys[child] == nil {
+			changed = true
+		}
+		key.SubKeys = append(key.SubKeys, offline.store(child, timestamp))
+	}
+	if changed {
+		key.LastWritten = timestamp
+	}
+	return key
+}
+
+// decodeRegfValue converts value to the representation of the in-memory
+// registry.
+func decodeRegfValue(value *regfValue) *memoryRegistryValue {
+	return newMemoryRegistryValue(value.Name, rawRegistryValue(value.Type, value.Data))
+}
+
+// encodeRegfValue returns the data of value as stored in hive files.
+func encodeRegfValue(value *memoryRegistryValue) []byte {
+	return value.registryValue().rawData()
+}
+
+// resolve maps keys Windows creates at runtime to the hives: HKEY_CLASSES_ROOT
+// to the classes of HKEY_LOCAL_MACHINE and CurrentControlSet to the current
+// control set of the SYSTEM hive.
+func (reg *offlineRegistry) resolve(rootKey RegistryRootKey, path string) (RegistryRootKey, string) {
+	path = strings.Join(splitRegistryPath(path), "\\")
+	if rootKey == HKCR {
+		return HKLM, strings.TrimSuffix("SOFTWARE\\Classes\\"+path, "\\")
+	}
+	const currentControlSet = "SYSTEM\\CurrentControlSet"
+	if rootKey == HKLM && reg.controlSet != "" &&
+		(strings.EqualFold(path, currentControlSet) || hasPathPrefixFold(path, currentControlSet)) {
+		return HKLM, "SYSTEM\\" + reg.controlSet + path[len(currentControlSet):]
+	}
+	return rootKey, path
+}
+
+// writable returns true if path below rootKey can be changed: it is stored
+// in one of the hives, or it is the hardentools key, which is only kept in
+// memory if there is no NTUSER.DAT.
+func (reg *offlineRegistry) writable(rootKey RegistryRootKey, path string) bool {
+	for _, offline := range reg.hives {
+		if offline.mount.rootKey == rootKey && (offline.mount.path == "" ||
+			strings.EqualFold(path, offline.mount.path) || hasPathPrefixFold(path, offline.mount.path)) {
+			return true
+		}
+	}
+	hardentoolsKey := strings.TrimSuffix(hardentoolsKeyPath, "\\")
+	return rootKey == HKCU && !reg.hasUserHive() &&
+		(strings.EqualFold(path, hardentoolsKey) || hasPathPrefixFold(path, hardentoolsKey))
+}
+
+// hasUserHive returns true if a hive is loaded as HKEY_CURRENT_USER.
+func (reg *offlineRegistry) hasUserHive() bool {
+	for _, offline := range reg.hives {
+		if offline.mount.rootKey == HKCU {
+			return true
+		}
+	}
+	return false
+}
+
+// isMountPoint returns true if a hive is loaded as path below rootKey.
+func (reg *offlineRegistry) isMountPoint(rootKey RegistryRootKey, path string) bool {
+	for _, offline := range reg.hives {
+		if offline.mount.rootKey == rootKey && strings.EqualFold(offline.mount.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenKey opens an existing key. Keys outside the hives can only be read.
+func (reg *offlineRegistry) OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error) {
+	rootKey, path = reg.resolve(rootKey, path)
+	if wantsWriteAccess(access) && !reg.writable(rootKey, path) {
+		return nil, errRegistryAccessDenied
+	}
+	return reg.memoryRegistry.OpenKey(rootKey, path, access)
+}
+
+// CreateKey creates or opens a key in one of the hives.
+func (reg *offlineRegistry) CreateKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, bool, error) {
+	rootKey, path = reg.resolve(rootKey, path)
+	if !reg.writable(rootKey, path) {
+		return nil, false, errRegistryAccessDenied
+	}
+	return reg.memoryRegistry.CreateKey(rootKey, path, access)
+}
+
+// DeleteKey deletes a key of one of the hives. The root keys of the hives
+// can't be deleted.
+func (reg *offlineRegistry) DeleteKey(rootKey RegistryRootKey, path string) error {
+	rootKey, path = reg.resolve(rootKey, path)
+	if !reg.writable(rootKey, path) || reg.isMountPoint(rootKey, path) {
+		return errRegistryAccessDenied
+	}
+	return reg.memoryRegistry.DeleteKey(rootKey, path)
+}
+
+// save writes all hives back to their files.
+func (reg *offlineRegistry) save() error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	now := regfTimestamp(time.Now())
+	for _, offline := range reg.hives {
+		root := offline.store(reg.find(offline.mount.rootKey, offline.mount.path), now)
+		root.Name = offline.hive.Root.Name
+
+		hive := *offline.hive
+		hive.Root = root
+		hive.Sequence++
+		hive.LastWritten = now
+		if err := writeRegfHiveFile(offline.file, &hive); err != nil {
+			return fmt.Errorf("could not write %s: %s", offline.file, err.Error())
+		}
+		offline.hive.Sequence = hive.Sequence
+	}
+	return nil
+}
+
+// files returns the names of the hive files.
+func (reg *offlineRegistry) files() []string {
+	var files []string
+	for _, offline := range reg.hives {
+		files = append(files, offline.file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// useOfflineHives makes all further commands work on the comma separated
+// hive files instead of the registry of the running system.
+func useOfflineHives(files string) {
+	if allUsersMode {
+		fmt.Println("-all-users can't be combined with -offline-hive.")
+		os.Exit(-1)
+	}
+	reg, err := openOfflineRegistry(strings.Split(files, ","))
+	if err != nil {
+		fmt.Println("Could not load offline hives: " + err.Error())
+		os.Exit(-1)
+	}
+	if !reg.hasUserHive() {
+		Info.Println("No NTUSER.DAT given, the original values are not saved in the offline hives and can't be restored later.")
+	}
+	offlineHives = reg
+	registryBackend = reg
+}
+
+// saveOfflineHives writes the changes to the offline hives (if used).
+func saveOfflineHives() {
+	if offlineHives == nil {
+		return
+	}
+	if err := offlineHives.save(); err != nil {
+		fmt.Println("Saving offline hives failed: " + err.Error())
+		os.Exit(-1)
+	}
+	for _, file := range offlineHives.files() {
+		fmt.Println("Saved " + file)
+	}
+}
@@ -0,0 +1,173 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestHive writes a hive file with the given keys and values to dir.
+func writeTestHive(t *testing.T, dir, name string, keys map[string][]*regfValue) string {
+	t.Helper()
+	root := &regfKey{Name: "ROOT"}
+	for path, values := range keys {
+		key := root
+		for _, component := range splitRegistryPath(path) {
+			subKey := findRegfKey(key, component)
+			if subKey == nil {
+				subKey = &regfKey{Name: component}
+				key.SubKeys = append(key.SubKeys, subKey)
+			}
+			key = subKey
+		}
+		key.Values = values
+	}
+
+	file := filepath.Join(dir, name)
+	if err := writeRegfHiveFile(file, &regfHive{Sequence: 1, Root: root}); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// useOfflineRegistry replaces the registry backend with the hive files for
+// the duration of the test.
+func useOfflineRegistry(t *testing.T, files ...string) *offlineRegistry {
+	t.Helper()
+	initLogging(logOptions{Off: true})
+	reg, err := openOfflineRegistry(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous, previousHives := registryBackend, offlineHives
+	registryBackend, offlineHives = reg, reg
+	t.Cleanup(func() { registryBackend, offlineHives = previous, previousHives })
+	return reg
+}
+
+func TestOfflineHardenRestore(t *testing.T) {
+	const policiesPath = "Microsoft\\Windows\\CurrentVersion\\Policies\\System"
+	dir := t.TempDir()
+	// Odd length and missing null terminator, as written by some programs.
+	odd := &regfValue{Name: "Odd", Type: regSZ, Data: []byte{'A', 0, 'B'}}
+	software := writeTestHive(t, dir, "SOFTWARE", map[string][]*regfValue{
+		policiesPath: {{Name: "EnableLUA", Type: regDWORD, Data: []byte{0, 0, 0, 0}}, odd},
+	})
+	system := writeTestHive(t, dir, "SYSTEM", map[string][]*regfValue{
+		"Select":                      {{Name: "Current", Type: regDWORD, Data: []byte{2, 0, 0, 0}}},
+		"ControlSet002\\Control\\Lsa": nil,
+	})
+	ntuser := writeTestHive(t, dir, "NTUSER.DAT", map[string][]*regfValue{"Software\\Microsoft": nil})
+
+	reg := useOfflineRegistry(t, software, system, ntuser)
+	for _, subject := range []HardenInterface{UAC, LSA, WSH} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+	}
+	markStatus(true)
+	if _, _, err := registryBackend.CreateKey(HKLM, "SAM\\Test", keyAllAccess); err != errRegistryAccessDenied {
+		t.Errorf("creating a key outside the hives returned %v", err)
+	}
+	if err := registryBackend.DeleteKey(HKLM, "SOFTWARE"); err != errRegistryAccessDenied {
+		t.Errorf("deleting the root key of a hive returned %v", err)
+	}
+	if err := reg.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything has been written to the hive files, including the backup
+	// journal in NTUSER.DAT.
+	reg = useOfflineRegistry(t, software, system, ntuser)
+	if !checkStatus() {
+		t.Error("hardentools status has not been saved")
+	}
+	for _, subject := range []HardenInterface{UAC, LSA, WSH} {
+		if !subject.IsHardened() {
+			t.Errorf("%s is not hardened after reading the hives again", subject.Name())
+		}
+	}
+	written, err := readRegfHiveFile(system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsa := findRegfKey(written.Root, "ControlSet002\\Control\\Lsa"); lsa == nil || len(lsa.Values) != 1 {
+		t.Error("CurrentControlSet has not been mapped to ControlSet002")
+	}
+	if findRegfKey(written.Root, "CurrentControlSet") != nil {
+		t.Error("CurrentControlSet has been created in the hive")
+	}
+
+	for _, subject := range []HardenInterface{UAC, LSA, WSH} {
+		if err := restoreSubject(subject); err != nil {
+			t.Fatalf("restoring %s failed: %s", subject.Name(), err)
+		}
+	}
+	markStatus(false)
+	if err := reg.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err = readRegfHiveFile(software)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := findRegfKey(written.Root, policiesPath)
+	if len(policies.Values) != 2 || !bytes.Equal(policies.Values[0].Data, []byte{0, 0, 0, 0}) {
+		t.Errorf("UAC has not been restored: %+v", policies.Values)
+	}
+	if !bytes.Equal(policies.Values[1].Data, odd.Data) {
+		t.Errorf("untouched value has been changed to %x", policies.Values[1].Data)
+	}
+	if written, err = readRegfHiveFile(ntuser); err != nil {
+		t.Fatal(err)
+	} else if key := findRegfKey(written.Root, hardentoolsKeyPath); key != nil && len(key.Values) > 0 {
+		t.Errorf("hardentools status and backup journal have not been removed: %+v", key.Values)
+	}
+}
+
+func TestOfflineSubjectsWithoutUserHive(t *testing.T) {
+	dir := t.TempDir()
+	software := writeTestHive(t, dir, "SOFTWARE", nil)
+	useOfflineRegistry(t, software)
+	previous := allHardenSubjects
+	t.Cleanup(func() { allHardenSubjects = previous })
+
+	// Only subjects that just change registry values can be applied.
+	selectHardenSubjects()
+	for _, hardenSubject := range allHardenSubjects {
+		if name := hardenSubject.Name(); name == WindowsASR.Name() || name == FileAssociations.Name() {
+			t.Errorf("%s has been selected for offline hives", hardenSubject.Name())
+		}
+	}
+
+	// The hardentools key is kept in memory if there is no NTUSER.DAT, but
+	// all other keys of HKEY_CURRENT_USER can't be changed.
+	if err := UAC.Harden(true); err != nil {
+		t.Fatal(err)
+	}
+	markStatus(true)
+	if !checkStatus() {
+		t.Error("hardentools status has not been kept")
+	}
+	if err := WSH.Harden(true); err == nil {
+		t.Error("hardening HKEY_CURRENT_USER without NTUSER.DAT did not fail")
+	}
+}
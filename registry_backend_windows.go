@@ -0,0 +1,246 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	advapi32           = windows.NewLazySystemDLL("advapi32.dll")
+	procRegLoadKeyW    = advapi32.NewProc("RegLoadKeyW")
+	procRegUnLoadKeyW  = advapi32.NewProc("RegUnLoadKeyW")
+	procRegSetValueExW = advapi32.NewProc("RegSetValueExW")
+)
+
+func init() {
+	registryBackend = windowsRegistry{}
+}
+
+// windowsRegistry is the RegistryBackend for the real Windows registry.
+type windowsRegistry struct{}
+
+// windowsRegistryKey wraps registry.Key to implement RegistryKey.
+type windowsRegistryKey struct {
+	key registry.Key
+}
+
+// translateRegistryError maps Windows registry errors to the backend
+// independent errors.
+func translateRegistryError(err error) error {
+	switch err {
+	case registry.ErrNotExist, syscall.ERROR_PATH_NOT_FOUND:
+		return errRegistryNotExist
+	case syscall.ERROR_ACCESS_DENIED:
+		return errRegistryAccessDenied
+	case registry.ErrUnexpectedType:
+		return errRegistryUnexpectedType
+	}
+	return err
+}
+
+// windowsRootKey returns the root key and path to use for path below
+// rootKey (see resolveCurrentUser).
+func windowsRootKey(rootKey RegistryRootKey, path string) (registry.Key, string) {
+	rootKey, path = resolveCurrentUser(rootKey, path)
+	return registry.Key(rootKey), path
+}
+
+// OpenKey opens an existing registry key.
+func (windowsRegistry) OpenKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, error) {
+	root, path := windowsRootKey(rootKey, path)
+	key, err := registry.OpenKey(root, path, access)
+	if err != nil {
+		return nil, translateRegistryError(err)
+	}
+	return &windowsRegistryKey{key}, nil
+}
+
+// CreateKey creates or opens a registry key.
+func (windowsRegistry) CreateKey(rootKey RegistryRootKey, path string, access uint32) (RegistryKey, bool, error) {
+	root, path := windowsRootKey(rootKey, path)
+	key, openedExisting, err := registry.CreateKey(root, path, access)
+	if err != nil {
+		return nil, false, translateRegistryError(err)
+	}
+	return &windowsRegistryKey{key}, openedExisting, nil
+}
+
+// DeleteKey deletes a registry key without subkeys.
+func (windowsRegistry) DeleteKey(rootKey RegistryRootKey, path string) error {
+	root, path := windowsRootKey(rootKey, path)
+	return translateRegistryError(registry.DeleteKey(root, path))
+}
+
+// LoadHive loads the hive file as HKEY_USERS\mountName. This needs the
+// backup and restore privileges, which are enabled for elevated processes.
+func (windowsRegistry) LoadHive(mountName, file string) error {
+	if err := enablePrivileges("SeBackupPrivilege", "SeRestorePrivilege"); err != nil {
+		return err
+	}
+	mountNamePtr, err := windows.UTF16PtrFromString(mountName)
+	if err != nil {
+		return err
+	}
+	filePtr, err := windows.UTF16PtrFromString(file)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procRegLoadKeyW.Call(uintptr(HKU), uintptr(unsafe.Pointer(mountNamePtr)),
+		uintptr(unsafe.Pointer(filePtr)))
+	if ret != 0 {
+		return translateRegistryError(syscall.Errno(ret))
+	}
+	return nil
+}
+
+// UnloadHive unloads the hive loaded as HKEY_USERS\mountName.
+func (windowsRegistry) UnloadHive(mountName string) error {
+	mountNamePtr, err := windows.UTF16PtrFromString(mountName)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procRegUnLoadKeyW.Call(uintptr(HKU), uintptr(unsafe.Pointer(mountNamePtr)))
+	if ret != 0 {
+		return translateRegistryError(syscall.Errno(ret))
+	}
+	return nil
+}
+
+// enablePrivileges enables the named privileges of the process token.
+func enablePrivileges(names ...string) error {
+	var token windows.Token
+	err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+	if err != nil {
+		return err
+	}
+	defer token.Close()
+
+	for _, name := range names {
+		namePtr, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			return err
+		}
+		privileges := windows.Tokenprivileges{PrivilegeCount: 1}
+		if err := windows.LookupPrivilegeValue(nil, namePtr, &privileges.Privileges[0].Luid); err != nil {
+			return err
+		}
+		privileges.Privileges[0].Attributes = windows.SE_PRIVILEGE_ENABLED
+		if err := windows.AdjustTokenPrivileges(token, false, &privileges, 0, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *windowsRegistryKey) Close() error {
+	return k.key.Close()
+}
+
+func (k *windowsRegistryKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	val, valtype, err := k.key.GetIntegerValue(name)
+	return val, valtype, translateRegistryError(err)
+}
+
+func (k *windowsRegistryKey) GetStringValue(name string) (string, uint32, error) {
+	val, valtype, err := k.key.GetStringValue(name)
+	return val, valtype, translateRegistryError(err)
+}
+
+func (k *windowsRegistryKey) GetStringsValue(name string) ([]string, uint32, error) {
+	val, valtype, err := k.key.GetStringsValue(name)
+	return val, valtype, translateRegistryError(err)
+}
+
+func (k *windowsRegistryKey) GetBinaryValue(name string) ([]byte, uint32, error) {
+	val, valtype, err := k.key.GetBinaryValue(name)
+	return val, valtype, translateRegistryError(err)
+}
+
+func (k *windowsRegistryKey) GetRawValue(name string) ([]byte, uint32, error) {
+	size, valtype, err := k.key.GetValue(name, nil)
+	if err != nil {
+		return nil, valtype, translateRegistryError(err)
+	}
+	data := make([]byte, size)
+	size, valtype, err = k.key.GetValue(name, data)
+	if err != nil {
+		return nil, valtype, translateRegistryError(err)
+	}
+	return data[:size], valtype, nil
+}
+
+func (k *windowsRegistryKey) SetDWordValue(name string, value uint32) error {
+	return translateRegistryError(k.key.SetDWordValue(name, value))
+}
+
+func (k *windowsRegistryKey) SetQWordValue(name string, value uint64) error {
+	return translateRegistryError(k.key.SetQWordValue(name, value))
+}
+
+func (k *windowsRegistryKey) SetStringValue(name, value string) error {
+	return translateRegistryError(k.key.SetStringValue(name, value))
+}
+
+func (k *windowsRegistryKey) SetExpandStringValue(name, value string) error {
+	return translateRegistryError(k.key.SetExpandStringValue(name, value))
+}
+
+func (k *windowsRegistryKey) SetStringsValue(name string, value []string) error {
+	return translateRegistryError(k.key.SetStringsValue(name, value))
+}
+
+func (k *windowsRegistryKey) SetBinaryValue(name string, value []byte) error {
+	return translateRegistryError(k.key.SetBinaryValue(name, value))
+}
+
+// SetRawValue sets a value of any type, registry.Key only has setters for
+// the common types.
+func (k *windowsRegistryKey) SetRawValue(name string, valtype uint32, value []byte) error {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var data *byte
+	if len(value) > 0 {
+		data = &value[0]
+	}
+	ret, _, _ := procRegSetValueExW.Call(uintptr(k.key), uintptr(unsafe.Pointer(namePtr)), 0,
+		uintptr(valtype), uintptr(unsafe.Pointer(data)), uintptr(len(value)))
+	if ret != 0 {
+		return translateRegistryError(syscall.Errno(ret))
+	}
+	return nil
+}
+
+func (k *windowsRegistryKey) DeleteValue(name string) error {
+	return translateRegistryError(k.key.DeleteValue(name))
+}
+
+func (k *windowsRegistryKey) ReadValueNames(maxCount int) ([]string, error) {
+	names, err := k.key.ReadValueNames(maxCount)
+	return names, translateRegistryError(err)
+}
+
+func (k *windowsRegistryKey) ReadSubKeyNames(maxCount int) ([]string, error) {
+	names, err := k.key.ReadSubKeyNames(maxCount)
+	return names, translateRegistryError(err)
+}
@@ -0,0 +1,132 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// registryKeySnapshot is the content of a registry key including all
+// subkeys, as it is stored in the backup journal before the key is deleted.
+type registryKeySnapshot struct {
+	Name    string                 `json:"name"`
+	Values  []registryNamedValue   `json:"values,omitempty"`
+	SubKeys []*registryKeySnapshot `json:"subkeys,omitempty"`
+}
+
+// registryNamedValue is a value of a registryKeySnapshot. The default value
+// of a key has an empty name.
+type registryNamedValue struct {
+	Name  string         `json:"name"`
+	Value *registryValue `json:"value"`
+}
+
+// readRegistryKeySnapshot reads path below rootKey with all values and
+// subkeys. Values of types without typed data are saved as raw data.
+func readRegistryKeySnapshot(rootKey RegistryRootKey, path string) (*registryKeySnapshot, error) {
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+
+	snapshot := &registryKeySnapshot{Name: path[strings.LastIndex(path, "\\")+1:]}
+	valueNames, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range valueNames {
+		value, err := readRegistryValue(key, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s\\%s: %s", path, name, err.Error())
+		}
+		snapshot.Values = append(snapshot.Values, registryNamedValue{name, value})
+	}
+
+	subKeyNames, err := key.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range subKeyNames {
+		subKey, err := readRegistryKeySnapshot(rootKey, path+"\\"+name)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.SubKeys = append(snapshot.SubKeys, subKey)
+	}
+	return snapshot, nil
+}
+
+// write creates path below rootKey with all values and subkeys of snapshot.
+func (snapshot *registryKeySnapshot) write(rootKey RegistryRootKey, path string) error {
+	key, _, err := registryBackend.CreateKey(rootKey, path, keyAllAccess)
+	if err != nil {
+		return err
+	}
+	for _, value := range snapshot.Values {
+		if err := writeRegistryValue(key, value.Name, value.Value); err != nil {
+			key.Close()
+			return err
+		}
+	}
+	key.Close()
+
+	for _, subKey := range snapshot.SubKeys {
+		if err := subKey.write(rootKey, path+"\\"+subKey.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRegistryKeyTree deletes path below rootKey including all subkeys.
+func deleteRegistryKeyTree(rootKey RegistryRootKey, path string) error {
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead)
+	if err != nil {
+		return err
+	}
+	subKeyNames, err := key.ReadSubKeyNames(0)
+	key.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range subKeyNames {
+		if err := deleteRegistryKeyTree(rootKey, path+"\\"+name); err != nil {
+			return err
+		}
+	}
+	return registryBackend.DeleteKey(rootKey, path)
+}
+
+// settings returns all values of snapshot (including subkeys) as if it was
+// stored at path below rootKey. Keys without values are created.
+func (snapshot *registryKeySnapshot) settings(rootKey RegistryRootKey, path string) []registrySetting {
+	var settings []registrySetting
+	if len(snapshot.Values) == 0 {
+		settings = append(settings, registrySetting{RootKey: rootKey, Path: path, CreateKey: true})
+	}
+	for _, value := range snapshot.Values {
+		settings = append(settings, registrySetting{RootKey: rootKey, Path: path,
+			ValueName: value.Name, Value: value.Value})
+	}
+	for _, subKey := range snapshot.SubKeys {
+		settings = append(settings, subKey.settings(rootKey, path+"\\"+subKey.Name)...)
+	}
+	return settings
+}
@@ -0,0 +1,84 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Group Policy Registry.pol files (PReg format) contain a header followed by
+// entries of the form
+//
+//	[key;value;type;size;data]
+//
+// where brackets and semicolons are UTF-16LE characters, key and value are
+// null terminated UTF-16LE strings and type and size are little endian
+// DWORDs. Values are deleted by an entry for "**del.<value>", keys by a
+// "**DeleteKeys" entry with the key as data. An entry with an empty value
+// name and no data (REG_NONE) creates its key.
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+const (
+	registryPolSignature = 0x67655250 // "PReg"
+	registryPolVersion   = 1
+	// registryPolDeletePrefix is prepended to the names of deleted values.
+	registryPolDeletePrefix = "**del."
+	// registryPolDeleteKeys is the value name of key deletions.
+	registryPolDeleteKeys = "**DeleteKeys"
+)
+
+// formatRegistryPol returns a Registry.pol file that sets (or deletes) all
+// settings. The root keys of settings are not part of the file, it is
+// applied to HKEY_LOCAL_MACHINE or HKEY_CURRENT_USER depending on where it
+// is stored in the Group Policy Object.
+func formatRegistryPol(settings []registrySetting) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, registryPolSignature)
+	data = binary.LittleEndian.AppendUint32(data, registryPolVersion)
+
+	for _, setting := range settings {
+		path := setting.Path
+		valueName := setting.ValueName
+		value := setting.Value
+		switch {
+		case setting.DeleteKey:
+			// The subkey to delete is given relative to the key of the
+			// entry, i.e. only its last path component.
+			parent := max(strings.LastIndex(setting.Path, "\\"), 0)
+			path = setting.Path[:parent]
+			valueName = registryPolDeleteKeys
+			value = stringValue(strings.TrimPrefix(setting.Path[parent:], "\\"))
+		case setting.CreateKey:
+			valueName = ""
+			value = &registryValue{Type: regNone}
+		case value == nil:
+			valueName = registryPolDeletePrefix + valueName
+			value = stringValue(" ")
+		}
+		valueData := value.rawData()
+
+		data = append(data, encodeUTF16LE("[")...)
+		data = append(data, encodeUTF16LE(path+"\x00;")...)
+		data = append(data, encodeUTF16LE(valueName+"\x00;")...)
+		data = binary.LittleEndian.AppendUint32(data, value.Type)
+		data = append(data, encodeUTF16LE(";")...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(valueData)))
+		data = append(data, encodeUTF16LE(";")...)
+		data = append(data, valueData...)
+		data = append(data, encodeUTF16LE("]")...)
+	}
+	return data
+}
@@ -19,16 +19,14 @@ package main
 import (
 	"errors"
 	"fmt"
-	"strings"
-
-	"golang.org/x/sys/windows/registry"
+	"time"
 )
 
 // RegistrySingleValueDWORD is a data type for a single registry DWORD value
 // that suffices for hardening a distinct setting or as part of a
 // RegistryMultiValue.
 type RegistrySingleValueDWORD struct {
-	RootKey         registry.Key
+	RootKey         RegistryRootKey
 	Path            string
 	ValueName       string
 	HardenedValue   uint32
@@ -42,7 +40,7 @@ type RegistrySingleValueDWORD struct {
 // that suffices for hardening a distinct setting or as part of a
 // RegistryMultiValue.
 type RegistrySingleValueSZ struct {
-	RootKey         registry.Key
+	RootKey         RegistryRootKey
 	Path            string
 	ValueName       string
 	HardenedValue   string
@@ -52,12 +50,53 @@ type RegistrySingleValueSZ struct {
 	hardenByDefault bool
 }
 
+// RegistrySingleValue is a data type for a single registry value of any
+// type, e.g. imported from a .reg file. If HardenedValue is nil, the value is
+// deleted when hardening.
+type RegistrySingleValue struct {
+	RootKey         RegistryRootKey
+	Path            string
+	ValueName       string
+	HardenedValue   *registryValue
+	shortName       string
+	longName        string
+	description     string
+	hardenByDefault bool
+}
+
+// RegistryKeyAbsent is a data type for a registry key that is deleted
+// (including all subkeys) when hardening, e.g. a URL protocol handler. The
+// whole key is saved in the backup journal and recreated on restore.
+type RegistryKeyAbsent struct {
+	RootKey         RegistryRootKey
+	Path            string
+	shortName       string
+	longName        string
+	description     string
+	hardenByDefault bool
+}
+
+// RegistryKeyPresent is a data type for a registry key that is created
+// (without values) when hardening, e.g. an empty key section of a .reg file.
+// Like keys created for hardened values, it is kept when restoring.
+type RegistryKeyPresent struct {
+	RootKey         RegistryRootKey
+	Path            string
+	shortName       string
+	longName        string
+	description     string
+	hardenByDefault bool
+}
+
 // RegistryMultiValue is a data type for multiple SingleValueDWORDs
 // use if a single hardening needs multiple RegistrySingleValueDWORD to be
-// modified.
+// modified. Keys in ArrayKeyAbsent are deleted before any value is set.
 type RegistryMultiValue struct {
 	ArraySingleDWORD []*RegistrySingleValueDWORD
 	ArraySingleSZ    []*RegistrySingleValueSZ
+	ArraySingleValue []*RegistrySingleValue
+	ArrayKeyAbsent   []*RegistryKeyAbsent
+	ArrayKeyPresent  []*RegistryKeyPresent
 	shortName        string
 	longName         string
 	description      string
@@ -80,24 +119,19 @@ func (regValue *RegistrySingleValueDWORD) Harden(harden bool) error {
 // IsHardened verifies if harden object of type RegistrySingleValueDWORD
 // is already hardened.
 func (regValue *RegistrySingleValueDWORD) IsHardened() bool {
-	key, err := registry.OpenKey(regValue.RootKey, regValue.Path, registry.READ)
-
-	if err == nil {
-		currentValue, _, err := key.GetIntegerValue(regValue.ValueName)
-		if err == nil {
-			if uint32(currentValue) == regValue.HardenedValue {
-				Trace.Printf("IsHardened?: (OK) %s\\%s = %d",
-					regValue.Path, regValue.ValueName, currentValue)
-				return true
-			}
-			Trace.Printf("IsHardened?: (not) %s\\%s = %d (hardened value = %d)",
-				regValue.Path, regValue.ValueName, currentValue,
-				regValue.HardenedValue)
-		}
-	}
-	Trace.Printf("IsHardened?: (not) %s\\%s (not found)",
-		regValue.Path, regValue.ValueName)
-	return false
+	return regValue.Status().State == StateHardened
+}
+
+// Status returns the status of the registry value.
+func (regValue *RegistrySingleValueDWORD) Status() HardenStatus {
+	return registryValueStatus(regValue.RootKey, regValue.Path,
+		regValue.ValueName, dwordValue(regValue.HardenedValue))
+}
+
+// RegistrySettings returns the registry value set by hardening.
+func (regValue *RegistrySingleValueDWORD) RegistrySettings() ([]registrySetting, error) {
+	return []registrySetting{{RootKey: regValue.RootKey, Path: regValue.Path,
+		ValueName: regValue.ValueName, Value: dwordValue(regValue.HardenedValue)}}, nil
 }
 
 // Name returns the (short) name of the harden item.
@@ -135,27 +169,22 @@ func (regValue *RegistrySingleValueSZ) Harden(harden bool) error {
 	return hardenKeySZ(regValue.RootKey, regValue.Path, regValue.ValueName, regValue.HardenedValue)
 }
 
-// IsHardened verifies if harden object of type RegistrySingleValueDWORD
+// IsHardened verifies if harden object of type RegistrySingleValueSZ
 // is already hardened.
 func (regValue *RegistrySingleValueSZ) IsHardened() bool {
-	key, err := registry.OpenKey(regValue.RootKey, regValue.Path, registry.READ)
-
-	if err == nil {
-		currentValue, _, err := key.GetStringValue(regValue.ValueName)
-		if err == nil {
-			if currentValue == regValue.HardenedValue {
-				Trace.Printf("IsHardened?: (OK) %s\\%s = %s",
-					regValue.Path, regValue.ValueName, currentValue)
-				return true
-			}
-			Trace.Printf("IsHardened?: (not) %s\\%s = %s (hardened value = %s)",
-				regValue.Path, regValue.ValueName, currentValue,
-				regValue.HardenedValue)
-		}
-	}
-	Trace.Printf("IsHardened?: (not) %s\\%s (not found)",
-		regValue.Path, regValue.ValueName)
-	return false
+	return regValue.Status().State == StateHardened
+}
+
+// Status returns the status of the registry value.
+func (regValue *RegistrySingleValueSZ) Status() HardenStatus {
+	return registryValueStatus(regValue.RootKey, regValue.Path,
+		regValue.ValueName, stringValue(regValue.HardenedValue))
+}
+
+// RegistrySettings returns the registry value set by hardening.
+func (regValue *RegistrySingleValueSZ) RegistrySettings() ([]registrySetting, error) {
+	return []registrySetting{{RootKey: regValue.RootKey, Path: regValue.Path,
+		ValueName: regValue.ValueName, Value: stringValue(regValue.HardenedValue)}}, nil
 }
 
 // Name returns the (short) name of the harden item.
@@ -178,22 +207,205 @@ func (regValue *RegistrySingleValueSZ) HardenByDefault() bool {
 	return regValue.hardenByDefault
 }
 
+//// -------- RegistrySingleValue ----------
+
+// Harden function for RegistrySingleValue struct.
+func (regValue *RegistrySingleValue) Harden(harden bool) error {
+	if harden == false {
+		// Restore.
+		// don't do anything here since this is done by restoreSavedRegistryKeys()
+		// in the main procedure
+		return nil
+	}
+
+	// else: Harden.
+	if regValue.HardenedValue == nil {
+		return hardenDeleteValue(regValue.RootKey, regValue.Path, regValue.ValueName)
+	}
+	return hardenValue(regValue.RootKey, regValue.Path, regValue.ValueName, regValue.HardenedValue)
+}
+
+// IsHardened verifies if harden object of type RegistrySingleValue is
+// already hardened.
+func (regValue *RegistrySingleValue) IsHardened() bool {
+	return regValue.Status().State == StateHardened
+}
+
+// Status returns the status of the registry value.
+func (regValue *RegistrySingleValue) Status() HardenStatus {
+	return registryValueStatus(regValue.RootKey, regValue.Path,
+		regValue.ValueName, regValue.HardenedValue)
+}
+
+// RegistrySettings returns the registry value set (or deleted) by hardening.
+func (regValue *RegistrySingleValue) RegistrySettings() ([]registrySetting, error) {
+	return []registrySetting{{RootKey: regValue.RootKey, Path: regValue.Path,
+		ValueName: regValue.ValueName, Value: regValue.HardenedValue}}, nil
+}
+
+// Name returns the (short) name of the harden item.
+func (regValue *RegistrySingleValue) Name() string {
+	return regValue.shortName
+}
+
+// LongName returns the long name of the harden item.
+func (regValue *RegistrySingleValue) LongName() string {
+	return regValue.longName
+}
+
+// Description of the harden item.
+func (regValue *RegistrySingleValue) Description() string {
+	return regValue.description
+}
+
+// HardenByDefault returns if subject should be hardened by default.
+func (regValue *RegistrySingleValue) HardenByDefault() bool {
+	return regValue.hardenByDefault
+}
+
+//// -------- RegistryKeyAbsent ----------
+
+// Harden function for RegistryKeyAbsent struct.
+func (regKey *RegistryKeyAbsent) Harden(harden bool) error {
+	if harden == false {
+		// Restore.
+		// don't do anything here since this is done by restoreSavedRegistryKeys()
+		// in the main procedure
+		return nil
+	}
+
+	// else: Harden.
+	return hardenDeleteKey(regKey.RootKey, regKey.Path)
+}
+
+// IsHardened verifies if harden object of type RegistryKeyAbsent is already
+// hardened.
+func (regKey *RegistryKeyAbsent) IsHardened() bool {
+	return regKey.Status().State == StateHardened
+}
+
+// Status returns the status of the registry key.
+func (regKey *RegistryKeyAbsent) Status() HardenStatus {
+	return registryKeyAbsentStatus(regKey.RootKey, regKey.Path)
+}
+
+// RegistrySettings returns the deletion of the registry key.
+func (regKey *RegistryKeyAbsent) RegistrySettings() ([]registrySetting, error) {
+	return []registrySetting{{RootKey: regKey.RootKey, Path: regKey.Path, DeleteKey: true}}, nil
+}
+
+// Name returns the (short) name of the harden item.
+func (regKey *RegistryKeyAbsent) Name() string {
+	return regKey.shortName
+}
+
+// LongName returns the long name of the harden item.
+func (regKey *RegistryKeyAbsent) LongName() string {
+	return regKey.longName
+}
+
+// Description of the harden item.
+func (regKey *RegistryKeyAbsent) Description() string {
+	return regKey.description
+}
+
+// HardenByDefault returns if subject should be hardened by default.
+func (regKey *RegistryKeyAbsent) HardenByDefault() bool {
+	return regKey.hardenByDefault
+}
+
+//// -------- RegistryKeyPresent ----------
+
+// Harden function for RegistryKeyPresent struct.
+func (regKey *RegistryKeyPresent) Harden(harden bool) error {
+	if harden == false {
+		// Restore: nothing to do, the (empty) key is kept.
+		return nil
+	}
+
+	// else: Harden.
+	rootKeyName, _ := getRootKeyName(regKey.RootKey)
+	key, _, err := registryBackend.CreateKey(regKey.RootKey, regKey.Path, keyWrite)
+	if err != nil {
+		return fmt.Errorf("Couldn't create registry key: %s\\%s", rootKeyName, regKey.Path)
+	}
+	return key.Close()
+}
+
+// IsHardened verifies if harden object of type RegistryKeyPresent is already
+// hardened.
+func (regKey *RegistryKeyPresent) IsHardened() bool {
+	return regKey.Status().State == StateHardened
+}
+
+// Status returns the status of the registry key.
+func (regKey *RegistryKeyPresent) Status() HardenStatus {
+	status := registryKeyAbsentStatus(regKey.RootKey, regKey.Path)
+	switch status.State {
+	case StateHardened:
+		status.State = StateNotHardened
+		status.Reason = "missing"
+	case StateNotHardened:
+		status.State = StateHardened
+		status.Reason = ""
+	}
+	return status
+}
+
+// RegistrySettings returns the creation of the registry key.
+func (regKey *RegistryKeyPresent) RegistrySettings() ([]registrySetting, error) {
+	return []registrySetting{{RootKey: regKey.RootKey, Path: regKey.Path, CreateKey: true}}, nil
+}
+
+// Name returns the (short) name of the harden item.
+func (regKey *RegistryKeyPresent) Name() string {
+	return regKey.shortName
+}
+
+// LongName returns the long name of the harden item.
+func (regKey *RegistryKeyPresent) LongName() string {
+	return regKey.longName
+}
+
+// Description of the harden item.
+func (regKey *RegistryKeyPresent) Description() string {
+	return regKey.description
+}
+
+// HardenByDefault returns if subject should be hardened by default.
+func (regKey *RegistryKeyPresent) HardenByDefault() bool {
+	return regKey.hardenByDefault
+}
+
 // --------- RegistryMultiValue -------
 
-// Harden function for RegistryMultiValue struct.
+// Harden function for RegistryMultiValue struct. All values are hardened in
+// a transaction, so either all or none of them are changed.
 func (regMultiValue RegistryMultiValue) Harden(harden bool) error {
+	var children []HardenInterface
+	for _, keyAbsent := range regMultiValue.ArrayKeyAbsent {
+		children = append(children, keyAbsent)
+	}
+	for _, keyPresent := range regMultiValue.ArrayKeyPresent {
+		children = append(children, keyPresent)
+	}
 	for _, singleDWORD := range regMultiValue.ArraySingleDWORD {
-		err := singleDWORD.Harden(harden)
-		if err != nil {
-			Info.Println("Could not harden " + singleDWORD.Name() +
-				" due to error: " + err.Error())
-			return err
-		}
+		children = append(children, singleDWORD)
 	}
 	for _, singleSZ := range regMultiValue.ArraySingleSZ {
-		err := singleSZ.Harden(harden)
+		children = append(children, singleSZ)
+	}
+	for _, singleValue := range regMultiValue.ArraySingleValue {
+		children = append(children, singleValue)
+	}
+
+	if harden {
+		return hardenTransactionally(children)
+	}
+	for _, child := range children {
+		err := child.Harden(harden)
 		if err != nil {
-			Info.Println("Could not harden " + singleSZ.Name() +
+			Info.Println("Could not restore " + child.Name() +
 				" due to error: " + err.Error())
 			return err
 		}
@@ -204,21 +416,54 @@ func (regMultiValue RegistryMultiValue) Harden(harden bool) error {
 // IsHardened verifies if harden object of type RegistryMultiValue is already
 // hardened.
 func (regMultiValue *RegistryMultiValue) IsHardened() (isHardened bool) {
-	var hardened = true
+	return regMultiValue.Status().State == StateHardened
+}
 
+// Status returns the combined status of all registry values.
+func (regMultiValue *RegistryMultiValue) Status() HardenStatus {
+	var children []HardenStatus
+	for _, keyAbsent := range regMultiValue.ArrayKeyAbsent {
+		children = append(children, keyAbsent.Status())
+	}
+	for _, keyPresent := range regMultiValue.ArrayKeyPresent {
+		children = append(children, keyPresent.Status())
+	}
 	for _, singleDWORD := range regMultiValue.ArraySingleDWORD {
-		if !singleDWORD.IsHardened() {
-			hardened = false
-		}
+		children = append(children, singleDWORD.Status())
 	}
-
 	for _, singleSZ := range regMultiValue.ArraySingleSZ {
-		if !singleSZ.IsHardened() {
-			hardened = false
-		}
+		children = append(children, singleSZ.Status())
+	}
+	for _, singleValue := range regMultiValue.ArraySingleValue {
+		children = append(children, singleValue.Status())
 	}
+	return combineHardenStatus(regMultiValue.shortName, children)
+}
 
-	return hardened
+// RegistrySettings returns all registry values set by hardening.
+func (regMultiValue *RegistryMultiValue) RegistrySettings() ([]registrySetting, error) {
+	var settings []registrySetting
+	for _, keyAbsent := range regMultiValue.ArrayKeyAbsent {
+		setting, _ := keyAbsent.RegistrySettings()
+		settings = append(settings, setting...)
+	}
+	for _, singleDWORD := range regMultiValue.ArraySingleDWORD {
+		setting, _ := singleDWORD.RegistrySettings()
+		settings = append(settings, setting...)
+	}
+	for _, singleSZ := range regMultiValue.ArraySingleSZ {
+		setting, _ := singleSZ.RegistrySettings()
+		settings = append(settings, setting...)
+	}
+	for _, singleValue := range regMultiValue.ArraySingleValue {
+		setting, _ := singleValue.RegistrySettings()
+		settings = append(settings, setting...)
+	}
+	for _, keyPresent := range regMultiValue.ArrayKeyPresent {
+		setting, _ := keyPresent.RegistrySettings()
+		settings = append(settings, setting...)
+	}
+	return settings, nil
 }
 
 // Name returns the (short) name of the harden item.
@@ -243,21 +488,21 @@ func (regMultiValue *RegistryMultiValue) HardenByDefault() bool {
 
 // Helper methods.
 // Get root key name (LOCAL_MACHINE vs. LOCAL_USER).
-func getRootKeyName(rootKey registry.Key) (rootKeyName string, err error) {
-	// this is kind of a hack, since registry.Key doesn't allow to get the
-	// name of the key itself
+func getRootKeyName(rootKey RegistryRootKey) (rootKeyName string, err error) {
+	// these names are part of the saved state format, so they must not
+	// change
 	switch rootKey {
-	case registry.CLASSES_ROOT:
+	case HKCR:
 		rootKeyName = "CLASSES_ROOT"
-	case registry.CURRENT_USER:
+	case HKCU:
 		rootKeyName = "CURRENT_USER"
-	case registry.LOCAL_MACHINE:
+	case HKLM:
 		rootKeyName = "LOCAL_MACHINE"
-	case registry.USERS:
+	case HKU:
 		rootKeyName = "USERS"
-	case registry.CURRENT_CONFIG:
+	case HKCC:
 		rootKeyName = "CURRENT_CONFIG"
-	case registry.PERFORMANCE_DATA:
+	case HKPD:
 		rootKeyName = "PERFORMANCE_DATA"
 	default:
 		// invalid rootKey?
@@ -268,33 +513,44 @@ func getRootKeyName(rootKey registry.Key) (rootKeyName string, err error) {
 }
 
 // Get root key from name (LOCAL_MACHINE vs. LOCAL_USER).
-func getRootKeyFromName(rootKeyName string) (rootKey registry.Key, err error) {
+func getRootKeyFromName(rootKeyName string) (rootKey RegistryRootKey, err error) {
 	switch rootKeyName {
 	case "CLASSES_ROOT":
-		rootKey = registry.CLASSES_ROOT
+		rootKey = HKCR
 	case "CURRENT_USER":
-		rootKey = registry.CURRENT_USER
+		rootKey = HKCU
 	case "LOCAL_MACHINE":
-		rootKey = registry.LOCAL_MACHINE
+		rootKey = HKLM
 	case "USERS":
-		rootKey = registry.USERS
+		rootKey = HKU
 	case "CURRENT_CONFIG":
-		rootKey = registry.CURRENT_CONFIG
+		rootKey = HKCC
 	case "PERFORMANCE_DATA":
-		rootKey = registry.PERFORMANCE_DATA
+		rootKey = HKPD
 	default:
 		// Invalid rootKeyName?
 		Info.Println("Invalid rootKeyName provided to restore registry function")
 		err = errors.New("Invalid rootKeyName provided to restore registry function")
-		return registry.CURRENT_USER, err
+		return HKCU, err
 	}
 	return rootKey, nil
 }
 
 // Harden Dword value including saving the original state.
-func hardenKey(rootKey registry.Key, path string, valueName string, hardenedValue uint32) error {
+func hardenKey(rootKey RegistryRootKey, path string, valueName string, hardenedValue uint32) error {
+	return hardenValue(rootKey, path, valueName, dwordValue(hardenedValue))
+}
+
+// Harden SZ (String) value including saving the original state.
+func hardenKeySZ(rootKey RegistryRootKey, path string, valueName string, hardenedValue string) error {
+	return hardenValue(rootKey, path, valueName, stringValue(hardenedValue))
+}
+
+// hardenValue sets a registry value of any type after saving its original
+// state in the backup journal.
+func hardenValue(rootKey RegistryRootKey, path string, valueName string, hardenedValue *registryValue) error {
 	rootKeyName, _ := getRootKeyName(rootKey)
-	key, _, err := registry.CreateKey(rootKey, path, registry.WRITE)
+	key, _, err := registryBackend.CreateKey(rootKey, path, keyWrite)
 	if err != nil {
 		return fmt.Errorf("Couldn't create / open registry key for write access: %s\\%s",
 			rootKeyName, path)
@@ -302,12 +558,12 @@ func hardenKey(rootKey registry.Key, path string, valueName string, hardenedValu
 	defer key.Close()
 
 	// Save current state.
-	err = saveOriginalRegistryDWORD(rootKey, path, valueName)
+	err = recordOriginalValue(rootKey, path, valueName, hardenedValue)
 	if err != nil {
 		return err
 	}
 	// Harden.
-	err = key.SetDWordValue(valueName, hardenedValue)
+	err = writeRegistryValue(key, valueName, hardenedValue)
 	if err != nil {
 		return fmt.Errorf("Couldn't set registry value: %s \\ %s \\ %s",
 			rootKeyName, path, valueName)
@@ -316,366 +572,138 @@ func hardenKey(rootKey registry.Key, path string, valueName string, hardenedValu
 	return nil
 }
 
-// Harden SZ (String) value including saving the original state.
-func hardenKeySZ(rootKey registry.Key, path string, valueName string, hardenedValue string) error {
+// hardenDeleteValue deletes a registry value of any type after saving its
+// original state in the backup journal.
+func hardenDeleteValue(rootKey RegistryRootKey, path string, valueName string) error {
 	rootKeyName, _ := getRootKeyName(rootKey)
-	key, _, err := registry.CreateKey(rootKey, path, registry.WRITE)
-	if err != nil {
-		return fmt.Errorf("Couldn't create / open registry key for write access: %s\\%s",
+	key, err := registryBackend.OpenKey(rootKey, path, keyAllAccess)
+	if err == errRegistryNotExist {
+		// Nothing to delete.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Couldn't open registry key for write access: %s\\%s",
 			rootKeyName, path)
 	}
 	defer key.Close()
 
 	// Save current state.
-	err = saveOriginalRegistrySZ(rootKey, path, valueName)
+	err = recordOriginalValue(rootKey, path, valueName, nil)
 	if err != nil {
 		return err
 	}
 	// Harden.
-	err = key.SetStringValue(valueName, hardenedValue)
-	if err != nil {
-		return fmt.Errorf("Couldn't set registry value: %s \\ %s \\ %s",
+	err = key.DeleteValue(valueName)
+	if err != nil && err != errRegistryNotExist {
+		return fmt.Errorf("Couldn't delete registry value: %s \\ %s \\ %s",
 			rootKeyName, path, valueName)
 	}
 
 	return nil
 }
 
-// Helper method for saving original registry key DWORD.
-func saveOriginalRegistryDWORD(rootKey registry.Key, keyName string, valueName string) error {
-	saveNonExisting := false
-
-	// Open hardentools root key.
-	hardentoolsKey, _, err := registry.CreateKey(registry.CURRENT_USER,
-		hardentoolsKeyPath, registry.ALL_ACCESS)
-	if err != nil {
-		return err
-	}
-	defer hardentoolsKey.Close()
-
-	// Get name of root key (e.g. CURRENT_USER).
-	rootKeyName, err := getRootKeyName(rootKey)
-	if err != nil {
-		return err
-	}
-
-	// Open registry key.
-	keyToSave, err := registry.OpenKey(rootKey, keyName, registry.READ)
-	if err != nil {
-		//Trace.Println("Could not open registry key to save due to error: " + err.Error())
-		saveNonExisting = true
-	} else {
-		defer keyToSave.Close()
-
-		// Now finally get value to save.
-		originalValue, _, err := keyToSave.GetIntegerValue(valueName)
-		if err != nil {
-			//Trace.Println("Could not retrieve registry value to save (" + keyName + ", " + valueName + ") due to error: " + err.Error())
-			saveNonExisting = true
-		} else {
-			// save value
-			Trace.Println("Saving value for: " + "SavedStateNew_" + rootKeyName + "\\" + keyName + "_" + valueName)
-			err = hardentoolsKey.SetDWordValue("SavedStateNew_"+rootKeyName+"\\"+keyName+"____"+valueName, uint32(originalValue))
-			if err != nil {
-				Info.Println("Could not save state due to error: " + err.Error())
-			}
-		}
-	}
-
-	if saveNonExisting {
-		// Save as not existing before hardening.
-		Trace.Println("Saving " + rootKeyName + "\\" + keyName + "_" + valueName + " as not existing before hardening")
-		err = hardentoolsKey.SetDWordValue("SavedStateNotExisting_"+rootKeyName+"\\"+keyName+"____"+valueName, 0)
-		if err != nil {
-			Info.Println("Could not save state due to error: " + err.Error())
-			return err
-		}
+// hardenDeleteKey deletes a registry key with all subkeys after saving its
+// original content in the backup journal.
+func hardenDeleteKey(rootKey RegistryRootKey, path string) error {
+	rootKeyName, _ := getRootKeyName(rootKey)
+	if path == "" {
+		return fmt.Errorf("Refusing to delete root key %s", rootKeyName)
 	}
-
-	return nil
-}
-
-// Helper method for saving original registry key SZ (string).
-func saveOriginalRegistrySZ(rootKey registry.Key, keyName string, valueName string) error {
-	saveNonExisting := false
-
-	// Open hardentools root key.
-	hardentoolsKey, _, err := registry.CreateKey(registry.CURRENT_USER,
-		hardentoolsKeyPath, registry.ALL_ACCESS)
-	if err != nil {
-		return err
+	if !registryKeyExists(rootKey, path) {
+		// Nothing to delete.
+		return nil
 	}
-	defer hardentoolsKey.Close()
 
-	// Get name of root key (e.g. CURRENT_USER).
-	rootKeyName, err := getRootKeyName(rootKey)
+	// Save current state.
+	err := recordOriginalKey(rootKey, path)
 	if err != nil {
 		return err
 	}
-
-	// Open registry key.
-	keyToSave, err := registry.OpenKey(rootKey, keyName, registry.READ)
-	if err != nil {
-		//Trace.Println("Could not open registry key to save due to error: " + err.Error())
-		saveNonExisting = true
-	} else {
-		defer keyToSave.Close()
-
-		// Now finally get value to save.
-		originalValue, _, err := keyToSave.GetStringValue(valueName)
-		if err != nil {
-			//Trace.Println("Could not retrieve registry value to save (" + keyName + ", " + valueName + ") due to error: " + err.Error())
-			saveNonExisting = true
-		} else {
-			// save value
-			Trace.Println("Saving value for: " + "SavedStateNewSZ_" + rootKeyName + "\\" + keyName + "_" + valueName)
-			err = hardentoolsKey.SetStringValue("SavedStateNewSZ_"+rootKeyName+"\\"+keyName+"____"+valueName, originalValue)
-			if err != nil {
-				Info.Println("Could not save state due to error: " + err.Error())
-			}
-		}
-	}
-
-	if saveNonExisting {
-		// Save as not existing before hardening.
-		Trace.Println("Saving " + rootKeyName + "\\" + keyName + "_" + valueName + " as not existing before hardening")
-		err = hardentoolsKey.SetDWordValue("SavedStateNotExisting_"+rootKeyName+"\\"+keyName+"____"+valueName, 0)
-		if err != nil {
-			Info.Println("Could not save state due to error: " + err.Error())
-			return err
-		}
+	// Harden.
+	err = deleteRegistryKeyTree(rootKey, path)
+	if err != nil && err != errRegistryNotExist {
+		return fmt.Errorf("Couldn't delete registry key: %s \\ %s", rootKeyName, path)
 	}
 
 	return nil
 }
 
-// Helper method for restoring registry key from saved state for DWORD values.
-func retrieveOriginalRegistryDWORD(rootKey registry.Key, keyName string, valueName string) (value uint32, err error) {
-	// Open hardentools root key
-	hardentoolsKey, _, err := registry.CreateKey(registry.CURRENT_USER, hardentoolsKeyPath, registry.ALL_ACCESS)
-	if err != nil {
-		return 0, err
-	}
-	defer hardentoolsKey.Close()
-
-	// Get rootKeyName.
-	rootKeyName, err := getRootKeyName(rootKey)
-	if err != nil {
-		Info.Println("Could not get rootKeyName")
-		return 0, err
-	}
-
-	// Get saved state
-	value64, _, err := hardentoolsKey.GetIntegerValue("SavedState_" + rootKeyName + "\\" + keyName + "_" + valueName)
-	if err != nil {
-		return 0, err
-	}
-
-	return uint32(value64), nil
-}
-
-// restoreSavedRegistryKeys restores all saved registry keys from their saved
-// registry state.
+// restoreSavedRegistryKeys restores all saved registry keys from the backup
+// journal. Saved state of older hardentools versions is migrated to the
+// journal first.
 func restoreSavedRegistryKeys() error {
-	// Open hardentools root key.
-	hardentoolsKey, err := registry.OpenKey(registry.CURRENT_USER, hardentoolsKeyPath, registry.QUERY_VALUE)
+	report, err := migrateLegacySavedState()
 	if err != nil {
 		return err
 	}
-	defer hardentoolsKey.Close()
 
-	params, err := hardentoolsKey.ReadValueNames(0)
-	if err != nil {
-		Info.Printf("Can't ReadSubKeyNames %s %#v", hardentoolsKeyPath, err)
-		return err
-	}
-
-	//// handle DWORD and new states
-	settings := make(map[string]uint64)
-	for _, param := range params {
-		val, _, err := hardentoolsKey.GetIntegerValue(param)
-		if err == nil {
-			settings[param] = val
-		}
-	}
-
-	for regKey, regValue := range settings {
-		if strings.HasPrefix(regKey, "SavedState_") {
-			// TODO: this section can be removed in future versions
-			regKey = strings.TrimPrefix(regKey, "SavedState_")
-			rootKeyName := strings.Split(regKey, "\\")[0]
-			regKey = strings.TrimPrefix(regKey, rootKeyName)
-			regKey = strings.TrimPrefix(regKey, "\\")
-			valueName := regKey[strings.LastIndex(regKey, "_")+1:]
-			regKey = strings.TrimSuffix(regKey, "_"+valueName)
-			Trace.Printf("to be restored: %s\\%s\\%s = %d\n", rootKeyName,
-				regKey, valueName, regValue)
-
-			rootKey, err := getRootKeyFromName(rootKeyName)
-			if err == nil {
-				key, err := registry.OpenKey(rootKey, regKey, registry.ALL_ACCESS)
-				if err != nil {
-					Info.Println("Could not open registry key " + regKey + " due to error: " + err.Error())
-				} else {
-					defer key.Close()
-
-					Info.Printf("restoreSavedRegistryKeys: Restoring registry value %s\\%s = %d",
-						regKey, valueName, regValue)
-					err = key.SetDWordValue(valueName, uint32(regValue))
-					if err != nil {
-						Info.Printf("Could not restore registry value %s\\%s = %d due to error: %s\n",
-							regKey, valueName, regValue, err.Error())
-					}
-				}
-			}
-		} else if strings.HasPrefix(regKey, "SavedStateNew_") {
-			regKey = strings.TrimPrefix(regKey, "SavedStateNew_")
-			rootKeyName := strings.Split(regKey, "\\")[0]
-			regKey = strings.TrimPrefix(regKey, rootKeyName)
-			regKey = strings.TrimPrefix(regKey, "\\")
-			valueName := regKey[strings.LastIndex(regKey, "____")+4:]
-			regKey = strings.TrimSuffix(regKey, "____"+valueName)
-			Trace.Printf("to be restored: %s\\%s\\%s = %d\n", rootKeyName, regKey, valueName, regValue)
-
-			rootKey, err := getRootKeyFromName(rootKeyName)
-			if err == nil {
-				key, err := registry.OpenKey(rootKey, regKey, registry.ALL_ACCESS)
-				if err != nil {
-					Info.Println("Could not open registry key " + regKey + " due to error: " + err.Error())
-				} else {
-					defer key.Close()
-
-					Trace.Printf("restoreSavedRegistryKeys: Restoring registry value %s\\%s = %d",
-						regKey, valueName, regValue)
-					err = key.SetDWordValue(valueName, uint32(regValue))
-					if err != nil {
-						Info.Printf("Could not restore registry value %s\\%s = %d due to error: %s\n",
-							regKey, valueName, regValue, err.Error())
-					}
-				}
-			}
-		} else if strings.HasPrefix(regKey, "SavedStateNotExisting_") {
-			regKey = strings.TrimPrefix(regKey, "SavedStateNotExisting_")
-			rootKeyName := strings.Split(regKey, "\\")[0]
-			regKey = strings.TrimPrefix(regKey, rootKeyName)
-			regKey = strings.TrimPrefix(regKey, "\\")
-			valueName := regKey[strings.LastIndex(regKey, "____")+4:]
-			regKey = strings.TrimSuffix(regKey, "____"+valueName)
-			Trace.Printf("to be restored (deleted): %s\\%s\\%s\n", rootKeyName, regKey, valueName)
-
-			rootKey, err := getRootKeyFromName(rootKeyName)
-			if err == nil {
-				key, err := registry.OpenKey(rootKey, regKey, registry.ALL_ACCESS)
-				if err != nil {
-					Info.Println("Could not open registry key " + regKey + " due to error: " + err.Error())
-				} else {
-					defer key.Close()
-
-					err = key.DeleteValue(valueName)
-					if err != nil {
-						// should be Info logger in the future, when registry
-						// keys are not deleted by restoreKey() anymore
-						Trace.Printf("Could not restore registry value (by deleting) %s\\%s due to error: %s\n",
-							regKey, valueName, err.Error())
-					}
-				}
-			}
-		}
-	}
-
-	// handle String (SZ) values
-	settingsSZ := make(map[string]string)
-	for _, param := range params {
-		val, _, err := hardentoolsKey.GetStringValue(param)
-		if err == nil {
-			settingsSZ[param] = val
-		}
+	err = restoreBackupJournal()
+	if err == nil && len(report.Problems) > 0 {
+		err = fmt.Errorf("%d legacy saved states could not be restored, see -migrate-state",
+			len(report.Problems))
 	}
-
-	for regKey, regValue := range settingsSZ {
-		if strings.HasPrefix(regKey, "SavedStateNewSZ_") {
-			regKey = strings.TrimPrefix(regKey, "SavedStateNewSZ_")
-			rootKeyName := strings.Split(regKey, "\\")[0]
-			regKey = strings.TrimPrefix(regKey, rootKeyName)
-			regKey = strings.TrimPrefix(regKey, "\\")
-			valueName := regKey[strings.LastIndex(regKey, "____")+4:]
-			regKey = strings.TrimSuffix(regKey, "____"+valueName)
-			Trace.Printf("to be restored: %s\\%s\\%s = %s\n", rootKeyName, regKey, valueName, regValue)
-
-			rootKey, err := getRootKeyFromName(rootKeyName)
-			if err == nil {
-				key, err := registry.OpenKey(rootKey, regKey, registry.ALL_ACCESS)
-				if err != nil {
-					Info.Println("Could not open registry key " + regKey + " due to error: " + err.Error())
-				} else {
-					defer key.Close()
-
-					Trace.Printf("restoreSavedRegistryKeys: Restoring registry value %s\\%s = %s",
-						regKey, valueName, regValue)
-					err = key.SetStringValue(valueName, regValue)
-					if err != nil {
-						Info.Printf("Could not restore registry value %s\\%s = %s due to error: %s\n",
-							regKey, valueName, regValue, err.Error())
-					}
-				}
-			}
-		}
-	}
-
 	return err
 }
 
 // saveHardenState is a helper method for saving non-registry-based harden status
 func saveHardenState(feature, stateToSafe string) error {
-	// Open hardentools root key.
-	hardentoolsKey, _, err := registry.CreateKey(registry.CURRENT_USER,
-		hardentoolsKeyPath, registry.ALL_ACCESS)
+	journal, err := loadBackupJournal()
 	if err != nil {
 		return err
 	}
-	defer hardentoolsKey.Close()
 
 	// save value
 	Trace.Println("Saving value for feature: " + feature + " with " + stateToSafe)
-	err = hardentoolsKey.SetStringValue("SavedStateNonReg_"+feature, stateToSafe)
+	state := journal.findState(feature)
+	newState := state == nil
+	if newState {
+		state = &journalState{Subject: journalSubject, Feature: feature}
+		journal.States = append(journal.States, state)
+	}
+	state.State = stateToSafe
+	state.Timestamp = time.Now().UTC()
+
+	err = journal.save()
 	if err != nil {
 		Info.Println("Could not save state due to error: " + err.Error())
+		return err
+	}
+	if newState && currentTransaction != nil {
+		currentTransaction.logStateChange(feature)
 	}
-
 	return nil
 }
 
 // getSavedHardenState is a helper method for saving non-registry-based harden status
 func getSavedHardenState(feature string) (savedState string, err error) {
-	// Open hardentools root key.
-	hardentoolsKey, err := registry.OpenKey(registry.CURRENT_USER, hardentoolsKeyPath, registry.QUERY_VALUE)
+	journal, err := loadBackupJournal()
 	if err != nil {
 		return "", err
 	}
-	defer hardentoolsKey.Close()
 
-	// Open registry key.
-	savedState, _, err = hardentoolsKey.GetStringValue("SavedStateNonReg_" + feature)
-	if err != nil {
-		Trace.Println("Could not retrieve saved state for feature " + feature + " due to error: " + err.Error())
-		return "", err
+	state := journal.findState(feature)
+	if state == nil {
+		return getLegacySavedHardenState(feature)
 	}
-	Trace.Println("Retreived saved state for feature " + feature + ":" + savedState)
-	return savedState, nil
+	Trace.Println("Retreived saved state for feature " + feature + ":" + state.State)
+	return state.State, nil
 }
 
 func deleteSavedHardenState(feature string) error {
-	// Open hardentools root key.
-	hardentoolsKey, err := registry.OpenKey(registry.CURRENT_USER, hardentoolsKeyPath, registry.QUERY_VALUE)
+	journal, err := loadBackupJournal()
 	if err != nil {
 		return err
 	}
-	defer hardentoolsKey.Close()
 
-	err = hardentoolsKey.DeleteValue("SavedStateNonReg_" + feature)
-	if err != nil {
-		Info.Printf("Could not delete saved state for feature %s due to error %s",
-			feature, err.Error())
+	for i, state := range journal.States {
+		if state.Feature == feature {
+			journal.States = append(journal.States[:i], journal.States[i+1:]...)
+			err = journal.save()
+			if err != nil {
+				Info.Printf("Could not delete saved state for feature %s due to error %s",
+					feature, err.Error())
+			}
+			return err
+		}
 	}
-	return err
+	return deleteLegacySavedHardenState(feature)
 }
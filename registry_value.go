@@ -0,0 +1,309 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// registryValue is a typed registry value as it is stored in the backup
+// journal.
+type registryValue struct {
+	Type    uint32
+	Integer uint64   // REG_DWORD, REG_QWORD
+	Str     string   // REG_SZ, REG_EXPAND_SZ
+	Strings []string // REG_MULTI_SZ
+	Binary  []byte   // REG_BINARY and all other types (raw data)
+}
+
+// registryValueTypeNames contains the names of the value types with typed
+// data. Values of other types are kept as raw data.
+var registryValueTypeNames = map[uint32]string{
+	regNone:     "REG_NONE",
+	regSZ:       "REG_SZ",
+	regExpandSZ: "REG_EXPAND_SZ",
+	regBinary:   "REG_BINARY",
+	regDWORD:    "REG_DWORD",
+	regMultiSZ:  "REG_MULTI_SZ",
+	regQWORD:    "REG_QWORD",
+}
+
+// registryValueTypeName returns the name of a value type (e.g. "REG_DWORD").
+func registryValueTypeName(valtype uint32) string {
+	if name, ok := registryValueTypeNames[valtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("REG_TYPE_%d", valtype)
+}
+
+// registryValueTypeFromName returns the value type for a name returned by
+// registryValueTypeName.
+func registryValueTypeFromName(name string) (uint32, error) {
+	for valtype, typeName := range registryValueTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return valtype, nil
+		}
+	}
+	if number, ok := strings.CutPrefix(strings.ToUpper(name), "REG_TYPE_"); ok {
+		if valtype, err := strconv.ParseUint(number, 10, 32); err == nil {
+			return uint32(valtype), nil
+		}
+	}
+	return regNone, fmt.Errorf("unsupported registry value type %s", name)
+}
+
+// dwordValue returns a REG_DWORD registryValue.
+func dwordValue(value uint32) *registryValue {
+	return &registryValue{Type: regDWORD, Integer: uint64(value)}
+}
+
+// stringValue returns a REG_SZ registryValue.
+func stringValue(value string) *registryValue {
+	return &registryValue{Type: regSZ, Str: value}
+}
+
+// expandStringValue returns a REG_EXPAND_SZ registryValue.
+func expandStringValue(value string) *registryValue {
+	return &registryValue{Type: regExpandSZ, Str: value}
+}
+
+// multiStringValue returns a REG_MULTI_SZ registryValue.
+func multiStringValue(values ...string) *registryValue {
+	return &registryValue{Type: regMultiSZ, Strings: values}
+}
+
+// qwordValue returns a REG_QWORD registryValue.
+func qwordValue(value uint64) *registryValue {
+	return &registryValue{Type: regQWORD, Integer: value}
+}
+
+// binaryValue returns a REG_BINARY registryValue.
+func binaryValue(value []byte) *registryValue {
+	return &registryValue{Type: regBinary, Binary: value}
+}
+
+// rawRegistryValue returns the registryValue of valtype with the data as
+// stored in the registry. Integers with less data than expected are padded
+// with zeros, strings end at the first null.
+func rawRegistryValue(valtype uint32, data []byte) *registryValue {
+	value := &registryValue{Type: valtype}
+	padded := make([]byte, 8)
+	copy(padded, data)
+	switch valtype {
+	case regDWORD:
+		value.Integer = uint64(binary.LittleEndian.Uint32(padded))
+	case regQWORD:
+		value.Integer = binary.LittleEndian.Uint64(padded)
+	case regSZ, regExpandSZ:
+		value.Str, _, _ = strings.Cut(decodeUTF16LE(data), "\x00")
+	case regMultiSZ:
+		if list := strings.TrimRight(decodeUTF16LE(data), "\x00"); list != "" {
+			value.Strings = strings.Split(list, "\x00")
+		}
+	default:
+		value.Binary = data
+	}
+	return value
+}
+
+// String returns the value data in a human readable form.
+func (value *registryValue) String() string {
+	if value == nil {
+		return "(not existing)"
+	}
+	switch value.Type {
+	case regDWORD, regQWORD:
+		return fmt.Sprintf("%d", value.Integer)
+	case regSZ, regExpandSZ:
+		return value.Str
+	case regMultiSZ:
+		return strings.Join(value.Strings, "\\0")
+	default:
+		return hex.EncodeToString(value.Binary)
+	}
+}
+
+// rawData returns the data of value as stored in the registry. Strings are
+// null terminated UTF-16LE.
+func (value *registryValue) rawData() []byte {
+	switch value.Type {
+	case regDWORD:
+		return binary.LittleEndian.AppendUint32(nil, uint32(value.Integer))
+	case regQWORD:
+		return binary.LittleEndian.AppendUint64(nil, value.Integer)
+	case regSZ, regExpandSZ:
+		return encodeUTF16LE(value.Str + "\x00")
+	case regMultiSZ:
+		return encodeUTF16LE(strings.Join(value.Strings, "\x00") + "\x00\x00")
+	default:
+		return value.Binary
+	}
+}
+
+// encodeUTF16LE encodes s as UTF-16LE (without terminating null).
+func encodeUTF16LE(s string) []byte {
+	var data []byte
+	for _, code := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, code)
+	}
+	return data
+}
+
+// Equal returns true if value and other have the same type and data.
+func (value *registryValue) Equal(other *registryValue) bool {
+	if value == nil || other == nil {
+		return value == other
+	}
+	if value.Type != other.Type {
+		return false
+	}
+	switch value.Type {
+	case regDWORD, regQWORD:
+		return value.Integer == other.Integer
+	case regSZ, regExpandSZ:
+		return value.Str == other.Str
+	case regMultiSZ:
+		if len(value.Strings) != len(other.Strings) {
+			return false
+		}
+		for i := range value.Strings {
+			if value.Strings[i] != other.Strings[i] {
+				return false
+			}
+		}
+		return true
+	default:
+		return bytes.Equal(value.Binary, other.Binary)
+	}
+}
+
+// registryValueJSON is the JSON representation of registryValue.
+type registryValueJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalJSON encodes the value as {"type": "REG_DWORD", "data": 1}. Binary
+// data and the raw data of other types is hex encoded.
+func (value registryValue) MarshalJSON() ([]byte, error) {
+	var data interface{}
+	switch value.Type {
+	case regDWORD, regQWORD:
+		data = value.Integer
+	case regSZ, regExpandSZ:
+		data = value.Str
+	case regMultiSZ:
+		data = value.Strings
+		if value.Strings == nil {
+			data = []string{}
+		}
+	default:
+		data = hex.EncodeToString(value.Binary)
+	}
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(registryValueJSON{registryValueTypeName(value.Type), encodedData})
+}
+
+// UnmarshalJSON decodes a value encoded by MarshalJSON.
+func (value *registryValue) UnmarshalJSON(data []byte) error {
+	var encoded registryValueJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	valtype, err := registryValueTypeFromName(encoded.Type)
+	if err != nil {
+		return err
+	}
+	*value = registryValue{Type: valtype}
+
+	switch valtype {
+	case regDWORD, regQWORD:
+		err = json.Unmarshal(encoded.Data, &value.Integer)
+		if err == nil && valtype == regDWORD && value.Integer > 0xffffffff {
+			err = fmt.Errorf("REG_DWORD value %d out of range", value.Integer)
+		}
+	case regSZ, regExpandSZ:
+		err = json.Unmarshal(encoded.Data, &value.Str)
+	case regMultiSZ:
+		err = json.Unmarshal(encoded.Data, &value.Strings)
+	default:
+		var hexData string
+		if err = json.Unmarshal(encoded.Data, &hexData); err == nil {
+			value.Binary, err = hex.DecodeString(hexData)
+		}
+	}
+	return err
+}
+
+// readRegistryValue reads the value name of key with whatever type it has.
+// It returns errRegistryNotExist if the value doesn't exist.
+func readRegistryValue(key RegistryKey, name string) (*registryValue, error) {
+	// GetBinaryValue returns the real type of the value, even if it isn't
+	// REG_BINARY.
+	binary, valtype, err := key.GetBinaryValue(name)
+	if err != nil && err != errRegistryUnexpectedType {
+		return nil, err
+	}
+
+	value := &registryValue{Type: valtype}
+	switch valtype {
+	case regBinary:
+		value.Binary = binary
+	case regDWORD, regQWORD:
+		value.Integer, _, err = key.GetIntegerValue(name)
+	case regSZ, regExpandSZ:
+		value.Str, _, err = key.GetStringValue(name)
+	case regMultiSZ:
+		value.Strings, _, err = key.GetStringsValue(name)
+	default:
+		// REG_NONE, REG_LINK, REG_RESOURCE_LIST etc. are kept as raw data.
+		value.Binary, _, err = key.GetRawValue(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// writeRegistryValue writes value with its type as value name of key.
+func writeRegistryValue(key RegistryKey, name string, value *registryValue) error {
+	switch value.Type {
+	case regDWORD:
+		return key.SetDWordValue(name, uint32(value.Integer))
+	case regQWORD:
+		return key.SetQWordValue(name, value.Integer)
+	case regSZ:
+		return key.SetStringValue(name, value.Str)
+	case regExpandSZ:
+		return key.SetExpandStringValue(name, value.Str)
+	case regMultiSZ:
+		return key.SetStringsValue(name, value.Strings)
+	case regBinary:
+		return key.SetBinaryValue(name, value.Binary)
+	}
+	return key.SetRawValue(name, value.Type, value.Binary)
+}
@@ -0,0 +1,550 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Machine-readable reports of the status of all harden subjects and of the
+// results of a harden or restore run, e.g. for inventory scripts. They are
+// written instead of the text output if a report format is selected with
+// -format.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported report formats.
+const (
+	reportFormatText  = "text"
+	reportFormatJSON  = "json"
+	reportFormatCSV   = "csv"
+	reportFormatSARIF = "sarif"
+)
+
+// Results of a harden subject in a harden or restore run.
+const (
+	resultHardened   = "hardened"
+	resultRestored   = "restored"
+	resultFailed     = "failed"
+	resultRolledBack = "rolled back"
+	resultSkipped    = "skipped"
+)
+
+const (
+	hardentoolsURL = "https://github.com/securitywithoutborders/hardentools"
+	sarifSchema    = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion   = "2.1.0"
+)
+
+// reportFormat is the format of the report written instead of the text
+// output. An empty string (or reportFormatText) selects the text output.
+var reportFormat string
+
+// reportOutput is where reports are written to. All other output goes to
+// stderr while a report is written, so it can't mix with the report.
+var reportOutput io.Writer = os.Stdout
+
+// runResults contains the results of the last harden or restore run by
+// harden subject name.
+var runResults = make(map[string]runResult)
+
+// runResult is the result of a harden subject in a harden or restore run.
+type runResult struct {
+	Result string
+	Error  string
+}
+
+// recordRunResult records the result of hardenSubject in the current run and
+// logs it to the log file.
+func recordRunResult(name, result string, err error) {
+	entry := runResult{Result: result}
+	level := slog.LevelInfo
+	attrs := []any{"subject", name, "result", result}
+	if err != nil {
+		entry.Error = err.Error()
+		level = slog.LevelError
+		attrs = append(attrs, "error", entry.Error)
+	}
+	runResults[name] = entry
+	logger.Log(logFileOnly, level, "Harden subject "+result, attrs...)
+}
+
+// useReportFormat selects the report format (case insensitive). Afterwards
+// all other output is redirected to stderr.
+func useReportFormat(format string) error {
+	format = strings.ToLower(format)
+	switch format {
+	case "", reportFormatText:
+		return nil
+	case reportFormatJSON, reportFormatCSV, reportFormatSARIF:
+	default:
+		return fmt.Errorf("unknown format %q (supported: text, json, csv, sarif)", format)
+	}
+	reportFormat = format
+	reportOutput = os.Stdout
+	os.Stdout = os.Stderr
+	return nil
+}
+
+// isReportMode returns true if a report should be written instead of the
+// text output.
+func isReportMode() bool {
+	return reportFormat != "" && reportFormat != reportFormatText
+}
+
+// hardenReport is the status of all harden subjects, optionally with the
+// results of a harden or restore run.
+type hardenReport struct {
+	Tool      string          `json:"tool"`
+	Version   string          `json:"version"`
+	Operation string          `json:"operation"` // status, harden or restore
+	Time      time.Time       `json:"time"`
+	Elevated  bool            `json:"elevated"`
+	OSName    string          `json:"os_name,omitempty"`
+	OSVersion string          `json:"os_version,omitempty"`
+	OSBuild   string          `json:"os_build,omitempty"`
+	Hardened  bool            `json:"hardened"` // Status of the hardentools registry key.
+	Error     string          `json:"error,omitempty"`
+	Subjects  []subjectReport `json:"subjects"`
+	Users     []userReport    `json:"users,omitempty"`
+}
+
+// subjectReport is the status of a harden subject.
+type subjectReport struct {
+	Name     string          `json:"name"`
+	Category string          `json:"category"`
+	State    string          `json:"state"`
+	Reason   string          `json:"reason,omitempty"`
+	Result   string          `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Settings []settingReport `json:"settings,omitempty"`
+
+	subject HardenInterface
+}
+
+// settingReport is the status of a single setting (e.g. a registry value) of
+// a harden subject.
+type settingReport struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// userReport is the status of the per-user harden subjects of a user
+// profile (with -all-users).
+type userReport struct {
+	SID      string          `json:"sid"`
+	Path     string          `json:"path"`
+	Subjects []subjectReport `json:"subjects"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+// newHardenReport returns a report with the status of allHardenSubjects.
+// If operation is harden or restore, the results of the last run are added.
+func newHardenReport(operation string) *hardenReport {
+	report := &hardenReport{
+		Tool:      "Hardentools",
+		Version:   hardentoolsVersion,
+		Operation: operation,
+		Time:      time.Now().UTC(),
+		Elevated:  offlineHives == nil && isElevated(),
+		Hardened:  checkStatus(),
+	}
+	report.OSName, report.OSVersion, report.OSBuild = windowsVersion()
+	for _, hardenSubject := range allHardenSubjects {
+		subject := newSubjectReport(hardenSubject)
+		if operation != "status" {
+			if result, ok := runResults[hardenSubject.Name()]; ok {
+				subject.Result, subject.Error = result.Result, result.Error
+			} else {
+				subject.Result = resultSkipped
+			}
+		}
+		report.Subjects = append(report.Subjects, subject)
+	}
+	return report
+}
+
+// newRunReport returns the report of the last harden (or restore if harden
+// is false) run, or nil if no report should be written.
+func newRunReport(harden bool) *hardenReport {
+	if !isReportMode() {
+		return nil
+	}
+	if harden {
+		return newHardenReport("harden")
+	}
+	return newHardenReport("restore")
+}
+
+// newSubjectReport returns the current status of hardenSubject.
+func newSubjectReport(hardenSubject HardenInterface) subjectReport {
+	status := getHardenStatus(hardenSubject)
+	subject := subjectReport{
+		Name:     hardenSubject.Name(),
+		Category: subjectCategory(hardenSubject),
+		State:    status.State.String(),
+		Reason:   status.Reason,
+		subject:  hardenSubject,
+	}
+	for _, child := range status.Children {
+		subject.Settings = appendSettingReports(subject.Settings, child)
+	}
+	return subject
+}
+
+// appendSettingReports appends the settings of status (the leaves of the
+// status tree) to settings.
+func appendSettingReports(settings []settingReport, status HardenStatus) []settingReport {
+	if len(status.Children) == 0 {
+		return append(settings, settingReport{status.Name, status.State.String(), status.Reason})
+	}
+	for _, child := range status.Children {
+		settings = appendSettingReports(settings, child)
+	}
+	return settings
+}
+
+// addUserProfiles adds the status of the per-user harden subjects of all
+// user profiles to report. For harden and restore reports, results are the
+// results of hardenUserProfiles, otherwise the profiles are listed.
+func (report *hardenReport) addUserProfiles(results []userProfileResult) error {
+	if report.Operation == "status" {
+		profiles, err := listUserProfiles()
+		if err != nil {
+			return err
+		}
+		for _, profile := range profiles {
+			results = append(results, userProfileResult{Profile: profile})
+		}
+	}
+
+	result := resultRestored
+	if report.Operation == "harden" {
+		result = resultHardened
+	}
+	for _, profileResult := range results {
+		user := userReport{SID: profileResult.Profile.SID, Path: profileResult.Profile.Path}
+		err := withUserHive(profileResult.Profile, func() error {
+			for _, hardenSubject := range perUserSubjects() {
+				subject := newSubjectReport(hardenSubject)
+				if containsFold(profileResult.Changed, hardenSubject.Name()) {
+					subject.Result = result
+				}
+				user.Subjects = append(user.Subjects, subject)
+			}
+			return nil
+		})
+		if err != nil {
+			user.Errors = append(user.Errors, err.Error())
+		}
+		for _, err := range profileResult.Errors {
+			user.Errors = append(user.Errors, err.Error())
+		}
+		report.Users = append(report.Users, user)
+	}
+	return nil
+}
+
+// subjectCategory returns the product or area hardenSubject belongs to.
+func subjectCategory(hardenSubject HardenInterface) string {
+	name := hardenSubject.Name()
+	for _, lolbin := range LOLBins {
+		if lolbin.Name() == name {
+			return "LOLBins"
+		}
+	}
+	switch {
+	case strings.HasPrefix(name, "Office"), strings.HasPrefix(name, "OneNote"):
+		return "Office"
+	case strings.HasPrefix(name, "Adobe"):
+		return "Adobe"
+	case strings.HasPrefix(name, "LibreOffice"):
+		return "LibreOffice"
+	}
+	return "Windows"
+}
+
+// windowsVersion returns product name, version (e.g. 23H2) and build number
+// (including the update revision) of Windows. Values that can't be read are
+// empty.
+func windowsVersion() (name, version, build string) {
+	key, err := registryBackend.OpenKey(HKLM,
+		"SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion", keyQueryValue)
+	if err != nil {
+		return "", "", ""
+	}
+	defer key.Close()
+
+	name, _, _ = key.GetStringValue("ProductName")
+	version, _, _ = key.GetStringValue("DisplayVersion")
+	build, _, _ = key.GetStringValue("CurrentBuild")
+	if revision, _, err := key.GetIntegerValue("UBR"); err == nil && build != "" {
+		build += "." + strconv.FormatUint(revision, 10)
+	}
+	return name, version, build
+}
+
+// writeReport writes report in the selected report format to reportOutput.
+func writeReport(report *hardenReport) error {
+	switch reportFormat {
+	case reportFormatCSV:
+		return writeCSVReport(reportOutput, report)
+	case reportFormatSARIF:
+		return writeSARIFReport(reportOutput, report)
+	}
+	return writeJSONReport(reportOutput, report)
+}
+
+// writeReportOrExit writes report and exits with an error if that fails.
+func writeReportOrExit(report *hardenReport) {
+	if err := writeReport(report); err != nil {
+		fmt.Println("Could not write report: " + err.Error())
+		os.Exit(-1)
+	}
+}
+
+// writeJSONReport writes report as JSON to w.
+func writeJSONReport(w io.Writer, report *hardenReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// csvReportHeader contains the columns of CSV reports.
+var csvReportHeader = []string{
+	"user", "subject", "category", "state", "reason", "result", "error",
+	"setting", "setting_state", "setting_reason",
+	"operation", "version", "elevated", "os_name", "os_version", "os_build",
+}
+
+// writeCSVReport writes report as CSV to w. There is a line for every
+// setting of every subject (or a single one for subjects without settings),
+// the columns of the subject and of the report are repeated on every line.
+func writeCSVReport(w io.Writer, report *hardenReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvReportHeader); err != nil {
+		return err
+	}
+
+	writeSubjects := func(user string, subjects []subjectReport) {
+		for _, subject := range subjects {
+			settings := subject.Settings
+			if len(settings) == 0 {
+				settings = []settingReport{{}}
+			}
+			for _, setting := range settings {
+				writer.Write([]string{
+					user, subject.Name, subject.Category, subject.State, subject.Reason,
+					subject.Result, subject.Error,
+					setting.Name, setting.State, setting.Reason,
+					report.Operation, report.Version, strconv.FormatBool(report.Elevated),
+					report.OSName, report.OSVersion, report.OSBuild,
+				})
+			}
+		}
+	}
+	writeSubjects("", report.Subjects)
+	for _, user := range report.Users {
+		writeSubjects(user.SID, user.Subjects)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// SARIF (Static Analysis Results Interchange Format) log, reduced to the
+// parts used by hardentools.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	FullDescription  sarifMessage           `json:"fullDescription"`
+	Properties       map[string]interface{} `json:"properties"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool                   `json:"executionSuccessful"`
+	EndTimeUTC          time.Time              `json:"endTimeUtc"`
+	Properties          map[string]interface{} `json:"properties"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	Kind       string                 `json:"kind"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind,omitempty"`
+}
+
+// writeSARIFReport writes report as SARIF 2.1.0 log to w. Every harden
+// subject is a rule, every subject (of every user) a result that passes if
+// it is hardened. The settings that are not hardened are the locations of
+// the result.
+func writeSARIFReport(w io.Writer, report *hardenReport) error {
+	run := sarifRun{
+		Tool: sarifTool{sarifDriver{
+			Name:           report.Tool,
+			Version:        report.Version,
+			InformationURI: hardentoolsURL,
+		}},
+		Invocations: []sarifInvocation{{
+			ExecutionSuccessful: report.Error == "",
+			EndTimeUTC:          report.Time,
+			Properties: map[string]interface{}{
+				"operation": report.Operation,
+				"elevated":  report.Elevated,
+				"osName":    report.OSName,
+				"osVersion": report.OSVersion,
+				"osBuild":   report.OSBuild,
+				"hardened":  report.Hardened,
+			},
+		}},
+		Results: []sarifResult{},
+	}
+	if report.Error != "" {
+		run.Invocations[0].Properties["error"] = report.Error
+	}
+
+	rules := make(map[string]bool)
+	addSubjects := func(user string, subjects []subjectReport) {
+		for _, subject := range subjects {
+			if !rules[subject.Name] {
+				rules[subject.Name] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               subject.Name,
+					ShortDescription: sarifMessage{subject.subject.LongName()},
+					FullDescription:  sarifMessage{subject.subject.Description()},
+					Properties:       map[string]interface{}{"category": subject.Category},
+				})
+			}
+			result := newSARIFResult(subject)
+			if user != "" {
+				result.Properties["user"] = user
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+	addSubjects("", report.Subjects)
+	for _, user := range report.Users {
+		addSubjects(user.SID, user.Subjects)
+		for _, err := range user.Errors {
+			run.Invocations[0].ExecutionSuccessful = false
+			run.Results = append(run.Results, sarifResult{
+				RuleID:     "user-profile",
+				Kind:       "fail",
+				Level:      "error",
+				Message:    sarifMessage{err},
+				Properties: map[string]interface{}{"user": user.SID},
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{sarifSchema, sarifVersion, []sarifRun{run}})
+}
+
+// newSARIFResult returns the SARIF result of subject.
+func newSARIFResult(subject subjectReport) sarifResult {
+	result := sarifResult{
+		RuleID:  subject.Name,
+		Kind:    "pass",
+		Level:   "none",
+		Message: sarifMessage{subject.Name + ": " + subject.State},
+		Properties: map[string]interface{}{
+			"category": subject.Category,
+			"state":    subject.State,
+			"settings": subject.Settings,
+		},
+	}
+	if subject.Reason != "" {
+		result.Message.Text += " (" + subject.Reason + ")"
+	}
+	if subject.Result != "" {
+		result.Properties["result"] = subject.Result
+	}
+
+	switch subject.State {
+	case StateNotHardened.String(), StatePartiallyHardened.String():
+		result.Kind, result.Level = "fail", "warning"
+	case StateError.String():
+		result.Kind, result.Level = "fail", "error"
+	case StateUnknown.String():
+		result.Kind = "review"
+	case StateNotApplicable.String():
+		result.Kind = "notApplicable"
+	}
+	if subject.Error != "" {
+		result.Kind, result.Level = "fail", "error"
+		result.Message.Text += ": " + subject.Result + ": " + subject.Error
+		result.Properties["error"] = subject.Error
+	}
+
+	for _, setting := range subject.Settings {
+		if setting.State == StateHardened.String() || setting.State == StateNotApplicable.String() {
+			continue
+		}
+		result.Locations = append(result.Locations, sarifLocation{[]sarifLogicalLocation{{
+			FullyQualifiedName: setting.Name,
+			Kind:               "setting",
+		}}})
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+)
+
+// hardenForReport hardens WSH, Show File Ext and UAC (which fails, since the
+// policies key can't be written), skips Office Macros and returns the report
+// of the run.
+func hardenForReport(t *testing.T) *hardenReport {
+	t.Helper()
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	key, _, _ := reg.CreateKey(HKLM, "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion", keyAllAccess)
+	key.SetStringValue("ProductName", "Windows 10 Pro")
+	key.SetStringValue("DisplayVersion", "23H2")
+	key.SetStringValue("CurrentBuild", "22631")
+	key.SetDWordValue("UBR", 4317)
+	key.Close()
+	reg.SetAccessDenied(HKLM, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Policies", true)
+	useSubjects(t, WSH, ShowFileExt, UAC, OfficeMacros)
+	expertConfig[OfficeMacros.Name()] = false
+
+	if err := triggerAll(true); err != nil {
+		t.Fatal(err)
+	}
+	return newHardenReport("harden")
+}
+
+func TestHardenReport(t *testing.T) {
+	report := hardenForReport(t)
+
+	if report.OSName != "Windows 10 Pro" || report.OSVersion != "23H2" || report.OSBuild != "22631.4317" {
+		t.Errorf("Windows version = %s %s %s", report.OSName, report.OSVersion, report.OSBuild)
+	}
+	if report.Version != hardentoolsVersion || report.Elevated {
+		t.Errorf("version %s, elevated %t", report.Version, report.Elevated)
+	}
+
+	expected := []struct {
+		name, category, state, result string
+		settings                      int
+		failed                        bool
+	}{
+		{WSH.Name(), "Windows", "hardened", resultHardened, 0, false},
+		{ShowFileExt.Name(), "Windows", "hardened", resultHardened, 3, false},
+		{UAC.Name(), "Windows", "not hardened", resultFailed, 3, true},
+		{OfficeMacros.Name(), "Office", "not hardened", resultSkipped, 12, false},
+	}
+	if len(report.Subjects) != len(expected) {
+		t.Fatalf("report contains %d subjects", len(report.Subjects))
+	}
+	for i, subject := range report.Subjects {
+		test := expected[i]
+		if subject.Name != test.name || subject.Category != test.category ||
+			subject.State != test.state || subject.Result != test.result ||
+			len(subject.Settings) != test.settings || (subject.Error != "") != test.failed {
+			t.Errorf("unexpected report of %s: %+v", test.name, subject)
+		}
+	}
+}
+
+func TestReportFormats(t *testing.T) {
+	report := hardenForReport(t)
+
+	var buffer bytes.Buffer
+	if err := writeJSONReport(&buffer, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded hardenReport
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Subjects) != 4 || decoded.Subjects[1].Settings[0].Name == "" || decoded.Operation != "harden" {
+		t.Errorf("unexpected JSON report %s", buffer.String())
+	}
+
+	buffer.Reset()
+	if err := writeCSVReport(&buffer, report); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, WSH, 3 settings of Show File Ext, 3 of UAC and 12 of Office.
+	if len(records) != 20 {
+		t.Fatalf("CSV report has %d lines", len(records))
+	}
+	if records[2][1] != ShowFileExt.Name() || records[2][7] == "" || records[1][15] != "22631.4317" {
+		t.Errorf("unexpected CSV lines %q, %q", records[1], records[2])
+	}
+
+	buffer.Reset()
+	if err := writeSARIFReport(&buffer, report); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buffer.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	run := log.Runs[0]
+	if log.Version != sarifVersion || len(run.Tool.Driver.Rules) != 4 || len(run.Results) != 4 {
+		t.Fatalf("unexpected SARIF log %s", buffer.String())
+	}
+	kinds := []string{"pass", "pass", "fail", "fail"}
+	levels := []string{"none", "none", "error", "warning"}
+	for i, result := range run.Results {
+		if result.Kind != kinds[i] || result.Level != levels[i] {
+			t.Errorf("SARIF result of %s is %s/%s", result.RuleID, result.Kind, result.Level)
+		}
+	}
+	if len(run.Results[2].Locations) != 3 {
+		t.Errorf("SARIF result of %s has %d locations", UAC.Name(), len(run.Results[2].Locations))
+	}
+}
@@ -0,0 +1,374 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Saved state of hardentools versions before the backup journal was
+// introduced. Root key, path and value name were encoded in the names of
+// registry values in the hardentools key:
+//  - SavedState_<root>\<path>_<value>               (DWORD, oldest format)
+//  - SavedStateNew_<root>\<path>____<value>         (DWORD)
+//  - SavedStateNewSZ_<root>\<path>____<value>       (SZ)
+//  - SavedStateNotExisting_<root>\<path>____<value> (value did not exist)
+//  - SavedStateNonReg_<feature>                     (non-registry state)
+// The separators may also occur in paths and value names, so these entries
+// are migrated to the backup journal only if they can be decoded without
+// guessing. All other entries are reported and kept.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	legacyStatePrefix            = "SavedState"
+	legacyStateOldPrefix         = "SavedState_"
+	legacyStateDWORDPrefix       = "SavedStateNew_"
+	legacyStateSZPrefix          = "SavedStateNewSZ_"
+	legacyStateNotExistingPrefix = "SavedStateNotExisting_"
+	legacyStateNonRegPrefix      = "SavedStateNonReg_"
+)
+
+// legacyStateProblem describes a legacy saved state entry that could not be
+// migrated.
+type legacyStateProblem struct {
+	ValueName string
+	Reason    string
+}
+
+func (problem legacyStateProblem) String() string {
+	return problem.ValueName + ": " + problem.Reason
+}
+
+// legacyMigrationReport is the result of migrateLegacySavedState.
+type legacyMigrationReport struct {
+	// Migrated contains the names of the migrated (and deleted) legacy
+	// values.
+	Migrated []string
+	// Problems contains all legacy values that have been kept because they
+	// can't be parsed or are ambiguous.
+	Problems []legacyStateProblem
+}
+
+// legacyEntry is a parsed legacy registry value entry.
+type legacyEntry struct {
+	valueName string
+	entry     *journalEntry
+}
+
+// migrateLegacySavedState parses all legacy saved state entries, adds the
+// usable ones to the backup journal and deletes them afterwards. Entries that
+// can't be parsed or are ambiguous are reported and not touched.
+func migrateLegacySavedState() (*legacyMigrationReport, error) {
+	report := &legacyMigrationReport{}
+
+	hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	if err == errRegistryNotExist {
+		return report, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer hardentoolsKey.Close()
+
+	params, err := hardentoolsKey.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(params)
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse all entries and group registry entries by the value they
+	// belong to.
+	var order []string
+	entriesByValue := make(map[string][]legacyEntry)
+	var states []legacyEntry
+	var stateValues []*journalState
+	for _, param := range params {
+		if !strings.HasPrefix(param, legacyStatePrefix) {
+			continue
+		}
+
+		if strings.HasPrefix(param, legacyStateNonRegPrefix) {
+			state, problem := parseLegacyHardenState(hardentoolsKey, param)
+			if problem != "" {
+				report.Problems = append(report.Problems, legacyStateProblem{param, problem})
+				continue
+			}
+			states = append(states, legacyEntry{valueName: param})
+			stateValues = append(stateValues, state)
+			continue
+		}
+
+		entry, problem := parseLegacyRegistryEntry(hardentoolsKey, param)
+		if problem != "" {
+			report.Problems = append(report.Problems, legacyStateProblem{param, problem})
+			continue
+		}
+		id := strings.ToLower(entry.String())
+		if _, ok := entriesByValue[id]; !ok {
+			order = append(order, id)
+		}
+		entriesByValue[id] = append(entriesByValue[id], legacyEntry{param, entry})
+	}
+
+	// Add usable entries to the journal.
+	var migrated []string
+	for _, id := range order {
+		entries := entriesByValue[id]
+		entry := entries[0].entry
+
+		conflict := false
+		for _, other := range entries[1:] {
+			if !other.entry.Original.Equal(entry.Original) {
+				conflict = true
+			}
+		}
+		existing := journal.findEntry(entry.Root, entry.Path, entry.Name)
+		if existing != nil && !existing.Original.Equal(entry.Original) {
+			conflict = true
+		}
+		if conflict {
+			for _, legacy := range entries {
+				report.Problems = append(report.Problems, legacyStateProblem{legacy.valueName,
+					"ambiguous: conflicting saved original values for " + entry.String()})
+			}
+			continue
+		}
+
+		if existing == nil {
+			journal.Records = append(journal.Records, entry)
+		}
+		for _, legacy := range entries {
+			migrated = append(migrated, legacy.valueName)
+		}
+	}
+	for i, state := range stateValues {
+		existing := journal.findState(state.Feature)
+		if existing != nil && existing.State != state.State {
+			report.Problems = append(report.Problems, legacyStateProblem{states[i].valueName,
+				"ambiguous: conflicting saved states for feature " + state.Feature})
+			continue
+		}
+		if existing == nil {
+			journal.States = append(journal.States, state)
+		}
+		migrated = append(migrated, states[i].valueName)
+	}
+
+	for _, problem := range report.Problems {
+		Info.Printf("Legacy saved state not migrated: %s", problem)
+	}
+	if len(migrated) == 0 {
+		return report, nil
+	}
+
+	// Save the journal before deleting anything, so that no saved state is
+	// lost if hardentools is interrupted.
+	if err := journal.save(); err != nil {
+		return report, err
+	}
+	for _, valueName := range migrated {
+		if err := hardentoolsKey.DeleteValue(valueName); err != nil {
+			return report, fmt.Errorf("could not delete migrated legacy saved state %s: %s",
+				valueName, err.Error())
+		}
+		Trace.Printf("Migrated legacy saved state %s", valueName)
+		report.Migrated = append(report.Migrated, valueName)
+	}
+	return report, nil
+}
+
+// parseLegacyRegistryEntry parses a legacy saved state value of a registry
+// value. It returns a reason instead if the entry isn't usable.
+func parseLegacyRegistryEntry(hardentoolsKey RegistryKey, param string) (*journalEntry, string) {
+	var prefix, separator string
+	var expectedType uint32
+	switch {
+	case strings.HasPrefix(param, legacyStateOldPrefix):
+		prefix, separator, expectedType = legacyStateOldPrefix, "_", regDWORD
+	case strings.HasPrefix(param, legacyStateDWORDPrefix):
+		prefix, separator, expectedType = legacyStateDWORDPrefix, "____", regDWORD
+	case strings.HasPrefix(param, legacyStateSZPrefix):
+		prefix, separator, expectedType = legacyStateSZPrefix, "____", regSZ
+	case strings.HasPrefix(param, legacyStateNotExistingPrefix):
+		prefix, separator, expectedType = legacyStateNotExistingPrefix, "____", regNone
+	default:
+		return nil, "unknown saved state encoding"
+	}
+
+	savedValue, err := readRegistryValue(hardentoolsKey, param)
+	if err != nil {
+		return nil, "unreadable: " + err.Error()
+	}
+	if expectedType != regNone && savedValue.Type != expectedType {
+		return nil, fmt.Sprintf("unexpected value type %s (expected %s)",
+			registryValueTypeName(savedValue.Type), registryValueTypeName(expectedType))
+	}
+
+	encoded := strings.TrimPrefix(param, prefix)
+	separatorIndex := strings.Index(encoded, "\\")
+	if separatorIndex < 0 {
+		return nil, "no root key"
+	}
+	rootKeyName := encoded[:separatorIndex]
+	rootKey, err := getRootKeyFromName(rootKeyName)
+	if err != nil {
+		return nil, "unknown root key " + rootKeyName
+	}
+
+	path, valueName, problem := resolveLegacyValuePath(rootKey, encoded[separatorIndex+1:], separator)
+	if problem != "" {
+		return nil, problem
+	}
+
+	entry := &journalEntry{
+		Root:      rootKeyName,
+		Path:      path,
+		Name:      valueName,
+		Timestamp: time.Now().UTC(),
+	}
+	if expectedType != regNone {
+		entry.Original = savedValue
+	}
+	// The hardened value has not been saved by older versions, so the
+	// current value is used.
+	if key, err := registryBackend.OpenKey(rootKey, path, keyRead); err == nil {
+		entry.Hardened, _ = readRegistryValue(key, valueName)
+		key.Close()
+	}
+	return entry, ""
+}
+
+// resolveLegacyValuePath splits "path<separator>valueName". If the separator
+// occurs more than once, the registry is used to find out which split is
+// meant. A reason is returned if that is not possible.
+func resolveLegacyValuePath(rootKey RegistryRootKey, encoded, separator string) (path, valueName, problem string) {
+	type candidate struct{ path, valueName string }
+	var candidates, existingKeys, existingValues []candidate
+
+	for i := 1; i < len(encoded); i++ {
+		if !strings.HasPrefix(encoded[i:], separator) {
+			continue
+		}
+		c := candidate{encoded[:i], encoded[i+len(separator):]}
+		candidates = append(candidates, c)
+
+		key, err := registryBackend.OpenKey(rootKey, c.path, keyRead)
+		if err != nil {
+			continue
+		}
+		existingKeys = append(existingKeys, c)
+		if _, err := readRegistryValue(key, c.valueName); err == nil {
+			existingValues = append(existingValues, c)
+		}
+		key.Close()
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return "", "", fmt.Sprintf("no %q separator between path and value name", separator)
+	case len(candidates) == 1:
+		return candidates[0].path, candidates[0].valueName, ""
+	case len(existingValues) == 1:
+		return existingValues[0].path, existingValues[0].valueName, ""
+	case len(existingValues) == 0 && len(existingKeys) == 1:
+		return existingKeys[0].path, existingKeys[0].valueName, ""
+	}
+
+	var splits []string
+	for _, c := range candidates {
+		splits = append(splits, fmt.Sprintf("%q/%q", c.path, c.valueName))
+	}
+	return "", "", "ambiguous: could be any of the key/value pairs " + strings.Join(splits, ", ")
+}
+
+// parseLegacyHardenState parses a legacy saved state value of a
+// non-registry-based harden subject.
+func parseLegacyHardenState(hardentoolsKey RegistryKey, param string) (*journalState, string) {
+	feature := strings.TrimPrefix(param, legacyStateNonRegPrefix)
+	if feature == "" {
+		return nil, "no feature name"
+	}
+	state, _, err := hardentoolsKey.GetStringValue(param)
+	if err != nil {
+		return nil, "unreadable: " + err.Error()
+	}
+	return &journalState{Feature: feature, State: state, Timestamp: time.Now().UTC()}, ""
+}
+
+// getLegacySavedHardenState returns a non-registry-based harden status saved
+// by an older hardentools version.
+func getLegacySavedHardenState(feature string) (savedState string, err error) {
+	// Open hardentools root key.
+	hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyQueryValue)
+	if err != nil {
+		return "", err
+	}
+	defer hardentoolsKey.Close()
+
+	savedState, _, err = hardentoolsKey.GetStringValue(legacyStateNonRegPrefix + feature)
+	if err != nil {
+		Trace.Println("Could not retrieve saved state for feature " + feature + " due to error: " + err.Error())
+		return "", err
+	}
+	Trace.Println("Retreived legacy saved state for feature " + feature + ":" + savedState)
+	return savedState, nil
+}
+
+// deleteLegacySavedHardenState deletes a non-registry-based harden status saved
+// by an older hardentools version.
+func deleteLegacySavedHardenState(feature string) error {
+	// Open hardentools root key.
+	hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	if err != nil {
+		return err
+	}
+	defer hardentoolsKey.Close()
+
+	err = hardentoolsKey.DeleteValue(legacyStateNonRegPrefix + feature)
+	if err != nil {
+		Info.Printf("Could not delete saved state for feature %s due to error %s",
+			feature, err.Error())
+	}
+	return err
+}
+
+// hasLegacySavedState returns true if the hardentools key contains saved
+// state of an older hardentools version.
+func hasLegacySavedState() bool {
+	hardentoolsKey, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyQueryValue)
+	if err != nil {
+		return false
+	}
+	defer hardentoolsKey.Close()
+
+	params, err := hardentoolsKey.ReadValueNames(0)
+	if err != nil {
+		return false
+	}
+	for _, param := range params {
+		if strings.HasPrefix(param, legacyStatePrefix) {
+			return true
+		}
+	}
+	return false
+}
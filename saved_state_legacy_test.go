@@ -0,0 +1,176 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// seedLegacyState writes values in the format of older hardentools versions.
+func seedLegacyState(t *testing.T, reg *memoryRegistry, dwords map[string]uint32, strs map[string]string) {
+	t.Helper()
+	key, _, err := reg.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	key.SetDWordValue("Harden", 1)
+	for name, value := range dwords {
+		key.SetDWordValue(name, value)
+	}
+	for name, value := range strs {
+		key.SetStringValue(name, value)
+	}
+}
+
+func problemValueNames(report *legacyMigrationReport) []string {
+	var names []string
+	for _, problem := range report.Problems {
+		names = append(names, problem.ValueName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMigrateLegacySavedState(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Test", keyAllAccess)
+	key.SetDWordValue("Old", 1)
+	key.SetDWordValue("DWORD", 1)
+	key.SetStringValue("SZ", "hardened")
+	key.SetDWordValue("New", 1)
+	key.Close()
+	// Only one of the possible splits exists in the registry.
+	key, _, _ = reg.CreateKey(HKCU, "Software\\Test\\Sub____Key", keyAllAccess)
+	key.SetDWordValue("Value", 1)
+	key.Close()
+
+	seedLegacyState(t, reg, map[string]uint32{
+		"SavedState_CURRENT_USER\\Software\\Test_Old":                     0,
+		"SavedStateNew_CURRENT_USER\\Software\\Test____DWORD":             0,
+		"SavedStateNotExisting_CURRENT_USER\\Software\\Test____New":       0,
+		"SavedStateNew_CURRENT_USER\\Software\\Test\\Sub____Key____Value": 2,
+	}, map[string]string{
+		"SavedStateNewSZ_CURRENT_USER\\Software\\Test____SZ": "original",
+		"SavedStateNonReg_recall":                            "enabled",
+	})
+
+	report, err := migrateLegacySavedState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 || len(report.Migrated) != 6 {
+		t.Fatalf("migrated = %v, problems = %v", report.Migrated, report.Problems)
+	}
+
+	journal, _ := loadBackupJournal()
+	expected := map[string]*registryValue{
+		"CURRENT_USER\\Software\\Test\\Old":               dwordValue(0),
+		"CURRENT_USER\\Software\\Test\\DWORD":             dwordValue(0),
+		"CURRENT_USER\\Software\\Test\\New":               nil,
+		"CURRENT_USER\\Software\\Test\\Sub____Key\\Value": dwordValue(2),
+		"CURRENT_USER\\Software\\Test\\SZ":                stringValue("original"),
+	}
+	if len(journal.Records) != len(expected) {
+		t.Errorf("journal contains %d records, expected %d", len(journal.Records), len(expected))
+	}
+	for _, entry := range journal.Records {
+		original, ok := expected[entry.String()]
+		if !ok || !original.Equal(entry.Original) {
+			t.Errorf("unexpected record %s = %s", entry, entry.Original)
+		}
+	}
+	if state, _ := getSavedHardenState("recall"); state != "enabled" {
+		t.Errorf("saved state of recall = %q", state)
+	}
+
+	// All legacy values have been deleted.
+	key, _ = reg.OpenKey(HKCU, hardentoolsKeyPath, keyRead)
+	names, _ := key.ReadValueNames(0)
+	key.Close()
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{backupJournalValueName, "Harden"}) {
+		t.Errorf("values after migration: %v", names)
+	}
+
+	// Migrating again doesn't change anything.
+	if report, err := migrateLegacySavedState(); err != nil || len(report.Migrated) != 0 {
+		t.Errorf("second migration = %v, %v", report, err)
+	}
+}
+
+func TestMigrateLegacySavedStateProblems(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	// Neither or both of the possible splits exist.
+	key, _, _ := reg.CreateKey(HKCU, "Software\\A____B", keyAllAccess)
+	key.SetDWordValue("C", 1)
+	key.Close()
+	key, _, _ = reg.CreateKey(HKCU, "Software\\A", keyAllAccess)
+	key.SetDWordValue("B____C", 1)
+	key.Close()
+
+	seedLegacyState(t, reg, map[string]uint32{
+		"SavedStateNew_CURRENT_USER\\Software\\A____B____C":         0,
+		"SavedStateNew_CURRENT_USER\\Software\\X____Y____Z":         0,
+		"SavedStateNew_SOME_ROOT\\Software\\Test____Value":          0,
+		"SavedStateNew_CURRENT_USER\\Software\\Test":                0,
+		"SavedStateNewSZ_CURRENT_USER\\Software\\Test____WrongType": 0,
+		"SavedStateUnknown_CURRENT_USER\\Software\\Test____Value":   0,
+		// Conflicting saved states for the same value.
+		"SavedStateNew_CURRENT_USER\\Software\\Test____Conflict":         0,
+		"SavedStateNotExisting_CURRENT_USER\\Software\\Test____Conflict": 0,
+	}, map[string]string{
+		"SavedStateNew_CURRENT_USER\\Software\\Test____WrongType2": "0",
+	})
+	before := dumpRegistry(t, reg)
+
+	report, err := migrateLegacySavedState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"SavedStateNewSZ_CURRENT_USER\\Software\\Test____WrongType",
+		"SavedStateNew_CURRENT_USER\\Software\\A____B____C",
+		"SavedStateNew_CURRENT_USER\\Software\\Test",
+		"SavedStateNew_CURRENT_USER\\Software\\Test____Conflict",
+		"SavedStateNew_CURRENT_USER\\Software\\Test____WrongType2",
+		"SavedStateNew_CURRENT_USER\\Software\\X____Y____Z",
+		"SavedStateNew_SOME_ROOT\\Software\\Test____Value",
+		"SavedStateNotExisting_CURRENT_USER\\Software\\Test____Conflict",
+		"SavedStateUnknown_CURRENT_USER\\Software\\Test____Value",
+	}
+	if names := problemValueNames(report); !reflect.DeepEqual(names, expected) {
+		t.Errorf("problems = %v", report.Problems)
+	}
+	if len(report.Migrated) != 0 {
+		t.Errorf("migrated = %v", report.Migrated)
+	}
+
+	// Nothing has been changed or lost.
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry has been changed:\nbefore: %v\nafter:  %v", before, after)
+	}
+
+	// Restore reports the entries that could not be restored.
+	if err := restoreSavedRegistryKeys(); err == nil {
+		t.Error("restoreSavedRegistryKeys did not report legacy problems")
+	}
+}
@@ -0,0 +1,267 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HardenState is the state of a harden subject on the system.
+type HardenState int
+
+// Possible states of a harden subject.
+const (
+	StateNotHardened HardenState = iota
+	StateHardened
+	StatePartiallyHardened
+	StateNotApplicable // e.g. Office is not installed
+	StateUnknown       // e.g. PowerShell failed
+	StateError         // e.g. registry access denied
+)
+
+var hardenStateNames = map[HardenState]string{
+	StateNotHardened:       "not hardened",
+	StateHardened:          "hardened",
+	StatePartiallyHardened: "partially hardened",
+	StateNotApplicable:     "not applicable",
+	StateUnknown:           "unknown",
+	StateError:             "error",
+}
+
+// String returns the name of the state.
+func (state HardenState) String() string {
+	return hardenStateNames[state]
+}
+
+// HardenStatus is the detailed status of a harden subject or of a part of it.
+type HardenStatus struct {
+	Name     string
+	State    HardenState
+	Reason   string         // Why the subject is in this state (optional).
+	Children []HardenStatus // Status of the parts of composite subjects.
+}
+
+// String returns the state together with the reason.
+func (status HardenStatus) String() string {
+	if status.Reason == "" {
+		return status.State.String()
+	}
+	return status.State.String() + " (" + status.Reason + ")"
+}
+
+// HardenStatusReporter is implemented by harden subjects that can tell more
+// than hardened or not hardened, e.g. if they are composed of several
+// settings or are not applicable to the system.
+type HardenStatusReporter interface {
+	Status() HardenStatus
+}
+
+// getHardenStatus returns the status of hardenSubject. Subjects that don't
+// implement HardenStatusReporter are either hardened or not hardened.
+func getHardenStatus(hardenSubject HardenInterface) HardenStatus {
+	var status HardenStatus
+
+	if reporter, ok := hardenSubject.(HardenStatusReporter); ok {
+		status = reporter.Status()
+	} else if hardenSubject.IsHardened() {
+		status.State = StateHardened
+	} else {
+		status.State = StateNotHardened
+	}
+	if name := hardenSubject.Name(); name != "" {
+		status.Name = name
+	}
+	return status
+}
+
+// combineHardenStatus returns the status of a subject composed of children.
+// Children that are not applicable are ignored, unless none is applicable.
+// An error or unknown state of a child makes the whole subject erroneous or
+// unknown.
+func combineHardenStatus(name string, children []HardenStatus) HardenStatus {
+	status := HardenStatus{Name: name, Children: children}
+
+	counts := make(map[HardenState]int)
+	for _, child := range children {
+		counts[child.State]++
+	}
+	applicable := len(children) - counts[StateNotApplicable]
+
+	switch {
+	case applicable == 0:
+		status.State = StateNotApplicable
+		status.Reason = commonReason(children)
+	case counts[StateError] > 0:
+		status.State = StateError
+		status.Reason = firstChildReason(children, StateError)
+	case counts[StateUnknown] > 0:
+		status.State = StateUnknown
+		status.Reason = firstChildReason(children, StateUnknown)
+	case counts[StateHardened] == applicable:
+		status.State = StateHardened
+	case counts[StateNotHardened] == applicable:
+		status.State = StateNotHardened
+	default:
+		status.State = StatePartiallyHardened
+		status.Reason = fmt.Sprintf("%d of %d hardened", counts[StateHardened], applicable)
+	}
+	return status
+}
+
+// commonReason returns the reason of all children if it is the same for all
+// of them.
+func commonReason(children []HardenStatus) string {
+	if len(children) == 0 {
+		return ""
+	}
+	for _, child := range children[1:] {
+		if child.Reason != children[0].Reason {
+			return ""
+		}
+	}
+	return children[0].Reason
+}
+
+// firstChildReason returns name and reason of the first child in state.
+func firstChildReason(children []HardenStatus, state HardenState) string {
+	for _, child := range children {
+		if child.State == state {
+			if child.Reason == "" {
+				return child.Name
+			}
+			return child.Name + ": " + child.Reason
+		}
+	}
+	return ""
+}
+
+// registryValueStatus returns the status of a single registry value that is
+// hardened if it is set to hardenedValue, or if it doesn't exist if
+// hardenedValue is nil.
+func registryValueStatus(rootKey RegistryRootKey, path, valueName string, hardenedValue *registryValue) HardenStatus {
+	rootKeyName, _ := getRootKeyName(rootKey)
+	status := HardenStatus{Name: rootKeyName + "\\" + path + "\\" + valueName}
+
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead)
+	if err != nil {
+		if err == errRegistryNotExist && hardenedValue == nil {
+			status.State = StateHardened
+		} else if err == errRegistryNotExist {
+			status.State = StateNotHardened
+			status.Reason = "not set"
+		} else {
+			status.State = StateError
+			status.Reason = err.Error()
+		}
+		Trace.Printf("IsHardened?: (%s) %s\\%s", status, path, valueName)
+		return status
+	}
+	defer key.Close()
+
+	currentValue, err := readRegistryValue(key, valueName)
+	switch {
+	case err == errRegistryNotExist && hardenedValue == nil:
+		status.State = StateHardened
+	case err == errRegistryNotExist:
+		status.State = StateNotHardened
+		status.Reason = "not set"
+	case err != nil:
+		status.State = StateError
+		status.Reason = err.Error()
+	case hardenedValue == nil:
+		status.State = StateNotHardened
+		status.Reason = fmt.Sprintf("is %s, hardened value is deleted",
+			formatPlannedValue(currentValue))
+	case isHardenedValue(currentValue, hardenedValue):
+		status.State = StateHardened
+	default:
+		status.State = StateNotHardened
+		status.Reason = fmt.Sprintf("is %s, hardened value is %s",
+			formatPlannedValue(currentValue), formatPlannedValue(hardenedValue))
+	}
+	Trace.Printf("IsHardened?: (%s) %s\\%s", status, path, valueName)
+	return status
+}
+
+// registryKeyAbsentStatus returns the status of a registry key that is
+// deleted when hardening.
+func registryKeyAbsentStatus(rootKey RegistryRootKey, path string) HardenStatus {
+	rootKeyName, _ := getRootKeyName(rootKey)
+	status := HardenStatus{Name: rootKeyName + "\\" + path}
+
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead)
+	switch {
+	case err == errRegistryNotExist:
+		status.State = StateHardened
+	case err != nil:
+		status.State = StateError
+		status.Reason = err.Error()
+	default:
+		key.Close()
+		status.State = StateNotHardened
+		status.Reason = "exists"
+	}
+	Trace.Printf("IsHardened?: (%s) %s", status, path)
+	return status
+}
+
+// isHardenedValue returns true if currentValue has the type and data of
+// hardenedValue. A value with the hardened data but another type (e.g. a
+// REG_SZ "0" instead of a REG_DWORD 0) is not hardened, since the
+// application reading it might ignore it.
+func isHardenedValue(currentValue, hardenedValue *registryValue) bool {
+	return currentValue.Equal(hardenedValue)
+}
+
+// regExBaseKey returns the key of pathRegEx up to the last format verb, e.g.
+// the key of the Office version and application. If it does not exist, the
+// product is not installed.
+func regExBaseKey(pathRegEx string, args ...interface{}) string {
+	return fmt.Sprintf(pathRegEx[:strings.LastIndex(pathRegEx, "%s")+2], args...)
+}
+
+// registryKeyExists returns true if path exists below rootKey.
+func registryKeyExists(rootKey RegistryRootKey, path string) bool {
+	return registryKeyExistsInView(rootKey, path, 0)
+}
+
+// registryKeyExistsInView returns true if path exists below rootKey in the
+// registry view (keyWow6464Key, keyWow6432Key or 0 for the view of the
+// process).
+func registryKeyExistsInView(rootKey RegistryRootKey, path string, view uint32) bool {
+	key, err := registryBackend.OpenKey(rootKey, path, keyRead|view)
+	if err != nil {
+		return err != errRegistryNotExist
+	}
+	key.Close()
+	return true
+}
+
+// printHardenStatus writes status and the status of its children, indented
+// by their depth.
+func printHardenStatus(w io.Writer, status HardenStatus, depth int) {
+	fmt.Fprintf(w, "%s%s: %s\n", strings.Repeat("  ", depth), status.Name, status)
+	if status.State == StateHardened || status.State == StateNotApplicable {
+		// Details are only interesting if something is missing.
+		return
+	}
+	for _, child := range status.Children {
+		printHardenStatus(w, child, depth+1)
+	}
+}
@@ -0,0 +1,195 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCombineHardenStatus(t *testing.T) {
+	hardened := HardenStatus{Name: "a", State: StateHardened}
+	notHardened := HardenStatus{Name: "b", State: StateNotHardened}
+	notApplicable := HardenStatus{Name: "c", State: StateNotApplicable, Reason: "not installed"}
+	unknown := HardenStatus{Name: "d", State: StateUnknown, Reason: "PowerShell failed"}
+
+	tests := []struct {
+		children []HardenStatus
+		expected string
+	}{
+		{[]HardenStatus{hardened, notApplicable}, "hardened"},
+		{[]HardenStatus{notHardened, notApplicable}, "not hardened"},
+		{[]HardenStatus{hardened, notHardened, notApplicable}, "partially hardened (1 of 2 hardened)"},
+		{[]HardenStatus{notApplicable, notApplicable}, "not applicable (not installed)"},
+		{[]HardenStatus{hardened, unknown}, "unknown (d: PowerShell failed)"},
+		{nil, "not applicable"},
+	}
+	for _, test := range tests {
+		if status := combineHardenStatus("test", test.children); status.String() != test.expected {
+			t.Errorf("combineHardenStatus(%v) = %q, expected %q", test.children, status, test.expected)
+		}
+	}
+}
+
+func TestRegistryStatus(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+
+	if status := getHardenStatus(WSH); status.State != StateNotHardened ||
+		status.Reason != "is REG_DWORD 1, hardened value is REG_DWORD 0" {
+		t.Errorf("status of %s = %s", WSH.Name(), status)
+	}
+
+	key, _, _ := reg.CreateKey(HKCU, "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced", keyAllAccess)
+	key.SetDWordValue("HideFileExt", 0)
+	key.Close()
+	status := getHardenStatus(ShowFileExt)
+	if status.State != StatePartiallyHardened || status.Reason != "1 of 3 hardened" || len(status.Children) != 3 {
+		t.Errorf("status of %s = %s", ShowFileExt.Name(), status)
+	}
+	if ShowFileExt.IsHardened() {
+		t.Errorf("partially hardened %s is hardened", ShowFileExt.Name())
+	}
+}
+
+func TestOfficeStatus(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	// All versions are hardened if no install is detected.
+	if status := getHardenStatus(OfficeMacros); status.State != StateNotHardened ||
+		len(status.Children) != len(standardOfficeVersions)*len(standardOfficeApps) {
+		t.Errorf("status without detected Office = %s", status)
+	}
+
+	// Only Word 2016 is installed.
+	seedRegistry(t, reg)
+	status := getHardenStatus(OfficeMacros)
+	if status.State != StateNotHardened {
+		t.Errorf("status with Word 2016 = %s", status)
+	}
+	applicable := 0
+	for _, child := range status.Children {
+		if child.State != StateNotApplicable {
+			applicable++
+		}
+	}
+	if applicable != 1 {
+		t.Errorf("%d applicable Office versions, expected 1: %v", applicable, status.Children)
+	}
+
+	if err := hardenOrRestoreSubject(OfficeMacros, true); err != nil {
+		t.Fatal(err)
+	}
+	if status := getHardenStatus(OfficeMacros); status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+}
+
+func TestAdobeStatus(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	if status := getHardenStatus(AdobePDFJS); status.State != StateNotApplicable {
+		t.Errorf("status without Adobe = %s", status)
+	}
+
+	// Acrobat Reader DC and a new Acrobat version (32 bit).
+	for _, path := range []string{
+		"SOFTWARE\\Adobe\\Acrobat Reader\\DC\\InstallPath",
+		"SOFTWARE\\WOW6432Node\\Adobe\\Adobe Acrobat\\2024\\InstallPath",
+	} {
+		key, _, _ := reg.CreateKey(HKLM, path, keyAllAccess)
+		key.Close()
+	}
+	if err := hardenOrRestoreSubject(AdobePDFJS, true); err != nil {
+		t.Fatal(err)
+	}
+
+	status := getHardenStatus(AdobePDFJS)
+	if status.State != StateHardened || len(status.Children) != 2 ||
+		status.Children[0].Name != "Acrobat Reader DC" ||
+		status.Children[1].Name != "Adobe Acrobat 2024 (unknown version)" {
+		t.Errorf("status after hardening = %s %v", status, status.Children)
+	}
+	values := dumpRegistry(t, reg)
+	for _, name := range []string{
+		"CURRENT_USER\\SOFTWARE\\Adobe\\Acrobat Reader\\DC\\JSPrefs\\bEnableJS",
+		"CURRENT_USER\\SOFTWARE\\Adobe\\Adobe Acrobat\\2024\\JSPrefs\\bEnableJS",
+	} {
+		if values[name] != "4:0" {
+			t.Errorf("%s = %q", name, values[name])
+		}
+	}
+	if _, ok := values["CURRENT_USER\\SOFTWARE\\Adobe\\Acrobat Reader\\XI\\JSPrefs\\bEnableJS"]; ok {
+		t.Error("Acrobat Reader XI has been hardened, but is not installed")
+	}
+}
+
+func TestAdobeStatus64Bit(t *testing.T) {
+	// 64 bit Acrobat DC only, detected by a 32 bit process.
+	reg := useWow64Registry(t)
+	key, _, _ := reg.CreateKey(HKLM, "SOFTWARE\\Adobe\\Adobe Acrobat\\DC\\InstallPath", keyAllAccess)
+	key.Close()
+
+	if installs := detectAdobeInstalls(); len(installs) != 1 || installs[0].String() != "Adobe Acrobat DC" {
+		t.Fatalf("detected %v", installs)
+	}
+	if err := hardenOrRestoreSubject(AdobePDFJS, true); err != nil {
+		t.Fatal(err)
+	}
+	if status := getHardenStatus(AdobePDFJS); status.State != StateHardened {
+		t.Errorf("status after hardening = %s", status)
+	}
+	name := "CURRENT_USER\\SOFTWARE\\Adobe\\Adobe Acrobat\\DC\\JSPrefs\\bEnableJS"
+	if value := dumpRegistry(t, reg)[name]; value != "4:0" {
+		t.Errorf("%s = %q", name, value)
+	}
+}
+
+func TestCommandStatus(t *testing.T) {
+	useMemoryRegistry(t)
+
+	useCommandTranscript(t, "assoc_partially_hardened.json")
+	status := getHardenStatus(FileAssociations)
+	if status.State != StatePartiallyHardened || status.Reason != "2 of 11 hardened" {
+		t.Errorf("status of %s = %s", FileAssociations.Name(), status)
+	}
+	if status.Children[2].Reason != "associated: .JSE=JSEFile" {
+		t.Errorf("status of %s = %s", status.Children[2].Name, status.Children[2])
+	}
+
+	useCommandTranscript(t, "recall_not_available.json")
+	if status := getHardenStatus(Recall); status.State != StateNotApplicable {
+		t.Errorf("status of unavailable Recall = %s", status)
+	}
+}
+
+func TestPrintHardenStatus(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	setWindowsVersion(t, reg, "19045")
+	useCommandTranscript(t, "asr_audit_mode.json")
+
+	var out bytes.Buffer
+	printHardenStatus(&out, getHardenStatus(WindowsASR), 0)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(ruleIDArray)+1 ||
+		lines[0] != fmt.Sprintf("%s: partially hardened (%d of %d hardened)", WindowsASR.Name(), len(ruleIDArray)-1, len(ruleIDArray)) ||
+		lines[5] != "  "+ruleIDArray[4]+": not hardened (Audit)" {
+		t.Errorf("printHardenStatus = %s", out.String())
+	}
+}
@@ -0,0 +1,641 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Registry based harden subjects are defined in TOML or JSON files. The
+// default set is embedded into hardentools, additional subjects can be put
+// into subjectsDir. A definition file looks like this:
+//
+//	name = "WSH"
+//	long_name = "Windows Script Host"
+//	description = "Windows Script Host will be deactivated."
+//	harden_by_default = true
+//	requires_privileges = false
+//
+//	[[values]]
+//	root = "CURRENT_USER"
+//	path = 'SOFTWARE\Microsoft\Windows Script Host\Settings'
+//	name = "Enabled"
+//	type = "REG_DWORD"
+//	data = 0
+//
+// Keys listed as [[absent_keys]] (with label, description, root and path)
+// are deleted including all subkeys. Executables listed in disallow_run
+// (e.g. disallow_run = ["cmd.exe"]) are blocked with the Explorer
+// DisallowRun policy. Executables listed in ifeo_block are blocked for all
+// users by setting ifeoBlockDebugger as their Image File Execution Options
+// Debugger (below HKEY_LOCAL_MACHINE, so requires_privileges must be set).
+//
+// type can be REG_DWORD, REG_QWORD (integer data), REG_SZ, REG_EXPAND_SZ
+// (string data), REG_MULTI_SZ (list of strings) or REG_BINARY (hex string).
+// Paths of DWORD values may contain the placeholders {office_version} and
+// {office_app} or {adobe_version} (and {adobe_product}). Such a value is
+// hardened for every installed version (and application or product) in
+// office_versions and office_apps or adobe_versions and adobe_products, or
+// for all (standard) ones if the lists are omitted. Adobe paths without
+// {adobe_product} are Acrobat Reader paths.
+
+//go:embed subjects/*.toml
+var embeddedSubjectFiles embed.FS
+
+// Placeholders for templated registry paths.
+const (
+	placeholderOfficeVersion = "{office_version}"
+	placeholderOfficeApp     = "{office_app}"
+	placeholderAdobeVersion  = "{adobe_version}"
+	placeholderAdobeProduct  = "{adobe_product}"
+)
+
+// subjectsDir is the directory with additional subject definitions given
+// with -subjects-dir. If it is empty, the definitions in defaultSubjectsDir
+// are loaded, but only if the directory can only be changed by
+// administrators, since the definitions are applied with elevated rights.
+var subjectsDir string
+
+// subjectDefinition is the content of a subject definition file.
+type subjectDefinition struct {
+	Name               string            `toml:"name" json:"name"`
+	LongName           string            `toml:"long_name" json:"long_name"`
+	Description        string            `toml:"description" json:"description"`
+	HardenByDefault    bool              `toml:"harden_by_default" json:"harden_by_default"`
+	RequiresPrivileges bool              `toml:"requires_privileges" json:"requires_privileges"`
+	Values             []valueDefinition `toml:"values" json:"values"`
+	AbsentKeys         []keyDefinition   `toml:"absent_keys" json:"absent_keys"`
+	DisallowRun        []string          `toml:"disallow_run" json:"disallow_run"`
+	IFEOBlock          []string          `toml:"ifeo_block" json:"ifeo_block"`
+
+	file          string          // File the definition has been loaded from.
+	hardenSubject HardenInterface // Harden subject built from the definition.
+}
+
+// valueDefinition is a registry value of a subject definition.
+type valueDefinition struct {
+	Label          string      `toml:"label" json:"label"`
+	Description    string      `toml:"description" json:"description"`
+	Root           string      `toml:"root" json:"root"`
+	Path           string      `toml:"path" json:"path"`
+	Name           string      `toml:"name" json:"name"`
+	Type           string      `toml:"type" json:"type"`
+	Data           interface{} `toml:"data" json:"data"`
+	OfficeVersions []string    `toml:"office_versions" json:"office_versions"`
+	OfficeApps     []string    `toml:"office_apps" json:"office_apps"`
+	AdobeVersions  []string    `toml:"adobe_versions" json:"adobe_versions"`
+	AdobeProducts  []string    `toml:"adobe_products" json:"adobe_products"`
+}
+
+// keyDefinition is a registry key of a subject definition that is deleted
+// (with all subkeys) when hardening.
+type keyDefinition struct {
+	Label       string `toml:"label" json:"label"`
+	Description string `toml:"description" json:"description"`
+	Root        string `toml:"root" json:"root"`
+	Path        string `toml:"path" json:"path"`
+}
+
+// embeddedSubjectDefinitions contains the embedded subject definitions by
+// subject name.
+var embeddedSubjectDefinitions = loadEmbeddedSubjectDefinitions()
+
+// loadEmbeddedSubjectDefinitions loads the definitions embedded into
+// hardentools. They are part of the program, so errors are fatal.
+func loadEmbeddedSubjectDefinitions() map[string]*subjectDefinition {
+	subjectsFS, err := fs.Sub(embeddedSubjectFiles, "subjects")
+	if err != nil {
+		panic(err)
+	}
+	definitions, errs := loadSubjectDefinitions(subjectsFS)
+	if len(errs) > 0 {
+		panic(errors.Join(errs...))
+	}
+
+	byName := make(map[string]*subjectDefinition, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+	return byName
+}
+
+// embeddedSubject returns the embedded harden subject with name.
+func embeddedSubject(name string) HardenInterface {
+	definition, ok := embeddedSubjectDefinitions[name]
+	if !ok {
+		panic("no embedded definition of harden subject " + name)
+	}
+	return definition.hardenSubject
+}
+
+// defaultSubjectsDir returns the default directory for additional subject
+// definitions. Any user can create it, so its permissions are verified
+// before loading definitions from it (see checkAdminOnlyDir).
+func defaultSubjectsDir() string {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		return ""
+	}
+	return filepath.Join(programData, "Hardentools", "subjects")
+}
+
+// loadSubjectDefinitions loads all .toml and .json files in the root of
+// fsys in alphabetical order. Definitions that can't be loaded are skipped
+// and returned as errors. Names must be unique.
+func loadSubjectDefinitions(fsys fs.FS) (definitions []*subjectDefinition, errs []error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, []error{err}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	names := make(map[string]string)
+	for _, entry := range entries {
+		ext := strings.ToLower(path.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".toml" && ext != ".json") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		definition, err := parseSubjectDefinition(entry.Name(), data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if file, ok := names[definition.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: harden subject %q is already defined in %s",
+				entry.Name(), definition.Name, file))
+			continue
+		}
+		names[definition.Name] = entry.Name()
+		definitions = append(definitions, definition)
+	}
+	return definitions, errs
+}
+
+// parseSubjectDefinition parses the subject definition in data and builds
+// the harden subject. The format is chosen by the extension of file.
+func parseSubjectDefinition(file string, data []byte) (*subjectDefinition, error) {
+	definition := &subjectDefinition{file: file}
+
+	switch strings.ToLower(path.Ext(file)) {
+	case ".toml":
+		meta, err := toml.Decode(string(data), definition)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown key %s", file, undecoded[0])
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		decoder.UseNumber()
+		if err := decoder.Decode(definition); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type", file)
+	}
+
+	hardenSubject, err := definition.build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	definition.hardenSubject = hardenSubject
+	return definition, nil
+}
+
+// build returns the harden subject described by definition. A subject with
+// a single value (absent key or DisallowRun list) is of the type of that
+// value, a subject with several values is a RegistryMultiValue or, if it
+// contains templated values or a DisallowRun list, a MultiHardenInterfaces.
+func (definition *subjectDefinition) build() (HardenInterface, error) {
+	if definition.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	if len(definition.Values) == 0 && len(definition.AbsentKeys) == 0 &&
+		len(definition.DisallowRun) == 0 && len(definition.IFEOBlock) == 0 {
+		return nil, fmt.Errorf("harden subject %q has no values", definition.Name)
+	}
+	longName := definition.LongName
+	if longName == "" {
+		longName = definition.Name
+	}
+
+	var children []HardenInterface
+	for i := range definition.AbsentKeys {
+		child, err := definition.AbsentKeys[i].build()
+		if err != nil {
+			return nil, fmt.Errorf("absent key %d of %q: %w", i+1, definition.Name, err)
+		}
+		children = append(children, child)
+	}
+	for i := range definition.Values {
+		child, err := definition.Values[i].build()
+		if err != nil {
+			return nil, fmt.Errorf("value %d of %q: %w", i+1, definition.Name, err)
+		}
+		children = append(children, child)
+	}
+	if len(definition.DisallowRun) > 0 {
+		for _, executable := range definition.DisallowRun {
+			if executable == "" || strings.ContainsAny(executable, "\\/") {
+				return nil, fmt.Errorf("invalid disallow_run executable %q of %q", executable, definition.Name)
+			}
+		}
+		children = append(children, &DisallowRunList{
+			Executables: definition.DisallowRun,
+			shortName:   "DisallowRun",
+		})
+	}
+	for _, executable := range definition.IFEOBlock {
+		if executable == "" || strings.ContainsAny(executable, "\\/") {
+			return nil, fmt.Errorf("invalid ifeo_block executable %q of %q", executable, definition.Name)
+		}
+		children = append(children, &RegistrySingleValueSZ{
+			RootKey:       HKLM,
+			Path:          ifeoKey + "\\" + executable,
+			ValueName:     "Debugger",
+			HardenedValue: ifeoBlockDebugger,
+			shortName:     "IFEO " + executable,
+		})
+	}
+
+	if len(children) == 1 {
+		switch child := children[0].(type) {
+		case *RegistrySingleValueDWORD:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *RegistrySingleValueSZ:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *RegistrySingleValue:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *RegistryKeyAbsent:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *OfficeRegistryRegExSingleDWORD:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *AdobeRegistryRegExSingleDWORD:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		case *DisallowRunList:
+			child.shortName, child.longName = definition.Name, longName
+			child.description, child.hardenByDefault = definition.Description, definition.HardenByDefault
+		}
+		return children[0], nil
+	}
+
+	multiValue := &RegistryMultiValue{
+		shortName:       definition.Name,
+		longName:        longName,
+		description:     definition.Description,
+		hardenByDefault: definition.HardenByDefault,
+	}
+	for _, child := range children {
+		switch child := child.(type) {
+		case *RegistrySingleValueDWORD:
+			multiValue.ArraySingleDWORD = append(multiValue.ArraySingleDWORD, child)
+		case *RegistrySingleValueSZ:
+			multiValue.ArraySingleSZ = append(multiValue.ArraySingleSZ, child)
+		case *RegistrySingleValue:
+			multiValue.ArraySingleValue = append(multiValue.ArraySingleValue, child)
+		case *RegistryKeyAbsent:
+			multiValue.ArrayKeyAbsent = append(multiValue.ArrayKeyAbsent, child)
+		default:
+			return &MultiHardenInterfaces{
+				hardenInterfaces: children,
+				shortName:        definition.Name,
+				longName:         longName,
+				description:      definition.Description,
+				hardenByDefault:  definition.HardenByDefault,
+			}, nil
+		}
+	}
+	return multiValue, nil
+}
+
+// build returns the harden subject for a single value definition.
+func (value *valueDefinition) build() (HardenInterface, error) {
+	rootKey, err := rootKeyFromDefinition(value.Root)
+	if err != nil {
+		return nil, err
+	}
+	if value.Path == "" || strings.Contains(value.Path, "%") {
+		return nil, fmt.Errorf("invalid path %q", value.Path)
+	}
+
+	isOffice := strings.Contains(value.Path, placeholderOfficeVersion) ||
+		strings.Contains(value.Path, placeholderOfficeApp)
+	isAdobe := strings.Contains(value.Path, placeholderAdobeVersion) ||
+		strings.Contains(value.Path, placeholderAdobeProduct)
+	if !isOffice && (len(value.OfficeVersions) > 0 || len(value.OfficeApps) > 0) {
+		return nil, errors.New("office_versions and office_apps need a path with " +
+			placeholderOfficeVersion + " and " + placeholderOfficeApp)
+	}
+	if !isAdobe && len(value.AdobeVersions) > 0 {
+		return nil, errors.New("adobe_versions needs a path with " + placeholderAdobeVersion)
+	}
+	if !strings.Contains(value.Path, placeholderAdobeProduct) && len(value.AdobeProducts) > 0 {
+		return nil, errors.New("adobe_products needs a path with " + placeholderAdobeProduct)
+	}
+	if (isOffice || isAdobe) && value.Type != "REG_DWORD" {
+		return nil, errors.New("templated paths are only supported for REG_DWORD values")
+	}
+
+	switch {
+	case isOffice:
+		versionIndex := strings.Index(value.Path, placeholderOfficeVersion)
+		appIndex := strings.Index(value.Path, placeholderOfficeApp)
+		if isAdobe || versionIndex < 0 || appIndex < versionIndex ||
+			strings.Count(value.Path, placeholderOfficeVersion) != 1 ||
+			strings.Count(value.Path, placeholderOfficeApp) != 1 {
+			return nil, fmt.Errorf("path %q needs %s followed by %s", value.Path,
+				placeholderOfficeVersion, placeholderOfficeApp)
+		}
+		data, err := value.dwordData()
+		if err != nil {
+			return nil, err
+		}
+		return &OfficeRegistryRegExSingleDWORD{
+			RootKey: rootKey,
+			PathRegEx: strings.NewReplacer(placeholderOfficeVersion, "%s",
+				placeholderOfficeApp, "%s").Replace(value.Path),
+			ValueName:      value.Name,
+			HardenedValue:  data,
+			OfficeApps:     stringsOrDefault(value.OfficeApps, standardOfficeApps),
+			OfficeVersions: stringsOrDefault(value.OfficeVersions, standardOfficeVersions),
+			shortName:      value.labelOr(value.Path),
+			description:    value.Description,
+		}, nil
+	case isAdobe:
+		if strings.Count(value.Path, placeholderAdobeVersion) != 1 ||
+			strings.Count(value.Path, placeholderAdobeProduct) > 1 {
+			return nil, fmt.Errorf("path %q needs %s once and %s at most once", value.Path,
+				placeholderAdobeVersion, placeholderAdobeProduct)
+		}
+		for _, product := range value.AdobeProducts {
+			if !containsFold(standardAdobeProducts, product) {
+				return nil, fmt.Errorf("unknown Adobe product %q", product)
+			}
+		}
+		data, err := value.dwordData()
+		if err != nil {
+			return nil, err
+		}
+		return &AdobeRegistryRegExSingleDWORD{
+			RootKey:       rootKey,
+			PathTemplate:  value.Path,
+			ValueName:     value.Name,
+			HardenedValue: data,
+			AdobeProducts: value.AdobeProducts,
+			AdobeVersions: value.AdobeVersions,
+			shortName:     value.labelOr(value.Path),
+			description:   value.Description,
+		}, nil
+	}
+
+	switch value.Type {
+	case "REG_DWORD":
+		data, err := value.dwordData()
+		if err != nil {
+			return nil, err
+		}
+		return &RegistrySingleValueDWORD{
+			RootKey:       rootKey,
+			Path:          value.Path,
+			ValueName:     value.Name,
+			HardenedValue: data,
+			shortName:     value.Label,
+			description:   value.Description,
+		}, nil
+	case "REG_SZ":
+		data, ok := value.Data.(string)
+		if !ok {
+			return nil, fmt.Errorf("data of REG_SZ value %s must be a string", value.Name)
+		}
+		return &RegistrySingleValueSZ{
+			RootKey:       rootKey,
+			Path:          value.Path,
+			ValueName:     value.Name,
+			HardenedValue: data,
+			shortName:     value.Label,
+			description:   value.Description,
+		}, nil
+	case "REG_EXPAND_SZ", "REG_MULTI_SZ", "REG_QWORD", "REG_BINARY":
+		data, err := value.typedData()
+		if err != nil {
+			return nil, err
+		}
+		return &RegistrySingleValue{
+			RootKey:       rootKey,
+			Path:          value.Path,
+			ValueName:     value.Name,
+			HardenedValue: data,
+			shortName:     value.Label,
+			description:   value.Description,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %q", value.Type)
+}
+
+// typedData returns the data of a REG_EXPAND_SZ, REG_MULTI_SZ, REG_QWORD or
+// REG_BINARY value. REG_MULTI_SZ data is a list of strings, REG_BINARY data
+// a hex string (e.g. "de,ad,be,ef" like in .reg files).
+func (value *valueDefinition) typedData() (*registryValue, error) {
+	switch value.Type {
+	case "REG_EXPAND_SZ":
+		if data, ok := value.Data.(string); ok {
+			return expandStringValue(data), nil
+		}
+		return nil, fmt.Errorf("data of REG_EXPAND_SZ value %s must be a string", value.Name)
+	case "REG_MULTI_SZ":
+		list, ok := value.Data.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("data of REG_MULTI_SZ value %s must be a list of strings", value.Name)
+		}
+		data := make([]string, len(list))
+		for i, element := range list {
+			if data[i], ok = element.(string); !ok || data[i] == "" {
+				return nil, fmt.Errorf("data of REG_MULTI_SZ value %s must be a list of non-empty strings", value.Name)
+			}
+		}
+		return multiStringValue(data...), nil
+	case "REG_QWORD":
+		switch number := value.Data.(type) {
+		case int64: // TOML
+			if number >= 0 {
+				return qwordValue(uint64(number)), nil
+			}
+		case json.Number:
+			if data, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+				return qwordValue(data), nil
+			}
+		default:
+			return nil, fmt.Errorf("data of REG_QWORD value %s must be an integer", value.Name)
+		}
+		return nil, fmt.Errorf("data of REG_QWORD value %s is out of range", value.Name)
+	default:
+		hexData, ok := value.Data.(string)
+		if !ok {
+			return nil, fmt.Errorf("data of REG_BINARY value %s must be a hex string", value.Name)
+		}
+		data, err := hex.DecodeString(strings.NewReplacer(",", "", " ", "").Replace(hexData))
+		if err != nil {
+			return nil, fmt.Errorf("data of REG_BINARY value %s is not a hex string", value.Name)
+		}
+		return binaryValue(data), nil
+	}
+}
+
+// build returns the harden subject for a key definition.
+func (key *keyDefinition) build() (HardenInterface, error) {
+	rootKey, err := rootKeyFromDefinition(key.Root)
+	if err != nil {
+		return nil, err
+	}
+	if key.Path == "" || strings.ContainsAny(key.Path, "%{}") {
+		return nil, fmt.Errorf("invalid path %q", key.Path)
+	}
+	return &RegistryKeyAbsent{
+		RootKey:     rootKey,
+		Path:        key.Path,
+		shortName:   key.Label,
+		description: key.Description,
+	}, nil
+}
+
+// dwordData returns the data of a REG_DWORD value.
+func (value *valueDefinition) dwordData() (uint32, error) {
+	var data int64
+	switch number := value.Data.(type) {
+	case int64: // TOML
+		data = number
+	case json.Number:
+		var err error
+		if data, err = number.Int64(); err != nil {
+			return 0, fmt.Errorf("data of REG_DWORD value %s is not an integer", value.Name)
+		}
+	default:
+		return 0, fmt.Errorf("data of REG_DWORD value %s must be an integer", value.Name)
+	}
+	if data < 0 || data > math.MaxUint32 {
+		return 0, fmt.Errorf("data of REG_DWORD value %s is out of range", value.Name)
+	}
+	return uint32(data), nil
+}
+
+// labelOr returns the label of the value or fallback, if it has none.
+func (value *valueDefinition) labelOr(fallback string) string {
+	if value.Label != "" {
+		return value.Label
+	}
+	return fallback
+}
+
+// rootKeyFromDefinition returns the root key with the name used in saved
+// state, e.g. CURRENT_USER.
+func rootKeyFromDefinition(rootKeyName string) (RegistryRootKey, error) {
+	for _, rootKey := range []RegistryRootKey{HKCR, HKCU, HKLM, HKU, HKCC, HKPD} {
+		if name, _ := getRootKeyName(rootKey); name == rootKeyName {
+			return rootKey, nil
+		}
+	}
+	return HKCU, fmt.Errorf("invalid root key %q", rootKeyName)
+}
+
+// stringsOrDefault returns values, or defaultValues if values is empty.
+func stringsOrDefault(values, defaultValues []string) []string {
+	if len(values) == 0 {
+		return defaultValues
+	}
+	return values
+}
+
+// hardenSubjectsFor returns the built-in harden subjects available with or
+// without elevated rights plus the additional subjects defined in
+// subjectsDir (or the default subjects directory).
+func hardenSubjectsFor(elevated bool) []HardenInterface {
+	var hardenSubjects []HardenInterface
+	if elevated {
+		hardenSubjects = append(hardenSubjects, hardenSubjectsForPrivilegedUsers...)
+	} else {
+		hardenSubjects = append(hardenSubjects, hardenSubjectsForUnprivilegedUsers...)
+	}
+	dir := subjectsDir
+	if dir == "" {
+		dir = defaultSubjectsDir()
+	}
+	if dir == "" {
+		return hardenSubjects
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return hardenSubjects
+	}
+	if subjectsDir == "" {
+		if err := checkAdminOnlyDir(dir); err != nil {
+			Info.Printf("Not loading subject definitions from %s: %s (use -subjects-dir to load them anyway)",
+				dir, err)
+			return hardenSubjects
+		}
+	}
+
+	definitions, errs := loadSubjectDefinitions(os.DirFS(dir))
+	for _, err := range errs {
+		Info.Printf("Skipping subject definition in %s: %s", dir, err)
+	}
+
+	names := make(map[string]bool)
+	for _, hardenSubject := range hardenSubjectsForPrivilegedUsers {
+		names[hardenSubject.Name()] = true
+	}
+	for _, definition := range definitions {
+		switch {
+		case names[definition.Name]:
+			Info.Printf("Skipping subject definition %s: harden subject %q already exists",
+				definition.file, definition.Name)
+		case definition.RequiresPrivileges && !elevated:
+			Trace.Printf("Skipping subject definition %s: needs elevated rights", definition.file)
+		default:
+			Info.Printf("Loaded harden subject %q from %s", definition.Name, definition.file)
+			hardenSubjects = append(hardenSubjects, definition.hardenSubject)
+		}
+	}
+	return hardenSubjects
+}
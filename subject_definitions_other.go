@@ -1,5 +1,5 @@
 // Hardentools
-// Copyright (C) 2017-2022  Security Without Borders
+// Copyright (C) 2017-2025 Security Without Borders
 //
 // This program is free software: you can redistribute it and/or modify
 // it under the terms of the GNU General Public License as published by
@@ -14,20 +14,14 @@
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
+//go:build !windows
+
 package main
 
-import (
-	"golang.org/x/sys/windows/registry"
-)
+import "errors"
 
-// WSH contains registry keys for Windows Script Host Settings.
-var WSH = &RegistrySingleValueDWORD{
-	RootKey:         registry.CURRENT_USER,
-	Path:            "SOFTWARE\\Microsoft\\Windows Script Host\\Settings",
-	ValueName:       "Enabled",
-	HardenedValue:   0,
-	shortName:       "WSH",
-	longName:        "Windows Script Host",
-	description:     "Windows Script Host will be deactivated.\nYou can't e.g. execute VBS scripts anymore.",
-	hardenByDefault: true,
+// checkAdminOnlyDir can't verify the permissions of dir on other operating
+// systems, so the default subjects directory is never trusted there.
+func checkAdminOnlyDir(dir string) error {
+	return errors.New("permissions can only be verified on Windows")
 }
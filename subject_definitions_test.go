@@ -0,0 +1,353 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedSubjectDefinitions(t *testing.T) {
+	unprivileged := make(map[string]bool)
+	for _, hardenSubject := range hardenSubjectsForUnprivilegedUsers {
+		unprivileged[hardenSubject.Name()] = true
+	}
+	used := make(map[string]bool)
+	for _, hardenSubject := range hardenSubjectsForPrivilegedUsers {
+		used[hardenSubject.Name()] = true
+	}
+
+	for name, definition := range embeddedSubjectDefinitions {
+		if !used[name] {
+			t.Errorf("embedded harden subject %q (%s) is not used", name, definition.file)
+		}
+		if definition.RequiresPrivileges == unprivileged[name] {
+			t.Errorf("%s: requires_privileges = %v, but subject is available for unprivileged users: %v",
+				definition.file, definition.RequiresPrivileges, unprivileged[name])
+		}
+	}
+}
+
+func TestParseSubjectDefinition(t *testing.T) {
+	tomlDefinition := `
+name = "Test"
+description = "Test subject"
+harden_by_default = true
+
+[[values]]
+root = "CURRENT_USER"
+path = 'Software\Test'
+name = "Enabled"
+type = "REG_DWORD"
+data = 0
+
+[[values]]
+label = "Test Office"
+root = "CURRENT_USER"
+path = 'Software\Microsoft\Office\{office_version}\{office_app}\Security'
+name = "Test"
+type = "REG_DWORD"
+data = 0xb5
+office_apps = ["Word"]
+`
+	definition, err := parseSubjectDefinition("test.toml", []byte(tomlDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &MultiHardenInterfaces{
+		hardenInterfaces: []HardenInterface{
+			&RegistrySingleValueDWORD{
+				RootKey:   HKCU,
+				Path:      "Software\\Test",
+				ValueName: "Enabled",
+			},
+			&OfficeRegistryRegExSingleDWORD{
+				RootKey:        HKCU,
+				PathRegEx:      "Software\\Microsoft\\Office\\%s\\%s\\Security",
+				ValueName:      "Test",
+				HardenedValue:  0xb5,
+				OfficeApps:     []string{"Word"},
+				OfficeVersions: standardOfficeVersions,
+				shortName:      "Test Office",
+			},
+		},
+		shortName:       "Test",
+		longName:        "Test",
+		description:     "Test subject",
+		hardenByDefault: true,
+	}
+	if !reflect.DeepEqual(definition.hardenSubject, expected) {
+		t.Errorf("parsed %#v, expected %#v", definition.hardenSubject, expected)
+	}
+
+	jsonDefinition := `{
+		"name": "Test",
+		"long_name": "Test JSON",
+		"requires_privileges": true,
+		"values": [
+			{"root": "LOCAL_MACHINE", "path": "Software\\Test", "name": "A", "type": "REG_SZ", "data": "x"},
+			{"root": "LOCAL_MACHINE", "path": "Software\\Test", "name": "B", "type": "REG_DWORD", "data": 4294967295}
+		]
+	}`
+	definition, err = parseSubjectDefinition("test.json", []byte(jsonDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiValue, ok := definition.hardenSubject.(*RegistryMultiValue)
+	if !ok || !definition.RequiresPrivileges || multiValue.LongName() != "Test JSON" ||
+		len(multiValue.ArraySingleSZ) != 1 || multiValue.ArraySingleSZ[0].HardenedValue != "x" ||
+		len(multiValue.ArraySingleDWORD) != 1 || multiValue.ArraySingleDWORD[0].HardenedValue != 0xffffffff {
+		t.Errorf("parsed %#v", definition.hardenSubject)
+	}
+
+	typedDefinition := `
+name = "Typed"
+
+[[values]]
+root = "LOCAL_MACHINE"
+path = 'SOFTWARE\Policies\Microsoft\Windows Defender\Exclusions'
+name = "Extensions"
+type = "REG_MULTI_SZ"
+data = [".exe", ".js"]
+
+[[values]]
+root = "LOCAL_MACHINE"
+path = 'SOFTWARE\Test'
+name = "Q"
+type = "REG_QWORD"
+data = 0x100000000
+
+[[values]]
+root = "LOCAL_MACHINE"
+path = 'SOFTWARE\Test'
+name = "B"
+type = "REG_BINARY"
+data = "de,ad be ef"
+
+[[values]]
+root = "LOCAL_MACHINE"
+path = 'SOFTWARE\Test'
+name = "E"
+type = "REG_EXPAND_SZ"
+data = "%SystemRoot%"
+`
+	definition, err = parseSubjectDefinition("typed.toml", []byte(typedDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, _ := getRegistrySettings(definition.hardenSubject)
+	expectedValues := []*registryValue{multiStringValue(".exe", ".js"), qwordValue(1 << 32),
+		binaryValue([]byte{0xde, 0xad, 0xbe, 0xef}), expandStringValue("%SystemRoot%")}
+	if len(settings) != len(expectedValues) {
+		t.Fatalf("parsed %v", settings)
+	}
+	for i, setting := range settings {
+		if !setting.Value.Equal(expectedValues[i]) {
+			t.Errorf("value %s = %s, expected %s", setting, formatPlannedValue(setting.Value),
+				formatPlannedValue(expectedValues[i]))
+		}
+	}
+}
+
+func TestParseAbsentKeyDefinition(t *testing.T) {
+	definition, err := parseSubjectDefinition("msdt.toml", []byte(`
+name = "MSDT"
+description = "Removes the ms-msdt URL protocol handler."
+
+[[absent_keys]]
+root = "CLASSES_ROOT"
+path = 'ms-msdt'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &RegistryKeyAbsent{
+		RootKey:     HKCR,
+		Path:        "ms-msdt",
+		shortName:   "MSDT",
+		longName:    "MSDT",
+		description: "Removes the ms-msdt URL protocol handler.",
+	}
+	if !reflect.DeepEqual(definition.hardenSubject, expected) {
+		t.Errorf("parsed %#v, expected %#v", definition.hardenSubject, expected)
+	}
+
+	_, err = parseSubjectDefinition("a.toml", []byte("name = \"Test\"\n[[absent_keys]]\nroot = \"CLASSES_ROOT\"\npath = ''"))
+	if err == nil || !strings.Contains(err.Error(), "absent key 1 of \"Test\": invalid path") {
+		t.Errorf("absent key without path returned %v", err)
+	}
+}
+
+func TestParseDisallowRunDefinition(t *testing.T) {
+	definition, err := parseSubjectDefinition("wscript.json", []byte(`{
+	"name": "Disable wscript.exe",
+	"description": "Blocks wscript.exe and cscript.exe.",
+	"harden_by_default": true,
+	"disallow_run": ["wscript.exe", "cscript.exe"]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &DisallowRunList{
+		Executables:     []string{"wscript.exe", "cscript.exe"},
+		shortName:       "Disable wscript.exe",
+		longName:        "Disable wscript.exe",
+		description:     "Blocks wscript.exe and cscript.exe.",
+		hardenByDefault: true,
+	}
+	if !reflect.DeepEqual(definition.hardenSubject, expected) {
+		t.Errorf("parsed %#v, expected %#v", definition.hardenSubject, expected)
+	}
+}
+
+func TestParseSubjectDefinitionErrors(t *testing.T) {
+	value := func(fields string) string {
+		return "name = \"Test\"\n[[values]]\n" + fields
+	}
+	tests := []struct {
+		file       string
+		definition string
+		expected   string
+	}{
+		{"a.toml", `long_name = "Test"`, "missing name"},
+		{"a.toml", `name = "Test"`, "has no values"},
+		{"a.toml", "name = \"Test\"\nunknown = 1", "unknown key unknown"},
+		{"a.json", `{"name": "Test", "unknown": 1}`, "unknown field"},
+		{"a.yaml", `name: Test`, "unsupported file type"},
+		{"a.toml", value("root = \"HKCU\"\npath = 'A'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1"), "invalid root key"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_NONE\"\ndata = 1"), "unsupported value type"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_BINARY\"\ndata = \"xy\""), "not a hex string"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_MULTI_SZ\"\ndata = \"x\""), "must be a list of strings"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_MULTI_SZ\"\ndata = [\"x\", \"\"]"), "non-empty strings"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_QWORD\"\ndata = -1"), "out of range"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = -1"), "out of range"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = \"1\""), "must be an integer"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_SZ\"\ndata = 1"), "must be a string"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = '%s'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1"), "invalid path"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A\\{office_app}\\{office_version}'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1"), "followed by"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A\\{adobe_version}'\nname = \"B\"\ntype = \"REG_SZ\"\ndata = \"1\""), "only supported for REG_DWORD"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1\nadobe_versions = [\"DC\"]"), "needs a path with {adobe_version}"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A\\{adobe_product}\\{adobe_version}'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1\nadobe_products = [\"Acrobat Pro\"]"), "unknown Adobe product"},
+		{"a.toml", value("root = \"CURRENT_USER\"\npath = 'A\\{adobe_version}'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1\nadobe_products = [\"Adobe Acrobat\"]"), "needs a path with {adobe_product}"},
+		{"a.toml", "name = \"Test\"\ndisallow_run = [\"C:\\\\cmd.exe\"]", "invalid disallow_run executable"},
+		{"a.toml", "name = \"Test\"\nifeo_block = [\"\"]", "invalid ifeo_block executable"},
+	}
+	for _, test := range tests {
+		_, err := parseSubjectDefinition(test.file, []byte(test.definition))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("parseSubjectDefinition(%s, %q) = %v, expected %q", test.file, test.definition, err, test.expected)
+		}
+	}
+}
+
+func TestLoadSubjectDefinitions(t *testing.T) {
+	valid := "name = \"Test\"\n[[values]]\nroot = \"CURRENT_USER\"\npath = 'A'\nname = \"B\"\ntype = \"REG_DWORD\"\ndata = 1\n"
+	fsys := fstest.MapFS{
+		"a.toml":     {Data: []byte(valid)},
+		"b.toml":     {Data: []byte(valid)},
+		"c.json":     {Data: []byte("{")},
+		"readme.txt": {Data: []byte("not a definition")},
+	}
+
+	definitions, errs := loadSubjectDefinitions(fsys)
+	if len(definitions) != 1 || definitions[0].file != "a.toml" {
+		t.Errorf("loaded %v", definitions)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "already defined in a.toml") ||
+		!strings.HasPrefix(errs[1].Error(), "c.json:") {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestHardenSubjectsFor(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	dir := t.TempDir()
+	oldSubjectsDir := subjectsDir
+	subjectsDir = dir
+	t.Cleanup(func() { subjectsDir = oldSubjectsDir })
+
+	writeDefinition := func(file, name string, privileged bool) {
+		definition := fmt.Sprintf("name = %q\nrequires_privileges = %v\n[[values]]\nroot = \"CURRENT_USER\"\n"+
+			"path = 'Software\\Site'\nname = %q\ntype = \"REG_DWORD\"\ndata = 1\n", name, privileged, name)
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(definition), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDefinition("site.toml", "Site", false)
+	writeDefinition("site_admin.toml", "Site Admin", true)
+	writeDefinition("wsh.toml", WSH.Name(), false)
+
+	hardenSubjects := hardenSubjectsFor(false)
+	if len(hardenSubjects) != len(hardenSubjectsForUnprivilegedUsers)+1 ||
+		hardenSubjects[len(hardenSubjects)-1].Name() != "Site" {
+		t.Errorf("unprivileged harden subjects: %v", hardenSubjects)
+	}
+	hardenSubjects = hardenSubjectsFor(true)
+	if len(hardenSubjects) != len(hardenSubjectsForPrivilegedUsers)+2 {
+		t.Errorf("privileged harden subjects: %v", hardenSubjects)
+	}
+
+	site := hardenSubjects[len(hardenSubjects)-2]
+	if err := hardenOrRestoreSubject(site, true); err != nil {
+		t.Fatal(err)
+	}
+	if !site.IsHardened() {
+		t.Errorf("%s is not hardened", site.Name())
+	}
+	if value := dumpRegistry(t, reg)["CURRENT_USER\\Software\\Site\\Site"]; value == "" {
+		t.Errorf("%s has not been hardened in the registry", site.Name())
+	}
+
+	subjectsDir = filepath.Join(dir, "missing")
+	if hardenSubjects := hardenSubjectsFor(false); len(hardenSubjects) != len(hardenSubjectsForUnprivilegedUsers) {
+		t.Errorf("harden subjects without subjects dir: %v", hardenSubjects)
+	}
+}
+
+func TestHardenSubjectsForDefaultDir(t *testing.T) {
+	useMemoryRegistry(t)
+	programData := t.TempDir()
+	t.Setenv("ProgramData", programData)
+	dir := filepath.Join(programData, "Hardentools", "subjects")
+	os.MkdirAll(dir, 0o700)
+	definition := "name = \"Site\"\n[[values]]\nroot = \"CURRENT_USER\"\npath = 'Software\\Site'\n" +
+		"name = \"Site\"\ntype = \"REG_DWORD\"\ndata = 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "site.toml"), []byte(definition), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default directory is only used if checkAdminOnlyDir accepts it,
+	// which is never the case on other operating systems.
+	hardenSubjects := hardenSubjectsFor(false)
+	loaded := hardenSubjects[len(hardenSubjects)-1].Name() == "Site"
+	if trusted := checkAdminOnlyDir(dir) == nil; loaded != trusted {
+		t.Errorf("definitions of the default directory loaded: %t, directory trusted: %t", loaded, trusted)
+	}
+
+	// An explicit directory is always used.
+	oldSubjectsDir := subjectsDir
+	subjectsDir = dir
+	t.Cleanup(func() { subjectsDir = oldSubjectsDir })
+	if hardenSubjects := hardenSubjectsFor(false); hardenSubjects[len(hardenSubjects)-1].Name() != "Site" {
+		t.Errorf("definitions of -subjects-dir have not been loaded: %v", hardenSubjects)
+	}
+}
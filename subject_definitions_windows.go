@@ -0,0 +1,85 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// trustedInstallerSid is the SID of the TrustedInstaller service, which owns
+// many system directories.
+const trustedInstallerSid = "S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464"
+
+// Access rights that allow to change the content of a directory (or the
+// directory itself).
+const directoryWriteAccess = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA | windows.FILE_WRITE_EA |
+	windows.FILE_WRITE_ATTRIBUTES | fileDeleteChild | windows.DELETE | windows.WRITE_DAC |
+	windows.WRITE_OWNER | windows.GENERIC_WRITE | windows.GENERIC_ALL
+
+// fileDeleteChild is the right to delete files in a directory.
+const fileDeleteChild = 0x40
+
+// isAdminSid returns true if sid is an administrator, SYSTEM or
+// TrustedInstaller.
+func isAdminSid(sid *windows.SID) bool {
+	return sid.IsWellKnown(windows.WinBuiltinAdministratorsSid) ||
+		sid.IsWellKnown(windows.WinLocalSystemSid) || sid.String() == trustedInstallerSid
+}
+
+// checkAdminOnlyDir returns an error unless dir and its parent directory are
+// owned by an administrator (or SYSTEM) and only administrators can write to
+// them. Otherwise another user could have placed files there.
+func checkAdminOnlyDir(dir string) error {
+	for _, checkDir := range []string{dir, filepath.Dir(dir)} {
+		sd, err := windows.GetNamedSecurityInfo(checkDir, windows.SE_FILE_OBJECT,
+			windows.OWNER_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+		if err != nil {
+			return fmt.Errorf("could not read permissions of %s: %w", checkDir, err)
+		}
+		owner, _, err := sd.Owner()
+		if err != nil {
+			return fmt.Errorf("could not read owner of %s: %w", checkDir, err)
+		}
+		if !isAdminSid(owner) {
+			return fmt.Errorf("%s is owned by %s, not by an administrator", checkDir, owner)
+		}
+
+		dacl, _, err := sd.DACL()
+		if err != nil || dacl == nil {
+			return fmt.Errorf("%s has no access control list", checkDir)
+		}
+		for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+			var ace *windows.ACCESS_ALLOWED_ACE
+			if err := windows.GetAce(dacl, i, &ace); err != nil {
+				return fmt.Errorf("could not read permissions of %s: %w", checkDir, err)
+			}
+			if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE ||
+				ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 || ace.Mask&directoryWriteAccess == 0 {
+				continue
+			}
+			sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+			if !isAdminSid(sid) {
+				return fmt.Errorf("%s can be changed by %s", checkDir, sid)
+			}
+		}
+	}
+	return nil
+}
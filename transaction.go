@@ -0,0 +1,198 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// Hardening is applied in transactions: every registry value changed and
+// every harden state saved while a transaction is active is logged, so that
+// the changes can be rolled back if hardening fails half way. Transactions
+// can be nested; committing a nested transaction hands its log over to the
+// enclosing one.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// hardenTransaction logs the changes done while it is active.
+type hardenTransaction struct {
+	parent  *hardenTransaction
+	changes []transactionChange
+	states  []string
+}
+
+// transactionChange is a single changed registry value. before contains the
+// value before the change; newEntry is true if the change created the
+// journal entry.
+type transactionChange struct {
+	before   journalEntry
+	newEntry bool
+}
+
+// currentTransaction is the innermost active transaction or nil.
+var currentTransaction *hardenTransaction
+
+// errRollbackIncomplete is reported if a failed subject might have changed
+// settings that are not logged in the transaction (e.g. by running
+// commands), so they might not have been rolled back.
+var errRollbackIncomplete = errors.New("rollback incomplete")
+
+// RollbackError is returned if hardening failed and the changes done so far
+// have been rolled back.
+type RollbackError struct {
+	Err         error // the error that caused the rollback
+	RollbackErr error // nil if the rollback has been successful
+}
+
+func (e *RollbackError) Error() string {
+	if errors.Is(e.RollbackErr, errRollbackIncomplete) {
+		return fmt.Sprintf("%s (%s)", e.Err.Error(), e.RollbackErr.Error())
+	}
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%s (rollback failed: %s)", e.Err.Error(), e.RollbackErr.Error())
+	}
+	return e.Err.Error() + " (rolled back)"
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// isRolledBack returns true if err reports a successful rollback.
+func isRolledBack(err error) bool {
+	var rollbackErr *RollbackError
+	return errors.As(err, &rollbackErr) && rollbackErr.RollbackErr == nil
+}
+
+// beginTransaction starts a (possibly nested) transaction.
+func beginTransaction() *hardenTransaction {
+	currentTransaction = &hardenTransaction{parent: currentTransaction}
+	return currentTransaction
+}
+
+// logValueChange is called before a registry value is changed.
+func (tx *hardenTransaction) logValueChange(before journalEntry, newEntry bool) {
+	tx.changes = append(tx.changes, transactionChange{before, newEntry})
+}
+
+// logStateChange is called after a harden state has been saved.
+func (tx *hardenTransaction) logStateChange(feature string) {
+	tx.states = append(tx.states, feature)
+}
+
+// commit ends the transaction and keeps all changes.
+func (tx *hardenTransaction) commit() {
+	currentTransaction = tx.parent
+	if tx.parent != nil {
+		tx.parent.changes = append(tx.parent.changes, tx.changes...)
+		tx.parent.states = append(tx.parent.states, tx.states...)
+	}
+}
+
+// rollback ends the transaction and restores all changed registry values in
+// reverse order. Journal entries and harden states created by the
+// transaction are removed.
+func (tx *hardenTransaction) rollback() error {
+	currentTransaction = tx.parent
+
+	var firstErr error
+	for i := len(tx.changes) - 1; i >= 0; i-- {
+		change := tx.changes[i]
+		if change.before.Key != nil {
+			Info.Printf("Rolling back deletion of %s", &change.before)
+		} else {
+			Info.Printf("Rolling back %s to %s", &change.before, change.before.Original)
+		}
+		if err := change.before.restore(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not roll back %s: %s", &change.before, err.Error())
+		}
+	}
+	if len(tx.changes) == 0 && len(tx.states) == 0 {
+		return firstErr
+	}
+
+	journal, err := loadBackupJournal()
+	if err != nil {
+		if firstErr == nil {
+			firstErr = err
+		}
+		return firstErr
+	}
+	for _, change := range tx.changes {
+		if !change.newEntry {
+			continue
+		}
+		for i, entry := range journal.Records {
+			if entry.Root == change.before.Root && strings.EqualFold(entry.Path, change.before.Path) &&
+				strings.EqualFold(entry.Name, change.before.Name) && (entry.Key == nil) == (change.before.Key == nil) {
+				journal.Records = append(journal.Records[:i], journal.Records[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, feature := range tx.states {
+		for i, state := range journal.States {
+			if state.Feature == feature {
+				journal.States = append(journal.States[:i], journal.States[i+1:]...)
+				break
+			}
+		}
+	}
+	if err := journal.save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// hardenTransactionally hardens all children in a transaction. If a child
+// fails, it and the children that have already been hardened are restored
+// (in reverse order) and all registry values changed meanwhile are set back
+// to their originals. If the failed child might have changed settings that
+// are not logged in the transaction, the rollback is reported as incomplete.
+func hardenTransactionally(children []HardenInterface) error {
+	tx := beginTransaction()
+	for i, child := range children {
+		logged := len(tx.changes) + len(tx.states)
+		err := child.Harden(true)
+		if err == nil {
+			continue
+		}
+		Info.Printf("Could not harden %s due to error: %s, rolling back", child.Name(), err.Error())
+
+		unlogged := len(tx.changes)+len(tx.states) == logged &&
+			!isRegistrySubject(child, func(RegistryRootKey) bool { return true })
+		var rollbackErr error
+		for j := i; j >= 0; j-- {
+			if err := children[j].Harden(false); err != nil && rollbackErr == nil {
+				rollbackErr = fmt.Errorf("could not restore %s: %s", children[j].Name(), err.Error())
+			}
+		}
+		if err := tx.rollback(); err != nil && rollbackErr == nil {
+			rollbackErr = err
+		}
+		if unlogged && rollbackErr == nil {
+			rollbackErr = fmt.Errorf("%w: %s might have changed settings that are not logged", errRollbackIncomplete, child.Name())
+		}
+		if isRolledBack(err) {
+			// Report the original cause only once.
+			err = errors.Unwrap(err)
+		}
+		return &RollbackError{err, rollbackErr}
+	}
+	tx.commit()
+	return nil
+}
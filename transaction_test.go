@@ -0,0 +1,229 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSubject is a non-registry harden subject that logs all calls.
+type fakeSubject struct {
+	name  string
+	fail  bool
+	calls *[]string
+}
+
+func (subject fakeSubject) Harden(harden bool) error {
+	if harden {
+		*subject.calls = append(*subject.calls, "harden "+subject.name)
+	} else {
+		*subject.calls = append(*subject.calls, "restore "+subject.name)
+	}
+	if harden && subject.fail {
+		return errors.New(subject.name + " failed")
+	}
+	return nil
+}
+
+func (subject fakeSubject) IsHardened() bool      { return false }
+func (subject fakeSubject) Name() string          { return subject.name }
+func (subject fakeSubject) LongName() string      { return subject.name }
+func (subject fakeSubject) Description() string   { return subject.name }
+func (subject fakeSubject) HardenByDefault() bool { return true }
+
+// deniedDWORD is a registry value that can't be written without privileges.
+var deniedDWORD = &RegistrySingleValueDWORD{
+	RootKey:       HKLM,
+	Path:          "SOFTWARE\\Policies\\Test",
+	ValueName:     "Denied",
+	HardenedValue: 1,
+	shortName:     "Denied",
+}
+
+func TestRegistryMultiValueRollback(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	reg.SetAccessDenied(HKLM, "", true)
+	before := dumpRegistry(t, reg)
+
+	subject := &RegistryMultiValue{
+		ArraySingleDWORD: []*RegistrySingleValueDWORD{
+			{RootKey: HKCU, Path: "SOFTWARE\\Microsoft\\Windows Script Host\\Settings", ValueName: "Enabled", HardenedValue: 0},
+			{RootKey: HKCU, Path: "SOFTWARE\\Test", ValueName: "New", HardenedValue: 1},
+			deniedDWORD,
+		},
+		shortName: "Test",
+	}
+
+	err := hardenOrRestoreSubject(subject, true)
+	if !isRolledBack(err) || !strings.HasSuffix(err.Error(), "(rolled back)") {
+		t.Fatalf("Harden = %v, expected rollback", err)
+	}
+	if strings.Count(err.Error(), "rolled back") != 1 {
+		t.Errorf("nested rollback reported more than once: %s", err)
+	}
+
+	// The journal entries have been removed, so only the hardentools key
+	// with the empty journal is left.
+	after := dumpRegistry(t, reg)
+	for name := range after {
+		if strings.HasPrefix(name, "CURRENT_USER\\"+hardentoolsKeyPath) {
+			delete(after, name)
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after rollback:\nbefore: %v\nafter:  %v", before, after)
+	}
+	if journal, _ := loadBackupJournal(); len(journal.Records) != 0 {
+		t.Errorf("journal after rollback = %v", journal.Records)
+	}
+	if currentTransaction != nil {
+		t.Error("transaction is still active")
+	}
+}
+
+func TestMultiHardenInterfacesRollback(t *testing.T) {
+	useMemoryRegistry(t)
+	var calls []string
+
+	subject := &MultiHardenInterfaces{
+		hardenInterfaces: []HardenInterface{
+			fakeSubject{"first", false, &calls},
+			fakeSubject{"second", false, &calls},
+			fakeSubject{"third", true, &calls},
+			fakeSubject{"fourth", false, &calls},
+		},
+		shortName: "Test",
+	}
+
+	// The failed subject is restored too, but since it doesn't log its
+	// changes in the transaction, it might not have been rolled back
+	// completely.
+	err := subject.Harden(true)
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || !errors.Is(rollbackErr.RollbackErr, errRollbackIncomplete) ||
+		isRolledBack(err) || !strings.Contains(err.Error(), "rollback incomplete: third") {
+		t.Fatalf("Harden = %v, expected incomplete rollback", err)
+	}
+	expected := []string{"harden first", "harden second", "harden third", "restore third", "restore second", "restore first"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %v, expected %v", calls, expected)
+	}
+}
+
+func TestRollbackFailure(t *testing.T) {
+	reg := useMemoryRegistry(t)
+
+	// The first value is changed, but can't be rolled back any more.
+	subject := &RegistryMultiValue{
+		ArraySingleDWORD: []*RegistrySingleValueDWORD{
+			{RootKey: HKCU, Path: "SOFTWARE\\Test", ValueName: "Value", HardenedValue: 1},
+		},
+	}
+	var calls []string
+	multi := &MultiHardenInterfaces{
+		hardenInterfaces: []HardenInterface{
+			subject,
+			denyingSubject{reg},
+			fakeSubject{"fail", true, &calls},
+		},
+	}
+
+	err := multi.Harden(true)
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || rollbackErr.RollbackErr == nil || isRolledBack(err) {
+		t.Fatalf("Harden = %v, expected failed rollback", err)
+	}
+	if !strings.Contains(err.Error(), "rollback failed") {
+		t.Errorf("error message %q does not report failed rollback", err)
+	}
+}
+
+func TestRollbackRemovesJournalEntriesCaseInsensitively(t *testing.T) {
+	useMemoryRegistry(t)
+	tx := beginTransaction()
+	if err := hardenKey(HKCU, "SOFTWARE\\Test", "Value", 1); err != nil {
+		t.Fatal(err)
+	}
+	tx.changes[0].before.Path = "software\\test"
+	tx.changes[0].before.Name = "VALUE"
+
+	if err := tx.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if journal, _ := loadBackupJournal(); len(journal.Records) != 0 {
+		t.Errorf("journal after rollback = %v", journal.Records)
+	}
+}
+
+// denyingSubject makes SOFTWARE\Test read only when hardened.
+type denyingSubject struct {
+	reg *memoryRegistry
+}
+
+func (subject denyingSubject) Harden(harden bool) error {
+	if harden {
+		subject.reg.SetAccessDenied(HKCU, "SOFTWARE\\Test", true)
+	}
+	return nil
+}
+
+func (subject denyingSubject) IsHardened() bool      { return false }
+func (subject denyingSubject) Name() string          { return "deny" }
+func (subject denyingSubject) LongName() string      { return "deny" }
+func (subject denyingSubject) Description() string   { return "deny" }
+func (subject denyingSubject) HardenByDefault() bool { return true }
+
+func TestAtomicHardeningRun(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	seedRegistry(t, reg)
+	reg.SetAccessDenied(HKLM, "", true)
+	before := dumpRegistry(t, reg)
+
+	previousSubjects := allHardenSubjects
+	allHardenSubjects = []HardenInterface{WSH, OfficeOLE, UAC, ShowFileExt}
+	expertConfig = map[string]bool{WSH.Name(): true, OfficeOLE.Name(): true, UAC.Name(): true, ShowFileExt.Name(): true}
+	atomicHardening = true
+	defer func() {
+		allHardenSubjects = previousSubjects
+		atomicHardening = false
+	}()
+
+	err := triggerAll(true)
+	if !isRolledBack(err) || !strings.Contains(err.Error(), UAC.Name()) {
+		t.Fatalf("triggerAll = %v, expected rollback", err)
+	}
+	if WSH.IsHardened() || OfficeOLE.IsHardened() || ShowFileExt.IsHardened() {
+		t.Error("subjects are still hardened after rollback")
+	}
+	markStatus(false)
+	if after := dumpRegistry(t, reg); !reflect.DeepEqual(before, after) {
+		t.Errorf("registry differs after rollback:\nbefore: %v\nafter:  %v", before, after)
+	}
+
+	// Without atomicHardening only the failed subject is rolled back.
+	atomicHardening = false
+	if err := triggerAll(true); err != nil {
+		t.Errorf("triggerAll = %v", err)
+	}
+	if !WSH.IsHardened() || !OfficeOLE.IsHardened() || !ShowFileExt.IsHardened() {
+		t.Error("subjects have not been hardened")
+	}
+}
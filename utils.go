@@ -16,107 +16,19 @@
 
 package main
 
-/*
-// some C code for managing elevated privileges
-#include <windows.h>
-#include <shellapi.h>
-
-// Checks if we are running with elevated privileges (admin rights).
-int IsElevated( ) {
-    boolean fRet = FALSE;
-    HANDLE hToken = NULL;
-    if( OpenProcessToken( GetCurrentProcess( ),TOKEN_QUERY,&hToken ) ) {
-        TOKEN_ELEVATION Elevation;
-        DWORD cbSize = sizeof( TOKEN_ELEVATION );
-        if( GetTokenInformation( hToken, TokenElevation, &Elevation, sizeof( Elevation ), &cbSize ) ) {
-            fRet = Elevation.TokenIsElevated;
-        }
-    }
-    if( hToken ) {
-        CloseHandle( hToken );
-    }
-    if( fRet ){
-		return 1;
-	}
-	else {
-		return 0;
-	}
-}
-
-// Executes the executable in the current directory (or in path) with "runas"
-// to aquire admin privileges.
-int ExecuteWithRunas(char execName[]){
-	SHELLEXECUTEINFO shExecInfo;
-
-	shExecInfo.cbSize = sizeof(SHELLEXECUTEINFO);
-
-	shExecInfo.fMask = 0x00008000;
-	shExecInfo.hwnd = NULL;
-	shExecInfo.lpVerb = "runas";
-	shExecInfo.lpFile = execName;
-	shExecInfo.lpParameters = NULL;
-	shExecInfo.lpDirectory = NULL;
-	shExecInfo.nShow = SW_NORMAL;
-	shExecInfo.hInstApp = NULL;
-
-	boolean success = ShellExecuteEx(&shExecInfo);
-	if (success)
-		return 1;
-	else
-		return 0;
-}
-*/
-import "C"
-
 import (
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
+	"slices"
 	"strings"
-	"syscall"
-	"unsafe"
-
-	"golang.org/x/sys/windows/registry"
 )
 
-// isElevated verifies if program is running with admin privileges
-func isElevated() bool {
-	isElevated := C.IsElevated()
-	if isElevated == 1 {
-		return true
-	}
-	return false
-}
-
-// startWithElevatedPrivs starts progName with elevated privileges
-func startWithElevatedPrivs(progName string) bool {
-	cprogname := C.CString(progName)
-	defer C.free(unsafe.Pointer(cprogname))
-	ret := C.ExecuteWithRunas(cprogname)
-	if ret == 1 {
-		return true
-	}
-	return false
-}
-
-// Helper method for executing cmd commands (does not open cmd window).
-func executeCommand(cmd string, args ...string) (string, error) {
-	var out []byte
-	command := exec.Command(cmd, args...)
-	command.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	out, err := command.CombinedOutput()
-
-	return string(out), err
-}
-
 // checkStatus checks status of hardentools registry key
 // (that tells if user environment is hardened / not hardened).
 func checkStatus() bool {
-	key, err := registry.OpenKey(registry.CURRENT_USER, hardentoolsKeyPath,
-		registry.READ)
+	key, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath,
+		keyRead)
 	if err != nil {
 		return false
 	}
@@ -139,8 +51,8 @@ func checkStatus() bool {
 func markStatus(hardened bool) {
 
 	if hardened {
-		key, _, err := registry.CreateKey(registry.CURRENT_USER,
-			hardentoolsKeyPath, registry.ALL_ACCESS)
+		key, _, err := registryBackend.CreateKey(HKCU,
+			hardentoolsKeyPath, keyAllAccess)
 		if err != nil {
 			Info.Println(err.Error())
 			panic(err)
@@ -155,11 +67,18 @@ func markStatus(hardened bool) {
 			panic(err)
 		}
 	} else {
-		// On restore delete all hardentools registry keys afterwards.
-		err := registry.DeleteKey(registry.CURRENT_USER, hardentoolsKeyPath)
-		if err != nil {
+		// Only remove the marker. The backup journal is kept, it still
+		// contains the values that could not be restored (if any).
+		key, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+		if err == errRegistryNotExist {
+			return
+		} else if err == nil {
+			defer key.Close()
+			err = key.DeleteValue("Harden")
+		}
+		if err != nil && err != errRegistryNotExist {
 			Info.Println(err.Error())
-			ShowFailure("Remove hardentools registry keys", "Could not remove")
+			ShowFailure("Remove hardentools status", "Could not remove")
 		}
 	}
 }
@@ -168,8 +87,10 @@ func markStatus(hardened bool) {
 // harden == true => harden
 // harden == false => restore
 // triggerAll evaluates the expertConfig settings and hardens/restores only
-// the active items.
-func triggerAll(harden bool) {
+// the active items. Every subject is hardened in a transaction; if
+// atomicHardening is set, the whole run is rolled back if any subject fails
+// and an error is returned. Subjects are restored in reverse order.
+func triggerAll(harden bool) error {
 	var outputString string
 	if harden {
 		Info.Println("Now we are hardening...")
@@ -180,108 +101,438 @@ func triggerAll(harden bool) {
 	}
 
 	Trace.Println(outputString)
+	runResults = make(map[string]runResult)
 
-	for _, hardenSubject := range allHardenSubjects {
+	var runTransaction *hardenTransaction
+	var hardened []HardenInterface
+	if harden && atomicHardening {
+		runTransaction = beginTransaction()
+	}
+
+	// Restore in reverse order, e.g. to remove the Image File Execution
+	// Options blocks of cmd.exe and PowerShell.exe before the harden subjects
+	// executing them.
+	hardenSubjects := allHardenSubjects
+	if !harden {
+		hardenSubjects = slices.Clone(allHardenSubjects)
+		slices.Reverse(hardenSubjects)
+	}
+
+	for _, hardenSubject := range hardenSubjects {
 		if expertConfig[hardenSubject.Name()] == true {
 
-			err := hardenSubject.Harden(harden)
+			var err error
+			if harden {
+				err = hardenOrRestoreSubject(hardenSubject, harden)
+			} else {
+				err = restoreSubject(hardenSubject)
+			}
 
 			if err != nil {
 				ShowFailure(hardenSubject.Name(), err.Error())
 				Info.Printf("Error for operation %s: %s", hardenSubject.Name(), err.Error())
+				recordRunResult(hardenSubject.Name(), resultFailed, err)
+				if runTransaction != nil {
+					return rollbackRun(runTransaction, hardened, hardenSubject, err)
+				}
 			} else {
 				ShowSuccess(hardenSubject.Name())
 				Trace.Printf("%s %s has been successful", outputString, hardenSubject.Name())
+				if harden {
+					recordRunResult(hardenSubject.Name(), resultHardened, nil)
+				} else {
+					recordRunResult(hardenSubject.Name(), resultRestored, nil)
+				}
+				hardened = append(hardened, hardenSubject)
 			}
 		}
 	}
+
+	if runTransaction != nil {
+		runTransaction.commit()
+	}
+	return nil
 }
 
-func cmdHardenRestore(harden bool) {
-	// check if hardentools has been started with elevated rights.
+// rollbackRun restores all subjects hardened in this run (in reverse order)
+// after failedSubject failed and rolls back runTransaction.
+func rollbackRun(runTransaction *hardenTransaction, hardened []HardenInterface, failedSubject HardenInterface, cause error) error {
+	Info.Printf("Rolling back all changes since %s failed", failedSubject.Name())
+
+	subjectErrs := make(map[string]error)
+	for i := len(hardened) - 1; i >= 0; i-- {
+		subjectErrs[hardened[i].Name()] = hardenOrRestoreSubject(hardened[i], false)
+	}
+	rollbackErr := runTransaction.rollback()
+
+	for _, hardenSubject := range hardened {
+		if err := subjectErrs[hardenSubject.Name()]; err != nil {
+			ShowFailure(hardenSubject.Name(), "rollback failed: "+err.Error())
+			recordRunResult(hardenSubject.Name(), resultFailed, fmt.Errorf("rollback failed: %w", err))
+		} else if rollbackErr != nil {
+			ShowFailure(hardenSubject.Name(), "rollback failed: "+rollbackErr.Error())
+			recordRunResult(hardenSubject.Name(), resultFailed, fmt.Errorf("rollback failed: %w", rollbackErr))
+		} else {
+			ShowFailure(hardenSubject.Name(), "rolled back")
+			recordRunResult(hardenSubject.Name(), resultRolledBack, nil)
+		}
+	}
+
+	var subjectRollback *RollbackError
+	if errors.As(cause, &subjectRollback) {
+		// Report the original cause only once, together with a failed or
+		// incomplete rollback of the subject.
+		cause = subjectRollback.Err
+		if rollbackErr == nil {
+			rollbackErr = subjectRollback.RollbackErr
+		}
+	}
+	cause = fmt.Errorf("%s failed: %s", failedSubject.Name(), cause.Error())
+	return &RollbackError{cause, rollbackErr}
+}
+
+// hardenOrRestoreSubject hardens or restores a single harden subject. All
+// values saved in the backup journal meanwhile are owned by this subject.
+// Hardening is done in a transaction, so a failing subject is not left
+// half-hardened.
+func hardenOrRestoreSubject(hardenSubject HardenInterface, harden bool) error {
+	journalSubject = hardenSubject.Name()
+	defer func() { journalSubject = "" }()
+
+	if harden {
+		return hardenTransactionally([]HardenInterface{hardenSubject})
+	}
+	return hardenSubject.Harden(harden)
+}
+
+// restoreSubject restores a single harden subject including the registry
+// values it saved in the backup journal. Values saved by other subjects are
+// left untouched, so they stay hardened.
+func restoreSubject(hardenSubject HardenInterface) error {
+	if err := hardenOrRestoreSubject(hardenSubject, false); err != nil {
+		return err
+	}
+	return restoreSubjectBackup(hardenSubject.Name())
+}
+
+// defaultExpertConfig returns the harden subjects selected by default. If
+// the system is not hardened yet, these are the subjects that are hardened
+// by default and not hardened yet. Otherwise (restore) these are all subjects
+// that need to be restored.
+func defaultExpertConfig(hardened bool) map[string]bool {
+	config := make(map[string]bool)
+	owners := journalOwners()
+	for _, hardenSubject := range allHardenSubjects {
+		if hardened {
+			config[hardenSubject.Name()] = needsRestore(hardenSubject, owners)
+		} else {
+			config[hardenSubject.Name()] = !hardenSubject.IsHardened() && hardenSubject.HardenByDefault()
+		}
+	}
+	return config
+}
+
+// isCompleteRestore returns true if all harden subjects that need to be
+// restored (see needsRestore) are selected in expertConfig. Otherwise only
+// the selected subjects are restored and everything else stays hardened.
+func isCompleteRestore() bool {
+	owners := journalOwners()
+	for _, hardenSubject := range allHardenSubjects {
+		if expertConfig[hardenSubject.Name()] == false && needsRestore(hardenSubject, owners) {
+			return false
+		}
+	}
+	return true
+}
+
+// journalOwners returns the names of all harden subjects that own saved
+// values or states in the backup journal.
+func journalOwners() map[string]bool {
+	owners := make(map[string]bool)
+	if journal, err := loadBackupJournal(); err == nil {
+		for _, entry := range journal.Records {
+			owners[entry.Subject] = true
+		}
+		for _, state := range journal.States {
+			owners[state.Subject] = true
+		}
+	}
+	return owners
+}
+
+// needsRestore returns true if hardenSubject owns entries of the backup
+// journal (see journalOwners) or is not completely restored, e.g. because
+// some of its settings have been changed after hardening and it is only
+// partially hardened now.
+func needsRestore(hardenSubject HardenInterface, owners map[string]bool) bool {
+	if owners[hardenSubject.Name()] {
+		return true
+	}
+	switch getHardenStatus(hardenSubject).State {
+	case StateNotHardened, StateNotApplicable:
+		return false
+	}
+	return true
+}
+
+// selectRestoreSubjects limits expertConfig to the harden subjects named in
+// restoreSubjectNames (if set).
+func selectRestoreSubjects() error {
+	return selectNamedSubjects(restoreSubjectNames)
+}
+
+// selectNamedSubjects sets expertConfig to the harden subjects named in names
+// (if set). Names are case insensitive.
+func selectNamedSubjects(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, hardenSubject := range allHardenSubjects {
+			if strings.EqualFold(hardenSubject.Name(), strings.TrimSpace(name)) {
+				selected[hardenSubject.Name()] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown harden subject %q", name)
+		}
+	}
+	expertConfig = selected
+	return nil
+}
+
+// selectHardenSubjects sets allHardenSubjects depending on whether
+// hardentools has been started with elevated rights.
+func selectHardenSubjects() {
+	if offlineHives != nil {
+		// Offline hives don't need privileges, but only subjects that
+		// just change registry values can be applied to them.
+		Info.Println("Using offline hives " + strings.Join(offlineHives.files(), ", "))
+		allHardenSubjects = nil
+		for _, hardenSubject := range hardenSubjectsFor(true) {
+			if isRegistrySubject(hardenSubject, func(RegistryRootKey) bool { return true }) {
+				allHardenSubjects = append(allHardenSubjects, hardenSubject)
+			}
+		}
+		return
+	}
+
 	elevationStatus := isElevated()
 	if elevationStatus {
 		Info.Println("Started with elevated rights")
-		allHardenSubjects = hardenSubjectsForPrivilegedUsers
 	} else {
 		Info.Println("Started without elevated rights")
-		allHardenSubjects = hardenSubjectsForUnprivilegedUsers
 	}
+	allHardenSubjects = hardenSubjectsFor(elevationStatus)
+}
+
+func cmdHardenRestore(harden bool) {
+	// check if hardentools has been started with elevated rights.
+	selectHardenSubjects()
 
 	// TODO: verify if hardening has been done with elevate privileges and now restoring
 	// should be done without elevated privileges (needs additional registry key)
 
+	if allUsersMode && !isElevated() {
+		fmt.Println("-all-users needs admin privileges.")
+		os.Exit(-1)
+	} else if allUsersMode && dryRunMode {
+		fmt.Println("-dry-run can't be combined with -all-users.")
+		os.Exit(-1)
+	}
+
 	// check hardening status
 	status := checkStatus()
 	if status == false && harden == false {
+		if allUsersMode {
+			// Other user profiles might still be hardened.
+			cmdHardenUserProfiles(false, newRunReport(false))
+			return
+		}
 		fmt.Println("Not hardened. Please harden before restoring.")
 		os.Exit(-1)
-	} else if status == true && harden == true {
+	} else if status == true && harden == true && len(hardenSubjectNames) == 0 {
+		if allUsersMode {
+			// Only the other user profiles still need to be hardened.
+			cmdHardenUserProfiles(true, newRunReport(true))
+			return
+		}
+		// Additional subjects can be hardened with -harden-subject.
 		fmt.Println("Already hardened. Please restore before hardening again.")
 		os.Exit(-1)
 	}
 
-	// build up expert settings checkboxes and map
-	expertConfig = make(map[string]bool)
-	for _, hardenSubject := range allHardenSubjects {
-		var subjectIsHardened = hardenSubject.IsHardened()
-		//var enableField bool
+	expertConfig = defaultExpertConfig(status)
+
+	names := restoreSubjectNames
+	if harden {
+		names = hardenSubjectNames
+	}
+	if err := selectNamedSubjects(names); err != nil {
+		fmt.Println(err.Error())
+		printSubjectNames()
+		os.Exit(-1)
+	}
+
+	if dryRunMode {
+		printPlan(os.Stdout, planAll(harden))
+		os.Exit(0)
+	}
 
-		if status == false {
-			// harden only settings which are not hardened yet
-			expertConfig[hardenSubject.Name()] = !subjectIsHardened && hardenSubject.HardenByDefault()
+	completeRestore := !harden && isCompleteRestore()
+	var restoreErr error
+	if !harden {
+		markRestoring(true)
+	}
+	err := triggerAll(harden)
+	if err != nil {
+		if !harden {
+			markRestoring(false)
+		}
+		// Everything of this run has been rolled back. A system that has
+		// been hardened before (e.g. with -harden-subject) stays hardened
+		// with its backup journal, otherwise it is not hardened anymore.
+		fmt.Println("Hardening failed: " + err.Error())
+		if !status {
+			markStatus(false)
+		}
+		showStatus()
+		if report := newRunReport(harden); report != nil {
+			report.Error = err.Error()
+			writeReportOrExit(report)
+		}
+		os.Exit(-1)
+	}
+	if harden {
+		markStatus(true)
+	} else if completeRestore {
+		// Values that could not be restored are kept in the backup journal
+		// and the system stays marked as hardened, so restoring can be
+		// retried.
+		restoreErr = restoreSavedRegistryKeys()
+		if restoreErr != nil {
+			ShowFailure("Restore saved registry values", restoreErr.Error())
 		} else {
-			// restore only hardened settings
-			expertConfig[hardenSubject.Name()] = subjectIsHardened
+			markStatus(false)
 		}
+	} else {
+		Info.Println("Only selected features have been restored, all others stay hardened.")
 	}
-
-	triggerAll(harden)
 	if !harden {
-		restoreSavedRegistryKeys()
+		markRestoring(false)
 	}
-	markStatus(harden)
 	showStatus()
+	saveOfflineHives()
+	report := newRunReport(harden)
+	if report != nil && restoreErr != nil {
+		report.Error = restoreErr.Error()
+	}
+	if allUsersMode {
+		cmdHardenUserProfiles(harden, report)
+	} else if report != nil {
+		writeReportOrExit(report)
+	}
+	if restoreErr != nil {
+		fmt.Println("Restoring failed, run -restore again to retry: " + restoreErr.Error())
+		os.Exit(-1)
+	}
 }
 
-// initLogging initializes loggers.
-func initLogging(traceHandle io.Writer, infoHandle io.Writer, guiVersion bool) {
-	if guiVersion {
-		Trace = log.New(traceHandle, "TRACE: ", log.Lshortfile)
-		Info = log.New(infoHandle, "INFO: ", log.Lshortfile)
+// cmdApplyReg hardens the registry values of the .reg file fileName, or
+// restores the values hardened with it before if harden is false.
+func cmdApplyReg(fileName string, harden bool) {
+	subject, err := loadRegFileSubject(fileName)
+	if err != nil {
+		fmt.Println("Could not load registry file: " + err.Error())
+		os.Exit(-1)
+	}
+
+	if dryRunMode {
+		printPlan(os.Stdout, planSingleSubject(subject, harden))
+		os.Exit(0)
+	}
+
+	if harden {
+		err = hardenOrRestoreSubject(subject, true)
 	} else {
-		Trace = log.New(traceHandle, "", 0)
-		Info = log.New(infoHandle, "", 0)
+		markRestoring(true)
+		err = restoreSubject(subject)
+		markRestoring(false)
 	}
-	log.SetOutput(infoHandle)
+	if err != nil {
+		fmt.Println("Applying registry file failed: " + err.Error())
+		os.Exit(-1)
+	}
+	saveOfflineHives()
+	printHardenStatus(os.Stdout, getHardenStatus(subject), 0)
+	os.Exit(0)
 }
 
-// initLoggingWithCmdParameters initializes logging considering if cli version specifics
-func initLoggingWithCmdParameters(logLevelPtr *string, cmd bool) {
-	var logfile *os.File
-	var err error
+// printSubjectNames prints the names of all harden subjects.
+func printSubjectNames() {
+	fmt.Println("Available harden subjects:")
+	for _, hardenSubject := range allHardenSubjects {
+		fmt.Println("  " + hardenSubject.Name())
+	}
+}
 
-	if cmd {
-		// command line only => use stdout
-		logfile = os.Stdout
-	} else {
-		// UI => use logfile
-		logfile, err = os.Create(logPath)
-		if err != nil {
-			panic(err)
+// cmdStatus prints the detailed status of all harden subjects (or writes
+// it as report).
+func cmdStatus() {
+	selectHardenSubjects()
+	if isReportMode() {
+		report := newHardenReport("status")
+		if allUsersMode {
+			if !isElevated() {
+				fmt.Println("-all-users needs admin privileges.")
+				os.Exit(-1)
+			}
+			if err := report.addUserProfiles(nil); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(-1)
+			}
 		}
+		writeReportOrExit(report)
+		os.Exit(0)
 	}
-	if strings.EqualFold(*logLevelPtr, "Info") {
-		// only standard log output
-		initLogging(ioutil.Discard, logfile, !cmd)
-	} else if strings.EqualFold(*logLevelPtr, "Trace") {
-		// standard + trace logging
-		initLogging(logfile, logfile, !cmd)
-	} else if strings.EqualFold(*logLevelPtr, "Off") {
-		// no logging
-		initLogging(ioutil.Discard, ioutil.Discard, !cmd)
-	} else {
-		// default logging (only standard log output)
-		initLogging(ioutil.Discard, logfile, !cmd)
+	printOfficeInstalls(os.Stdout)
+	for _, hardenSubject := range allHardenSubjects {
+		printHardenStatus(os.Stdout, getHardenStatus(hardenSubject), 0)
+	}
+	if allUsersMode {
+		if !isElevated() {
+			fmt.Println("-all-users needs admin privileges.")
+			os.Exit(-1)
+		}
+		if err := printUserProfilesStatus(os.Stdout); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-1)
+		}
+	}
+	os.Exit(0)
+}
+
+// cmdMigrateState migrates saved state of older hardentools versions to the
+// backup journal and prints all entries that could not be migrated.
+func cmdMigrateState() {
+	report, err := migrateLegacySavedState()
+	if err != nil {
+		fmt.Println("Migration of saved state failed: " + err.Error())
+		os.Exit(-1)
+	}
+	saveOfflineHives()
+
+	fmt.Printf("Migrated %d legacy saved state entries.\n", len(report.Migrated))
+	if len(report.Problems) == 0 {
+		os.Exit(0)
+	}
+	fmt.Printf("%d entries could not be migrated and have been kept:\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Println("  " + problem.String())
 	}
+	os.Exit(1)
 }
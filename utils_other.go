@@ -0,0 +1,39 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !windows
+
+package main
+
+// Hardentools only runs on Windows. These stand-ins allow to build and test
+// the platform independent parts (e.g. with the in-memory registry) on
+// other operating systems.
+
+import "os/exec"
+
+// isElevated always returns false on other operating systems.
+func isElevated() bool {
+	return false
+}
+
+// startWithElevatedPrivs is not supported on other operating systems.
+func startWithElevatedPrivs(progName string) bool {
+	return false
+}
+
+// hideCommandWindow does nothing on other operating systems.
+func hideCommandWindow(command *exec.Cmd) {
+}
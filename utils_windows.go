@@ -0,0 +1,100 @@
+// Hardentools
+// Copyright (C) 2017-2022 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+/*
+// some C code for managing elevated privileges
+#include <windows.h>
+#include <shellapi.h>
+
+// Checks if we are running with elevated privileges (admin rights).
+int IsElevated( ) {
+    boolean fRet = FALSE;
+    HANDLE hToken = NULL;
+    if( OpenProcessToken( GetCurrentProcess( ),TOKEN_QUERY,&hToken ) ) {
+        TOKEN_ELEVATION Elevation;
+        DWORD cbSize = sizeof( TOKEN_ELEVATION );
+        if( GetTokenInformation( hToken, TokenElevation, &Elevation, sizeof( Elevation ), &cbSize ) ) {
+            fRet = Elevation.TokenIsElevated;
+        }
+    }
+    if( hToken ) {
+        CloseHandle( hToken );
+    }
+    if( fRet ){
+		return 1;
+	}
+	else {
+		return 0;
+	}
+}
+
+// Executes the executable in the current directory (or in path) with "runas"
+// to aquire admin privileges.
+int ExecuteWithRunas(char execName[]){
+	SHELLEXECUTEINFO shExecInfo;
+
+	shExecInfo.cbSize = sizeof(SHELLEXECUTEINFO);
+
+	shExecInfo.fMask = 0x00008000;
+	shExecInfo.hwnd = NULL;
+	shExecInfo.lpVerb = "runas";
+	shExecInfo.lpFile = execName;
+	shExecInfo.lpParameters = NULL;
+	shExecInfo.lpDirectory = NULL;
+	shExecInfo.nShow = SW_NORMAL;
+	shExecInfo.hInstApp = NULL;
+
+	boolean success = ShellExecuteEx(&shExecInfo);
+	if (success)
+		return 1;
+	else
+		return 0;
+}
+*/
+import "C"
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// isElevated verifies if program is running with admin privileges
+func isElevated() bool {
+	isElevated := C.IsElevated()
+	if isElevated == 1 {
+		return true
+	}
+	return false
+}
+
+// startWithElevatedPrivs starts progName with elevated privileges
+func startWithElevatedPrivs(progName string) bool {
+	cprogname := C.CString(progName)
+	defer C.free(unsafe.Pointer(cprogname))
+	ret := C.ExecuteWithRunas(cprogname)
+	if ret == 1 {
+		return true
+	}
+	return false
+}
+
+// hideCommandWindow prevents command from opening a console window.
+func hideCommandWindow(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+}
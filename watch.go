@@ -0,0 +1,426 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// The watch mode keeps the system hardened: it watches all registry keys of
+// the settings recorded in the backup journal and re-applies the hardened
+// value whenever one of them is changed. The notifications come from a
+// registryChangeNotifier (RegNotifyChangeKeyValue on Windows, see
+// watch_windows.go), so the logic can be tested with synthetic events.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// registryChange is a change notification for a watched registry key.
+type registryChange struct {
+	RootKey RegistryRootKey
+	Path    string
+	Writer  string // Process that made the change, if known.
+}
+
+// registryChangeNotifier sends a registryChange whenever a watched key or
+// one of its subkeys is changed.
+type registryChangeNotifier interface {
+	// Watch starts watching path below rootKey. Keys that don't exist yet
+	// are watched, too.
+	Watch(rootKey RegistryRootKey, path string) error
+	// Changes returns the channel the notifications are sent to. It is
+	// closed when the notifier is closed.
+	Changes() <-chan registryChange
+	// Close stops watching all keys.
+	Close() error
+}
+
+// watchSettleDelay is the time to wait after a change before checking the
+// settings, so that a series of changes (e.g. by a restore) is handled once.
+var watchSettleDelay = 2 * time.Second
+
+// restoringValueName is the value of the hardentools key that is set while
+// restoring. The watch mode (e.g. the watch service) does not re-apply
+// settings while it is set, so it does not harden again what is being
+// restored. It contains the start time of the restore, the marker of an
+// interrupted restore is ignored after restoringTimeout.
+const restoringValueName = "Restoring"
+
+// restoringTimeout is the time after which a restoring marker is ignored.
+var restoringTimeout = 30 * time.Minute
+
+// watchExcludedSubjects contains the names of the harden subjects whose
+// settings should not be re-applied by the watch mode.
+var watchExcludedSubjects []string
+
+// watchedKey is a registry key watched for changes.
+type watchedKey struct {
+	rootKey RegistryRootKey
+	path    string
+}
+
+// String returns the full path of key.
+func (key watchedKey) String() string {
+	rootKeyName, _ := getRootKeyName(key.rootKey)
+	return rootKeyName + "\\" + key.path
+}
+
+// watchExcluded returns true if the settings of subject should not be
+// re-applied.
+func watchExcluded(subject string) bool {
+	return containsFold(watchExcludedSubjects, subject)
+}
+
+// watchedKeys returns the keys of all settings recorded in journal that are
+// not excluded, and the hardentools key itself (to notice changes of the
+// backup journal).
+func watchedKeys(journal *backupJournal) []watchedKey {
+	keys := []watchedKey{{HKCU, hardentoolsKeyPath}}
+	add := func(key watchedKey) {
+		if !containsWatchedKey(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, entry := range journal.Records {
+		if watchExcluded(entry.Subject) {
+			continue
+		}
+		rootKey, err := getRootKeyFromName(entry.Root)
+		if err != nil {
+			continue
+		}
+		add(watchedKey{rootKey, entry.Path})
+	}
+	for _, state := range journal.States {
+		if strings.HasPrefix(state.Feature, disallowRunFeaturePrefix) && !watchExcluded(state.Subject) {
+			add(watchedKey{HKCU, explorerDisallowRunKey})
+		}
+	}
+	return keys
+}
+
+// watchHardenedSettings re-applies changed hardened settings until stop is
+// closed or the notifier is closed. Settings that have been changed while
+// not watching are re-applied at the start.
+func watchHardenedSettings(notifier registryChangeNotifier, stop <-chan struct{}) error {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		return err
+	}
+	if len(journal.Records) == 0 && len(journal.States) == 0 {
+		return errors.New("nothing has been hardened")
+	}
+
+	var watched []watchedKey
+	watchNewKeys := func(journal *backupJournal) {
+		for _, key := range watchedKeys(journal) {
+			if containsWatchedKey(watched, key) {
+				continue
+			}
+			if err := notifier.Watch(key.rootKey, key.path); err != nil {
+				Info.Printf("Could not watch %s: %s", key, err.Error())
+				continue
+			}
+			Trace.Printf("Watching %s", key)
+			watched = append(watched, key)
+		}
+	}
+	watchNewKeys(journal)
+	Info.Printf("Watching %d registry keys for changes", len(watched))
+	if !waitWhileRestoring(stop) {
+		return nil
+	}
+	healHardenedSettings(nil)
+
+	for {
+		var changes []registryChange
+		select {
+		case <-stop:
+			return nil
+		case change, ok := <-notifier.Changes():
+			if !ok {
+				return nil
+			}
+			changes = append(changes, change)
+		}
+
+		// Collect further changes until things have settled.
+		closed := false
+		settled := time.After(watchSettleDelay)
+	collect:
+		for {
+			select {
+			case <-stop:
+				return nil
+			case change, ok := <-notifier.Changes():
+				if !ok {
+					closed = true
+					break collect
+				}
+				changes = append(changes, change)
+			case <-settled:
+				break collect
+			}
+		}
+
+		// Settings that are being restored are removed from the backup
+		// journal when the restore has finished.
+		if !waitWhileRestoring(stop) {
+			return nil
+		}
+		healHardenedSettings(changes)
+		if journal, err := loadBackupJournal(); err == nil {
+			// Subjects might have been hardened in the meantime.
+			watchNewKeys(journal)
+		}
+		if closed {
+			return nil
+		}
+	}
+}
+
+// markRestoring sets the restoring marker if restoring is true, or removes
+// it otherwise.
+func markRestoring(restoring bool) {
+	if restoring {
+		key, _, err := registryBackend.CreateKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+		if err == nil {
+			err = key.SetStringValue(restoringValueName, time.Now().UTC().Format(time.RFC3339))
+			key.Close()
+		}
+		if err != nil {
+			Info.Println("Could not pause the watch mode while restoring: " + err.Error())
+		}
+		return
+	}
+
+	key, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	if err == nil {
+		err = key.DeleteValue(restoringValueName)
+		key.Close()
+	}
+	if err != nil && err != errRegistryNotExist {
+		Info.Println("Could not resume the watch mode after restoring: " + err.Error())
+	}
+}
+
+// isRestoring returns true if the restoring marker is set and has not timed
+// out.
+func isRestoring() bool {
+	key, err := registryBackend.OpenKey(HKCU, hardentoolsKeyPath, keyQueryValue)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+
+	started, _, err := key.GetStringValue(restoringValueName)
+	if err != nil {
+		return false
+	}
+	startTime, err := time.Parse(time.RFC3339, started)
+	return err == nil && time.Since(startTime) < restoringTimeout
+}
+
+// waitWhileRestoring waits until no restore is in progress. It returns false
+// if stop is closed in the meantime.
+func waitWhileRestoring(stop <-chan struct{}) bool {
+	if isRestoring() {
+		Info.Println("Restore in progress, waiting before re-applying settings")
+	}
+	for isRestoring() {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(watchSettleDelay):
+		}
+	}
+	return true
+}
+
+// containsWatchedKey returns true if keys contains key.
+func containsWatchedKey(keys []watchedKey, key watchedKey) bool {
+	for _, existing := range keys {
+		if existing.rootKey == key.rootKey && strings.EqualFold(existing.path, key.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// healHardenedSettings re-applies all hardened settings of the backup journal
+// that have been changed and logs them. changes are the notifications that
+// triggered the check; they are used to find out who made a change. The
+// backup journal is read again every time, so restored subjects are not
+// hardened again. Returns the number of re-applied settings.
+func healHardenedSettings(changes []registryChange) int {
+	journal, err := loadBackupJournal()
+	if err != nil {
+		Info.Println("Could not read backup journal: " + err.Error())
+		return 0
+	}
+
+	healed := 0
+	for _, entry := range journal.Records {
+		if watchExcluded(entry.Subject) {
+			continue
+		}
+		current, drifted, err := entry.checkDrift()
+		if err != nil || !drifted {
+			continue
+		}
+		Info.Printf("%s: %s has been changed to %s by %s, re-applying %s",
+			entry.Subject, entry, current, changeWriter(changes, entry.Root, entry.Path), entry.expected())
+		if err := entry.reapply(); err != nil {
+			Info.Printf("Could not re-apply %s: %s", entry, err.Error())
+			continue
+		}
+		healed++
+	}
+
+	missing, err := missingDisallowRunEntries(journal)
+	if err != nil {
+		Info.Println(err.Error())
+	}
+	for _, state := range missing {
+		if watchExcluded(state.Subject) {
+			continue
+		}
+		Info.Printf("%s: %s has been removed by %s, adding it again", state.Subject,
+			disallowRunEntryName(state), changeWriter(changes, "CURRENT_USER", explorerDisallowRunKey))
+		journalSubject = state.Subject
+		err := addDisallowRunEntries([]string{disallowRunStateExecutable(state)})
+		journalSubject = ""
+		if err != nil {
+			Info.Printf("Could not add %s again: %s", disallowRunStateExecutable(state), err.Error())
+			continue
+		}
+		healed++
+	}
+	return healed
+}
+
+// changeWriter returns the writer of the change of path below the root key
+// named rootKeyName, or "an unknown process".
+func changeWriter(changes []registryChange, rootKeyName, path string) string {
+	for _, change := range changes {
+		changeRootName, _ := getRootKeyName(change.RootKey)
+		if change.Writer != "" && changeRootName == rootKeyName &&
+			(strings.EqualFold(change.Path, path) || hasPathPrefixFold(path, change.Path)) {
+			return change.Writer
+		}
+	}
+	return "an unknown process"
+}
+
+// hasPathPrefixFold returns true if path is below the key prefix.
+func hasPathPrefixFold(path, prefix string) bool {
+	return len(path) > len(prefix) && path[len(prefix)] == '\\' && strings.EqualFold(path[:len(prefix)], prefix)
+}
+
+// reapply writes the hardened value of entry again, or deletes its key again.
+func (entry *journalEntry) reapply() error {
+	rootKey, err := getRootKeyFromName(entry.Root)
+	if err != nil {
+		return err
+	}
+
+	if entry.Key != nil {
+		err := deleteRegistryKeyTree(rootKey, entry.Path)
+		if err == errRegistryNotExist {
+			return nil
+		}
+		return err
+	}
+
+	if entry.Hardened == nil {
+		key, err := registryBackend.OpenKey(rootKey, entry.Path, keyAllAccess)
+		if err == errRegistryNotExist {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer key.Close()
+		err = key.DeleteValue(entry.Name)
+		if err == errRegistryNotExist {
+			return nil
+		}
+		return err
+	}
+
+	key, _, err := registryBackend.CreateKey(rootKey, entry.Path, keyAllAccess)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return writeRegistryValue(key, entry.Name, entry.Hardened)
+}
+
+// cmdWatch re-applies changed hardened settings until it is interrupted, or
+// until the service is stopped if running as the watch service.
+func cmdWatch() {
+	if offlineHives != nil {
+		fmt.Println("-watch can't be combined with -offline-hive.")
+		os.Exit(-1)
+	}
+	notifier, err := newRegistryChangeNotifier()
+	if err != nil {
+		fmt.Println("Watching failed: " + err.Error())
+		os.Exit(-1)
+	}
+
+	if runningAsService() {
+		err = runWatchService(notifier)
+	} else {
+		stop := make(chan struct{})
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		fmt.Println("Watching hardened settings, press Ctrl+C to stop.")
+		err = watchHardenedSettings(notifier, stop)
+	}
+	notifier.Close()
+	if err != nil {
+		fmt.Println("Watching failed: " + err.Error())
+		os.Exit(-1)
+	}
+	os.Exit(0)
+}
+
+// cmdWatchService installs the watch service if install is true, or
+// uninstalls it otherwise.
+func cmdWatchService(install bool) {
+	if install {
+		if err := installWatchService(); err != nil {
+			fmt.Println("Could not install watch service: " + err.Error())
+			os.Exit(-1)
+		}
+		fmt.Println("Watch service " + watchServiceName + " has been installed and started.")
+	} else {
+		if err := uninstallWatchService(); err != nil {
+			fmt.Println("Could not uninstall watch service: " + err.Error())
+			os.Exit(-1)
+		}
+		fmt.Println("Watch service " + watchServiceName + " has been uninstalled.")
+	}
+	os.Exit(0)
+}
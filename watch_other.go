@@ -0,0 +1,51 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !windows
+
+package main
+
+import "errors"
+
+// watchServiceName is the name of the Windows service running -watch.
+const watchServiceName = "HardentoolsWatch"
+
+var errWatchNotSupported = errors.New("watching the registry is only supported on Windows")
+
+// newRegistryChangeNotifier is not supported on other operating systems.
+func newRegistryChangeNotifier() (registryChangeNotifier, error) {
+	return nil, errWatchNotSupported
+}
+
+// runningAsService always returns false on other operating systems.
+func runningAsService() bool {
+	return false
+}
+
+// runWatchService is not supported on other operating systems.
+func runWatchService(notifier registryChangeNotifier) error {
+	return errWatchNotSupported
+}
+
+// installWatchService is not supported on other operating systems.
+func installWatchService() error {
+	return errWatchNotSupported
+}
+
+// uninstallWatchService is not supported on other operating systems.
+func uninstallWatchService() error {
+	return errWatchNotSupported
+}
@@ -0,0 +1,193 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChangeNotifier is a registryChangeNotifier for synthetic events.
+type fakeChangeNotifier struct {
+	watched []watchedKey
+	changes chan registryChange
+}
+
+func (notifier *fakeChangeNotifier) Watch(rootKey RegistryRootKey, path string) error {
+	notifier.watched = append(notifier.watched, watchedKey{rootKey, path})
+	return nil
+}
+
+func (notifier *fakeChangeNotifier) Changes() <-chan registryChange {
+	return notifier.changes
+}
+
+func (notifier *fakeChangeNotifier) Close() error {
+	return nil
+}
+
+// watchForTest runs watchHardenedSettings for the given events and returns
+// its log output.
+func watchForTest(t *testing.T, notifier *fakeChangeNotifier, events ...registryChange) string {
+	t.Helper()
+	var logOutput bytes.Buffer
+	oldInfo := Info
+	Info = log.New(&logOutput, "", 0)
+	defer func() { Info = oldInfo }()
+
+	notifier.changes = make(chan registryChange)
+	done := make(chan error)
+	go func() {
+		done <- watchHardenedSettings(notifier, nil)
+	}()
+	for _, event := range events {
+		notifier.changes <- event
+	}
+	close(notifier.changes)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return logOutput.String()
+}
+
+func TestWatchReappliesChangedSettings(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	oldDelay := watchSettleDelay
+	watchSettleDelay = 0
+	defer func() { watchSettleDelay = oldDelay }()
+
+	for _, subject := range []HardenInterface{WSH, ShowFileExt, Cmd} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+	}
+
+	// Changed while not watching.
+	key, _ := reg.OpenKey(HKCU, explorerDisallowRunKey, keyAllAccess)
+	key.DeleteValue("1")
+	key.Close()
+	notifier := &fakeChangeNotifier{}
+	output := watchForTest(t, notifier, registryChange{RootKey: HKCU, Path: hardentoolsKeyPath})
+	if !strings.Contains(output, "entry cmd.exe has been removed by an unknown process, adding it again") {
+		t.Errorf("log output:\n%s", output)
+	}
+	if !Cmd.IsHardened() {
+		t.Errorf("%s is not hardened after watching", Cmd.Name())
+	}
+	if len(notifier.watched) != 5 ||
+		!containsWatchedKey(notifier.watched, watchedKey{HKCU, explorerDisallowRunKey}) ||
+		!containsWatchedKey(notifier.watched, watchedKey{HKCU, hardentoolsKeyPath}) {
+		t.Errorf("watched keys = %v", notifier.watched)
+	}
+}
+
+func TestWatchWaitsWhileRestoring(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	oldDelay := watchSettleDelay
+	watchSettleDelay = time.Millisecond
+	defer func() { watchSettleDelay = oldDelay }()
+	for _, subject := range []HardenInterface{WSH, ShowFileExt} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+	}
+
+	// The restore has written the original value, but has not removed it
+	// from the backup journal yet.
+	markRestoring(true)
+	key, _ := reg.OpenKey(HKCU, "SOFTWARE\\Microsoft\\Windows Script Host\\Settings", keyAllAccess)
+	key.SetDWordValue("Enabled", 1)
+	key.Close()
+
+	notifier := &fakeChangeNotifier{changes: make(chan registryChange)}
+	done := make(chan error)
+	go func() {
+		done <- watchHardenedSettings(notifier, nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if WSH.IsHardened() {
+		t.Errorf("%s has been hardened again while restoring", WSH.Name())
+	}
+
+	if err := restoreSubjectBackup(WSH.Name()); err != nil {
+		t.Fatal(err)
+	}
+	markRestoring(false)
+	close(notifier.changes)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if WSH.IsHardened() || !ShowFileExt.IsHardened() {
+		t.Errorf("after restoring %s: %s, %s", WSH.Name(), getHardenStatus(WSH), getHardenStatus(ShowFileExt))
+	}
+
+	// The marker of an interrupted restore is ignored after a while.
+	key, _ = reg.OpenKey(HKCU, hardentoolsKeyPath, keyAllAccess)
+	key.SetStringValue(restoringValueName, time.Now().Add(-restoringTimeout).Format(time.RFC3339))
+	key.Close()
+	if isRestoring() {
+		t.Error("timed out restoring marker is honoured")
+	}
+}
+
+func TestHealHardenedSettings(t *testing.T) {
+	reg := useMemoryRegistry(t)
+	for _, subject := range []HardenInterface{WSH, ShowFileExt} {
+		if err := hardenOrRestoreSubject(subject, true); err != nil {
+			t.Fatalf("hardening %s failed: %s", subject.Name(), err)
+		}
+	}
+	var logOutput bytes.Buffer
+	oldInfo := Info
+	Info = log.New(&logOutput, "", 0)
+	defer func() { Info = oldInfo }()
+	watchExcludedSubjects = []string{ShowFileExt.Name()}
+	defer func() { watchExcludedSubjects = nil }()
+
+	key, _ := reg.OpenKey(HKCU, "SOFTWARE\\Microsoft\\Windows Script Host\\Settings", keyAllAccess)
+	key.SetDWordValue("Enabled", 1)
+	key.Close()
+	key, _ = reg.OpenKey(HKCU, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Advanced", keyAllAccess)
+	key.SetDWordValue("HideFileExt", 1)
+	key.Close()
+
+	changes := []registryChange{{HKCU, "SOFTWARE\\Microsoft\\Windows Script Host", "evil.exe"}}
+	if healed := healHardenedSettings(changes); healed != 1 {
+		t.Errorf("%d settings re-applied", healed)
+	}
+	expected := "WSH: CURRENT_USER\\SOFTWARE\\Microsoft\\Windows Script Host\\Settings\\Enabled has been changed " +
+		"to REG_DWORD 1 by evil.exe, re-applying REG_DWORD 0\n"
+	if logOutput.String() != expected {
+		t.Errorf("log output:\n%s", logOutput.String())
+	}
+	// The excluded subject stays changed.
+	if report, _ := auditBackupJournal(); len(report.Drifts) != 1 || report.Drifts[0].Subject != ShowFileExt.Name() {
+		t.Errorf("drifts after healing = %v", report.Drifts)
+	}
+
+	// Restored subjects are not hardened again.
+	watchExcludedSubjects = nil
+	if err := restoreSubject(ShowFileExt); err != nil {
+		t.Fatal(err)
+	}
+	if healed := healHardenedSettings(nil); healed != 0 {
+		t.Errorf("%d settings re-applied after restore", healed)
+	}
+}
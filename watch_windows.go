@@ -0,0 +1,257 @@
+// Hardentools
+// Copyright (C) 2017-2025 Security Without Borders
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// watchServiceName is the name of the Windows service running -watch.
+const watchServiceName = "HardentoolsWatch"
+
+// windowsChangeNotifier is the registryChangeNotifier for the Windows
+// registry. Every key is watched by a goroutine using
+// RegNotifyChangeKeyValue. The writer of a change is not known.
+type windowsChangeNotifier struct {
+	changes chan registryChange
+	done    chan struct{}
+	stop    windows.Handle // Event signaled by Close.
+	wg      sync.WaitGroup
+}
+
+// newRegistryChangeNotifier returns a notifier for the Windows registry.
+func newRegistryChangeNotifier() (registryChangeNotifier, error) {
+	stop, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &windowsChangeNotifier{
+		changes: make(chan registryChange, 16),
+		done:    make(chan struct{}),
+		stop:    stop,
+	}, nil
+}
+
+// Watch starts watching path below rootKey and its subkeys.
+func (notifier *windowsChangeNotifier) Watch(rootKey RegistryRootKey, path string) error {
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	notifier.wg.Add(1)
+	go notifier.watch(rootKey, path, event)
+	return nil
+}
+
+// watch sends a registryChange for every change of path below rootKey until
+// the notifier is closed. The key is opened again after every change, so a
+// key that does not exist (yet) is watched through its nearest existing
+// parent.
+func (notifier *windowsChangeNotifier) watch(rootKey RegistryRootKey, path string, event windows.Handle) {
+	defer notifier.wg.Done()
+	defer windows.CloseHandle(event)
+
+	for {
+		key, err := openNearestKey(rootKey, path)
+		if err != nil {
+			Info.Printf("Could not watch %s: %s", watchedKey{rootKey, path}, err.Error())
+			return
+		}
+		err = windows.RegNotifyChangeKeyValue(windows.Handle(key), true,
+			windows.REG_NOTIFY_CHANGE_NAME|windows.REG_NOTIFY_CHANGE_LAST_SET, event, true)
+		if err != nil {
+			key.Close()
+			Info.Printf("Could not watch %s: %s", watchedKey{rootKey, path}, err.Error())
+			return
+		}
+		result, err := windows.WaitForMultipleObjects([]windows.Handle{event, notifier.stop}, false, windows.INFINITE)
+		key.Close()
+		if err != nil || result != windows.WAIT_OBJECT_0 {
+			return
+		}
+
+		select {
+		case notifier.changes <- registryChange{RootKey: rootKey, Path: path}:
+		case <-notifier.done:
+			return
+		}
+	}
+}
+
+// openNearestKey opens path below rootKey for change notifications, or its
+// nearest existing parent if it does not exist.
+func openNearestKey(rootKey RegistryRootKey, path string) (registry.Key, error) {
+	root, path := windowsRootKey(rootKey, path)
+	for path != "" {
+		key, err := registry.OpenKey(root, path, registry.NOTIFY)
+		if err != registry.ErrNotExist && err != windows.ERROR_PATH_NOT_FOUND {
+			return key, err
+		}
+		if i := strings.LastIndex(path, "\\"); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	return root, nil
+}
+
+// Changes returns the channel the notifications are sent to.
+func (notifier *windowsChangeNotifier) Changes() <-chan registryChange {
+	return notifier.changes
+}
+
+// Close stops watching all keys and closes the changes channel.
+func (notifier *windowsChangeNotifier) Close() error {
+	windows.SetEvent(notifier.stop)
+	close(notifier.done)
+	notifier.wg.Wait()
+	close(notifier.changes)
+	return windows.CloseHandle(notifier.stop)
+}
+
+// runningAsService returns true if hardentools has been started by the
+// service control manager.
+func runningAsService() bool {
+	isService, err := svc.IsWindowsService()
+	return err == nil && isService
+}
+
+// watchService runs watchHardenedSettings as a Windows service.
+type watchService struct {
+	notifier registryChangeNotifier
+}
+
+// Execute runs the service until it is stopped.
+func (service *watchService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- watchHardenedSettings(service.notifier, stop)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				Info.Println("Watching failed: " + err.Error())
+				return false, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// runWatchService runs the watch mode as Windows service. Since the service
+// has no console, the log is written to watch.log in watchLogDir.
+func runWatchService(notifier registryChangeNotifier) error {
+	if dir, err := watchLogDir(); err == nil {
+		initLogging(logOptions{
+			Level:    slog.LevelInfo,
+			JSON:     strings.EqualFold(logFormat, "json"),
+			Dir:      dir,
+			FileName: "watch.log",
+		})
+	}
+	return svc.Run(watchServiceName, &watchService{notifier})
+}
+
+// watchLogDir returns the directory of the log file of the watch service.
+func watchLogDir() (string, error) {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		return "", fmt.Errorf("ProgramData is not set")
+	}
+	return filepath.Join(programData, "Hardentools"), nil
+}
+
+// installWatchService installs and starts a service that runs -watch for the
+// current user (and with the current -watch-exclude list).
+func installWatchService() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	tokenUser, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return err
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+	if service, err := manager.OpenService(watchServiceName); err == nil {
+		service.Close()
+		return fmt.Errorf("service %s is already installed", watchServiceName)
+	}
+
+	args := []string{"-watch", "-watch-user", tokenUser.User.Sid.String()}
+	if len(watchExcludedSubjects) > 0 {
+		args = append(args, "-watch-exclude", strings.Join(watchExcludedSubjects, ","))
+	}
+	service, err := manager.CreateService(watchServiceName, executable, mgr.Config{
+		DisplayName: "Hardentools Watch",
+		Description: "Re-applies hardened settings when they are changed.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	return service.Start()
+}
+
+// uninstallWatchService stops and removes the watch service.
+func uninstallWatchService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	service, err := manager.OpenService(watchServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", watchServiceName)
+	}
+	defer service.Close()
+	service.Control(svc.Stop)
+	return service.Delete()
+}
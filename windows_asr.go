@@ -32,8 +32,6 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-
-	"golang.org/x/sys/windows/registry"
 )
 
 var ruleIDArray = []string{
@@ -137,29 +135,12 @@ func (asr WindowsASRStruct) IsHardened() bool {
 		return false
 	}
 
-	psString := fmt.Sprintf("$prefs = Get-MpPreference; $prefs.AttackSurfaceReductionRules_Ids")
-	ruleIDsOut, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psString)
+	currentRuleIDs, currentRuleActions, err := getASRRules()
 	if err != nil {
-		Info.Printf("ERROR: WindowsASR: Verify if Windows Defender is running. Executing Powershell.exe with command \"%s\" failed.", psString)
-		Info.Printf("ERROR: WindowsASR: Powershell Output was: %s", ruleIDsOut)
 		// In case command does not work we assume we are not hardened.
 		return false
 	}
 
-	psString = fmt.Sprintf("$prefs = Get-MpPreference; $prefs.AttackSurfaceReductionRules_Actions")
-	ruleActionsOut, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psString)
-	if err != nil {
-		Info.Printf("ERROR: WindowsASR: Verify if Windows Defender is running. Executing Powershell.exe with command \"%s\" failed.", psString)
-		Info.Printf("ERROR: WindowsASR: Powershell Output was: %s", ruleActionsOut)
-		// In case command does not work we assume we are not hardened.
-		return false
-	}
-
-	// Verify if all relevant ruleIDs are there.
-	// Split/remove line feeds and carriage return.
-	currentRuleIDs := strings.Split(ruleIDsOut, "\r\n")
-	currentRuleActions := strings.Split(ruleActionsOut, "\r\n")
-
 	for i, ruleIDdebug := range currentRuleIDs {
 		if len(ruleIDdebug) > 0 {
 			Trace.Printf("ruleID %d = %s with action = %s\n", i, ruleIDdebug, currentRuleActions[i])
@@ -192,6 +173,118 @@ func (asr WindowsASRStruct) IsHardened() bool {
 	return true
 }
 
+// Status returns the status of every ASR rule.
+func (asr WindowsASRStruct) Status() HardenStatus {
+	if !checkWindowsVersion() {
+		return HardenStatus{State: StateNotApplicable, Reason: "needs at least Windows 10 - 1709"}
+	}
+
+	currentRuleIDs, currentRuleActions, err := getASRRules()
+	if err != nil {
+		return HardenStatus{State: StateUnknown, Reason: "PowerShell failed, verify if Windows Defender is running"}
+	}
+
+	var children []HardenStatus
+	for _, ruleID := range ruleIDArray {
+		child := HardenStatus{Name: ruleID, State: StateNotHardened, Reason: "not configured"}
+		for j, currentRuleID := range currentRuleIDs {
+			if strings.EqualFold(ruleID, currentRuleID) {
+				child.Reason = asrActionName(currentRuleActions[j])
+				if currentRuleActions[j] == "1" {
+					child.State, child.Reason = StateHardened, ""
+				}
+			}
+		}
+		children = append(children, child)
+	}
+	return combineHardenStatus(asr.shortName, children)
+}
+
+// Plan returns the ASR rule changes Harden would make.
+func (asr WindowsASRStruct) Plan(harden bool) ([]plannedOperation, error) {
+	if !checkWindowsVersion() {
+		// Harden does nothing on older Windows versions.
+		return nil, nil
+	}
+
+	currentRuleIDs, currentRuleActions, err := getASRRules()
+	if err != nil {
+		return nil, errors.New("could not get ASR rules, verify if Windows Defender is running")
+	}
+
+	var operations []plannedOperation
+	for i, ruleID := range ruleIDArray {
+		current := "not configured"
+		for j, currentRuleID := range currentRuleIDs {
+			if strings.EqualFold(ruleID, currentRuleID) {
+				current = asrActionName(currentRuleActions[j])
+			}
+		}
+
+		enabled := actionsArrayNotHardended[i]
+		if harden {
+			enabled = actionsArrayHardended[i]
+		}
+		newAction := "Disabled"
+		if enabled {
+			newAction = "Enabled"
+		}
+		operations = append(operations, plannedOperation{
+			Action:  "ASR rule",
+			Target:  ruleID,
+			Current: current,
+			New:     newAction,
+		})
+	}
+	return operations, nil
+}
+
+// getASRRules returns the IDs and actions of all configured ASR rules.
+func getASRRules() (ruleIDs, ruleActions []string, err error) {
+	psString := fmt.Sprintf("$prefs = Get-MpPreference; $prefs.AttackSurfaceReductionRules_Ids")
+	ruleIDsOut, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psString)
+	if err != nil {
+		Info.Printf("ERROR: WindowsASR: Verify if Windows Defender is running. Executing Powershell.exe with command \"%s\" failed.", psString)
+		Info.Printf("ERROR: WindowsASR: Powershell Output was: %s", ruleIDsOut)
+		return nil, nil, err
+	}
+
+	psString = fmt.Sprintf("$prefs = Get-MpPreference; $prefs.AttackSurfaceReductionRules_Actions")
+	ruleActionsOut, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psString)
+	if err != nil {
+		Info.Printf("ERROR: WindowsASR: Verify if Windows Defender is running. Executing Powershell.exe with command \"%s\" failed.", psString)
+		Info.Printf("ERROR: WindowsASR: Powershell Output was: %s", ruleActionsOut)
+		return nil, nil, err
+	}
+
+	// Split/remove line feeds and carriage return.
+	ruleIDs = strings.Split(ruleIDsOut, "\r\n")
+	ruleActions = strings.Split(ruleActionsOut, "\r\n")
+
+	if len(ruleIDs) != len(ruleActions) {
+		Info.Printf("ERROR: WindowsASR: Got %d rule IDs but %d rule actions",
+			len(ruleIDs), len(ruleActions))
+		return nil, nil, errors.New("number of ASR rule IDs and actions differs")
+	}
+	return ruleIDs, ruleActions, nil
+}
+
+// asrActionName returns the name of an ASR rule action as returned by
+// Get-MpPreference.
+func asrActionName(action string) string {
+	switch action {
+	case "0":
+		return "Disabled"
+	case "1":
+		return "Enabled"
+	case "2":
+		return "Audit"
+	case "6":
+		return "Warn"
+	}
+	return "unknown action " + action
+}
+
 // AddMPPreference sets a ASR rule using Add-MpPreference.
 func AddMPPreference(ruleID string, enabled bool) error {
 	// Example: Add-MpPreference -AttackSurfaceReductionRules_Ids
@@ -238,9 +331,9 @@ func (asr WindowsASRStruct) HardenByDefault() bool {
 // checkWindowsVersion checks if hardentools is running on Windows 10 with
 // Patch Level >= 1709.
 func checkWindowsVersion() bool {
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE,
+	k, err := registryBackend.OpenKey(HKLM,
 		"SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion",
-		registry.QUERY_VALUE)
+		keyQueryValue)
 	if err != nil {
 		return false
 	}
@@ -18,7 +18,7 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -29,7 +29,10 @@ import (
 
 // IsHardened checks if ASR is already hardened
 func TestIsHardened(t *testing.T) {
-	initLogging(ioutil.Discard, ioutil.Discard, false)
+	if runtime.GOOS != "windows" {
+		t.Skip("needs Windows Defender")
+	}
+	initLogging(logOptions{Off: true})
 
 	if !checkWindowsVersion() {
 		t.Error("Invalid Windows Version")
@@ -65,6 +68,82 @@ func TestIsHardened(t *testing.T) {
 	debugOutput(t)
 }
 
+// setWindowsVersion sets the Windows version checked by
+// checkWindowsVersion.
+func setWindowsVersion(t *testing.T, reg *memoryRegistry, build string) {
+	t.Helper()
+	key, _, err := reg.CreateKey(HKLM, "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion", keyAllAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	key.SetDWordValue("CurrentMajorVersionNumber", 10)
+	key.SetDWordValue("CurrentMinorVersionNumber", 0)
+	key.SetStringValue("CurrentBuild", build)
+}
+
+func TestWindowsASRIsHardenedTranscripts(t *testing.T) {
+	tests := []struct {
+		transcript string
+		hardened   bool
+	}{
+		{"asr_is_hardened.json", true},
+		{"asr_audit_mode.json", false},
+		{"asr_rule_missing.json", false},
+		{"asr_truncated_actions.json", false},
+		{"asr_defender_not_running.json", false},
+		{"asr_timeout.json", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.transcript, func(t *testing.T) {
+			setWindowsVersion(t, useMemoryRegistry(t), "19045")
+			useCommandTranscript(t, test.transcript)
+
+			if hardened := WindowsASR.IsHardened(); hardened != test.hardened {
+				t.Errorf("IsHardened() = %v, expected %v", hardened, test.hardened)
+			}
+		})
+	}
+}
+
+func TestWindowsASROldWindowsVersion(t *testing.T) {
+	setWindowsVersion(t, useMemoryRegistry(t), "14393")
+	// No commands must be executed.
+	useCommandTranscript(t, "empty.json")
+
+	if WindowsASR.IsHardened() {
+		t.Error("IsHardened() = true on Windows 10 1607")
+	}
+	if err := WindowsASR.Harden(true); err != nil {
+		t.Errorf("Harden(true) = %s", err)
+	}
+}
+
+func TestWindowsASRHarden(t *testing.T) {
+	tests := []struct {
+		transcript string
+		harden     bool
+		fails      bool
+	}{
+		{"asr_harden.json", true, false},
+		{"asr_harden_fails.json", true, true},
+		{"asr_restore.json", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.transcript, func(t *testing.T) {
+			setWindowsVersion(t, useMemoryRegistry(t), "19045")
+			useCommandTranscript(t, test.transcript)
+
+			err := WindowsASR.Harden(test.harden)
+			if (err != nil) != test.fails {
+				t.Errorf("Harden(%v) = %v", test.harden, err)
+			}
+		})
+	}
+}
+
 func debugOutput(t *testing.T) {
 	psString := fmt.Sprintf("$prefs = Get-MpPreference; $prefs.AttackSurfaceReductionRules_Ids")
 	ruleIDsOut, err := executeCommand("PowerShell.exe", "-noprofile", "-Command", psString)